@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuditFilter narrows down the audit records that are listed.
+// Zero-valued fields match every record.
+type AuditFilter struct {
+	User    string
+	EntryID string
+
+	// Action matches the records of the action and of its
+	// sub-actions, e.g. "status" matches "status.read".
+	Action string
+
+	// After and Before bound the time of records.
+	After  time.Time
+	Before time.Time
+}
+
+// query encodes the filter as query parameters.
+func (f AuditFilter) query() url.Values {
+	q := url.Values{}
+	if f.User != "" {
+		q.Set("user", f.User)
+	}
+	if f.EntryID != "" {
+		q.Set("entry_id", f.EntryID)
+	}
+	if f.Action != "" {
+		q.Set("action", f.Action)
+	}
+	if !f.After.IsZero() {
+		q.Set("after", f.After.Format(time.RFC3339))
+	}
+	if !f.Before.IsZero() {
+		q.Set("before", f.Before.Format(time.RFC3339))
+	}
+	return q
+}
+
+// AuditPage is a page of audit records, most recent first.
+type AuditPage struct {
+	Page        int64              `json:"page"`
+	PageCount   int64              `json:"page_count"`
+	RecordCount int64              `json:"record_count"`
+	Records     []data.AuditRecord `json:"records"`
+}
+
+// Audit fetches a page of audit records matching the filter. It
+// requires the admin scope.
+func (c *Client) Audit(ctx context.Context, filter AuditFilter, page int64) (AuditPage, error) {
+	q := filter.query()
+	q.Set("page", strconv.FormatInt(page, 10))
+	var p AuditPage
+	err := c.do(ctx, request{method: "GET", path: "/audit", query: q}, &p)
+	return p, err
+}
+
+// IterAudit iterates over every audit record matching the filter, most
+// recent first.
+func (c *Client) IterAudit(ctx context.Context, filter AuditFilter) *Iterator[data.AuditRecord] {
+	return newIterator(ctx, func(ctx context.Context, page int64) ([]data.AuditRecord, bool, error) {
+		p, err := c.Audit(ctx, filter, page)
+		return p.Records, page < p.PageCount, err
+	})
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Selection selects the entries of a bulk action, either by ID or by
+// filter. Filters may match at most 1000 entries.
+type Selection struct {
+	IDs    []string     `json:"ids,omitempty"`
+	Filter *EntryFilter `json:"filter,omitempty"`
+}
+
+// BulkItem reports the outcome of a bulk action on an entry.
+type BulkItem struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkResult reports the outcome of a bulk action on every selected
+// entry. Entries are processed independently, so some may fail while
+// others succeed.
+type BulkResult struct {
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	Results   []BulkItem `json:"results"`
+}
+
+// Err describes the entries that the action failed on, or returns nil
+// if it succeeded on every entry.
+func (r BulkResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	errs := []error{fmt.Errorf("%d of %d entries failed", r.Failed,
+		r.Failed+r.Succeeded)}
+	for _, item := range r.Results {
+		if !item.OK {
+			errs = append(errs, fmt.Errorf("%s: %s", item.ID, item.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bulk sends a bulk action to the given path. Fields are added to the
+// selection in the request body.
+func (c *Client) bulk(ctx context.Context, path string, sel Selection, fields map[string]any) (BulkResult, error) {
+	body := map[string]any{}
+	if len(sel.IDs) > 0 {
+		body["ids"] = sel.IDs
+	}
+	if sel.Filter != nil {
+		body["filter"] = sel.Filter
+	}
+	for k, v := range fields {
+		body[k] = v
+	}
+	var r BulkResult
+	err := c.do(ctx, request{method: "POST", path: "/entries/bulk/" + path, body: body}, &r)
+	return r, err
+}
+
+// BulkDelete deletes the selected entries.
+func (c *Client) BulkDelete(ctx context.Context, sel Selection) (BulkResult, error) {
+	return c.bulk(ctx, "delete", sel, nil)
+}
+
+// BulkSetStatus marks the selected entries as read or unread.
+func (c *Client) BulkSetStatus(ctx context.Context, sel Selection, status string) (BulkResult, error) {
+	return c.bulk(ctx, "status", sel, map[string]any{"status": status})
+}
+
+// BulkTag adds and removes tags of the selected entries.
+func (c *Client) BulkTag(ctx context.Context, sel Selection, add, remove []string) (BulkResult, error) {
+	return c.bulk(ctx, "tags", sel, map[string]any{"add": add, "remove": remove})
+}
+
+// BulkMove moves the selected entries to another mailbox.
+func (c *Client) BulkMove(ctx context.Context, sel Selection, mailbox string) (BulkResult, error) {
+	return c.bulk(ctx, "move", sel, map[string]any{"mailbox": mailbox})
+}
@@ -0,0 +1,255 @@
+// Package client implements a Go client for the Mailbox API.
+//
+//	c, err := client.New("https://example.com", client.WithToken("mbx_..."))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	it := c.IterEntries(ctx, client.EntryFilter{Mailbox: "sales"})
+//	for it.Next() {
+//		fmt.Println(it.Value().Subject)
+//	}
+//	if err := it.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Prefix is the path prefix of the API version spoken by the client.
+const Prefix = "/api/v1"
+
+const (
+	// DefaultTimeout is the default time limit of a request,
+	// including reading the response. Event streams are exempt.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultRetries is the default number of times that failed
+	// requests are retried.
+	DefaultRetries = 2
+
+	// retryBackoff is the delay before the first retry, doubling with
+	// every attempt.
+	retryBackoff = 500 * time.Millisecond
+)
+
+// Client sends requests to a Mailbox server. It is safe for concurrent
+// use.
+type Client struct {
+	endpoint string
+	http     *http.Client
+	auth     string
+	retries  int
+}
+
+// Option is used to configure a Client in New. For example:
+//
+//	c, err := client.New(endpoint, client.WithTimeout(time.Minute))
+type Option func(*Client)
+
+// New creates a client of the server at endpoint, the URL that the
+// server's routes are served under, e.g. "https://example.com".
+func New(endpoint string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("invalid endpoint: scheme must be http or https")
+	}
+	c := &Client{
+		endpoint: strings.TrimSuffix(u.String(), "/"),
+		http:     &http.Client{Timeout: DefaultTimeout},
+		retries:  DefaultRetries,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// WithToken authenticates requests with an API or session token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.auth = "Bearer " + token
+	}
+}
+
+// WithBasicAuth authenticates requests with a username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.auth = "Basic " + base64.StdEncoding.EncodeToString(
+			[]byte(username+":"+password))
+	}
+}
+
+// WithHTTPClient sets the HTTP client that sends requests.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithTimeout sets the time limit of requests. Zero means no limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		timed := *c.http
+		timed.Timeout = d
+		c.http = &timed
+	}
+}
+
+// WithRetries sets the number of times that failed requests are
+// retried. Requests are only retried if they failed to reach the
+// server, or if the server was temporarily unable to handle them and
+// they may safely be repeated.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.retries = n
+	}
+}
+
+// Endpoint returns the URL that the server's routes are served under.
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// envelope is the response body of every API route.
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error *Error          `json:"error"`
+}
+
+// request describes an API request. Its body is JSON-encoded, unless
+// it is raw.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        any
+	raw         []byte
+	contentType string
+}
+
+// do sends the request, retrying it if possible, and decodes the
+// response's payload into out (if not nil).
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	if req.body != nil {
+		payload, err := json.Marshal(req.body)
+		if err != nil {
+			return fmt.Errorf("error encoding the request: %s", err)
+		}
+		req.raw, req.contentType = payload, "application/json"
+	}
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, req, out)
+		if err == nil || attempt >= c.retries || !retryable(req.method, err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff << attempt):
+		}
+	}
+}
+
+// send sends the request once.
+func (c *Client) send(ctx context.Context, req request, out any) error {
+	resp, err := c.open(ctx, c.http, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading the response: %s", err)
+	}
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return fmt.Errorf("error reading the response: %s", err)
+	}
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("error reading the response: %s", err)
+	}
+	return nil
+}
+
+// open sends the request with the HTTP client h and returns the
+// response, unless the server refused the request.
+func (c *Client) open(ctx context.Context, h *http.Client, req request) (*http.Response, error) {
+	target := c.endpoint + Prefix + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	if req.raw != nil {
+		body = bytes.NewReader(req.raw)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %s", err)
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if c.auth != "" {
+		httpReq.Header.Set("Authorization", c.auth)
+	}
+	resp, err := h.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error making the request: %w", err)
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	// Responses that are not enveloped, e.g. from a proxy, are
+	// described by their status.
+	var env envelope
+	content, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(content, &env) != nil || env.Error == nil {
+		env.Error = &Error{
+			Status:  resp.StatusCode,
+			Code:    statusCode(resp.StatusCode),
+			Message: http.StatusText(resp.StatusCode),
+		}
+	}
+	return nil, env.Error
+}
+
+// retryable reports whether a request that failed with err may be
+// retried.
+func retryable(method string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// The request did not reach the server, or its response
+		// could not be read.
+		return method != http.MethodPost
+	}
+	switch apiErr.Status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return method != http.MethodPost
+	}
+	return false
+}
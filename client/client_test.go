@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// newServer serves handler under Prefix, returning a client of it.
+func newServer(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(Prefix+"/", handler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL+"/", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// respond writes an enveloped response with the payload, or an error
+// if status is not successful.
+func respond(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if status >= http.StatusBadRequest {
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{
+			"status": status, "code": statusCode(status), "message": payload,
+		}})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": payload})
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		wantErr  bool
+	}{
+		{"https://example.com", false},
+		{"http://localhost:8080/mailbox/", false},
+		{"ftp://example.com", true},
+		{"example.com", true},
+		{"http://%zz", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			c, err := New(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && c.Endpoint()[len(c.Endpoint())-1] == '/' {
+				t.Errorf("Endpoint() = %q, want no trailing slash", c.Endpoint())
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+		want string
+	}{
+		{"token", WithToken("mbx_secret"), "Bearer mbx_secret"},
+		{"basic", WithBasicAuth("alice", "correct horse"), "Basic YWxpY2U6Y29ycmVjdCBob3JzZQ=="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			c := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Authorization")
+				respond(w, http.StatusOK, nil)
+			}, tt.opt)
+			if err := c.DeleteEntry(context.Background(), "1234"); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+		message string
+	}{
+		{"enveloped", func(w http.ResponseWriter, r *http.Request) {
+			respond(w, http.StatusNotFound, "the entry does not exist")
+		}, ErrNotFound, "the entry does not exist"},
+		{"proxy", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "<html>Forbidden</html>", http.StatusForbidden)
+		}, ErrForbidden, "Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newServer(t, tt.handler, WithRetries(0))
+			_, err := c.Entry(context.Background(), "1234")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Entry() error = %v, want %v", err, tt.want)
+			}
+			var apiErr *Error
+			if errors.As(err, &apiErr) && apiErr.Message != tt.message {
+				t.Errorf("Message = %q, want %q", apiErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		post     bool
+		attempts int32
+	}{
+		{"unavailable", http.StatusServiceUnavailable, false, 2},
+		{"unavailable post", http.StatusServiceUnavailable, true, 1},
+		{"rate limited post", http.StatusTooManyRequests, true, 2},
+		{"bad request", http.StatusBadRequest, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			c := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				respond(w, tt.status, http.StatusText(tt.status))
+			}, WithRetries(1))
+			var err error
+			if tt.post {
+				_, err = c.AddNote(context.Background(), "1234", "Called back")
+			} else {
+				_, err = c.Entry(context.Background(), "1234")
+			}
+			if err == nil {
+				t.Fatal("request succeeded")
+			}
+			if got := attempts.Load(); got != tt.attempts {
+				t.Errorf("%d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestIterEntries(t *testing.T) {
+	var query string
+	c := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("mailbox")
+		page, _ := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+		entries := []data.Form{}
+		if page < 3 {
+			entries = append(entries, data.Form{ID: fmt.Sprint(page)})
+		}
+		respond(w, http.StatusOK, EntryPage{Page: page, PageCount: 2, EntryCount: 3,
+			Entries: entries})
+	})
+	forms, err := c.IterEntries(context.Background(), EntryFilter{Mailbox: "sales"}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forms) != 3 || forms[0].ID != "0" || forms[2].ID != "2" {
+		t.Errorf("iterated %v, want entries 0 to 2", forms)
+	}
+	if query != "sales" {
+		t.Errorf("mailbox = %q, want sales", query)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	var body map[string]any
+	c := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		respond(w, http.StatusOK, BulkResult{Succeeded: 1, Failed: 1, Results: []BulkItem{
+			{ID: "1", OK: true}, {ID: "2", Error: "not found"},
+		}})
+	})
+	r, err := c.BulkSetStatus(context.Background(), Selection{IDs: []string{"1", "2"}},
+		data.StatusRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["status"] != data.StatusRead || body["filter"] != nil {
+		t.Errorf("request body = %v", body)
+	}
+	if err := r.Err(); err == nil {
+		t.Error("Err() = nil, want the failed entry")
+	}
+	if err := (BulkResult{Succeeded: 2}).Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var resumed string
+	c := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		resumed = r.URL.Query().Get("last_event_id")
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": keepalive\n\n"+
+			"id: 2\nevent: change\ndata: {\"id\":\"2\",\"type\":\"created\"}\n\n"+
+			"id: 3\ndata: not json\n\n")
+	})
+	changes := []data.Change{}
+	last, err := c.Events(context.Background(), "1", func(change data.Change) {
+		changes = append(changes, change)
+	})
+	if err != ErrStreamClosed {
+		t.Errorf("Events() error = %v, want %v", err, ErrStreamClosed)
+	}
+	if resumed != "1" || last != "3" {
+		t.Errorf("resumed after %q and ended at %q, want 1 and 3", resumed, last)
+	}
+	if len(changes) != 1 || changes[0].ID != "2" {
+		t.Errorf("received %v, want change 2", changes)
+	}
+}
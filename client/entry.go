@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/url"
+	"strconv"
+)
+
+// EntryFilter narrows down the entries that are listed. Zero-valued
+// fields match every entry.
+type EntryFilter struct {
+	Mailbox string `json:"mailbox,omitempty"`
+
+	// Status is either data.StatusRead or data.StatusUnread.
+	Status string `json:"status,omitempty"`
+
+	// Tag matches the entries carrying the tag.
+	Tag string `json:"tag,omitempty"`
+
+	// Assignee matches the entries assigned to the user.
+	Assignee string `json:"assignee,omitempty"`
+
+	// State matches the entries in the workflow state, and Overdue
+	// those open for longer than the workflow's SLA.
+	State   string `json:"state,omitempty"`
+	Overdue bool   `json:"overdue,omitempty"`
+}
+
+// query encodes the filter as query parameters.
+func (f EntryFilter) query() url.Values {
+	q := url.Values{}
+	if f.Mailbox != "" {
+		q.Set("mailbox", f.Mailbox)
+	}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if f.Tag != "" {
+		q.Set("tag", f.Tag)
+	}
+	if f.Assignee != "" {
+		q.Set("assignee", f.Assignee)
+	}
+	if f.State != "" {
+		q.Set("state", f.State)
+	}
+	if f.Overdue {
+		q.Set("overdue", "true")
+	}
+	return q
+}
+
+// EntryPage is a page of entries, most recent first.
+type EntryPage struct {
+	Page       int64       `json:"page"`
+	PageCount  int64       `json:"page_count"`
+	EntryCount int64       `json:"entry_count"`
+	Entries    []data.Form `json:"entries"`
+}
+
+// Thread is the conversation of an entry, in chronological order.
+type Thread struct {
+	EntryID      string       `json:"entry_id"`
+	MessageCount int          `json:"message_count"`
+	Messages     []data.Reply `json:"messages"`
+}
+
+// Workflow describes the states that entries move through as they are
+// handled.
+type Workflow struct {
+	States      []string            `json:"states"`
+	Initial     string              `json:"initial"`
+	Transitions map[string][]string `json:"transitions"`
+	Closed      []string            `json:"closed"`
+
+	// SLA is how long, in seconds, entries may stay open before they
+	// are overdue. Zero means that entries are never overdue.
+	SLA int64 `json:"sla"`
+}
+
+// Submit submits a contact form. The captcha token is required if the
+// server validates captchas, and ignored otherwise.
+func (c *Client) Submit(ctx context.Context, form data.Form, captcha string) error {
+	var body any = form.Submission()
+	if captcha != "" {
+		body = data.FormWithCaptcha{Form: form.Submission(), Captcha: captcha}
+	}
+	return c.do(ctx, request{method: "POST", path: "/submissions", body: body}, nil)
+}
+
+// Entries fetches a page of entries matching the filter.
+func (c *Client) Entries(ctx context.Context, filter EntryFilter, page int64) (EntryPage, error) {
+	q := filter.query()
+	q.Set("page", strconv.FormatInt(page, 10))
+	var p EntryPage
+	err := c.do(ctx, request{method: "GET", path: "/entries", query: q}, &p)
+	return p, err
+}
+
+// IterEntries iterates over every entry matching the filter, most
+// recent first.
+func (c *Client) IterEntries(ctx context.Context, filter EntryFilter) *Iterator[data.Form] {
+	return newIterator(ctx, func(ctx context.Context, page int64) ([]data.Form, bool, error) {
+		p, err := c.Entries(ctx, filter, page)
+		return p.Entries, page < p.PageCount, err
+	})
+}
+
+// Entry fetches an entry by its ID.
+func (c *Client) Entry(ctx context.Context, id string) (data.Form, error) {
+	var form data.Form
+	err := c.do(ctx, request{method: "GET", path: "/entries/" + url.PathEscape(id)}, &form)
+	return form, err
+}
+
+// SetStatus marks an entry as read or unread.
+func (c *Client) SetStatus(ctx context.Context, id, status string) error {
+	return c.do(ctx, request{method: "PUT", path: "/entries/" + url.PathEscape(id) + "/status",
+		body: map[string]string{"status": status}}, nil)
+}
+
+// Thread fetches the conversation of an entry.
+func (c *Client) Thread(ctx context.Context, id string) (Thread, error) {
+	var t Thread
+	err := c.do(ctx, request{method: "GET", path: "/entries/" + url.PathEscape(id) + "/thread"}, &t)
+	return t, err
+}
+
+// Reply emails a reply to the submitter of an entry. If subject is
+// empty, the server derives it from the entry's subject.
+func (c *Client) Reply(ctx context.Context, id, subject, body string) error {
+	return c.do(ctx, request{method: "POST", path: "/entries/" + url.PathEscape(id) + "/replies",
+		body: map[string]string{"subject": subject, "body": body}}, nil)
+}
+
+// AddTags adds tags to an entry, returning the entry's tags.
+func (c *Client) AddTags(ctx context.Context, id string, tags ...string) ([]string, error) {
+	var resp struct {
+		Tags []string `json:"tags"`
+	}
+	err := c.do(ctx, request{method: "POST", path: "/entries/" + url.PathEscape(id) + "/tags",
+		body: map[string][]string{"tags": tags}}, &resp)
+	return resp.Tags, err
+}
+
+// SetState moves an entry to another workflow state, returning the
+// entry.
+func (c *Client) SetState(ctx context.Context, id, state string) (data.Form, error) {
+	var form data.Form
+	err := c.do(ctx, request{method: "PUT", path: "/entries/" + url.PathEscape(id) + "/state",
+		body: map[string]string{"state": state}}, &form)
+	return form, err
+}
+
+// Workflow fetches the workflow of entries.
+func (c *Client) Workflow(ctx context.Context) (Workflow, error) {
+	var w Workflow
+	err := c.do(ctx, request{method: "GET", path: "/workflow"}, &w)
+	return w, err
+}
+
+// Assign assigns an entry to a user. An empty username unassigns the
+// entry.
+func (c *Client) Assign(ctx context.Context, id, username string) error {
+	return c.do(ctx, request{method: "PUT", path: "/entries/" + url.PathEscape(id) + "/assignee",
+		body: map[string]string{"assignee": username}}, nil)
+}
+
+// AddNote adds an internal note to an entry, returning the note.
+func (c *Client) AddNote(ctx context.Context, id, body string) (data.Note, error) {
+	var note data.Note
+	err := c.do(ctx, request{method: "POST", path: "/entries/" + url.PathEscape(id) + "/notes",
+		body: map[string]string{"body": body}}, &note)
+	return note, err
+}
+
+// RemoveTag removes a tag from an entry, returning the entry's tags.
+func (c *Client) RemoveTag(ctx context.Context, id, tag string) ([]string, error) {
+	var resp struct {
+		Tags []string `json:"tags"`
+	}
+	err := c.do(ctx, request{method: "DELETE",
+		path: "/entries/" + url.PathEscape(id) + "/tags/" + url.PathEscape(tag)}, &resp)
+	return resp.Tags, err
+}
+
+// Tags lists the tags of the entries matching the filter, sorted.
+func (c *Client) Tags(ctx context.Context, filter EntryFilter) ([]string, error) {
+	var resp struct {
+		Tags []string `json:"tags"`
+	}
+	err := c.do(ctx, request{method: "GET", path: "/tags", query: filter.query()}, &resp)
+	return resp.Tags, err
+}
+
+// DeleteEntry deletes an entry by its ID.
+func (c *Client) DeleteEntry(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: "DELETE", path: "/entries/" + url.PathEscape(id)}, nil)
+}
+
+// Inbound files a raw RFC 5322 email into the conversation of the entry
+// whose reply address it was sent to, returning the entry's ID.
+func (c *Client) Inbound(ctx context.Context, email []byte) (string, error) {
+	var resp struct {
+		EntryID string `json:"entry_id"`
+	}
+	err := c.do(ctx, request{method: "POST", path: "/inbound", raw: email,
+		contentType: "message/rfc822"}, &resp)
+	return resp.EntryID, err
+}
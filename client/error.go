@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error describes a request that the server refused.
+type Error struct {
+	Status  int            `json:"status"`
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Errors that requests may be compared with using errors.Is. They match
+// any Error with the same code.
+var (
+	ErrBadRequest   = &Error{Status: http.StatusBadRequest, Code: statusCode(http.StatusBadRequest)}
+	ErrUnauthorized = &Error{Status: http.StatusUnauthorized, Code: statusCode(http.StatusUnauthorized)}
+	ErrForbidden    = &Error{Status: http.StatusForbidden, Code: statusCode(http.StatusForbidden)}
+	ErrNotFound     = &Error{Status: http.StatusNotFound, Code: statusCode(http.StatusNotFound)}
+	ErrConflict     = &Error{Status: http.StatusConflict, Code: statusCode(http.StatusConflict)}
+	ErrRateLimited  = &Error{Status: http.StatusTooManyRequests, Code: statusCode(http.StatusTooManyRequests)}
+)
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server error: %d %s\n%s", e.Status,
+		http.StatusText(e.Status), e.Message)
+}
+
+// Is reports whether target is an Error with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// TOTPRequired reports whether a login was refused because it requires
+// a TOTP or recovery code.
+func (e *Error) TOTPRequired() bool {
+	required, _ := e.Details["totp_required"].(bool)
+	return required
+}
+
+// statusCode returns the error code of an HTTP status, e.g. "not_found".
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
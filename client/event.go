@@ -0,0 +1,98 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"strings"
+	"time"
+)
+
+// ErrStreamClosed is returned when the server ends an event stream.
+var ErrStreamClosed = errors.New("the event stream was closed by the server")
+
+// Events subscribes to the server's stream of changes to entries and
+// calls fn with each change until the stream ends or ctx is canceled.
+// The stream resumes after the change with the given ID (if any). It
+// returns the ID of the last change received, from which the next
+// subscription may resume.
+func (c *Client) Events(ctx context.Context, after string, fn func(data.Change)) (string, error) {
+	// Streams last indefinitely, unlike other requests.
+	h := *c.http
+	h.Timeout = 0
+
+	req := request{method: "GET", path: "/events"}
+	if after != "" {
+		req.query = map[string][]string{"last_event_id": {after}}
+	}
+	resp, err := c.open(ctx, &h, req)
+	if err != nil {
+		return after, err
+	}
+	defer resp.Body.Close()
+
+	// Events are separated by blank lines. Comments (e.g. keepalives)
+	// and unknown fields are ignored.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	id, payload := "", ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			var change data.Change
+			if payload != "" && json.Unmarshal([]byte(payload), &change) == nil {
+				fn(change)
+			}
+			if id != "" {
+				after = id
+			}
+			id, payload = "", ""
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			payload += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if ctx.Err() != nil {
+		return after, ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return after, fmt.Errorf("error reading the event stream: %s", err)
+	}
+	return after, ErrStreamClosed
+}
+
+// Watch calls fn with each change streamed by the server until ctx is
+// canceled, resubscribing with exponential backoff whenever the stream
+// fails. onError (if not nil) is called with the error that ended each
+// subscription, e.g. so that callers may give up or catch up on
+// changes that cannot be resumed.
+func (c *Client) Watch(ctx context.Context, fn func(data.Change), onError func(error)) {
+	after, delay := "", time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		var err error
+		after, err = c.Events(ctx, after, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		if onError != nil {
+			onError(err)
+		}
+
+		// Subscriptions that lasted a while reset the backoff.
+		if time.Since(start) > time.Minute {
+			delay = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, time.Minute)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import "context"
+
+// fetchFn fetches a page of a listing, reporting whether more pages
+// follow.
+type fetchFn[T any] func(ctx context.Context, page int64) ([]T, bool, error)
+
+// Iterator pages through a listing, fetching pages as they are needed.
+// For example:
+//
+//	it := c.IterJobs(ctx, data.JobDead)
+//	for it.Next() {
+//		fmt.Println(it.Value().ID)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	ctx   context.Context
+	fetch fetchFn[T]
+	page  int64
+	items []T
+	value T
+	more  bool
+	err   error
+}
+
+func newIterator[T any](ctx context.Context, fetch fetchFn[T]) *Iterator[T] {
+	return &Iterator[T]{ctx: ctx, fetch: fetch, more: true}
+}
+
+// Next advances the iterator, returning false once the listing is
+// exhausted or a page could not be fetched.
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if !it.more || it.err != nil {
+			return false
+		}
+		it.items, it.more, it.err = it.fetch(it.ctx, it.page)
+		if it.err != nil {
+			return false
+		}
+		it.more = it.more && len(it.items) > 0
+		it.page++
+	}
+	it.value, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All collects the remaining items.
+func (it *Iterator[T]) All() ([]T, error) {
+	items := []T{}
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+	return items, it.Err()
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/url"
+	"strconv"
+)
+
+// DeliveryPage is a page of webhook deliveries, most recent first.
+type DeliveryPage struct {
+	Page          int64           `json:"page"`
+	PageCount     int64           `json:"page_count"`
+	DeliveryCount int64           `json:"delivery_count"`
+	Deliveries    []data.Delivery `json:"deliveries"`
+}
+
+// JobPage is a page of outbox jobs, most recent first.
+type JobPage struct {
+	Page      int64      `json:"page"`
+	PageCount int64      `json:"page_count"`
+	JobCount  int64      `json:"job_count"`
+	Jobs      []data.Job `json:"jobs"`
+}
+
+// pageQuery encodes a page number and an optional status filter.
+func pageQuery(status string, page int64) url.Values {
+	q := url.Values{"page": {strconv.FormatInt(page, 10)}}
+	if status != "" {
+		q.Set("status", status)
+	}
+	return q
+}
+
+// Deliveries fetches a page of webhook deliveries. If status is not
+// empty, only pending, succeeded or failed deliveries are listed.
+func (c *Client) Deliveries(ctx context.Context, status string, page int64) (DeliveryPage, error) {
+	var p DeliveryPage
+	err := c.do(ctx, request{method: "GET", path: "/webhooks/deliveries",
+		query: pageQuery(status, page)}, &p)
+	return p, err
+}
+
+// IterDeliveries iterates over the webhook deliveries with the given
+// status (or every delivery), most recent first.
+func (c *Client) IterDeliveries(ctx context.Context, status string) *Iterator[data.Delivery] {
+	return newIterator(ctx, func(ctx context.Context, page int64) ([]data.Delivery, bool, error) {
+		p, err := c.Deliveries(ctx, status, page)
+		return p.Deliveries, page < p.PageCount, err
+	})
+}
+
+// Delivery fetches a webhook delivery by its ID.
+func (c *Client) Delivery(ctx context.Context, id string) (data.Delivery, error) {
+	var d data.Delivery
+	err := c.do(ctx, request{method: "GET", path: "/webhooks/deliveries/" + url.PathEscape(id)}, &d)
+	return d, err
+}
+
+// Redeliver resends a webhook delivery, returning its updated record.
+func (c *Client) Redeliver(ctx context.Context, id string) (data.Delivery, error) {
+	var d data.Delivery
+	err := c.do(ctx, request{method: "POST",
+		path: "/webhooks/deliveries/" + url.PathEscape(id) + "/redeliver"}, &d)
+	return d, err
+}
+
+// Jobs fetches a page of outbox jobs. If status is not empty, only
+// pending, running, succeeded or dead jobs are listed.
+func (c *Client) Jobs(ctx context.Context, status string, page int64) (JobPage, error) {
+	var p JobPage
+	err := c.do(ctx, request{method: "GET", path: "/jobs",
+		query: pageQuery(status, page)}, &p)
+	return p, err
+}
+
+// IterJobs iterates over the outbox jobs with the given status (or
+// every job), most recent first.
+func (c *Client) IterJobs(ctx context.Context, status string) *Iterator[data.Job] {
+	return newIterator(ctx, func(ctx context.Context, page int64) ([]data.Job, bool, error) {
+		p, err := c.Jobs(ctx, status, page)
+		return p.Jobs, page < p.PageCount, err
+	})
+}
+
+// Job fetches an outbox job by its ID.
+func (c *Client) Job(ctx context.Context, id string) (data.Job, error) {
+	var j data.Job
+	err := c.do(ctx, request{method: "GET", path: "/jobs/" + url.PathEscape(id)}, &j)
+	return j, err
+}
+
+// RetryJob requeues a dead outbox job, returning its updated record.
+func (c *Client) RetryJob(ctx context.Context, id string) (data.Job, error) {
+	var j data.Job
+	err := c.do(ctx, request{method: "POST", path: "/jobs/" + url.PathEscape(id) + "/retry"}, &j)
+	return j, err
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/url"
+)
+
+// TokenRequest describes an API token to create.
+type TokenRequest struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Mailbox string   `json:"mailbox,omitempty"`
+
+	// ExpiresIn is the token's lifetime, e.g. "720h". Tokens without
+	// one never expire.
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// Tokens lists every API token. Token secrets are never included.
+func (c *Client) Tokens(ctx context.Context) ([]data.Token, error) {
+	var resp struct {
+		Tokens []data.Token `json:"tokens"`
+	}
+	err := c.do(ctx, request{method: "GET", path: "/tokens"}, &resp)
+	return resp.Tokens, err
+}
+
+// CreateToken creates an API token, returning its secret along with
+// its description. The secret cannot be retrieved again.
+func (c *Client) CreateToken(ctx context.Context, req TokenRequest) (string, data.Token, error) {
+	var resp struct {
+		Token  string     `json:"token"`
+		Detail data.Token `json:"detail"`
+	}
+	err := c.do(ctx, request{method: "POST", path: "/tokens", body: req}, &resp)
+	return resp.Token, resp.Detail, err
+}
+
+// DeleteToken revokes an API token.
+func (c *Client) DeleteToken(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: "DELETE", path: "/tokens/" + url.PathEscape(id)}, nil)
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/url"
+	"time"
+)
+
+// Session is a session token issued by Login.
+type Session struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// Identity describes an authenticated caller. Name is the caller's
+// display name, which may differ from the username that identifies
+// them, e.g. for identity provider users.
+type Identity struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Mailbox  string   `json:"mailbox"`
+}
+
+// Can reports whether the caller was granted the given scope.
+func (i Identity) Can(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope || s == data.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// OIDCConfig describes the OpenID Connect provider that the server
+// accepts identity tokens from.
+type OIDCConfig struct {
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+}
+
+// TOTPEnrollment holds the secret of a pending two-factor
+// authentication enrollment, and its otpauth:// URL.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+// Login exchanges a username, password and, for users with two-factor
+// authentication enabled, a TOTP or recovery code for a session token.
+// Logins that lack a required code fail with an Error whose
+// TOTPRequired method reports true.
+func (c *Client) Login(ctx context.Context, username, password, code string) (Session, error) {
+	var s Session
+	err := c.do(ctx, request{method: "POST", path: "/login", body: map[string]string{
+		"username": username,
+		"password": password,
+		"code":     code,
+	}}, &s)
+	return s, err
+}
+
+// Logout revokes the session token that the client authenticates with.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, request{method: "POST", path: "/logout"}, nil)
+}
+
+// OIDC describes the server's OpenID Connect provider.
+func (c *Client) OIDC(ctx context.Context) (OIDCConfig, error) {
+	var config OIDCConfig
+	err := c.do(ctx, request{method: "GET", path: "/oidc"}, &config)
+	return config, err
+}
+
+// WhoAmI describes the authenticated caller.
+func (c *Client) WhoAmI(ctx context.Context) (Identity, error) {
+	var i Identity
+	err := c.do(ctx, request{method: "GET", path: "/whoami"}, &i)
+	return i, err
+}
+
+// Users lists every user.
+func (c *Client) Users(ctx context.Context) ([]data.User, error) {
+	var resp struct {
+		Users []data.User `json:"users"`
+	}
+	err := c.do(ctx, request{method: "GET", path: "/users"}, &resp)
+	return resp.Users, err
+}
+
+// CreateUser creates a user with the given role.
+func (c *Client) CreateUser(ctx context.Context, username, password, role string) error {
+	return c.do(ctx, request{method: "POST", path: "/users", body: map[string]string{
+		"username": username,
+		"password": password,
+		"role":     role,
+	}}, nil)
+}
+
+// DeleteUser deletes a user.
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	return c.do(ctx, request{method: "DELETE", path: "/users/" + url.PathEscape(username)}, nil)
+}
+
+// SetPassword changes a user's password.
+func (c *Client) SetPassword(ctx context.Context, username, password string) error {
+	return c.do(ctx, request{method: "PUT", path: "/users/" + url.PathEscape(username) + "/password",
+		body: map[string]string{"password": password}}, nil)
+}
+
+// SetRole changes a user's role.
+func (c *Client) SetRole(ctx context.Context, username, role string) error {
+	return c.do(ctx, request{method: "PUT", path: "/users/" + url.PathEscape(username) + "/role",
+		body: map[string]string{"role": role}}, nil)
+}
+
+// EnrollTOTP starts enrolling a user in two-factor authentication. The
+// enrollment is completed by EnableTOTP.
+func (c *Client) EnrollTOTP(ctx context.Context, username string) (TOTPEnrollment, error) {
+	var e TOTPEnrollment
+	err := c.do(ctx, request{method: "POST", path: "/users/" + url.PathEscape(username) + "/totp"}, &e)
+	return e, err
+}
+
+// EnableTOTP enables two-factor authentication for a user, given a code
+// generated from the enrollment's secret. It returns the user's
+// single-use recovery codes.
+func (c *Client) EnableTOTP(ctx context.Context, username, code string) ([]string, error) {
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	err := c.do(ctx, request{method: "POST", path: "/users/" + url.PathEscape(username) + "/totp/verify",
+		body: map[string]string{"code": code}}, &resp)
+	return resp.RecoveryCodes, err
+}
+
+// DisableTOTP disables two-factor authentication for a user.
+func (c *Client) DisableTOTP(ctx context.Context, username string) error {
+	return c.do(ctx, request{method: "DELETE", path: "/users/" + url.PathEscape(username) + "/totp"}, nil)
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
-	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/client"
+	"golang.org/x/term"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -22,23 +28,18 @@ submissions. Full documentation is available at:
 	api string
 	usr string
 	pwd string
-)
-
-type commonResponse struct {
-	Error string `json:"error"`
-}
+	tok string
 
-type readAllResponse struct {
-	Page       int64       `json:"page" binding:"required"`
-	PageCount  int64       `json:"page_count" binding:"required"`
-	EntryCount int64       `json:"entry_count" binding:"required"`
-	Entries    []data.Form `json:"entries" binding:"required"`
-}
+	// apiClient is the authenticated client of the API server, created
+	// by validateAPI.
+	apiClient *client.Client
+)
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&api, "api", "", "(Required) HTTP API endpoint")
 	rootCmd.PersistentFlags().StringVar(&usr, "username", "", "(Optional) Your basic auth username")
 	rootCmd.PersistentFlags().StringVar(&pwd, "password", "", "(Optional) Your basic auth password")
+	rootCmd.PersistentFlags().StringVar(&tok, "token", "", "(Optional) An API token, used instead of basic auth (or set MBX_TOKEN)")
 }
 
 func validateAPI() {
@@ -67,6 +68,111 @@ func validateAPI() {
 
 	parsedURL.Path = correctedPath
 	api = parsedURL.String()
+	apiClient = newClient(authOptions()...)
+}
+
+// newClient creates a client of the API server. The --api flag may
+// name either the server's root or its legacy "/mailbox" routes.
+func newClient(opts ...client.Option) *client.Client {
+	c, err := client.New(strings.TrimSuffix(api, "/mailbox"), opts...)
+	if err != nil {
+		fmt.Println("Error: invalid argument for \"--api\" flag (required)")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// authOptions returns the client options that add bearer token or
+// basic authentication (if applicable). Without explicit credentials,
+// the session saved by "mbx login" for the API endpoint is used.
+func authOptions() []client.Option {
+	if tok == "" {
+		tok = os.Getenv("MBX_TOKEN")
+	}
+	if tok != "" {
+		return []client.Option{client.WithToken(tok)}
+	}
+	if usr != "" && pwd != "" {
+		return []client.Option{client.WithBasicAuth(usr, pwd)}
+	}
+	if session := loadSessions()[api]; session != "" {
+		return []client.Option{client.WithToken(session)}
+	}
+	return nil
+}
+
+// fetchWhoAmI describes the authenticated caller, exiting if the
+// server cannot be reached.
+func fetchWhoAmI() client.Identity {
+	me, err := apiClient.WhoAmI(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return me
+}
+
+// sessionsPath returns the file that login sessions are saved to.
+func sessionsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mailbox", "sessions.json"), nil
+}
+
+// loadSessions reads the saved login sessions, keyed by API endpoint.
+func loadSessions() map[string]string {
+	sessions := map[string]string{}
+	path, err := sessionsPath()
+	if err != nil {
+		return sessions
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return sessions
+	}
+	json.Unmarshal(content, &sessions)
+	return sessions
+}
+
+// saveSession saves the session token for the API endpoint. An empty
+// token removes the endpoint's session.
+func saveSession(token string) error {
+	path, err := sessionsPath()
+	if err != nil {
+		return err
+	}
+	sessions := loadSessions()
+	if token == "" {
+		delete(sessions, api)
+	} else {
+		sessions[api] = token
+	}
+	content, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
+
+// readPassword prompts for a password without echoing it to the
+// terminal.
+func readPassword(prompt string) (string, error) {
+	fmt.Print(prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if len(password) == 0 {
+		return "", errors.New("password cannot be empty")
+	}
+	return string(password), nil
 }
 
 // Execute the cobra command line interface.
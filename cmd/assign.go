@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func init() {
+	rootCmd.AddCommand(assignCmd)
+	rootCmd.AddCommand(unassignCmd)
+}
+
+var assignCmd = &cobra.Command{
+	Use:   "assign [id] [username]",
+	Short: "Assign a contact form submission to a user",
+	Long: `Assign a contact form submission to a user, who is then
+responsible for handling it. If the username is omitted, the
+submission is assigned to you. Browse the submissions assigned
+to you using "mbx browse --mine".`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		username := ""
+		if len(args) > 1 {
+			username = args[1]
+		} else if username = fetchWhoAmI().Username; username == "" {
+			fmt.Println("Cannot assign submissions to yourself without logging in")
+			os.Exit(1)
+		}
+		if err := apiClient.Assign(context.Background(), args[0], username); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Submission assigned to", username)
+	},
+}
+
+var unassignCmd = &cobra.Command{
+	Use:   "unassign [id]",
+	Short: "Unassign a contact form submission",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		if err := apiClient.Assign(context.Background(), args[0], ""); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Submission unassigned")
+	},
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/client"
+	"os"
+	"time"
+)
+
+var (
+	auditFilter client.AuditFilter
+	auditSince  time.Duration
+	auditLimit  int
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&auditFilter.User, "user", "", "Only list the actions of the given user")
+	auditCmd.Flags().StringVarP(&auditFilter.Action, "action", "a", "",
+		"Only list the given action and its sub-actions, e.g. delete or status")
+	auditCmd.Flags().StringVarP(&auditFilter.EntryID, "entry", "e", "",
+		"Only list the actions on the given submission (or other resource)")
+	auditCmd.Flags().DurationVarP(&auditSince, "since", "s", 0,
+		"Only list the actions of the given period, e.g. 24h")
+	auditCmd.Flags().IntVarP(&auditLimit, "limit", "n", 50,
+		"The maximum number of records to list, or 0 for every record")
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "List the audit log, most recent first",
+	Long: `List the audit log, which records the user, action, ID of
+the submission (or other resource) and IP address of every
+authenticated request, most recent first. Requires the admin
+role.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		filter := auditFilter
+		if auditSince > 0 {
+			filter.After = time.Now().Add(-auditSince)
+		}
+		it := apiClient.IterAudit(context.Background(), filter)
+		for n := 0; (auditLimit <= 0 || n < auditLimit) && it.Next(); n++ {
+			r := it.Value()
+			action := r.Action
+			if r.Detail != "" {
+				action += " " + r.Detail
+			}
+			fmt.Printf("%s  %-12s %-15s %-24s %s\n",
+				r.Time.Local().Format("2006-01-02 15:04:05"), r.User, r.IP,
+				r.EntryID, action)
+		}
+		if err := it.Err(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
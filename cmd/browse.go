@@ -1,166 +1,312 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"context"
 	"fmt"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/client"
 	"github.com/zeim839/mailbox/cmd/table"
-	"io"
-	"net/http"
+	"github.com/zeim839/mailbox/data"
 	"os"
+	"strings"
+	"time"
 )
 
+// browseEntries caches the entries shown by browse, keyed by ID, so
+// that their conversations can be rendered without refetching them.
+var browseEntries = map[string]data.Form{}
+
+// browseInterval is the interval at which browse polls for changes.
+// If zero, browse subscribes to the server's event stream instead.
+var browseInterval time.Duration
+
+// browseLabel is the label that browsed entries are filtered by.
+var browseLabel string
+
+// browseState and browseOverdue restrict browse to the entries in the
+// workflow state and to those open for longer than the SLA.
+var (
+	browseState   string
+	browseOverdue bool
+)
+
+// browseMine restricts browse to the entries assigned to browseUser.
+var browseMine bool
+
+// browseUser is the username of the user browsing the entries.
+var browseUser string
+
+// browseChangeMsg reports that entries may have changed on the server.
+type browseChangeMsg struct{}
+
+// browseEntriesMsg delivers entries fetched in the background.
+type browseEntriesMsg struct {
+	entries []data.Form
+	err     error
+
+	// replace is set when the entries replace those of another view,
+	// rather than update the current one.
+	replace bool
+}
+
 type browseCmdModel struct {
 	table table.Model
+
+	// changes signals changes streamed by the server. It is nil when
+	// polling.
+	changes <-chan struct{}
 }
 
-func (m browseCmdModel) Init() tea.Cmd { return nil }
+func (m browseCmdModel) Init() tea.Cmd { return m.waitForChange() }
 
 func (m browseCmdModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "q", "ctrl+c":
+		case "q":
+			if !m.table.Editing() {
+				return m, tea.Quit
+			}
+		case "ctrl+c":
 			return m, tea.Quit
+		case "m":
+			if !m.table.Editing() && !m.table.Expanded() && browseUser != "" {
+				browseMine = !browseMine
+				return m, func() tea.Msg {
+					entries, err := fetchEntries()
+					return browseEntriesMsg{entries: entries, err: err, replace: true}
+				}
+			}
+		}
+	case browseChangeMsg:
+		return m, fetchEntriesCmd
+	case browseEntriesMsg:
+		// Entries are cached here, rather than by the command, as
+		// the cache is read while rendering.
+		if msg.replace {
+			if msg.err == nil {
+				m.table.SetRows(tableRows(msg.entries))
+			}
+			m.table, cmd = m.table.Update(table.ResultMsg{Err: msg.err})
+			return m, cmd
+		}
+		rowsMsg := table.RowsMsg{Err: msg.err}
+		if msg.err == nil {
+			rowsMsg.Rows = tableRows(msg.entries)
 		}
+		m.table, cmd = m.table.Update(rowsMsg)
+		return m, tea.Batch(cmd, m.waitForChange())
 	}
 	m.table, cmd = m.table.Update(msg)
 	return m, cmd
 }
 
 func (m browseCmdModel) View() string {
-	return m.table.View() + "\n"
+	if m.table.Expanded() || browseUser == "" {
+		return m.table.View() + "\n"
+	}
+	view := "Show assigned to me"
+	if browseMine {
+		view = "Show all"
+	}
+	return m.table.View() + helpStyle.Render("\n[m]       "+view) + "\n"
 }
 
-func init() {
-	rootCmd.AddCommand(browseCmd)
+// waitForChange returns a command that reports the next change to the
+// entries, or the end of the polling interval.
+func (m browseCmdModel) waitForChange() tea.Cmd {
+	if m.changes == nil {
+		return tea.Tick(browseInterval, func(time.Time) tea.Msg {
+			return browseChangeMsg{}
+		})
+	}
+	return func() tea.Msg {
+		<-m.changes
+		return browseChangeMsg{}
+	}
 }
 
-func fetchTablePage(page int64) ([]table.Row, int64) {
+// fetchEntriesCmd fetches the browsed entries in the background.
+func fetchEntriesCmd() tea.Msg {
+	entries, err := fetchEntries()
+	return browseEntriesMsg{entries: entries, err: err}
+}
 
-	// Create new request.
-	url := fmt.Sprintf("%s/entries/?page=%d", api, page)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Println("server failed to respond", url)
-		return []table.Row{}, -1
+// watchBrowseChanges subscribes to the server's event stream in the
+// background, signaling changes to the browsed mailbox. Consecutive
+// changes are coalesced into one signal. Changes are also signaled
+// whenever the stream fails, as those missed until it reconnects may
+// not be resumed.
+func watchBrowseChanges(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
 	}
+	go apiClient.Watch(ctx, func(change data.Change) {
+		if box == "" || change.Entry.Mailbox == "" || change.Entry.Mailbox == box {
+			signal()
+		}
+	}, func(error) { signal() })
+	return changes
+}
 
-	// Add basic authentication (if applicable).
-	if usr != "" && pwd != "" {
-		basicAuth := base64.StdEncoding.EncodeToString(
-			[]byte(usr + ":" + pwd))
+func init() {
+	browseCmd.Flags().StringVarP(&box, "mailbox", "b", "", "Only browse the given mailbox")
+	browseCmd.Flags().StringVarP(&browseLabel, "label", "l", "", "Only browse submissions with the given label")
+	browseCmd.Flags().StringVarP(&browseState, "state", "s", "", "Only browse submissions in the given workflow state")
+	browseCmd.Flags().BoolVar(&browseOverdue, "overdue", false, "Only browse submissions open for longer than the SLA")
+	browseCmd.Flags().BoolVarP(&browseMine, "mine", "m", false, "Only browse submissions assigned to you")
+	browseCmd.Flags().DurationVar(&browseInterval, "poll", 0, "Poll for changes at the given interval (e.g. 30s) instead of subscribing to server events")
+	rootCmd.AddCommand(browseCmd)
+}
 
-		req.Header.Add("Authorization", "Basic "+basicAuth)
+// fetchEntries fetches every entry of the browsed mailbox.
+func fetchEntries() ([]data.Form, error) {
+	filter := client.EntryFilter{Mailbox: box, Tag: browseLabel,
+		State: browseState, Overdue: browseOverdue}
+	if browseMine {
+		filter.Assignee = browseUser
 	}
+	return apiClient.IterEntries(context.Background(), filter).All()
+}
 
-	// Create a client and send the request.
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("server failed to respond:", url)
-		return []table.Row{}, -1
+// tableRows lists entries as table rows, caching them in browseEntries.
+func tableRows(entries []data.Form) []table.Row {
+	rows := []table.Row{}
+	for _, val := range entries {
+		browseEntries[val.ID] = val
+		rows = append(rows, table.Row{
+			val.ID,
+			val.Status,
+			stateCell(val),
+			val.From,
+			val.Subject,
+			val.Message,
+			strings.Join(val.Tags, ","),
+			val.Assignee,
+		})
 	}
-	defer resp.Body.Close()
+	return rows
+}
+
+// stateCell renders the workflow state of an entry, suffixed with '!'
+// if the entry is overdue.
+func stateCell(form data.Form) string {
+	if form.Overdue {
+		return form.State + " !"
+	}
+	return form.State
+}
 
-	// Read the response body.
-	body, err := io.ReadAll(resp.Body)
+func fetchTableData() []table.Row {
+	entries, err := fetchEntries()
 	if err != nil {
-		return []table.Row{}, -1
+		fmt.Println(err)
+		os.Exit(1)
 	}
+	return tableRows(entries)
+}
 
-	if resp.StatusCode == 200 {
-		var responseData readAllResponse
-		if err := json.Unmarshal(body, &responseData); err != nil {
-			return []table.Row{}, -1
+// renderConversation renders the expanded view of a row, listing the
+// entry's conversation.
+func renderConversation(row table.Row) string {
+	form, ok := browseEntries[row[0]]
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID: %s\nMailbox: %s\nStatus: %s\nState: %s\nSubject: %s\n",
+		form.ID, form.Mailbox, form.Status, form.State, form.Subject)
+	if form.Overdue {
+		fmt.Fprintf(&b, "Overdue: open for %s\n",
+			time.Since(form.Created).Round(time.Minute))
+	}
+	if len(form.Tags) > 0 {
+		fmt.Fprintf(&b, "Labels: %s\n", strings.Join(form.Tags, ", "))
+	}
+	if form.Assignee != "" {
+		fmt.Fprintf(&b, "Assignee: %s\n", form.Assignee)
+	}
+	for _, msg := range form.Thread() {
+		who := msg.From
+		if !msg.Inbound && msg.Author != "" {
+			who = msg.Author + " → " + msg.To
+		}
+		fmt.Fprintf(&b, "------\n%s  %s\n\n%s\n",
+			msg.Sent.Local().Format("2006-01-02 15:04"), who,
+			table.WrapText(msg.Body, 60))
+		for _, a := range msg.Attachments {
+			fmt.Fprintf(&b, "[attachment] %s (%s, %d bytes)\n", a.Filename,
+				a.ContentType, a.Size)
 		}
-		rows := []table.Row{}
-		for _, val := range responseData.Entries {
-			rows = append(rows, table.Row{
-				val.ID,
-				val.From,
-				val.Subject,
-				val.Message,
-			})
+	}
+	for _, rev := range form.History {
+		from, to := rev.From, rev.To
+		if from == "" {
+			from = "none"
 		}
-		next := int64(-1)
-		if responseData.Page < responseData.PageCount-1 {
-			next = responseData.Page + 1
+		if to == "" {
+			to = "none"
 		}
-		return rows, next
+		fmt.Fprintf(&b, "------\n%s  [%s] %s → %s by %s\n",
+			rev.Changed.Local().Format("2006-01-02 15:04"), rev.Field, from, to,
+			rev.Author)
 	}
-
-	// Error message.
-	var responseData commonResponse
-	json.Unmarshal(body, &responseData)
-	fmt.Println("Server error:", resp.Status)
-	if responseData.Error != "" {
-		fmt.Println(responseData.Error)
+	for _, note := range form.Notes {
+		fmt.Fprintf(&b, "------\n%s  [note] %s\n\n%s\n",
+			note.Created.Local().Format("2006-01-02 15:04"), note.Author,
+			table.WrapText(note.Body, 60))
 	}
-	os.Exit(1)
-	return []table.Row{}, -1
+	return b.String()
 }
 
-func fetchTableData() []table.Row {
-	next := int64(0)
-	rows := []table.Row{}
-	for next > -1 {
-		r, page := fetchTablePage(next)
-		rows = append(rows, r...)
-		next = page
+// deleteTableRows deletes the rows' entries in a single request. Entries
+// that could not be deleted are listed in the returned error.
+func deleteTableRows(rows []table.Row) error {
+	if len(rows) == 0 {
+		return nil
 	}
-	return rows
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row[0])
+	}
+	result, err := apiClient.BulkDelete(context.Background(), client.Selection{IDs: ids})
+	if err != nil {
+		return err
+	}
+	return result.Err()
 }
 
-func deleteTableRows(rows []table.Row) error {
+// labelTableRows adds a label to the rows' entries, or removes it if
+// it is prefixed with '-'.
+func labelTableRows(rows []table.Row, label string) error {
+	ids := []string{}
 	for _, row := range rows {
+		ids = append(ids, row[0])
+	}
+	add, remove := []string{label}, []string{}
+	if strings.HasPrefix(label, "-") {
+		add, remove = remove, []string{strings.TrimPrefix(label, "-")}
+	}
+	result, err := apiClient.BulkTag(context.Background(), client.Selection{IDs: ids}, add, remove)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
 
-		// Create a new request.
-		url := fmt.Sprintf("%s/entry/%s", api, row[0])
-		req, err := http.NewRequest("DELETE", url, nil)
-		if err != nil {
-			return fmt.Errorf("error creating request: %s", err.Error())
-		}
-
-		// Add basic authentication (if applicable).
-		if usr != "" && pwd != "" {
-			basicAuth := base64.StdEncoding.EncodeToString(
-				[]byte(usr + ":" + pwd))
-
-			req.Header.Add("Authorization", "Basic "+basicAuth)
-		}
-
-		// Create a client and send the request.
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return fmt.Errorf("error making request: %s", err.Error())
-		}
-		defer resp.Body.Close()
-
-		// Read the response body.
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("error reading response: %s", err.Error())
-		}
-
-		if resp.StatusCode == 200 {
-			continue
-		}
-
-		// Error message.
-		var responseData commonResponse
-		json.Unmarshal(body, &responseData)
-		fmt.Println("Server error:", resp.Status)
-		if responseData.Error != "" {
-			return fmt.Errorf("error reading response: %s", err.Error())
-		}
+func toggleTableRowStatus(row table.Row) error {
+	status := data.StatusRead
+	if row[1] == data.StatusRead {
+		status = data.StatusUnread
 	}
-	return nil
+	return apiClient.SetStatus(context.Background(), row[0], status)
 }
 
 var browseCmd = &cobra.Command{
@@ -170,27 +316,64 @@ var browseCmd = &cobra.Command{
 		validateAPI()
 		columns := []table.Column{
 			{Title: "ID", Width: 5},
+			{Title: "Status", Width: 6},
+			{Title: "State", Width: 12},
 			{Title: "From", Width: 15},
 			{Title: "Subject", Width: 15},
 			{Title: "Message", Width: 30},
+			{Title: "Labels", Width: 15},
+			{Title: "Assignee", Width: 10},
 		}
 
+		// The user is needed to browse the entries assigned to them,
+		// so it is fetched first.
+		me := fetchWhoAmI()
+		browseUser = me.Username
+		if browseMine && browseUser == "" {
+			fmt.Println("Cannot browse assigned submissions without logging in")
+			os.Exit(1)
+		}
 		rows := fetchTableData()
 		if len(rows) == 0 {
 			fmt.Println("No submissions found")
 			os.Exit(1)
 		}
 
-		t := table.New(
+		opts := []table.Option{
 			table.WithColumns(columns),
 			table.WithRows(rows),
 			table.WithFocused(true),
 			table.WithHeight(10),
 			table.WithRefreshFn(fetchTableData),
-			table.WithDeleteFn(deleteTableRows),
-		)
+			table.WithExpandFn(renderConversation),
+		}
 
+		// Only offer the actions that the user is permitted to take.
+		if me.Can(data.ScopeDelete) {
+			opts = append(opts, table.WithDeleteFn(deleteTableRows))
+		}
+		if me.Can(data.ScopeStatus) {
+			opts = append(opts, table.WithStatusFn(toggleTableRowStatus))
+		}
+		if me.Can(data.ScopeStatus) {
+			opts = append(opts, table.WithLabelFn(labelTableRows))
+		}
+		if me.Can(data.ScopeReply) {
+			opts = append(opts, table.WithReplyFn(replyTableRow))
+		}
 		s := table.DefaultStyles()
+
+		// Overdue entries are highlighted in their state column.
+		cell := s.Cell
+		overdue := s.Cell.Foreground(lipgloss.Color("196"))
+		opts = append(opts, table.WithStyleFunc(func(row, col int, value string) lipgloss.Style {
+			if col == 2 && strings.HasSuffix(value, " !") {
+				return overdue
+			}
+			return cell
+		}))
+		t := table.New(opts...)
+
 		s.Header = s.Header.
 			BorderStyle(lipgloss.NormalBorder()).
 			BorderForeground(lipgloss.Color("240")).
@@ -202,7 +385,10 @@ var browseCmd = &cobra.Command{
 			Bold(false)
 		t.SetStyles(s)
 
-		m := browseCmdModel{t}
+		m := browseCmdModel{table: t}
+		if browseInterval <= 0 {
+			m.changes = watchBrowseChanges(context.Background())
+		}
 		if _, err := tea.NewProgram(m).Run(); err != nil {
 			fmt.Println("Error running program:", err)
 			os.Exit(1)
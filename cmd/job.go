@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/data"
+	"os"
+)
+
+var (
+	jobStatus string
+	jobPage   int
+)
+
+func init() {
+	jobListCmd.Flags().StringVarP(&jobStatus, "status", "s", "",
+		"Only list pending, running, succeeded or dead jobs")
+	jobListCmd.Flags().IntVarP(&jobPage, "page", "p", 0, "Page number")
+	jobCmd.AddCommand(jobListCmd)
+	jobCmd.AddCommand(jobShowCmd)
+	jobCmd.AddCommand(jobRetryCmd)
+	rootCmd.AddCommand(jobCmd)
+}
+
+var jobCmd = &cobra.Command{
+	Use:   "job",
+	Short: "Inspect and retry outbox jobs",
+}
+
+var jobListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List outbox jobs, most recent first",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		page, err := apiClient.Jobs(context.Background(), jobStatus, int64(jobPage))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, j := range page.Jobs {
+			fmt.Printf("%s  %s  %-9s %-14s %-10s entry=%s attempts=%d\n",
+				j.ID, j.Created.Format("2006-01-02 15:04"), j.Status,
+				j.Event, j.Target, j.EntryID, j.Attempts)
+		}
+		fmt.Printf("Page %d of %d\n", page.Page, page.PageCount+1)
+	},
+}
+
+var jobShowCmd = &cobra.Command{
+	Use:   "show [id]",
+	Short: "Show an outbox job and its payload",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		j, err := apiClient.Job(context.Background(), args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("ID:      ", j.ID)
+		fmt.Println("Target:  ", j.Target)
+		fmt.Println("Event:   ", j.Event)
+		fmt.Println("Entry:   ", j.EntryID)
+		fmt.Println("Status:  ", j.Status)
+		fmt.Println("Attempts:", j.Attempts)
+		if j.Error != "" {
+			fmt.Println("Error:   ", j.Error)
+		}
+		if j.Status == data.JobPending {
+			fmt.Println("Next:    ", j.RunAt.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Println("Created: ", j.Created.Format("2006-01-02 15:04:05"))
+		fmt.Println("Updated: ", j.Updated.Format("2006-01-02 15:04:05"))
+		fmt.Println()
+		fmt.Println(j.Payload)
+	},
+}
+
+var jobRetryCmd = &cobra.Command{
+	Use:   "retry [id]",
+	Short: "Requeue a dead outbox job",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		if _, err := apiClient.RetryJob(context.Background(), args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Job successfully requeued")
+	},
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/client"
+	"os"
+	"strings"
+)
+
+func init() {
+	labelListCmd.Flags().StringVarP(&box, "mailbox", "b", "",
+		"Only list the labels used in the given mailbox")
+	labelCmd.AddCommand(labelListCmd)
+	labelCmd.AddCommand(labelAddCmd)
+	labelCmd.AddCommand(labelRemoveCmd)
+	rootCmd.AddCommand(labelCmd)
+}
+
+var labelCmd = &cobra.Command{
+	Use:     "label",
+	Aliases: []string{"tag"},
+	Short:   "Categorize contact form submissions with labels",
+	Long: `Categorize contact form submissions with free-form labels,
+such as sales, support or bug. Labels are 1-32 lowercase
+letters, numbers, '_' and '-'. Browse the submissions with a
+label using "mbx browse --label <label>".`,
+}
+
+var labelListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the labels in use",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		tags, err := apiClient.Tags(context.Background(), client.EntryFilter{Mailbox: box})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+	},
+}
+
+var labelAddCmd = &cobra.Command{
+	Use:   "add [id] [label]...",
+	Short: "Add labels to a submission",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		tags, err := apiClient.AddTags(context.Background(), args[0], args[1:]...)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Labels:", strings.Join(tags, ", "))
+	},
+}
+
+var labelRemoveCmd = &cobra.Command{
+	Use:   "remove [id] [label]...",
+	Short: "Remove labels from a submission",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		tags := []string{}
+		for _, tag := range args[1:] {
+			var err error
+			if tags, err = apiClient.RemoveTag(context.Background(), args[0], tag); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		fmt.Println("Labels:", strings.Join(tags, ", "))
+	},
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/client"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	loginCode  string
+	loginSSO   bool
+	loginScope string
+)
+
+type oidcDiscovery struct {
+	Issuer                      string `json:"issuer"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type deviceToken struct {
+	IDToken          string `json:"id_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func init() {
+	loginCmd.Flags().StringVarP(&loginCode, "code", "c", "",
+		"A TOTP or recovery code (prompted for if required)")
+	loginCmd.Flags().BoolVar(&loginSSO, "sso", false,
+		"Log in through the server's OpenID Connect provider")
+	loginCmd.Flags().StringVar(&loginScope, "sso-scope", "openid profile email",
+		"The OpenID Connect scopes to request")
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+}
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in and save a session token",
+	Long: `Log in with a username, password and, if two-factor
+authentication is enabled, a TOTP or recovery code. The
+resulting session token is saved and used by subsequent
+commands against the same API endpoint until it expires.
+
+With "--sso", mbx instead performs the OAuth device
+authorization flow with the server's OpenID Connect provider:
+open the printed URL, confirm the code, and the resulting
+identity token is saved as the session.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		if loginSSO {
+			ssoLogin()
+			return
+		}
+		if usr == "" {
+			usr = prompt("Username: ")
+		}
+		password := pwd
+		if password == "" {
+			var err error
+			if password, err = readPassword("Password: "); err != nil {
+				fmt.Println("Error reading password:", err)
+				os.Exit(1)
+			}
+		}
+
+		// Don't send any saved credentials as well.
+		anonymous := newClient()
+		ctx := context.Background()
+		session, err := anonymous.Login(ctx, usr, password, loginCode)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.TOTPRequired() && loginCode == "" {
+			code := prompt("Authentication code: ")
+			session, err = anonymous.Login(ctx, usr, password, code)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := saveSession(session.Token); err != nil {
+			fmt.Println("Error saving session:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Logged in as %q until %s\n", usr,
+			session.Expires.Local().Format("2006-01-02 15:04"))
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke and forget the saved session token",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		if loadSessions()[api] == "" {
+			fmt.Println("Not logged in")
+			os.Exit(1)
+		}
+		if err := apiClient.Logout(context.Background()); err != nil {
+			fmt.Println(err)
+		}
+		if err := saveSession(""); err != nil {
+			fmt.Println("Error removing session:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Logged out")
+	},
+}
+
+// ssoLogin performs the OAuth 2.0 device authorization flow (RFC 8628)
+// against the server's OpenID Connect provider and saves the issued
+// identity token as the session.
+func ssoLogin() {
+	config, err := apiClient.OIDC(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var discovery oidcDiscovery
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(wellKnown, &discovery); err != nil {
+		fmt.Println("Error discovering identity provider:", err)
+		os.Exit(1)
+	}
+	if discovery.DeviceAuthorizationEndpoint == "" {
+		fmt.Println("Error: identity provider does not support device authorization")
+		os.Exit(1)
+	}
+
+	var auth deviceAuthorization
+	err = postForm(discovery.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {config.ClientID},
+		"scope":     {loginScope},
+	}, &auth)
+	if err != nil {
+		fmt.Println("Error starting device authorization:", err)
+		os.Exit(1)
+	}
+
+	verificationURI := auth.VerificationURI
+	if auth.VerificationURIComplete != "" {
+		verificationURI = auth.VerificationURIComplete
+	}
+	fmt.Println("Open the following URL to log in:")
+	fmt.Println(verificationURI)
+	fmt.Println("and confirm the code:", auth.UserCode)
+
+	interval := time.Duration(max(auth.Interval, 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		var token deviceToken
+		err := postForm(discovery.TokenEndpoint, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {config.ClientID},
+		}, &token)
+		if err != nil && token.Error == "" {
+			fmt.Println("Error requesting token:", err)
+			os.Exit(1)
+		}
+		switch token.Error {
+		case "":
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			fmt.Println("Error:", token.Error, token.ErrorDescription)
+			os.Exit(1)
+		}
+		if token.IDToken == "" {
+			fmt.Println("Error: identity provider did not issue an ID token")
+			os.Exit(1)
+		}
+		if err := saveSession(token.IDToken); err != nil {
+			fmt.Println("Error saving session:", err)
+			os.Exit(1)
+		}
+		apiClient = newClient(client.WithToken(token.IDToken))
+		fmt.Println("Logged in as", fetchWhoAmI().Name)
+		return
+	}
+	fmt.Println("Error: device code expired, please try again")
+	os.Exit(1)
+}
+
+// getJSON fetches and decodes a JSON document.
+func getJSON(endpoint string, v any) error {
+	resp, err := http.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// postForm submits a URL-encoded form and decodes the JSON response,
+// even if the request was unsuccessful, since OAuth endpoints report
+// errors in the body.
+func postForm(endpoint string, form url.Values, v any) error {
+	resp, err := http.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// prompt reads a line of input from the terminal.
+func prompt(label string) string {
+	fmt.Print(label)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		fmt.Println("Error reading input:", err)
+		os.Exit(1)
+	}
+	return strings.TrimSpace(line)
+}
@@ -1,16 +1,13 @@
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
-	"io"
-	"net/http"
+	"github.com/zeim839/mailbox/data"
 	"os"
 	"strings"
 )
@@ -19,6 +16,7 @@ var (
 	src          string = ""
 	sub          string = ""
 	bod          string = ""
+	box          string = ""
 	enterPressed        = false
 
 	focusedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
@@ -209,6 +207,7 @@ func init() {
 	newCmd.Flags().StringVarP(&src, "from", "f", "", "The source email address")
 	newCmd.Flags().StringVarP(&sub, "sub", "s", "", "The message subject")
 	newCmd.Flags().StringVarP(&bod, "msg", "m", "", "The message body")
+	newCmd.Flags().StringVarP(&box, "mailbox", "b", "", "The destination mailbox")
 	rootCmd.AddCommand(newCmd)
 }
 
@@ -229,68 +228,13 @@ var newCmd = &cobra.Command{
 }
 
 func submit() {
-
-	// JSON payload
-	payload := map[string]string{
-		"from":    src,
-		"subject": sub,
-		"message": bod,
-	}
-
-	// Convert payload to JSON
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Println("Error marshalling JSON:", err)
-		os.Exit(1)
-	}
-
-	// Create a new request
-	req, err := http.NewRequest("POST", api+"/submit", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		os.Exit(1)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	if usr != "" && pwd != "" {
-		basicAuth := base64.StdEncoding.EncodeToString(
-			[]byte(usr + ":" + pwd))
-
-		req.Header.Add("Authorization", "Basic "+basicAuth)
-	}
-
-	// Create HTTP client
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error sending request:", err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Error reading response:", err)
-		os.Exit(1)
-	}
-
-	// Success.
-	if resp.StatusCode == 200 {
-		fmt.Println("Response Status:", resp.Status)
-		fmt.Println("(success)")
-		os.Exit(0)
-	}
-
-	// Error message.
-	var responseData commonResponse
-	json.Unmarshal(body, &responseData)
-	fmt.Println("Server error:", resp.Status)
-	if responseData.Error != "" {
-		fmt.Println(responseData.Error)
+	form := data.Form{From: src, Subject: sub, Message: bod, Mailbox: box}
+	if err := apiClient.Submit(context.Background(), form, ""); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	fmt.Println("(success)")
+	os.Exit(0)
 }
 
 func submitTUI() {
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+func init() {
+	rootCmd.AddCommand(noteCmd)
+}
+
+var noteCmd = &cobra.Command{
+	Use:   "note [id] [text]...",
+	Short: "Add an internal note to a contact form submission",
+	Long: `Add an internal note to a contact form submission, e.g. to
+share context with the other users handling the mailbox. Notes
+are never sent to the submitter. If no text is given, it is read
+from standard input.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		text := strings.Join(args[1:], " ")
+		if len(args) == 1 {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			text = string(b)
+		}
+		note, err := apiClient.AddNote(context.Background(), args[0], text)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Note added by %s at %s\n", note.Author,
+			note.Created.Local().Format("2006-01-02 15:04"))
+	},
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/cmd/table"
+	"github.com/zeim839/mailbox/data"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// errReplyAborted is returned when the reply draft was left empty or
+// unchanged.
+var errReplyAborted = errors.New("reply aborted: the draft was not edited")
+
+func init() {
+	rootCmd.AddCommand(replyCmd)
+}
+
+var replyCmd = &cobra.Command{
+	Use:   "reply [id]",
+	Short: "Reply to a contact form submission by email",
+	Long: `Reply to a contact form submission by email. The reply is
+composed in $EDITOR, sent through the server's SMTP relay and
+recorded on the submission. Leave the draft unchanged to abort.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		form, err := apiClient.Entry(context.Background(), args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		path, err := writeReplyDraft(form)
+		if err != nil {
+			fmt.Println("Error creating the draft:", err)
+			os.Exit(1)
+		}
+		defer os.Remove(path)
+		editor := editorCmd(path)
+		editor.Stdin, editor.Stdout, editor.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := editor.Run(); err != nil {
+			fmt.Println("Error running the editor:", err)
+			os.Exit(1)
+		}
+		if err := sendReplyDraft(form, path); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Reply successfully sent to", form.From)
+	},
+}
+
+// replyTemplate returns the initial draft of a reply to form. The first
+// line holds the subject and the original message is quoted below.
+func replyTemplate(form data.Form) string {
+	quoted := []string{}
+	for _, line := range strings.Split(strings.TrimRight(form.Message, "\n"), "\n") {
+		quoted = append(quoted, "> "+line)
+	}
+	return fmt.Sprintf("Subject: Re: %s\n\n\n\n%s wrote:\n%s\n", form.Subject,
+		form.From, strings.Join(quoted, "\n"))
+}
+
+// writeReplyDraft saves the reply template of form to a temporary file
+// and returns its path.
+func writeReplyDraft(form data.Form) (string, error) {
+	f, err := os.CreateTemp("", "mbx-reply-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(replyTemplate(form)); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// sendReplyDraft sends the draft at path as a reply to form, unless
+// the draft was left unchanged.
+func sendReplyDraft(form data.Form, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	draft := strings.ReplaceAll(string(raw), "\r\n", "\n")
+	if strings.TrimSpace(draft) == strings.TrimSpace(replyTemplate(form)) {
+		return errReplyAborted
+	}
+	subject := ""
+	if header, rest, ok := strings.Cut(draft, "\n"); ok &&
+		strings.HasPrefix(header, "Subject:") {
+		subject = strings.TrimSpace(strings.TrimPrefix(header, "Subject:"))
+		draft = rest
+	}
+	draft = strings.TrimSpace(draft)
+	if draft == "" {
+		return errReplyAborted
+	}
+	return apiClient.Reply(context.Background(), form.ID, subject, draft+"\n")
+}
+
+// editorCmd returns a command that opens path in the user's editor.
+func editorCmd(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Editors are often configured with arguments, e.g. "code -w".
+	args := strings.Fields(editor)
+	return exec.Command(args[0], append(args[1:], path)...)
+}
+
+// replyTableRow suspends the browse table to compose a reply to the
+// row's entry in $EDITOR, then sends it.
+func replyTableRow(row table.Row) tea.Cmd {
+	form := data.Form{
+		ID:      row[0],
+		From:    row[3],
+		Subject: row[4],
+		Message: row[5],
+	}
+	path, err := writeReplyDraft(form)
+	if err != nil {
+		return func() tea.Msg { return table.ResultMsg{Err: err} }
+	}
+	return tea.ExecProcess(editorCmd(path), func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err == nil {
+			err = sendReplyDraft(form, path)
+		}
+		return table.ResultMsg{Err: err}
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	stateCmd.AddCommand(stateListCmd)
+	stateCmd.AddCommand(stateSetCmd)
+	stateCmd.AddCommand(stateHistoryCmd)
+	rootCmd.AddCommand(stateCmd)
+}
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Move contact form submissions through the workflow",
+	Long: `Move contact form submissions through the workflow states
+configured on the server, e.g. from new to in-progress. Browse
+the submissions in a state using "mbx browse --state <state>",
+and those open for longer than the SLA using "mbx browse
+--overdue".`,
+}
+
+var stateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the workflow states and their transitions",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		w, err := apiClient.Workflow(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, state := range w.States {
+			to := append(slices.Clone(w.Transitions[state]), w.Transitions["*"]...)
+			kind := "open"
+			if slices.Contains(w.Closed, state) {
+				kind = "closed"
+			}
+			fmt.Printf("%s (%s) → %s\n", state, kind, strings.Join(to, ", "))
+		}
+		if w.SLA > 0 {
+			fmt.Println("SLA:", time.Duration(w.SLA)*time.Second)
+		}
+	},
+}
+
+var stateSetCmd = &cobra.Command{
+	Use:   "set [id] [state]",
+	Short: "Move a submission to another state",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		form, err := apiClient.SetState(context.Background(), args[0], args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("State:", form.State)
+	},
+}
+
+var stateHistoryCmd = &cobra.Command{
+	Use:   "history [id]",
+	Short: "List the changes to a submission's state and assignee",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		form, err := apiClient.Entry(context.Background(), args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, rev := range form.History {
+			fmt.Printf("%s  %s: %q → %q by %s\n",
+				rev.Changed.Local().Format("2006-01-02 15:04"), rev.Field,
+				rev.From, rev.To, rev.Author)
+		}
+		fmt.Println("State:", form.State)
+		if form.Overdue {
+			fmt.Printf("Overdue: open for %s\n", time.Since(form.Created).Round(time.Minute))
+		}
+	},
+}
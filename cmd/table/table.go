@@ -23,11 +23,13 @@ package table
 import (
 	"fmt"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mattn/go-runewidth"
 	"strings"
+	"time"
 )
 
 var (
@@ -36,9 +38,13 @@ var (
 	baseStyle    = lipgloss.NewStyle().
 			BorderStyle(lipgloss.NormalBorder()).
 			BorderForeground(lipgloss.Color("240"))
-	errStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#e74c3c"))
+	errStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#e74c3c"))
+	flashStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#2ecc71"))
 )
 
+// FlashDuration is the time that the new rows indicator is shown for.
+var FlashDuration = 5 * time.Second
+
 // Row represents one line in the table.
 type Row []string
 
@@ -54,6 +60,40 @@ type DeleteFn func(rows []Row) error
 // RefreshFn is a function that refreshes the available rows.
 type RefreshFn func() []Row
 
+// StatusFn is a function that toggles the status of a row.
+type StatusFn func(row Row) error
+
+// LabelFn is a function that labels rows. Labels prefixed with '-' are
+// removed instead.
+type LabelFn func(rows []Row, label string) error
+
+// ReplyFn is a function that composes and sends a reply to a row. It
+// returns a command whose completion is reported with a ResultMsg.
+type ReplyFn func(row Row) tea.Cmd
+
+// ExpandFn is a function that renders the expanded view of a row.
+type ExpandFn func(row Row) string
+
+// ResultMsg reports the outcome of an asynchronous action. The table
+// displays its error (if any) and refreshes its rows.
+type ResultMsg struct {
+	Err error
+}
+
+// RowsMsg delivers rows loaded in the background, e.g. after the
+// underlying data changed. The table merges them into its rows, or
+// displays the error (if any).
+type RowsMsg struct {
+	Rows []Row
+	Err  error
+}
+
+// flashMsg hides the new rows indicator, unless it was shown again
+// since.
+type flashMsg struct {
+	seq int
+}
+
 // Model defines a state for the table widget.
 type Model struct {
 	KeyMap     KeyMap
@@ -71,7 +111,15 @@ type Model struct {
 	isDelete   bool
 	deleteFn   DeleteFn
 	refreshFn  RefreshFn
+	statusFn   StatusFn
+	replyFn    ReplyFn
+	labelFn    LabelFn
+	expandFn   ExpandFn
+	labeling   bool
+	labelInput textinput.Model
 	err        error
+	flash      string
+	flashSeq   int
 }
 
 // KeyMap defines keybindings. It satisfies to the help.KeyMap interface, which
@@ -86,6 +134,9 @@ type KeyMap struct {
 	Mark       key.Binding
 	Execute    key.Binding
 	Expand     key.Binding
+	Toggle     key.Binding
+	Reply      key.Binding
+	Label      key.Binding
 }
 
 // ShortHelp implements the KeyMap interface.
@@ -97,7 +148,7 @@ func (km KeyMap) ShortHelp() []key.Binding {
 func (km KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{km.LineUp, km.LineDown, km.GotoTop, km.GotoBottom},
-		{km.PageUp, km.PageDown, km.Mark, km.Expand},
+		{km.PageUp, km.PageDown, km.Mark, km.Expand, km.Toggle, km.Reply, km.Label},
 	}
 }
 
@@ -131,7 +182,7 @@ func DefaultKeyMap() KeyMap {
 		),
 		Mark: key.NewBinding(
 			key.WithKeys("d", "D"),
-			key.WithHelp("d", "mark for deletion"),
+			key.WithHelp("d", "select/deselect"),
 		),
 		Execute: key.NewBinding(
 			key.WithKeys("x", "X"),
@@ -141,6 +192,18 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("enter"),
 			key.WithHelp("enter", "expand"),
 		),
+		Toggle: key.NewBinding(
+			key.WithKeys("r", "R"),
+			key.WithHelp("r", "mark read/unread"),
+		),
+		Reply: key.NewBinding(
+			key.WithKeys("a", "A"),
+			key.WithHelp("a", "reply"),
+		),
+		Label: key.NewBinding(
+			key.WithKeys("l", "L"),
+			key.WithHelp("l", "label"),
+		),
 	}
 }
 
@@ -205,7 +268,8 @@ func WithRows(rows []Row) Option {
 	}
 }
 
-// WithDeleteFn sets the deletion callback.
+// WithDeleteFn sets the deletion callback. Deletion actions are hidden
+// unless it is set.
 func WithDeleteFn(d DeleteFn) Option {
 	return func(m *Model) {
 		m.deleteFn = d
@@ -219,6 +283,38 @@ func WithRefreshFn(r RefreshFn) Option {
 	}
 }
 
+// WithStatusFn sets the status toggle callback. The status action is
+// hidden unless it is set.
+func WithStatusFn(s StatusFn) Option {
+	return func(m *Model) {
+		m.statusFn = s
+	}
+}
+
+// WithReplyFn sets the reply callback. The reply action is hidden
+// unless it is set.
+func WithReplyFn(r ReplyFn) Option {
+	return func(m *Model) {
+		m.replyFn = r
+	}
+}
+
+// WithLabelFn sets the labeling callback. The label action is hidden
+// unless it is set.
+func WithLabelFn(l LabelFn) Option {
+	return func(m *Model) {
+		m.labelFn = l
+	}
+}
+
+// WithExpandFn sets the renderer of the expanded view. By default,
+// every column of the row is listed.
+func WithExpandFn(e ExpandFn) Option {
+	return func(m *Model) {
+		m.expandFn = e
+	}
+}
+
 // WithHeight sets the height of the table.
 func WithHeight(h int) Option {
 	return func(m *Model) {
@@ -267,17 +363,45 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		return m, nil
 	}
 	switch msg := msg.(type) {
+	case ResultMsg:
+		m.err = msg.Err
+		m.refresh()
+	case RowsMsg:
+		if msg.Err != nil {
+			m.err = msg.Err
+			break
+		}
+		added := m.Merge(msg.Rows)
+		if added == 0 {
+			break
+		}
+		m.flash = "1 new message"
+		if added > 1 {
+			m.flash = fmt.Sprintf("%d new messages", added)
+		}
+		m.flashSeq++
+		seq := m.flashSeq
+		return m, tea.Tick(FlashDuration, func(time.Time) tea.Msg {
+			return flashMsg{seq}
+		})
+	case flashMsg:
+		if msg.seq == m.flashSeq {
+			m.flash = ""
+		}
 	case tea.KeyMsg:
+		if m.labeling {
+			return m.updateLabel(msg)
+		}
 		switch {
 		case key.Matches(msg, m.KeyMap.LineUp):
 			if m.isExpanded {
-				m.isDelete = !m.isDelete
+				m.isDelete = !m.isDelete && m.deleteFn != nil
 				break
 			}
 			m.MoveUp(1)
 		case key.Matches(msg, m.KeyMap.LineDown):
 			if m.isExpanded {
-				m.isDelete = !m.isDelete
+				m.isDelete = !m.isDelete && m.deleteFn != nil
 				break
 			}
 			m.MoveDown(1)
@@ -292,34 +416,50 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		case key.Matches(msg, m.KeyMap.GotoBottom):
 			m.GotoBottom()
 		case key.Matches(msg, m.KeyMap.Mark):
+			// Selections are deleted or labeled.
+			if m.deleteFn == nil && m.labelFn == nil {
+				break
+			}
 			m.Mark()
 			m.MoveDown(1)
 		case key.Matches(msg, m.KeyMap.Execute):
+			if m.deleteFn == nil {
+				break
+			}
 			rows := []Row{}
 			for i, ok := range m.marked {
 				if ok {
 					rows = append(rows, m.rows[i])
 				}
 			}
-			if m.deleteFn != nil {
-				m.err = m.deleteFn(rows)
+			m.err = m.deleteFn(rows)
+			m.refresh()
+		case key.Matches(msg, m.KeyMap.Toggle):
+			if m.statusFn == nil || m.SelectedRow() == nil {
+				break
 			}
-			if m.refreshFn != nil {
-				m.rows = m.refreshFn()
-				m.marked = make([]bool, len(m.rows))
+			m.err = m.statusFn(m.SelectedRow())
+			m.refresh()
+		case key.Matches(msg, m.KeyMap.Label):
+			if m.isExpanded || m.labelFn == nil || m.SelectedRow() == nil {
+				break
 			}
-			m.UpdateViewport()
+			m.labeling = true
+			m.labelInput = textinput.New()
+			m.labelInput.Prompt = "Label (-label to remove): "
+			m.labelInput.CharLimit = 33
+			return m, m.labelInput.Focus()
+		case key.Matches(msg, m.KeyMap.Reply):
+			if !m.isExpanded || m.replyFn == nil || m.SelectedRow() == nil {
+				break
+			}
+			return m, m.replyFn(m.SelectedRow())
 		case key.Matches(msg, m.KeyMap.Expand):
 			if m.isExpanded && m.isDelete {
-				if m.deleteFn != nil {
-					m.err = m.deleteFn([]Row{m.SelectedRow()})
-				}
-				if m.refreshFn != nil {
-					m.rows = m.refreshFn()
-					m.marked = make([]bool, len(m.rows))
-				}
-				m.UpdateViewport()
+				m.err = m.deleteFn([]Row{m.SelectedRow()})
+				m.refresh()
 				m.isExpanded = false
+				m.isDelete = false
 				break
 			}
 			if m.isExpanded && !m.isDelete {
@@ -332,6 +472,94 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateLabel handles keys while a label is typed. Enter labels the
+// marked rows, or the selected row if none are marked.
+func (m Model) updateLabel(msg tea.KeyMsg) (Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.labeling = false
+		return m, nil
+	case "enter":
+		m.labeling = false
+		label := strings.TrimSpace(m.labelInput.Value())
+		if label == "" || label == "-" {
+			return m, nil
+		}
+		rows := []Row{}
+		for i, ok := range m.marked {
+			if ok {
+				rows = append(rows, m.rows[i])
+			}
+		}
+		if len(rows) == 0 {
+			rows = append(rows, m.SelectedRow())
+		}
+		m.err = m.labelFn(rows, label)
+		m.refresh()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.labelInput, cmd = m.labelInput.Update(msg)
+	return m, cmd
+}
+
+// Editing reports whether the table is capturing text input, e.g. a
+// label, so that keys should not be handled elsewhere.
+func (m Model) Editing() bool {
+	return m.labeling
+}
+
+// Expanded reports whether the selected row is shown in its expanded
+// view.
+func (m Model) Expanded() bool {
+	return m.isExpanded && m.SelectedRow() != nil
+}
+
+// refresh reloads the rows through the refresh callback (if set) and
+// clears all marks.
+func (m *Model) refresh() {
+	if m.refreshFn != nil {
+		m.rows = m.refreshFn()
+		m.marked = make([]bool, len(m.rows))
+		m.cursor = clamp(m.cursor, 0, len(m.rows)-1)
+	}
+	m.UpdateViewport()
+}
+
+// Merge replaces the rows, keeping the cursor on the selected row and
+// the marks of the rows that remain. Rows are matched by their first
+// column. It returns the number of rows that were not present before.
+func (m *Model) Merge(rows []Row) int {
+	known := map[string]bool{}
+	marked := map[string]bool{}
+	for i, row := range m.rows {
+		if len(row) > 0 {
+			known[row[0]] = true
+			marked[row[0]] = m.marked[i]
+		}
+	}
+	selected := m.SelectedRow()
+	cursor := m.cursor
+	added := 0
+	m.marked = make([]bool, len(rows))
+	for i, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		if !known[row[0]] {
+			added++
+		}
+		m.marked[i] = marked[row[0]]
+		if len(selected) > 0 && row[0] == selected[0] {
+			cursor = i
+		}
+	}
+	m.rows = rows
+	m.cursor = clamp(cursor, 0, len(rows)-1)
+	m.UpdateViewport()
+	return added
+}
+
 // Focused returns the focus state of the table.
 func (m Model) Focused() bool {
 	return m.focus
@@ -352,7 +580,7 @@ func (m *Model) Blur() {
 
 // View renders the component.
 func (m Model) View() string {
-	if m.isExpanded && m.SelectedRow() != nil {
+	if m.Expanded() {
 		return m.expandedView()
 	}
 	errMsg := ""
@@ -360,12 +588,29 @@ func (m Model) View() string {
 		errMsg = "\n" + errStyle.Render(m.err.Error())
 		m.err = nil
 	}
+	if m.flash != "" {
+		errMsg += "\n" + flashStyle.Render("● "+m.flash)
+	}
+	help := blurredStyle.Render("\n[↑/k ↓/j] Navigate") +
+		blurredStyle.Render("         [enter] Expand entry")
+	if m.deleteFn != nil || m.labelFn != nil {
+		help += blurredStyle.Render("\n[d]       Select/deselect")
+	}
+	if m.deleteFn != nil {
+		help += blurredStyle.Render("  [x]     Delete selections")
+	}
+	if m.statusFn != nil {
+		help += blurredStyle.Render("\n[r]       Mark read/unread")
+	}
+	if m.labelFn != nil {
+		help += blurredStyle.Render("\n[l]       Label selections")
+	}
+	if m.labeling {
+		help = "\n" + m.labelInput.View() +
+			blurredStyle.Render("\n[enter]   Apply  [esc] Cancel")
+	}
 	return baseStyle.Render(m.headersView()+"\n"+m.viewport.View()) +
-		errMsg +
-		blurredStyle.Render("\n[↑/k ↓/j] Navigate") +
-		blurredStyle.Render("         [enter] Expand entry") +
-		blurredStyle.Render("\n[d]       Select/deselect") +
-		blurredStyle.Render("  [x]     Delete selections") +
+		errMsg + help +
 		blurredStyle.Render("\n[ctrl+c]  Quit")
 }
 
@@ -410,9 +655,11 @@ func (m Model) Columns() []Column {
 	return m.cols
 }
 
-// SetRows sets a new rows state.
+// SetRows sets a new rows state and clears all marks.
 func (m *Model) SetRows(r []Row) {
 	m.rows = r
+	m.marked = make([]bool, len(r))
+	m.cursor = clamp(m.cursor, 0, len(r)-1)
 	m.UpdateViewport()
 }
 
@@ -497,8 +744,8 @@ func (m *Model) GotoBottom() {
 	m.MoveDown(len(m.rows))
 }
 
-// Mark the current cursor position to indicate that the underlying
-// document will be deleted.
+// Mark the current cursor position to select the underlying document
+// for deletion or labeling.
 func (m *Model) Mark() {
 	if m.cursor < 0 || m.cursor >= len(m.rows) {
 		return
@@ -537,7 +784,8 @@ func (m Model) headersView() string {
 	return lipgloss.JoinHorizontal(lipgloss.Left, s...)
 }
 
-func wrapText(text string, maxLen int) string {
+// WrapText reflows text into lines of at most maxLen characters.
+func WrapText(text string, maxLen int) string {
 	var result strings.Builder
 	var currentLine strings.Builder
 	words := strings.Fields(text)
@@ -561,12 +809,16 @@ func (m Model) expandedView() string {
 		return ""
 	}
 	data := []string{}
-	for i, column := range m.cols {
-		if column.Title == "Message" {
-			data = append(data, "------\n", column.Title, ":\n\n", wrapText(row[i], 60), "\n")
-			continue
+	if m.expandFn != nil {
+		data = append(data, m.expandFn(row))
+	} else {
+		for i, column := range m.cols {
+			if column.Title == "Message" {
+				data = append(data, "------\n", column.Title, ":\n\n", WrapText(row[i], 60), "\n")
+				continue
+			}
+			data = append(data, column.Title, ": ", row[i], "\n")
 		}
-		data = append(data, column.Title, ": ", row[i], "\n")
 	}
 
 	deleteButton := fmt.Sprintf("[ %s ]", blurredStyle.Render("Delete"))
@@ -576,9 +828,22 @@ func (m Model) expandedView() string {
 	} else {
 		cancelButton = focusedStyle.Render("[ Cancel ]")
 	}
+	if m.deleteFn == nil {
+		deleteButton = ""
+	}
+	errMsg, help := "", ""
+	if m.err != nil {
+		errMsg = "\n" + errStyle.Render(m.err.Error())
+	}
+	if m.flash != "" {
+		errMsg += "\n" + flashStyle.Render("● "+m.flash)
+	}
+	if m.replyFn != nil {
+		help = blurredStyle.Render("\n[a] Reply")
+	}
 
 	return baseStyle.Render(strings.Join(data[:], "")) + "\n" +
-		cancelButton + deleteButton
+		cancelButton + deleteButton + errMsg + help
 }
 
 func (m *Model) renderRow(r int) string {
@@ -0,0 +1,58 @@
+package table
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"slices"
+	"testing"
+)
+
+// press sends the keys to the model, one after another.
+func press(m Model, keys ...string) Model {
+	for _, k := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		if k == "enter" {
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		}
+		m.Focus()
+		m, _ = m.Update(msg)
+	}
+	return m
+}
+
+func TestMarkAndLabel(t *testing.T) {
+	rows := []Row{{"1", "first"}, {"2", "second"}, {"3", "third"}}
+	tests := []struct {
+		name    string
+		delete  bool
+		keys    []string
+		labeled []string
+	}{
+		{"selected row", false, []string{"l", "x", "enter"}, []string{"1"}},
+		{"marked rows without delete", false, []string{"d", "d", "l", "x", "enter"},
+			[]string{"1", "2"}},
+		{"marked rows with delete", true, []string{"d", "j", "d", "l", "x", "enter"},
+			[]string{"1", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var labeled []string
+			opts := []Option{
+				WithColumns([]Column{{Title: "ID", Width: 4}, {Title: "Subject", Width: 10}}),
+				WithRows(rows),
+				WithLabelFn(func(rows []Row, label string) error {
+					for _, row := range rows {
+						labeled = append(labeled, row[0])
+					}
+					return nil
+				}),
+			}
+			if tt.delete {
+				opts = append(opts, WithDeleteFn(func([]Row) error { return nil }))
+			}
+			press(New(opts...), tt.keys...)
+			if !slices.Equal(labeled, tt.labeled) {
+				t.Errorf("labeled %q, want %q", labeled, tt.labeled)
+			}
+		})
+	}
+}
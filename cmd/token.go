@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/client"
+	"github.com/zeim839/mailbox/data"
+	"os"
+	"strings"
+)
+
+var (
+	tokenScopes  []string
+	tokenMailbox string
+	tokenExpires string
+)
+
+func init() {
+	tokenCreateCmd.Flags().StringSliceVarP(&tokenScopes, "scope", "s",
+		[]string{data.ScopeRead}, "Token scopes (read, status, reply, delete, admin)")
+	tokenCreateCmd.Flags().StringVarP(&tokenMailbox, "mailbox", "b", "",
+		"Restrict the token to a single mailbox")
+	tokenCreateCmd.Flags().StringVarP(&tokenExpires, "expires", "e", "",
+		"Token lifetime, e.g. \"720h\" (default never)")
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens for automated clients",
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		tokens, err := apiClient.Tokens(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, t := range tokens {
+			expires := "never"
+			if !t.Expires.IsZero() {
+				expires = t.Expires.Format("2006-01-02 15:04")
+			}
+			if t.Expired() {
+				expires += " (expired)"
+			}
+			mailbox := t.Mailbox
+			if mailbox == "" {
+				mailbox = "*"
+			}
+			fmt.Printf("%s  %-20s owner=%s scopes=%s mailbox=%s expires=%s\n",
+				t.ID, t.Name, t.Owner, strings.Join(t.Scopes, ","),
+				mailbox, expires)
+		}
+	},
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create an API token",
+	Long: `Create an API token. The token is printed once and cannot be
+retrieved again. Pass it to mbx with "--token" or the MBX_TOKEN
+environment variable, or send it as an "Authorization: Bearer"
+header.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		secret, _, err := apiClient.CreateToken(context.Background(), client.TokenRequest{
+			Name:      args[0],
+			Scopes:    tokenScopes,
+			Mailbox:   tokenMailbox,
+			ExpiresIn: tokenExpires,
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(secret)
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke [id]",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		if err := apiClient.DeleteToken(context.Background(), args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Token successfully revoked")
+	},
+}
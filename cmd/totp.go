@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mdp/qrterminal/v3"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func init() {
+	totpCmd.AddCommand(totpEnrollCmd)
+	totpCmd.AddCommand(totpDisableCmd)
+	userCmd.AddCommand(totpCmd)
+}
+
+var totpCmd = &cobra.Command{
+	Use:   "totp",
+	Short: "Manage two-factor authentication",
+}
+
+var totpEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Enable two-factor authentication for your account",
+	Long: `Enable TOTP two-factor authentication for the logged in
+user. Scan the QR code with an authenticator app and enter
+the code it shows. Once enabled, basic auth is refused for
+the account and "mbx login" must be used instead.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		me := fetchWhoAmI()
+		if me.Username == "" {
+			fmt.Println("Error: not logged in")
+			os.Exit(1)
+		}
+		ctx := context.Background()
+		enrollment, err := apiClient.EnrollTOTP(ctx, me.Username)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		qrterminal.GenerateHalfBlock(enrollment.URL, qrterminal.L, os.Stdout)
+		fmt.Println("Scan the QR code above, or enter this secret manually:")
+		fmt.Println(enrollment.Secret)
+		fmt.Println()
+
+		code := prompt("Authentication code: ")
+		recoveryCodes, err := apiClient.EnableTOTP(ctx, me.Username, code)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Two-factor authentication enabled. Store these single-use")
+		fmt.Println("recovery codes somewhere safe:")
+		fmt.Println()
+		for _, code := range recoveryCodes {
+			fmt.Println("  " + code)
+		}
+	},
+}
+
+var totpDisableCmd = &cobra.Command{
+	Use:   "disable [username]",
+	Short: "Disable two-factor authentication",
+	Long: `Disable two-factor authentication. If no username is given,
+it is disabled for the logged in user. Admins may disable it
+for other users.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		username := ""
+		if len(args) == 1 {
+			username = args[0]
+		} else {
+			username = fetchWhoAmI().Username
+		}
+		if username == "" {
+			fmt.Println("Error: no username given")
+			os.Exit(1)
+		}
+		if err := apiClient.DisableTOTP(context.Background(), username); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Two-factor authentication disabled for %q\n", username)
+	},
+}
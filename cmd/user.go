@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/data"
+	"os"
+)
+
+var userRole string
+
+func init() {
+	userAddCmd.Flags().StringVarP(&userRole, "role", "r", data.RoleViewer,
+		"The user's role (viewer, responder, admin)")
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userRemoveCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userRoleCmd)
+	rootCmd.AddCommand(userCmd)
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the server's administrator accounts",
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List administrator accounts",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		users, err := apiClient.Users(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, user := range users {
+			role := user.Role
+			if role == "" {
+				role = data.RoleAdmin
+			}
+			fmt.Printf("%-32s %-10s created %s\n", user.Username, role,
+				user.Created.Format("2006-01-02 15:04"))
+		}
+	},
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add [username]",
+	Short: "Create an administrator account",
+	Long: `Create an administrator account. The new user's password
+is read from the terminal.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		password := readNewPassword()
+		err := apiClient.CreateUser(context.Background(), args[0], password, userRole)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("User %q successfully created\n", args[0])
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove [username]",
+	Short: "Remove an administrator account",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		if err := apiClient.DeleteUser(context.Background(), args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("User %q successfully removed\n", args[0])
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd [username]",
+	Short: "Change an administrator's password",
+	Long: `Change an administrator's password. If no username is given,
+the password of the user set by "--username" is changed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		username := usr
+		if len(args) == 1 {
+			username = args[0]
+		}
+		if username == "" {
+			fmt.Println("Error: no username given")
+			os.Exit(1)
+		}
+		password := readNewPassword()
+		err := apiClient.SetPassword(context.Background(), username, password)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Password of %q successfully changed\n", username)
+	},
+}
+
+var userRoleCmd = &cobra.Command{
+	Use:   "role [username] [role]",
+	Short: "Change an administrator's role",
+	Long: `Change an administrator's role. Viewers may list and read
+entries, responders may also change their status, and admins
+may perform every action.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		err := apiClient.SetRole(context.Background(), args[0], args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Role of %q successfully changed to %s\n", args[0], args[1])
+	},
+}
+
+// readNewPassword prompts for a new password twice and exits if the
+// inputs do not match.
+func readNewPassword() string {
+	password, err := readPassword("New password: ")
+	if err != nil {
+		fmt.Println("Error reading password:", err)
+		os.Exit(1)
+	}
+	confirm, err := readPassword("Confirm password: ")
+	if err != nil {
+		fmt.Println("Error reading password:", err)
+		os.Exit(1)
+	}
+	if password != confirm {
+		fmt.Println("Error: passwords do not match")
+		os.Exit(1)
+	}
+	return password
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/client"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+var (
+	watchJSON bool
+	watchExec string
+)
+
+func init() {
+	watchCmd.Flags().StringVarP(&box, "mailbox", "b", "", "Only watch the given mailbox")
+	watchCmd.Flags().BoolVar(&watchJSON, "json", false, "Print each submission as a line of JSON")
+	watchCmd.Flags().StringVar(&watchExec, "exec", "", "Run a shell command for each submission, with the submission as JSON on stdin")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print contact form submissions as they arrive",
+	Long: `Print contact form submissions as they arrive, until
+interrupted. Submissions are printed one per line, or as JSON
+lines with --json. With --exec, a shell command is run for each
+submission, with the submission as JSON on stdin and its ID and
+mailbox in $MBX_ENTRY_ID and $MBX_MAILBOX. Lost connections are
+retried with increasing delays.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		ctx, stop := signal.NotifyContext(context.Background(),
+			os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		apiClient.Watch(ctx, func(change data.Change) {
+			if change.Type != data.ChangeCreated {
+				return
+			}
+			if box != "" && change.Entry.Mailbox != box {
+				return
+			}
+			if err := printSubmission(change.Entry); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if watchExec == "" {
+				return
+			}
+			if err := runSubmissionHook(ctx, watchExec, change.Entry); err != nil {
+				fmt.Fprintln(os.Stderr, "Error running the hook:", err)
+			}
+		}, func(err error) {
+			// Retrying does not fix rejected credentials or servers
+			// that cannot stream events.
+			var apiErr *client.Error
+			if errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError &&
+				apiErr.Status != http.StatusTooManyRequests {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(os.Stderr, "Connection lost, reconnecting:", err)
+		})
+	},
+}
+
+// printSubmission prints the submission to stdout, in the format that
+// was selected by the flags.
+func printSubmission(form data.Form) error {
+	if watchJSON {
+		content, err := json.Marshal(form)
+		if err != nil {
+			return fmt.Errorf("error encoding the submission: %s", err)
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	fmt.Printf("%s  %s  %-12s %s  %s\n", form.Created.Local().Format("2006-01-02 15:04"),
+		form.ID, form.Mailbox, form.From, form.Subject)
+	return nil
+}
+
+// runSubmissionHook runs the shell command with the submission as JSON
+// on stdin. The command's output is passed through.
+func runSubmissionHook(ctx context.Context, command string, form data.Form) error {
+	content, err := json.Marshal(form)
+	if err != nil {
+		return err
+	}
+	shell := exec.CommandContext(ctx, "sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		shell = exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	shell.Stdin = bytes.NewReader(append(content, '\n'))
+	shell.Stdout, shell.Stderr = os.Stdout, os.Stderr
+	shell.Env = append(os.Environ(), "MBX_ENTRY_ID="+form.ID,
+		"MBX_MAILBOX="+form.Mailbox)
+	return shell.Run()
+}
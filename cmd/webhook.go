@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zeim839/mailbox/data"
+	"os"
+)
+
+var (
+	deliveryStatus string
+	deliveryPage   int
+)
+
+func init() {
+	webhookDeliveriesCmd.Flags().StringVarP(&deliveryStatus, "status", "s", "",
+		"Only list pending, succeeded or failed deliveries")
+	webhookDeliveriesCmd.Flags().IntVarP(&deliveryPage, "page", "p", 0,
+		"Page number")
+	webhookCmd.AddCommand(webhookDeliveriesCmd)
+	webhookCmd.AddCommand(webhookShowCmd)
+	webhookCmd.AddCommand(webhookRedeliverCmd)
+	rootCmd.AddCommand(webhookCmd)
+}
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Inspect and redeliver webhook deliveries",
+}
+
+var webhookDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "List webhook deliveries, most recent first",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		page, err := apiClient.Deliveries(context.Background(), deliveryStatus,
+			int64(deliveryPage))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, d := range page.Deliveries {
+			fmt.Printf("%s  %s  %-9s %-14s entry=%s attempts=%d %s\n",
+				d.ID, d.Created.Format("2006-01-02 15:04"), d.Status,
+				d.Event, d.EntryID, d.Attempts, d.URL)
+		}
+		fmt.Printf("Page %d of %d\n", page.Page, page.PageCount+1)
+	},
+}
+
+var webhookShowCmd = &cobra.Command{
+	Use:   "show [id]",
+	Short: "Show a webhook delivery and its payload",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		d, err := apiClient.Delivery(context.Background(), args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		printDelivery(d)
+	},
+}
+
+var webhookRedeliverCmd = &cobra.Command{
+	Use:   "redeliver [id]",
+	Short: "Resend a webhook delivery",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAPI()
+		d, err := apiClient.Redeliver(context.Background(), args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Delivery %s %s after %d attempts\n", d.ID, d.Status,
+			d.Attempts)
+	},
+}
+
+// printDelivery writes a delivery record to standard output.
+func printDelivery(d data.Delivery) {
+	fmt.Println("ID:      ", d.ID)
+	fmt.Println("Event:   ", d.Event)
+	fmt.Println("Entry:   ", d.EntryID)
+	fmt.Println("URL:     ", d.URL)
+	fmt.Println("Status:  ", d.Status)
+	fmt.Println("Attempts:", d.Attempts)
+	if d.StatusCode != 0 {
+		fmt.Println("Response:", d.StatusCode)
+	}
+	if d.Error != "" {
+		fmt.Println("Error:   ", d.Error)
+	}
+	fmt.Println("Created: ", d.Created.Format("2006-01-02 15:04:05"))
+	fmt.Println("Updated: ", d.Updated.Format("2006-01-02 15:04:05"))
+	fmt.Println()
+	fmt.Println(d.Payload)
+}
@@ -1,15 +1,79 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/zeim839/mailbox/data"
+	"strings"
+	"time"
+)
 
 // Config defines the configuration parameters for a Mailbox server.
 type Config struct {
-	MongoURI      string `mapstructure:"MONGO_URI"`
-	GinMode       string `mapstructure:"GIN_MODE"`
-	Port          string `mapstructure:"PORT"`
-	Username      string `mapstructure:"USERNAME"`
-	Password      string `mapstructure:"PASSWORD"`
-	CaptchaSecret string `mapstructure:"CAPTCHA_SECRET"`
+	MongoURI      string        `mapstructure:"MONGO_URI"`
+	GinMode       string        `mapstructure:"GIN_MODE"`
+	Port          string        `mapstructure:"PORT"`
+	Proxies       string        `mapstructure:"TRUSTED_PROXIES"`
+	Username      string        `mapstructure:"USERNAME"`
+	Password      string        `mapstructure:"PASSWORD"`
+	CaptchaSecret string        `mapstructure:"CAPTCHA_SECRET"`
+	SessionTTL    time.Duration `mapstructure:"SESSION_TTL"`
+	OIDCIssuer    string        `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID  string        `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCAudience  string        `mapstructure:"OIDC_AUDIENCE"`
+	OIDCGroups    string        `mapstructure:"OIDC_GROUPS_CLAIM"`
+	OIDCRoles     string        `mapstructure:"OIDC_ROLES"`
+	SMTPHost      string        `mapstructure:"SMTP_HOST"`
+	SMTPPort      string        `mapstructure:"SMTP_PORT"`
+	SMTPUsername  string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword  string        `mapstructure:"SMTP_PASSWORD"`
+	SMTPFrom      string        `mapstructure:"SMTP_FROM"`
+	SMTPSecurity  string        `mapstructure:"SMTP_TLS"`
+	NotifyTo      string        `mapstructure:"NOTIFY_RECIPIENTS"`
+	NotifySubject string        `mapstructure:"NOTIFY_SUBJECT"`
+	NotifyBody    string        `mapstructure:"NOTIFY_BODY"`
+	WebhookURLs   string        `mapstructure:"WEBHOOK_URLS"`
+	WebhookSecret string        `mapstructure:"WEBHOOK_SECRET"`
+	WebhookEvents string        `mapstructure:"WEBHOOK_EVENTS"`
+	WebhookFlow   bool          `mapstructure:"WEBHOOK_WORKFLOW"`
+	SlackURL      string        `mapstructure:"SLACK_WEBHOOK_URL"`
+	MattermostURL string        `mapstructure:"MATTERMOST_WEBHOOK_URL"`
+	DiscordURL    string        `mapstructure:"DISCORD_WEBHOOK_URL"`
+	MatrixServer  string        `mapstructure:"MATRIX_HOMESERVER"`
+	MatrixToken   string        `mapstructure:"MATRIX_TOKEN"`
+	MatrixRoom    string        `mapstructure:"MATRIX_ROOM"`
+	ChatRoutes    string        `mapstructure:"CHAT_MAILBOXES"`
+	ChatInterval  time.Duration `mapstructure:"CHAT_INTERVAL"`
+	AckEnabled    bool          `mapstructure:"ACK_ENABLED"`
+	AckTemplates  string        `mapstructure:"ACK_TEMPLATES"`
+	AckMailboxes  string        `mapstructure:"ACK_MAILBOXES"`
+	AckInterval   time.Duration `mapstructure:"ACK_INTERVAL"`
+	AckMaxHourly  int           `mapstructure:"ACK_MAX_PER_HOUR"`
+	ReplyAddress  string        `mapstructure:"REPLY_ADDRESS"`
+	ReplySecret   string        `mapstructure:"REPLY_SECRET"`
+	InboundAddr   string        `mapstructure:"INBOUND_ADDR"`
+	InboundDomain string        `mapstructure:"INBOUND_DOMAIN"`
+	InboundRcpts  string        `mapstructure:"INBOUND_RECIPIENTS"`
+	InboundSize   int64         `mapstructure:"INBOUND_MAX_SIZE"`
+	InboundCert   string        `mapstructure:"INBOUND_TLS_CERT"`
+	InboundKey    string        `mapstructure:"INBOUND_TLS_KEY"`
+	IMAPAddr      string        `mapstructure:"IMAP_ADDR"`
+	IMAPDomain    string        `mapstructure:"IMAP_DOMAIN"`
+	IMAPCert      string        `mapstructure:"IMAP_TLS_CERT"`
+	IMAPKey       string        `mapstructure:"IMAP_TLS_KEY"`
+	IMAPInsecure  bool          `mapstructure:"IMAP_INSECURE_AUTH"`
+	Digests       string        `mapstructure:"DIGESTS"`
+	DigestTime    string        `mapstructure:"DIGEST_TIME"`
+	DigestWeekday string        `mapstructure:"DIGEST_WEEKDAY"`
+	DigestSubject string        `mapstructure:"DIGEST_SUBJECT"`
+	DigestBody    string        `mapstructure:"DIGEST_BODY"`
+	OutboxWorkers int           `mapstructure:"OUTBOX_WORKERS"`
+	OutboxTries   int           `mapstructure:"OUTBOX_ATTEMPTS"`
+	States        string        `mapstructure:"WORKFLOW_STATES"`
+	Transitions   string        `mapstructure:"WORKFLOW_TRANSITIONS"`
+	ClosedStates  string        `mapstructure:"WORKFLOW_CLOSED"`
+	SLA           time.Duration `mapstructure:"SLA"`
+	AuditFile     string        `mapstructure:"AUDIT_LOG_FILE"`
 }
 
 // LoadConfig fetches a configuration from the given directory path.
@@ -20,11 +84,224 @@ func LoadConfig(path string) (config Config, err error) {
 	viper.AutomaticEnv()
 	viper.SetDefault("PORT", "8080")
 	viper.SetDefault("GIN_MODE", "debug")
+	viper.SetDefault("TRUSTED_PROXIES", "")
 	viper.SetDefault("CAPTCHA_SECRET", "")
+	viper.SetDefault("SESSION_TTL", "1h")
+	viper.SetDefault("OIDC_ISSUER", "")
+	viper.SetDefault("OIDC_CLIENT_ID", "")
+	viper.SetDefault("OIDC_AUDIENCE", "")
+	viper.SetDefault("OIDC_GROUPS_CLAIM", "groups")
+	viper.SetDefault("OIDC_ROLES", "")
+	viper.SetDefault("SMTP_HOST", "")
+	viper.SetDefault("SMTP_PORT", "587")
+	viper.SetDefault("SMTP_USERNAME", "")
+	viper.SetDefault("SMTP_PASSWORD", "")
+	viper.SetDefault("SMTP_FROM", "")
+	viper.SetDefault("SMTP_TLS", "starttls")
+	viper.SetDefault("NOTIFY_RECIPIENTS", "")
+	viper.SetDefault("NOTIFY_SUBJECT", "")
+	viper.SetDefault("NOTIFY_BODY", "")
+	viper.SetDefault("WEBHOOK_URLS", "")
+	viper.SetDefault("WEBHOOK_SECRET", "")
+	viper.SetDefault("WEBHOOK_EVENTS", "")
+	viper.SetDefault("WEBHOOK_WORKFLOW", false)
+	viper.SetDefault("SLACK_WEBHOOK_URL", "")
+	viper.SetDefault("MATTERMOST_WEBHOOK_URL", "")
+	viper.SetDefault("DISCORD_WEBHOOK_URL", "")
+	viper.SetDefault("MATRIX_HOMESERVER", "")
+	viper.SetDefault("MATRIX_TOKEN", "")
+	viper.SetDefault("MATRIX_ROOM", "")
+	viper.SetDefault("CHAT_MAILBOXES", "")
+	viper.SetDefault("CHAT_INTERVAL", "30s")
+	viper.SetDefault("ACK_ENABLED", false)
+	viper.SetDefault("ACK_TEMPLATES", "")
+	viper.SetDefault("ACK_MAILBOXES", "")
+	viper.SetDefault("ACK_INTERVAL", "24h")
+	viper.SetDefault("ACK_MAX_PER_HOUR", 100)
+	viper.SetDefault("REPLY_ADDRESS", "")
+	viper.SetDefault("REPLY_SECRET", "")
+	viper.SetDefault("INBOUND_ADDR", "")
+	viper.SetDefault("INBOUND_DOMAIN", "localhost")
+	viper.SetDefault("INBOUND_RECIPIENTS", "")
+	viper.SetDefault("INBOUND_MAX_SIZE", 10<<20)
+	viper.SetDefault("INBOUND_TLS_CERT", "")
+	viper.SetDefault("INBOUND_TLS_KEY", "")
+	viper.SetDefault("IMAP_ADDR", "")
+	viper.SetDefault("IMAP_DOMAIN", "localhost")
+	viper.SetDefault("IMAP_TLS_CERT", "")
+	viper.SetDefault("IMAP_TLS_KEY", "")
+	viper.SetDefault("IMAP_INSECURE_AUTH", false)
+	viper.SetDefault("DIGESTS", "")
+	viper.SetDefault("DIGEST_TIME", "08:00")
+	viper.SetDefault("DIGEST_WEEKDAY", "monday")
+	viper.SetDefault("DIGEST_SUBJECT", "")
+	viper.SetDefault("DIGEST_BODY", "")
+	viper.SetDefault("OUTBOX_WORKERS", 4)
+	viper.SetDefault("OUTBOX_ATTEMPTS", 8)
+	viper.SetDefault("WORKFLOW_STATES", "")
+	viper.SetDefault("WORKFLOW_TRANSITIONS", "")
+	viper.SetDefault("WORKFLOW_CLOSED", "")
+	viper.SetDefault("SLA", "0")
+	viper.SetDefault("AUDIT_LOG_FILE", "")
 	err = viper.ReadInConfig()
 	if err != nil {
 		return
 	}
 	err = viper.Unmarshal(&config)
+	if config.OIDCAudience == "" {
+		config.OIDCAudience = config.OIDCClientID
+	}
 	return
 }
+
+// TrustedProxies returns the addresses and CIDR ranges of the proxies
+// whose forwarding headers are trusted, as configured by
+// TRUSTED_PROXIES.
+func (c Config) TrustedProxies() []string {
+	return splitList(c.Proxies)
+}
+
+// OIDCRoleMap maps identity provider groups to Mailbox roles, as
+// configured by OIDC_ROLES.
+func (c Config) OIDCRoleMap() map[string]string {
+	return parseMap(c.OIDCRoles)
+}
+
+// NotifyRecipients maps mailboxes to the email addresses notified of
+// new entries, as configured by NOTIFY_RECIPIENTS.
+func (c Config) NotifyRecipients() map[string][]string {
+	return parseList(c.NotifyTo)
+}
+
+// Webhooks returns the webhook endpoint URLs and the event types sent
+// to them, as configured by WEBHOOK_URLS and WEBHOOK_EVENTS.
+func (c Config) Webhooks() (urls, events []string) {
+	return splitList(c.WebhookURLs), splitList(c.WebhookEvents)
+}
+
+// AckMailboxList returns the mailboxes whose submitters are sent an
+// acknowledgement, as configured by ACK_MAILBOXES. An empty list means
+// every mailbox.
+func (c Config) AckMailboxList() []string {
+	return splitList(c.AckMailboxes)
+}
+
+// ChatMailboxes returns the mailboxes announced in the given chat
+// service, as configured by CHAT_MAILBOXES, and whether the service
+// announces any mailbox at all. A nil list means every mailbox.
+func (c Config) ChatMailboxes(service string) ([]string, bool) {
+	if strings.TrimSpace(c.ChatRoutes) == "" {
+		return nil, true
+	}
+	var mailboxes []string
+	for mailbox, services := range parseList(c.ChatRoutes) {
+		for _, s := range services {
+			if s != service {
+				continue
+			}
+			if mailbox == "*" {
+				return nil, true
+			}
+			mailboxes = append(mailboxes, mailbox)
+		}
+	}
+	return mailboxes, len(mailboxes) > 0
+}
+
+// InboundRecipients maps the lowercase addresses that the SMTP
+// listener accepts mail for to mailboxes, as configured by
+// INBOUND_RECIPIENTS.
+func (c Config) InboundRecipients() map[string]string {
+	m := map[string]string{}
+	for addr, mailbox := range parseMap(c.InboundRcpts) {
+		m[strings.ToLower(addr)] = mailbox
+	}
+	return m
+}
+
+// DigestSchedules maps mailboxes to the frequency of their digests,
+// daily or weekly, as configured by DIGESTS.
+func (c Config) DigestSchedules() map[string]string {
+	return parseMap(c.Digests)
+}
+
+// DigestSchedule returns the time of day, since midnight, that digests
+// are sent at and the weekday of weekly digests, as configured by
+// DIGEST_TIME and DIGEST_WEEKDAY.
+func (c Config) DigestSchedule() (time.Duration, time.Weekday, error) {
+	t, err := time.Parse("15:04", c.DigestTime)
+	if err != nil {
+		return 0, 0, fmt.Errorf("DIGEST_TIME must be formatted as HH:MM, got %q", c.DigestTime)
+	}
+	at := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), c.DigestWeekday) {
+			return at, day, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("DIGEST_WEEKDAY must be a day of the week, got %q", c.DigestWeekday)
+}
+
+// Workflow returns the workflow of entries, as configured by
+// WORKFLOW_STATES, WORKFLOW_TRANSITIONS, WORKFLOW_CLOSED and SLA.
+// Without WORKFLOW_STATES, empty settings default to those of
+// data.DefaultWorkflow. With it, entries may move between any of the
+// states unless WORKFLOW_TRANSITIONS is set, and none of them are
+// closed unless WORKFLOW_CLOSED is set.
+func (c Config) Workflow() (data.Workflow, error) {
+	w := data.DefaultWorkflow()
+	if strings.TrimSpace(c.States) != "" {
+		w.States = splitList(c.States)
+		w.Transitions = map[string][]string{"*": w.States}
+		w.Closed = nil
+	}
+	if strings.TrimSpace(c.Transitions) != "" {
+		w.Transitions = parseList(c.Transitions)
+	}
+	if strings.TrimSpace(c.ClosedStates) != "" {
+		w.Closed = splitList(c.ClosedStates)
+	}
+	w.SLA = c.SLA
+	if err := w.Validate(); err != nil {
+		return data.Workflow{}, fmt.Errorf("invalid workflow: %w", err)
+	}
+	return w, nil
+}
+
+// splitList parses a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseList parses a list of "key:value;value" pairs separated by
+// commas.
+func parseList(s string) map[string][]string {
+	m := map[string][]string{}
+	for key, values := range parseMap(s) {
+		for _, value := range strings.Split(values, ";") {
+			if value = strings.TrimSpace(value); value != "" {
+				m[key] = append(m[key], value)
+			}
+		}
+	}
+	return m
+}
+
+// parseMap parses a list of "key:value" pairs separated by commas.
+func parseMap(s string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		m[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return m
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"github.com/zeim839/mailbox/data"
+	"slices"
+	"testing"
+)
+
+func TestWorkflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Config
+		allowed [][2]string
+		denied  [][2]string
+		closed  []string
+		wantErr bool
+	}{
+		{
+			name:    "default",
+			allowed: [][2]string{{"new", "in-progress"}, {"closed", "in-progress"}},
+			denied:  [][2]string{{"closed", "new"}},
+			closed:  data.DefaultClosed,
+		},
+		{
+			name:    "custom states",
+			c:       Config{States: "open,waiting,done"},
+			allowed: [][2]string{{"open", "done"}, {"done", "open"}, {"waiting", "open"}},
+		},
+		{
+			name: "custom states and transitions",
+			c: Config{
+				States:       "open,waiting,done",
+				Transitions:  "open:waiting;done,waiting:done,*:open",
+				ClosedStates: "done",
+			},
+			allowed: [][2]string{{"open", "waiting"}, {"done", "open"}},
+			denied:  [][2]string{{"done", "waiting"}},
+			closed:  []string{"done"},
+		},
+		{
+			name:    "custom transitions",
+			c:       Config{Transitions: "new:closed,closed:new"},
+			allowed: [][2]string{{"closed", "new"}},
+			denied:  [][2]string{{"new", "in-progress"}},
+			closed:  data.DefaultClosed,
+		},
+		{
+			name:    "unknown state",
+			c:       Config{States: "open,done", ClosedStates: "closed"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := tt.c.Workflow()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Workflow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, move := range tt.allowed {
+				if !w.Allowed(move[0], move[1]) {
+					t.Errorf("Allowed(%q, %q) = false", move[0], move[1])
+				}
+			}
+			for _, move := range tt.denied {
+				if w.Allowed(move[0], move[1]) {
+					t.Errorf("Allowed(%q, %q) = true", move[0], move[1])
+				}
+			}
+			if !tt.wantErr && !slices.Equal(w.Closed, tt.closed) {
+				t.Errorf("Closed = %q, want %q", w.Closed, tt.closed)
+			}
+		})
+	}
+}
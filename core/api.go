@@ -0,0 +1,259 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIPrefix is the path prefix of the current version of the API.
+const APIPrefix = "/api/v1"
+
+// Route describes an API route, for both routing and documentation.
+type Route struct {
+	Method string
+
+	// Path is the route's path under APIPrefix, e.g. "/entries/:id".
+	Path string
+
+	// Legacy is the route's unversioned path (if any), which is
+	// served as a deprecated alias.
+	Legacy string
+
+	// Summary briefly describes the route in the API document.
+	Summary string
+
+	// Public routes do not require authentication. Others require
+	// the Scope (if set).
+	Public bool
+	Scope  string
+
+	// Query, Request and Response are samples of the query
+	// parameters, request body and response payload (if any), from
+	// which the API document's schemas are derived. Samples may be
+	// values of any JSON-encodable type, or gin.H maps of samples.
+	Query    gin.H
+	Request  any
+	Response any
+
+	// Stream routes respond with server-sent events, each carrying
+	// a Response.
+	Stream bool
+
+	Handler gin.HandlerFunc
+}
+
+// errorStatus corrects the status of responses that fail with
+// well-known errors, or errors wrapping them.
+var errorStatus = []struct {
+	err    error
+	status int
+}{
+	{data.ErrMongoNotFound, http.StatusNotFound},
+	{data.ErrMongoInvalidID, http.StatusNotFound},
+	{data.ErrMongoDuplicate, http.StatusConflict},
+	{data.ErrMongoConflict, http.StatusConflict},
+	{data.ErrMongoInternal, http.StatusInternalServerError},
+	{data.ErrMongoFailCreate, http.StatusServiceUnavailable},
+	{data.ErrMongoFailUpdate, http.StatusServiceUnavailable},
+	{data.ErrMongoFailDelete, http.StatusServiceUnavailable},
+	{data.ErrMongoUIDConflict, http.StatusServiceUnavailable},
+	{ErrDispatch, http.StatusServiceUnavailable},
+	{notify.ErrQueueNotDead, http.StatusConflict},
+	{notify.ErrWebhookUnknown, http.StatusConflict},
+}
+
+// fail responds with err and the given status. The error is recorded
+// on the context, so that Envelope may correct the status.
+func fail(c *gin.Context, status int, err error) {
+	c.Error(err)
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// Mount registers the routes under APIPrefix, along with the API
+// document, and under their legacy paths as deprecated aliases. Routes
+// that are not public are audited, including those that fail to
+// authenticate, and require auth (if not nil).
+func Mount(r gin.IRouter, routes []Route, auth gin.HandlerFunc) {
+	for _, route := range routes {
+		handlers := []gin.HandlerFunc{}
+		if !route.Public {
+			handlers = append(handlers, AuditMw())
+		}
+		if !route.Public && auth != nil {
+			handlers = append(handlers, auth)
+		}
+		if route.Scope != "" {
+			handlers = append(handlers, ScopeMw(route.Scope))
+		}
+		handlers = append(handlers, route.Handler)
+		r.Handle(route.Method, APIPrefix+route.Path,
+			append([]gin.HandlerFunc{Envelope()}, handlers...)...)
+		if route.Legacy != "" {
+			r.Handle(route.Method, route.Legacy,
+				append([]gin.HandlerFunc{Deprecated(APIPrefix + route.Path)}, handlers...)...)
+		}
+	}
+	r.GET(APIPrefix+"/openapi.json", OpenAPI(routes))
+}
+
+// Deprecated returns a Gin middleware that marks responses as
+// deprecated, linking to the successor route at path.
+func Deprecated(path string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, param := range c.Params {
+			path = strings.Replace(path, ":"+param.Key,
+				url.PathEscape(param.Value), 1)
+		}
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+path+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
+
+// Envelope returns a Gin middleware that wraps the responses of the
+// handlers that follow it in JSON envelopes. Successful responses carry
+// their payload under "data", and failed ones an "error" object with
+// the HTTP status, a code derived from it, a message and any other
+// details. The status of well-known errors recorded with fail is
+// corrected. Event streams are passed through.
+func Envelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &envelopeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if w.stream {
+			return
+		}
+		c.Writer = w.ResponseWriter
+		c.Writer.Header().Del("Content-Type")
+		status, body := w.Status(), bytes.TrimSpace(w.body.Bytes())
+
+		if status < http.StatusBadRequest {
+			var payload any
+			if json.Valid(body) {
+				payload = json.RawMessage(body)
+			} else if len(body) > 0 {
+				payload = string(body)
+			}
+			c.JSON(status, gin.H{"data": payload})
+			return
+		}
+
+		message, details := http.StatusText(status), gin.H{}
+		if err := json.Unmarshal(body, &details); err == nil {
+			if msg, ok := details["error"].(string); ok {
+				message = msg
+				delete(details, "error")
+			}
+		} else if len(body) > 0 {
+			message = string(body)
+		}
+		if err := c.Errors.Last(); err != nil {
+			for _, known := range errorStatus {
+				if errors.Is(err.Err, known.err) {
+					status = known.status
+					break
+				}
+			}
+		}
+		apiErr := gin.H{
+			"status":  status,
+			"code":    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+			"message": message,
+		}
+		if len(details) > 0 {
+			apiErr["details"] = details
+		}
+		c.JSON(status, gin.H{"error": apiErr})
+	}
+}
+
+// envelopeWriter buffers a response so that Envelope may wrap it, until
+// the response turns out to be an event stream.
+type envelopeWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+	stream bool
+}
+
+// streaming reports whether the response is an event stream, which is
+// written through as soon as it is detected.
+func (w *envelopeWriter) streaming() bool {
+	if !w.stream && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+	return w.stream
+}
+
+func (w *envelopeWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	w.streaming()
+}
+
+func (w *envelopeWriter) WriteHeaderNow() {
+	if w.streaming() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if w.streaming() {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *envelopeWriter) Flush() {
+	if w.streaming() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *envelopeWriter) Status() int {
+	if w.stream {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *envelopeWriter) Size() int {
+	if w.stream {
+		return w.ResponseWriter.Size()
+	}
+	if w.body.Len() == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *envelopeWriter) Written() bool {
+	if w.stream {
+		return w.ResponseWriter.Written()
+	}
+	return w.status != 0 || w.body.Len() > 0
+}
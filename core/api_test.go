@@ -0,0 +1,68 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		status  int
+		message string
+	}{
+		{"success", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"id": "abc"})
+		}, http.StatusOK, ""},
+		{"known error", func(c *gin.Context) {
+			fail(c, http.StatusBadRequest, data.ErrMongoNotFound)
+		}, http.StatusNotFound, data.ErrMongoNotFound.Error()},
+		{"wrapped known error", func(c *gin.Context) {
+			fail(c, http.StatusBadRequest, fmt.Errorf("entry: %w", data.ErrMongoConflict))
+		}, http.StatusConflict, "entry: " + data.ErrMongoConflict.Error()},
+		{"other error", func(c *gin.Context) {
+			fail(c, http.StatusBadRequest, errors.New("'status' is required"))
+		}, http.StatusBadRequest, "'status' is required"},
+		{"same message", func(c *gin.Context) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.ErrMongoNotFound.Error()})
+		}, http.StatusBadRequest, data.ErrMongoNotFound.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+			r.GET("/", Envelope(), tt.handler)
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body struct {
+				Data  map[string]any `json:"data"`
+				Error *struct {
+					Status  int    `json:"status"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid envelope %s: %v", w.Body, err)
+			}
+			if tt.message == "" {
+				if body.Error != nil || body.Data["id"] != "abc" {
+					t.Errorf("envelope = %s, want the payload under data", w.Body)
+				}
+				return
+			}
+			if body.Error == nil || body.Error.Status != tt.status ||
+				body.Error.Message != tt.message {
+				t.Errorf("envelope = %s, want error %d %q", w.Body, tt.status, tt.message)
+			}
+		})
+	}
+}
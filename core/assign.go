@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"time"
+)
+
+// MaxNotes is the maximum number of notes that an entry may have.
+var MaxNotes = 500
+
+// assignRequest defines the JSON body accepted by Assign.
+type assignRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+// noteRequest defines the JSON body accepted by AddNote.
+type noteRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// Assign returns a Gin middleware that assigns the entry referenced by
+// the "id" route parameter to a user, and notifies n (if not nil) of the
+// change. The assignee must be a registered user or the caller, while
+// an empty assignee unassigns the entry. The change is recorded in the
+// entry's history.
+func Assign(db data.Data, users data.Users, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req assignRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if req.Assignee != "" && req.Assignee != c.GetString(UserKey) {
+			if _, err := users.Read(ctx, req.Assignee); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "'assignee' must be an existing user",
+				})
+				return
+			}
+		}
+		id := c.Param("id")
+		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if form.Assignee != req.Assignee {
+			form, err = patchEntry(ctx, db, n, id, data.Patch{
+				Assignee: &req.Assignee,
+				History: []data.Revision{data.NewRevision("assignee",
+					form.Assignee, req.Assignee, c.GetString(UserKey))},
+				IfAssignee: &form.Assignee,
+			}, notify.EventUpdated, c.GetString(UserKey))
+			if errors.Is(err, data.ErrMongoConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "the entry's assignee changed in the meantime, please try again",
+				})
+				return
+			}
+			if err != nil {
+				fail(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		audit(c, "assign."+req.Assignee, id)
+		c.JSON(http.StatusOK, gin.H{"assignee": form.Assignee})
+	}
+}
+
+// AddNote returns a Gin middleware that adds an internal note, authored
+// by the caller, to the entry referenced by the "id" route parameter,
+// and notifies n (if not nil) of the change. It responds with the note.
+func AddNote(db data.Data, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req noteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		note := data.Note{
+			Author:  c.GetString(UserKey),
+			Body:    req.Body,
+			Created: time.Now().UTC(),
+		}
+		if note.Author == "" {
+			note.Author = "anonymous"
+		}
+		if err := note.Validate(); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		_, err = patchEntry(ctx, db, n, id, data.Patch{Notes: []data.Note{note},
+			MaxNotes: MaxNotes}, notify.EventUpdated, c.GetString(UserKey))
+		if errors.Is(err, data.ErrMongoConflict) {
+			err = errors.New("the entry has too many notes")
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "note", id)
+		c.JSON(http.StatusOK, note)
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"net/http"
+	"testing"
+)
+
+// staleData reads entries as they were before others changed them.
+type staleData struct {
+	*datatest.Data
+	stale data.Form
+}
+
+func (d staleData) Read(context.Context, string) (data.Form, error) {
+	return d.stale, nil
+}
+
+func TestAssign(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales", Assignee: "bob"}
+	users := datatest.NewUsers(data.User{Username: "alice"}, data.User{Username: "bob"})
+	tests := []struct {
+		name     string
+		assignee string
+		mailbox  string
+		code     int
+		want     string
+		history  int
+	}{
+		{"reassign", "alice", "", http.StatusOK, "alice", 1},
+		{"unassign", "", "", http.StatusOK, "", 1},
+		{"unchanged", "bob", "", http.StatusOK, "bob", 0},
+		{"self", "carol", "", http.StatusOK, "carol", 1},
+		{"unknown user", "dave", "", http.StatusBadRequest, "bob", 0},
+		{"restricted mailbox", "alice", "support", http.StatusBadRequest, "bob", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(form)
+			n := &recorder{}
+			values := map[string]any{UserKey: "carol"}
+			if tt.mailbox != "" {
+				values[MailboxKey] = tt.mailbox
+			}
+			w := serve(Assign(db, users, n), "PUT", "/:id", "/"+form.ID,
+				assignRequest{tt.assignee}, values)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			got, _ := db.Read(context.Background(), form.ID)
+			if got.Assignee != tt.want {
+				t.Errorf("assignee = %q, want %q", got.Assignee, tt.want)
+			}
+			if len(got.History) != tt.history || len(n.events) != tt.history {
+				t.Fatalf("%d revisions and %d events, want %d", len(got.History),
+					len(n.events), tt.history)
+			}
+			if tt.history > 0 && got.History[0].From != form.Assignee {
+				t.Errorf("revision from %q, want %q", got.History[0].From, form.Assignee)
+			}
+		})
+	}
+
+	// Assigning an entry that was reassigned since it was read fails,
+	// rather than recording a revision from the wrong assignee.
+	t.Run("reassigned meanwhile", func(t *testing.T) {
+		db := staleData{datatest.NewData(form), form}
+		db.stale.Assignee = "alice"
+		w := serve(Assign(db, users, nil), "PUT", "/:id", "/"+form.ID,
+			assignRequest{"carol"}, map[string]any{UserKey: "carol"})
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+		}
+		got, _ := db.Data.Read(context.Background(), form.ID)
+		if got.Assignee != "bob" || len(got.History) != 0 {
+			t.Errorf("entry was assigned to %q with %d revisions", got.Assignee,
+				len(got.History))
+		}
+	})
+}
+
+func TestAddNote(t *testing.T) {
+	defer func(limit int) { MaxNotes = limit }(MaxNotes)
+	MaxNotes = 2
+
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales"}
+	db := datatest.NewData(form)
+	h := AddNote(db, nil)
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusBadRequest} {
+		w := serve(h, "POST", "/:id", "/"+form.ID, noteRequest{"Called back"},
+			map[string]any{UserKey: "alice"})
+		if w.Code != want {
+			t.Fatalf("note %d: status = %d, want %d: %s", i, w.Code, want, w.Body)
+		}
+	}
+	got, _ := db.Read(context.Background(), form.ID)
+	if len(got.Notes) != MaxNotes {
+		t.Errorf("%d notes, want %d", len(got.Notes), MaxNotes)
+	}
+	if got.Notes[0].Author != "alice" {
+		t.Errorf("note author = %q, want alice", got.Notes[0].Author)
+	}
+
+	w := serve(h, "POST", "/:id", "/"+form.ID, noteRequest{" "}, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("blank note: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// auditedKey is the Gin context key under which audit marks requests
+// whose actions were recorded.
+const auditedKey = "mailbox.audited"
+
+// Auditor appends the actions recorded by Audit to the audit log, and
+// mirrors them to a file as JSON lines (if not nil).
+type Auditor struct {
+	store data.Audits
+	mu    sync.Mutex
+	file  io.Writer
+}
+
+// NewAuditor initializes an Auditor that appends records to store and,
+// if file is not nil, mirrors them to file.
+func NewAuditor(store data.Audits, file io.Writer) *Auditor {
+	return &Auditor{store: store, file: file}
+}
+
+// Record appends the records to the audit log and its mirror. The
+// records are mirrored even if the audit log fails, and the errors of
+// both are returned.
+func (a *Auditor) Record(records ...data.AuditRecord) error {
+	var lines []byte
+	var errs []error
+	if a.file != nil {
+		for _, r := range records {
+			line, err := json.Marshal(r)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			lines = append(append(lines, line...), '\n')
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	errs = append(errs, a.store.Create(ctx, records...))
+	if len(lines) > 0 {
+		a.mu.Lock()
+		_, err := a.file.Write(lines)
+		a.mu.Unlock()
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// auditor is the Auditor that Audit records actions with, if set.
+var auditor atomic.Pointer[Auditor]
+
+// SetAuditor sets the Auditor that Audit records actions with. Actions
+// are always logged, and also recorded with a if it is not nil.
+func SetAuditor(a *Auditor) {
+	auditor.Store(a)
+}
+
+// audit logs an action performed by the authenticated user on the
+// resource with the given id.
+func audit(c *gin.Context, action, id string) {
+	auditAll(c, action, []string{id}, "")
+}
+
+// auditQuery logs an action performed by the authenticated user on no
+// single resource, e.g. a listing, described by detail.
+func auditQuery(c *gin.Context, action, detail string) {
+	auditAll(c, action, []string{""}, detail)
+}
+
+// auditAll logs an action performed by the authenticated user on each
+// of the resources with the given ids, and records them at once. The
+// client's address is only taken from forwarding headers set by
+// trusted proxies.
+func auditAll(c *gin.Context, action string, ids []string, detail string) {
+	user := c.GetString(UserKey)
+	if user == "" {
+		user = "anonymous"
+	}
+	c.Set(auditedKey, true)
+	record(user, action, c.ClientIP(), ids, detail)
+}
+
+// Audit logs an action performed by user on the resource with the
+// given id, from the given address, and records it with the Auditor
+// (if set).
+func Audit(user, action, id, addr string) {
+	record(user, action, addr, []string{id}, "")
+}
+
+// record logs an action performed by user on each of the resources
+// with the given ids, from the given address, and records them with
+// the Auditor (if set).
+func record(user, action, addr string, ids []string, detail string) {
+	records := []data.AuditRecord{}
+	for _, id := range ids {
+		if detail != "" {
+			log.Printf("[AUDIT] user=%q action=%s id=%s detail=%q ip=%s",
+				user, action, id, detail, addr)
+		} else {
+			log.Printf("[AUDIT] user=%q action=%s id=%s ip=%s", user, action, id, addr)
+		}
+		r, err := data.NewAuditRecord(user, action, id, addr)
+		if err != nil {
+			log.Printf("[AUDIT] could not record action %s: %v", action, err)
+			continue
+		}
+		r.Detail = detail
+		records = append(records, r)
+	}
+	a := auditor.Load()
+	if a == nil || len(records) == 0 {
+		return
+	}
+	if err := a.Record(records...); err != nil {
+		log.Printf("[AUDIT] could not record action %s: %v", action, err)
+	}
+}
+
+// AuditMw returns a Gin middleware that audits the requests whose
+// handlers did not, e.g. because they failed or were forbidden. Such
+// requests are recorded by method and route, e.g. "GET /api/v1/users",
+// along with the resource that they refer to: the "id" route parameter,
+// or else the first one (if any). Mounted ahead of authentication, it
+// also records the requests that fail to authenticate.
+func AuditMw() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if !c.GetBool(auditedKey) {
+			audit(c, c.Request.Method+" "+c.FullPath(), auditID(c))
+		}
+	}
+}
+
+// auditID returns the route parameter that identifies the resource of
+// the request, preferring "id".
+func auditID(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	if len(c.Params) > 0 {
+		return c.Params[0].Value
+	}
+	return ""
+}
+
+// ReadAudit returns a Gin middleware that fetches paginated batches of
+// audit records, most recent first, filtered by the "user", "action"
+// and "entry_id" query parameters, and by the "after" and "before"
+// RFC 3339 timestamps.
+func ReadAudit(audits data.Audits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid page number",
+			})
+			return
+		}
+		filter := data.AuditFilter{
+			User:    c.Query("user"),
+			Action:  c.Query("action"),
+			EntryID: c.Query("entry_id"),
+		}
+		for key, t := range map[string]*time.Time{"after": &filter.After,
+			"before": &filter.Before} {
+			if c.Query(key) == "" {
+				continue
+			}
+			if *t, err = time.Parse(time.RFC3339, c.Query(key)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "'" + key + "' must be an RFC 3339 timestamp",
+				})
+				return
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		records, err := audits.ReadAll(ctx, filter, 20, int64(page))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		auditQuery(c, "audit", c.Request.URL.RawQuery)
+		c.JSON(http.StatusOK, gin.H{
+			"page":         page,
+			"page_count":   int64(audits.Count(ctx, filter) / 20),
+			"record_count": len(records),
+			"records":      records,
+		})
+	}
+}
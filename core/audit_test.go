@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingAudits fails to append records.
+type failingAudits struct {
+	*datatest.Audits
+}
+
+func (failingAudits) Create(context.Context, ...data.AuditRecord) error {
+	return data.ErrMongoInternal
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAuditorRecord(t *testing.T) {
+	r, err := data.NewAuditRecord("alice", "delete", "1234", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Records are mirrored even if the audit log fails.
+	var mirror bytes.Buffer
+	err = NewAuditor(failingAudits{datatest.NewAudits()}, &mirror).Record(r)
+	if !errors.Is(err, data.ErrMongoInternal) {
+		t.Errorf("Record() error = %v, want %v", err, data.ErrMongoInternal)
+	}
+	var got data.AuditRecord
+	if err := json.Unmarshal(mirror.Bytes(), &got); err != nil || got.ID != r.ID {
+		t.Errorf("mirrored %q, want record %s", mirror.String(), r.ID)
+	}
+
+	// Records are appended to the audit log even if the mirror fails.
+	audits := datatest.NewAudits()
+	if err := NewAuditor(audits, failingWriter{}).Record(r); err == nil {
+		t.Error("Record() succeeded despite the mirror failing")
+	}
+	if count := audits.Count(context.Background(), data.AuditFilter{}); count != 1 {
+		t.Errorf("%d records, want 1", count)
+	}
+}
+
+func TestAuditMw(t *testing.T) {
+	audits := datatest.NewAudits()
+	SetAuditor(NewAuditor(audits, nil))
+	t.Cleanup(func() { SetAuditor(nil) })
+
+	r := gin.New()
+	r.Use(AuditMw(), func(c *gin.Context) { c.Set(UserKey, "alice") })
+	r.DELETE("/entries/:id", func(c *gin.Context) {
+		audit(c, "delete", c.Param("id"))
+		c.Status(http.StatusOK)
+	})
+	r.GET("/users/:name", func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusForbidden)
+	})
+	for _, req := range [][2]string{{"DELETE", "/entries/1234"}, {"GET", "/users/bob"}} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req[0], req[1], nil))
+	}
+
+	records, _ := audits.ReadAll(context.Background(), data.AuditFilter{}, 10, 0)
+	actions := map[string]string{}
+	for _, record := range records {
+		if record.User != "alice" {
+			t.Errorf("record by %q, want alice", record.User)
+		}
+		actions[record.Action] = record.EntryID
+	}
+	want := map[string]string{"delete": "1234", "GET /users/:name": "bob"}
+	if len(actions) != len(want) {
+		t.Fatalf("recorded %v, want %v", actions, want)
+	}
+	for action, id := range want {
+		if actions[action] != id {
+			t.Errorf("action %q recorded on %q, want %q", action, actions[action], id)
+		}
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	audits := datatest.NewAudits()
+	SetAuditor(NewAuditor(audits, nil))
+	t.Cleanup(func() { SetAuditor(nil) })
+
+	// Forwarding headers are ignored unless set by trusted proxies.
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+	r.GET("/entries", func(c *gin.Context) {
+		auditQuery(c, "list", c.Request.URL.RawQuery)
+	})
+	req := httptest.NewRequest("GET", "/entries?page=2&mailbox=support", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	records, _ := audits.ReadAll(context.Background(), data.AuditFilter{}, 10, 0)
+	if len(records) != 1 {
+		t.Fatalf("%d records, want 1", len(records))
+	}
+	got := records[0]
+	if got.EntryID != "" || got.Detail != "page=2&mailbox=support" {
+		t.Errorf("recorded entry %q with detail %q, want no entry and the query",
+			got.EntryID, got.Detail)
+	}
+	if got.IP != "192.0.2.1" {
+		t.Errorf("IP = %q, want the remote address 192.0.2.1", got.IP)
+	}
+}
+
+func TestReadAudit(t *testing.T) {
+	audits := datatest.NewAudits()
+	now := time.Now().UTC()
+	for i, r := range []data.AuditRecord{
+		{User: "alice", Action: "status.read", EntryID: "1"},
+		{User: "alice", Action: "delete", EntryID: "2"},
+		{User: "bob", Action: "status.unread", EntryID: "1"},
+	} {
+		r.ID = string(rune('a' + i))
+		r.Time = now.Add(time.Duration(i-3) * time.Hour)
+		audits.Create(context.Background(), r)
+	}
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		ids    string
+	}{
+		{"all", "/", http.StatusOK, "cba"},
+		{"user", "/?user=alice", http.StatusOK, "ba"},
+		{"action", "/?action=status", http.StatusOK, "ca"},
+		{"entry", "/?entry_id=2", http.StatusOK, "b"},
+		{"after", "/?after=" + now.Add(-150*time.Minute).Format(time.RFC3339),
+			http.StatusOK, "cb"},
+		{"invalid time", "/?before=yesterday", http.StatusBadRequest, ""},
+		{"invalid page", "/?page=first", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(ReadAudit(audits), "GET", "/", tt.target, nil, nil)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp struct{ Records []data.AuditRecord }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			ids := ""
+			for _, r := range resp.Records {
+				ids += r.ID
+			}
+			if ids != tt.ids {
+				t.Errorf("records %q, want %q", ids, tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"strings"
+)
+
+const (
+	// UserKey is the Gin context key under which authentication
+	// middlewares store the username of the authenticated user.
+	UserKey = "mailbox.user"
+
+	// NameKey is the Gin context key under which authentication
+	// middlewares store the display name of the authenticated user,
+	// if it differs from their username.
+	NameKey = "mailbox.name"
+
+	// ScopesKey is the Gin context key under which authentication
+	// middlewares store the scopes granted to the request.
+	ScopesKey = "mailbox.scopes"
+
+	// MailboxKey is the Gin context key under which authentication
+	// middlewares store the mailbox that the request is restricted
+	// to, if any.
+	MailboxKey = "mailbox.mailbox"
+
+	// TokenKey is the Gin context key under which BearerAuthMw
+	// stores the ID of the API token that authenticated the request.
+	TokenKey = "mailbox.token"
+
+	// SessionKey is the Gin context key under which BearerAuthMw
+	// stores the ID of the login session that authenticated the
+	// request.
+	SessionKey = "mailbox.session"
+)
+
+// AuthMw returns a Gin middleware that accepts either basic auth
+// credentials from the user store, bearer API and session tokens, or,
+// if verifier is not nil, OpenID Connect identity tokens.
+func AuthMw(users data.Users, tokens data.Tokens, verifier *OIDCVerifier) gin.HandlerFunc {
+	basic := BasicAuthMw(users)
+	bearer := BearerAuthMw(tokens, users)
+	var oidc gin.HandlerFunc
+	if verifier != nil {
+		oidc = OIDCAuthMw(verifier)
+	}
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		switch {
+		case oidc != nil && strings.HasPrefix(header, "Bearer ") &&
+			IsJWT(strings.TrimPrefix(header, "Bearer ")):
+			oidc(c)
+		case strings.HasPrefix(header, "Bearer "):
+			bearer(c)
+		default:
+			basic(c)
+		}
+	}
+}
+
+// BasicAuthMw returns a Gin middleware that implements the basic
+// authorization scheme. Credentials are checked against the given
+// user store. Users with two-factor authentication enabled are
+// rejected, since basic auth cannot carry a second factor; they must
+// log in for a session token instead.
+func BasicAuthMw(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: need username and password",
+			})
+			return
+		}
+
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) != 2 || parts[0] != "Basic" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: scheme must be Basic",
+			})
+			return
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: could not decode base64",
+			})
+			return
+		}
+
+		credentials := strings.SplitN(string(decoded), ":", 2)
+		if len(credentials) != 2 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: wrong credentials",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, status, err := checkPassword(ctx, users, credentials[0], credentials[1])
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if user.TOTPEnabled {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: two-factor authentication is enabled, log in for a session token",
+			})
+			return
+		}
+
+		if user.FailedLogins > 0 {
+			users.LoginSucceeded(ctx, user.Username)
+		}
+		c.Set(UserKey, user.Username)
+		c.Set(ScopesKey, user.Scopes())
+		c.Next()
+	}
+}
+
+// checkPassword reads the user and checks their password, refusing
+// users that are locked out. Wrong passwords count towards the lockout.
+// Callers must reset the count once the user is fully authenticated.
+// It returns the status and error to respond with if the check fails.
+func checkPassword(ctx context.Context, users data.Users, username, password string) (data.User, int, error) {
+	// An unknown user yields an empty User, whose password check
+	// still costs a full bcrypt comparison.
+	user, err := users.Read(ctx, username)
+	if err != nil {
+		user.CheckPassword(password)
+		return user, http.StatusUnauthorized, errors.New("Unauthorized: wrong credentials")
+	}
+	if user.Locked() {
+		return user, http.StatusTooManyRequests,
+			errors.New("too many failed logins, please try again later")
+	}
+	if !user.CheckPassword(password) {
+		users.LoginFailed(ctx, user.Username)
+		return user, http.StatusUnauthorized, errors.New("Unauthorized: wrong credentials")
+	}
+	return user, http.StatusOK, nil
+}
+
+// BearerAuthMw returns a Gin middleware that authenticates requests
+// bearing an API token from the given token store. The token's scopes,
+// limited to those of its owner's role, and its mailbox restriction
+// are attached to the request.
+func BearerAuthMw(tokens data.Tokens, users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.Header("WWW-Authenticate", `Bearer realm="Restricted"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: scheme must be Bearer",
+			})
+			return
+		}
+
+		id, secret, err := data.ParseToken(parts[1])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: " + err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		token, err := tokens.Read(ctx, id)
+		if err != nil || !token.Check(secret) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: invalid or expired token",
+			})
+			return
+		}
+
+		// Tokens outlive neither their owner nor their owner's role.
+		owner, err := users.Read(ctx, token.Owner)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: token owner no longer exists",
+			})
+			return
+		}
+
+		c.Set(UserKey, token.Owner)
+		c.Set(ScopesKey, intersectScopes(token.Scopes, owner.Scopes()))
+		c.Set(MailboxKey, token.Mailbox)
+		if token.Session {
+			c.Set(SessionKey, token.ID)
+		} else {
+			c.Set(TokenKey, token.ID)
+		}
+		c.Next()
+	}
+}
+
+// ScopeMw returns a Gin middleware that rejects authenticated requests
+// lacking the given scope. Requests are let through when
+// authentication is not configured.
+func ScopeMw(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(ScopesKey); !ok {
+			c.Next()
+			return
+		}
+		if !hasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: missing scope " + scope,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// WhoAmI returns a Gin middleware that describes the authenticated
+// caller, so that clients may hide actions they are not permitted
+// to perform.
+func WhoAmI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes := []string{data.ScopeAdmin}
+		if s, ok := c.Get(ScopesKey); ok {
+			scopes = s.([]string)
+		}
+		name := c.GetString(NameKey)
+		if name == "" {
+			name = c.GetString(UserKey)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"username": c.GetString(UserKey),
+			"name":     name,
+			"scopes":   scopes,
+			"mailbox":  c.GetString(MailboxKey),
+		})
+	}
+}
+
+// isSelf reports whether the request was made by the given local user
+// in person, i.e. with their password or a login session rather than
+// an API token. Identity provider users are never local users.
+func isSelf(c *gin.Context, username string) bool {
+	return c.GetString(UserKey) == username && c.GetString(TokenKey) == "" &&
+		c.GetString(SessionKey) != oidcSession
+}
+
+// intersectScopes returns the scopes in granted that are also implied
+// by owner.
+func intersectScopes(granted, owner []string) []string {
+	if contains(owner, data.ScopeAdmin) {
+		return granted
+	}
+	if contains(granted, data.ScopeAdmin) {
+		return owner
+	}
+	scopes := []string{}
+	for _, s := range granted {
+		if contains(owner, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasScope reports whether the request was granted scope. The admin
+// scope implies every other scope.
+func hasScope(c *gin.Context, scope string) bool {
+	scopes, ok := c.Get(ScopesKey)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes.([]string) {
+		if s == scope || s == data.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccess reports whether the request may access entries filed
+// into the given mailbox.
+func canAccess(c *gin.Context, mailbox string) bool {
+	restricted := c.GetString(MailboxKey)
+	return restricted == "" || restricted == mailbox
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testContext returns a Gin context holding the given values.
+func testContext(values map[string]any) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	for key, value := range values {
+		c.Set(key, value)
+	}
+	return c
+}
+
+func TestIsSelf(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]any
+		username string
+		want     bool
+	}{
+		{"password", map[string]any{UserKey: "alice"}, "alice", true},
+		{"session", map[string]any{UserKey: "alice", SessionKey: "abc"}, "alice", true},
+		{"other user", map[string]any{UserKey: "bob"}, "alice", false},
+		{"api token", map[string]any{UserKey: "alice", TokenKey: "abc"}, "alice", false},
+		{"identity provider", map[string]any{UserKey: "alice",
+			SessionKey: oidcSession}, "alice", false},
+		{"prefixed identity provider", map[string]any{UserKey: OIDCPrefix + "alice",
+			SessionKey: oidcSession}, OIDCPrefix + "alice", false},
+		{"anonymous", map[string]any{}, "alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSelf(testContext(tt.values), tt.username); got != tt.want {
+				t.Errorf("isSelf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeMw(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		scope  string
+		want   int
+	}{
+		{"unscoped", map[string]any{}, data.ScopeDelete, http.StatusOK},
+		{"granted", map[string]any{ScopesKey: []string{data.ScopeRead,
+			data.ScopeDelete}}, data.ScopeDelete, http.StatusOK},
+		{"missing", map[string]any{ScopesKey: []string{data.ScopeRead}},
+			data.ScopeDelete, http.StatusForbidden},
+		{"none", map[string]any{ScopesKey: []string{}}, data.ScopeRead,
+			http.StatusForbidden},
+		{"admin", map[string]any{ScopesKey: []string{data.ScopeAdmin}},
+			data.ScopeDelete, http.StatusOK},
+		{"admin only", map[string]any{ScopesKey: []string{data.ScopeRead,
+			data.ScopeStatus, data.ScopeReply, data.ScopeDelete}},
+			data.ScopeAdmin, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+			r.GET("/", func(c *gin.Context) {
+				for key, value := range tt.values {
+					c.Set(key, value)
+				}
+			}, ScopeMw(tt.scope), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]any
+		mailbox string
+		want    bool
+	}{
+		{"unrestricted", map[string]any{}, "sales", true},
+		{"same mailbox", map[string]any{MailboxKey: "sales"}, "sales", true},
+		{"other mailbox", map[string]any{MailboxKey: "sales"}, "support", false},
+		{"unknown mailbox", map[string]any{MailboxKey: "sales"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canAccess(testContext(tt.values), tt.mailbox); got != tt.want {
+				t.Errorf("canAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
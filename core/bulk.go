@@ -0,0 +1,375 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BulkLimit is the maximum number of entries that a bulk action may
+// change at once.
+var BulkLimit = 1000
+
+// FilterRequest defines the entry filter accepted by ReadAll (as query
+// parameters) and by bulk actions.
+type FilterRequest struct {
+	Mailbox string `json:"mailbox" form:"mailbox"`
+	Status  string `json:"status" form:"status"`
+	Tag     string `json:"tag" form:"tag"`
+
+	// Assignee matches the entries assigned to the user.
+	Assignee string `json:"assignee" form:"assignee"`
+
+	// State matches the entries in the workflow state, and Overdue
+	// those open for longer than the workflow's SLA.
+	State   string `json:"state" form:"state"`
+	Overdue bool   `json:"overdue" form:"overdue"`
+}
+
+// filter validates the request against the workflow w and translates
+// it into a data.Filter, restricted to the caller's mailbox (if any).
+func (f FilterRequest) filter(c *gin.Context, w data.Workflow) (data.Filter, int, error) {
+	if f.Status != "" && f.Status != data.StatusRead && f.Status != data.StatusUnread {
+		return data.Filter{}, http.StatusBadRequest,
+			errors.New("'status' must be one of read or unread")
+	}
+	filter := data.Filter{Mailbox: f.Mailbox, Status: f.Status, Tag: f.Tag,
+		Assignee: f.Assignee}
+	if f.State != "" {
+		if !w.Valid(f.State) {
+			return data.Filter{}, http.StatusBadRequest,
+				errors.New("'state' must be one of " + strings.Join(w.States, ", "))
+		}
+		filter.States = w.Match(f.State)
+	}
+	if f.Overdue && !w.FilterOverdue(&filter, time.Now().UTC()) {
+		return data.Filter{}, http.StatusBadRequest,
+			errors.New("'overdue' requires an SLA and an open state")
+	}
+	if restricted := c.GetString(MailboxKey); restricted != "" {
+		if filter.Mailbox != "" && filter.Mailbox != restricted {
+			return data.Filter{}, http.StatusForbidden,
+				errors.New("Forbidden: token is restricted to mailbox " + restricted)
+		}
+		filter.Mailbox = restricted
+	}
+	return filter, http.StatusOK, nil
+}
+
+// BulkRequest selects the entries of a bulk action, either by ID or by
+// filter.
+type BulkRequest struct {
+	IDs    []string       `json:"ids"`
+	Filter *FilterRequest `json:"filter"`
+
+	// Status is set by status actions.
+	Status string `json:"status,omitempty"`
+
+	// Add and Remove list the tags set and cleared by tag actions.
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+
+	// Mailbox is the destination of move actions.
+	Mailbox string `json:"mailbox,omitempty"`
+}
+
+// BulkItem reports the outcome of a bulk action on an entry.
+type BulkItem struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkResponse reports the outcome of a bulk action on every selected
+// entry.
+type BulkResponse struct {
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	Results   []BulkItem `json:"results"`
+}
+
+// bulkAction describes how a bulk action changes the selected entries.
+type bulkAction struct {
+	// audit names the action in the audit log, and event is the type
+	// of the events dispatched for the entries that changed.
+	audit string
+	event string
+
+	// apply changes the entries with the given IDs at once, and
+	// returns the IDs of those it found.
+	apply func(ctx context.Context, ids []string) ([]string, error)
+
+	// change applies the action to the copy of an entry sent with its
+	// event, and reports whether the entry changed.
+	change func(form *data.Form) bool
+}
+
+// bulk returns a Gin middleware that selects entries by ID or by
+// filter, then applies the action to all of them at once and reports
+// the outcome per entry. The request is validated by check (if not
+// nil) before any entry is changed.
+func bulk(db data.Data, w data.Workflow, n notify.Notifier,
+	check func(*gin.Context, BulkRequest) (int, error),
+	action func(BulkRequest) bulkAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BulkRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if (len(req.IDs) == 0) == (req.Filter == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "exactly one of 'ids' or 'filter' is required",
+			})
+			return
+		}
+		if len(req.IDs) > BulkLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("at most %d entries may be changed at once", BulkLimit),
+			})
+			return
+		}
+		if check != nil {
+			if status, err := check(c, req); err != nil {
+				fail(c, status, err)
+				return
+			}
+		}
+		entries, status, err := selectEntries(c, db, w, req)
+		if err != nil {
+			fail(c, status, err)
+			return
+		}
+
+		act := action(req)
+		ids := []string{}
+		for _, sel := range entries {
+			if sel.err == nil {
+				ids = append(ids, sel.id)
+			}
+		}
+		found := map[string]bool{}
+		if len(ids) > 0 {
+			// The entries are changed, and the events of those that
+			// changed queued, in the same transaction.
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+			var done []string
+			err := db.Transact(ctx, func(ctx context.Context) error {
+				var err error
+				if done, err = act.apply(ctx, ids); err != nil {
+					return err
+				}
+				clear(found)
+				events := []notify.Event{}
+				for _, id := range done {
+					found[id] = true
+				}
+				for _, sel := range entries {
+					if found[sel.id] && act.change(&sel.form) {
+						events = append(events, notify.NewEvent(act.event,
+							sel.form, c.GetString(UserKey)))
+					}
+				}
+				return Dispatch(ctx, n, events...)
+			})
+			cancel()
+			if errors.Is(err, ErrDispatch) {
+				fail(c, http.StatusBadRequest, err)
+				return
+			}
+			if err != nil {
+				clear(found)
+			} else {
+				auditAll(c, act.audit, done, "")
+			}
+			for i := range entries {
+				switch {
+				case err != nil && entries[i].err == nil:
+					entries[i].err = err
+				case entries[i].err == nil && !found[entries[i].id]:
+					entries[i].err = data.ErrMongoNotFound
+				}
+			}
+		}
+
+		resp := BulkResponse{Results: []BulkItem{}}
+		for _, sel := range entries {
+			item := BulkItem{ID: sel.id}
+			if sel.err != nil {
+				item.Error = sel.err.Error()
+				resp.Failed++
+			} else {
+				item.OK = true
+				resp.Succeeded++
+			}
+			resp.Results = append(resp.Results, item)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// selected is an entry selected by a bulk request, or the error that
+// prevented reading it.
+type selected struct {
+	id   string
+	form data.Form
+	err  error
+}
+
+// selectEntries reads the entries selected by a bulk request. Entries
+// selected by ID that cannot be read are reported individually, while
+// filters that match more than BulkLimit entries are refused.
+func selectEntries(c *gin.Context, db data.Data, w data.Workflow, req BulkRequest) ([]selected, int, error) {
+	filter := data.Filter{IDs: []string{}}
+	if req.Filter != nil {
+		var status int
+		var err error
+		if filter, status, err = req.Filter.filter(c, w); err != nil {
+			return nil, status, err
+		}
+	}
+	seen := map[string]bool{}
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if req.Filter != nil {
+		if count := db.Count(ctx, filter); count > int64(BulkLimit) {
+			return nil, http.StatusBadRequest, fmt.Errorf(
+				"the filter matches %d entries, but at most %d may be changed at once",
+				count, BulkLimit)
+		}
+	}
+	forms, err := db.ReadAll(ctx, filter, int64(BulkLimit), 0)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	entries := []selected{}
+	if req.Filter != nil {
+		for _, form := range forms {
+			entries = append(entries, selected{id: form.ID, form: form})
+		}
+		return entries, http.StatusOK, nil
+	}
+
+	byID := map[string]data.Form{}
+	for _, form := range forms {
+		byID[form.ID] = form
+	}
+	for _, id := range filter.IDs {
+		form, ok := byID[id]
+		sel := selected{id: id, form: form}
+		if !ok || !canAccess(c, form.Mailbox) {
+			sel.err = data.ErrMongoNotFound
+		}
+		entries = append(entries, sel)
+	}
+	return entries, http.StatusOK, nil
+}
+
+// BulkDelete returns a Gin middleware that deletes the selected
+// entries and notifies n (if not nil) of each deleted entry.
+func BulkDelete(db data.Data, w data.Workflow, n notify.Notifier) gin.HandlerFunc {
+	return bulk(db, w, n, nil, func(req BulkRequest) bulkAction {
+		return bulkAction{
+			audit:  "delete",
+			event:  notify.EventDeleted,
+			apply:  db.DeleteAll,
+			change: func(*data.Form) bool { return true },
+		}
+	})
+}
+
+// BulkStatus returns a Gin middleware that sets the status of the
+// selected entries to read or unread, and notifies n (if not nil) of
+// each change.
+func BulkStatus(db data.Data, w data.Workflow, n notify.Notifier) gin.HandlerFunc {
+	check := func(c *gin.Context, req BulkRequest) (int, error) {
+		if req.Status != data.StatusRead && req.Status != data.StatusUnread {
+			return http.StatusBadRequest, errors.New("'status' must be one of read or unread")
+		}
+		return http.StatusOK, nil
+	}
+	return bulk(db, w, n, check, func(req BulkRequest) bulkAction {
+		return bulkAction{
+			audit: "status." + req.Status,
+			event: notify.EventStatusChanged,
+			apply: patchAll(db, data.Patch{Status: &req.Status}),
+			change: func(form *data.Form) bool {
+				changed := form.Status != req.Status
+				form.Status = req.Status
+				return changed
+			},
+		}
+	})
+}
+
+// BulkTag returns a Gin middleware that adds and removes tags of the
+// selected entries, and notifies n (if not nil) of each change.
+func BulkTag(db data.Data, w data.Workflow, n notify.Notifier) gin.HandlerFunc {
+	check := func(c *gin.Context, req BulkRequest) (int, error) {
+		if len(req.Add) == 0 && len(req.Remove) == 0 {
+			return http.StatusBadRequest, errors.New("one of 'add' or 'remove' is required")
+		}
+		if err := data.ValidateTags(append(req.Add, req.Remove...)); err != nil {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusOK, nil
+	}
+	return bulk(db, w, n, check, func(req BulkRequest) bulkAction {
+		return bulkAction{
+			audit: "tag",
+			event: notify.EventUpdated,
+			apply: patchAll(db, data.Patch{AddTags: req.Add, RemoveTags: req.Remove}),
+			change: func(form *data.Form) bool {
+				return form.Tag(req.Add, req.Remove)
+			},
+		}
+	})
+}
+
+// BulkMove returns a Gin middleware that moves the selected entries to
+// another mailbox, and notifies n (if not nil) of each change.
+func BulkMove(db data.Data, w data.Workflow, n notify.Notifier) gin.HandlerFunc {
+	check := func(c *gin.Context, req BulkRequest) (int, error) {
+		if !data.ValidMailbox(req.Mailbox) {
+			return http.StatusBadRequest, errors.New("'mailbox' must be a valid mailbox name")
+		}
+		if !canAccess(c, req.Mailbox) {
+			return http.StatusForbidden, errors.New(
+				"Forbidden: token is restricted to mailbox " + c.GetString(MailboxKey))
+		}
+		return http.StatusOK, nil
+	}
+	return bulk(db, w, n, check, func(req BulkRequest) bulkAction {
+		return bulkAction{
+			audit: "move." + req.Mailbox,
+			event: notify.EventUpdated,
+			apply: patchAll(db, data.Patch{Mailbox: &req.Mailbox}),
+			change: func(form *data.Form) bool {
+				changed := form.Mailbox != req.Mailbox
+				form.Mailbox = req.Mailbox
+				return changed
+			},
+		}
+	})
+}
+
+// patchAll returns a bulk action's apply function that patches the
+// entries with p.
+func patchAll(db data.Data, p data.Patch) func(context.Context, []string) ([]string, error) {
+	return func(ctx context.Context, ids []string) ([]string, error) {
+		return db.PatchAll(ctx, ids, p)
+	}
+}
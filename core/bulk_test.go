@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// recorder is a notifier that records every event.
+type recorder struct {
+	events []notify.Event
+}
+
+func (n *recorder) Notify(_ context.Context, e notify.Event) error {
+	n.events = append(n.events, e)
+	return nil
+}
+
+func TestBulk(t *testing.T) {
+	forms := []data.Form{
+		{ID: "000000000000000000000001", Mailbox: "sales", Tags: []string{"lead"}},
+		{ID: "000000000000000000000002", Mailbox: "sales", Status: data.StatusRead},
+		{ID: "000000000000000000000003", Mailbox: "support", Tags: []string{"bug"}},
+	}
+	w := data.DefaultWorkflow()
+	tests := []struct {
+		name    string
+		handler func(data.Data, data.Workflow, notify.Notifier) gin.HandlerFunc
+		req     BulkRequest
+		mailbox string
+		code    int
+		ok      []bool
+		events  int
+		check   func(t *testing.T, db data.Data)
+	}{
+		{"status by id", BulkStatus, BulkRequest{Status: data.StatusRead,
+			IDs: []string{forms[0].ID, forms[1].ID, "missing"}}, "",
+			http.StatusOK, []bool{true, true, false}, 1,
+			func(t *testing.T, db data.Data) {
+				wantStatus(t, db, forms[0].ID, data.StatusRead)
+			}},
+		{"status by filter", BulkStatus, BulkRequest{Status: data.StatusRead,
+			Filter: &FilterRequest{Mailbox: "support"}}, "",
+			http.StatusOK, []bool{true}, 1,
+			func(t *testing.T, db data.Data) {
+				wantStatus(t, db, forms[2].ID, data.StatusRead)
+				wantStatus(t, db, forms[0].ID, data.StatusUnread)
+			}},
+		{"invalid status", BulkStatus, BulkRequest{Status: "archived",
+			IDs: []string{forms[0].ID}}, "", http.StatusBadRequest, nil, 0, nil},
+		{"ids and filter", BulkStatus, BulkRequest{Status: data.StatusRead,
+			IDs: []string{forms[0].ID}, Filter: &FilterRequest{}}, "",
+			http.StatusBadRequest, nil, 0, nil},
+		{"tag", BulkTag, BulkRequest{Add: []string{"vip", "bug"}, Remove: []string{"lead", "bug"},
+			IDs: []string{forms[0].ID, forms[2].ID}}, "",
+			http.StatusOK, []bool{true, true}, 2,
+			func(t *testing.T, db data.Data) {
+				wantTags(t, db, forms[0].ID, "vip")
+				wantTags(t, db, forms[2].ID, "vip")
+			}},
+		{"tag nothing", BulkTag, BulkRequest{IDs: []string{forms[0].ID}}, "",
+			http.StatusBadRequest, nil, 0, nil},
+		{"move", BulkMove, BulkRequest{Mailbox: "archive",
+			IDs: []string{forms[0].ID, forms[2].ID}}, "",
+			http.StatusOK, []bool{true, true}, 2,
+			func(t *testing.T, db data.Data) {
+				wantCount(t, db, data.Filter{Mailbox: "archive"}, 2)
+			}},
+		{"move out of restricted mailbox", BulkMove, BulkRequest{Mailbox: "archive",
+			IDs: []string{forms[0].ID}}, "sales", http.StatusForbidden, nil, 0, nil},
+		{"delete restricted", BulkDelete, BulkRequest{
+			IDs: []string{forms[0].ID, forms[2].ID}}, "sales",
+			http.StatusOK, []bool{true, false}, 1,
+			func(t *testing.T, db data.Data) {
+				wantCount(t, db, data.Filter{}, 2)
+				wantCount(t, db, data.Filter{Mailbox: "support"}, 1)
+			}},
+		{"filter outside restricted mailbox", BulkDelete, BulkRequest{
+			Filter: &FilterRequest{Mailbox: "support"}}, "sales",
+			http.StatusForbidden, nil, 0, nil},
+		{"delete by filter", BulkDelete, BulkRequest{
+			Filter: &FilterRequest{Tag: "lead"}}, "",
+			http.StatusOK, []bool{true}, 1,
+			func(t *testing.T, db data.Data) {
+				wantCount(t, db, data.Filter{}, 2)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(forms...)
+			n := &recorder{}
+			values := map[string]any{UserKey: "alice"}
+			if tt.mailbox != "" {
+				values[MailboxKey] = tt.mailbox
+			}
+			rec := serve(tt.handler(db, w, n), "POST", "/", "/", tt.req, values)
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if len(n.events) != tt.events {
+				t.Errorf("notified %d events, want %d", len(n.events), tt.events)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp BulkResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			ok := []bool{}
+			for _, item := range resp.Results {
+				ok = append(ok, item.OK)
+			}
+			if !slices.Equal(ok, tt.ok) {
+				t.Errorf("results = %v, want %v", ok, tt.ok)
+			}
+			tt.check(t, db)
+		})
+	}
+}
+
+func TestBulkLimit(t *testing.T) {
+	defer func(limit int) { BulkLimit = limit }(BulkLimit)
+	BulkLimit = 1
+
+	db := datatest.NewData(data.Form{}, data.Form{})
+	h := BulkStatus(db, data.DefaultWorkflow(), nil)
+	req := BulkRequest{Status: data.StatusRead, Filter: &FilterRequest{}}
+	if w := serve(h, "POST", "/", "/", req, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	wantCount(t, db, data.Filter{Status: data.StatusRead}, 0)
+}
+
+func wantStatus(t *testing.T, db data.Data, id, status string) {
+	t.Helper()
+	form, err := db.Read(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Status != status {
+		t.Errorf("entry %s has status %q, want %q", id, form.Status, status)
+	}
+}
+
+func wantTags(t *testing.T, db data.Data, id string, tags ...string) {
+	t.Helper()
+	form, err := db.Read(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(form.Tags, tags) {
+		t.Errorf("entry %s has tags %v, want %v", id, form.Tags, tags)
+	}
+}
+
+func wantCount(t *testing.T, db data.Data, filter data.Filter, count int64) {
+	t.Helper()
+	if got := db.Count(context.Background(), filter); got != count {
+		t.Errorf("%d entries match, want %d", got, count)
+	}
+}
+
+func TestBulkNotifyFailure(t *testing.T) {
+	db := datatest.NewData(data.Form{}, data.Form{})
+	h := BulkStatus(db, data.DefaultWorkflow(), &failingNotifier{})
+	req := BulkRequest{Status: data.StatusRead, Filter: &FilterRequest{}}
+	if w := serve(h, "POST", "/", "/", req, nil); w.Code == http.StatusOK {
+		t.Errorf("status = %d, want an error", w.Code)
+	}
+	wantCount(t, db, data.Filter{Status: data.StatusRead}, 0)
+}
@@ -2,119 +2,96 @@ package core
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
 // Timeout is the time to wait before canceling a database transaction.
 var Timeout = 2 * time.Second
 
-// BasicAuthMw returns a Gin middleware that implements the basic
-// authorization scheme. username and password define the expected
-// credentials.
-func BasicAuthMw(username, password string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized: need username and password",
-			})
-			return
-		}
-
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Basic" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized: scheme must be Basic",
-			})
-			return
-		}
-
-		decoded, err := base64.StdEncoding.DecodeString(parts[1])
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized: could not decode base64",
-			})
-			return
-		}
+// ErrDispatch is returned when the notifications of a change cannot be
+// queued. The change is undone where the database supports transactions
+// (see Transact), so that clients may retry it.
+var ErrDispatch = errors.New("notifications could not be queued, please try again")
 
-		credentials := strings.SplitN(string(decoded), ":", 2)
-		if len(credentials) != 2 || credentials[0] != username || credentials[1] != password {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized: wrong credentials",
-			})
-			return
-		}
-
-		c.Next()
-	}
-}
-
-// Create returns a gin middleware that creates a new mailbox entry.
-func Create(db data.Data) gin.HandlerFunc {
+// Create returns a gin middleware that creates a new mailbox entry and
+// notifies n (if not nil) of it.
+func Create(db data.Data, n notify.Notifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var form data.Form
 		if err := c.ShouldBindJSON(&form); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
-		if err := form.Validate(); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
-			return
-		}
-		form.ID = "" // Remove the ID attribute.
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if _, err := db.Create(ctx, form); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+		// Remove server-managed attributes.
+		if _, err := Submit(ctx, db, n, form.Submission()); err != nil {
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
 		c.String(http.StatusOK, "")
 	}
 }
 
+// Submit validates a submission and files it as a new entry, notifying
+// n (if not nil) in the same transaction. It returns the ID of the new
+// entry. Callers must discard the fields that submitters may not set,
+// e.g. with data.Form.Submission.
+func Submit(ctx context.Context, db data.Data, n notify.Notifier, form data.Form) (string, error) {
+	if err := form.Validate(); err != nil {
+		reject(ctx, n, form)
+		return "", err
+	}
+	form.ID, form.Status = "", ""
+	form.Created = time.Now().UTC()
+	err := db.Transact(ctx, func(ctx context.Context) error {
+		id, err := db.Create(ctx, form)
+		if err != nil {
+			return err
+		}
+		form.ID = id
+		return Dispatch(ctx, n, notify.NewEvent(notify.EventCreated, form, ""))
+	})
+	if err != nil {
+		return "", err
+	}
+	return form.ID, nil
+}
+
 // CreateWithCaptcha returns a gin middleware that creates a new mailbox
-// entry, but only if the associated captcha token is valid.
-func CreateWithCaptcha(db data.Data, secret string) gin.HandlerFunc {
+// entry, but only if the associated captcha token is valid. The
+// notifier n (if not nil) is notified of the entry.
+func CreateWithCaptcha(db data.Data, secret string, n notify.Notifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var form data.FormWithCaptcha
 		if err := c.ShouldBindJSON(&form); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
 		if err := form.Validate(); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+			reject(ctx, n, form.Form)
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
-		form.ID = "" // Remove the ID attribute.
 		if !validateCaptcha(secret, form.Captcha, c.ClientIP()) {
+			reject(ctx, n, form.Form)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "failed to validate captcha",
 			})
 			return
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-		defer cancel()
-		if _, err := db.Create(ctx, form.Form); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+		// Remove server-managed attributes.
+		if _, err := Submit(ctx, db, n, form.Submission()); err != nil {
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
 		c.String(http.StatusOK, "")
@@ -122,8 +99,9 @@ func CreateWithCaptcha(db data.Data, secret string) gin.HandlerFunc {
 }
 
 // ReadAll returns a Gin middleware that fetches paginated batches of
-// mailbox entries.
-func ReadAll(db data.Data) gin.HandlerFunc {
+// mailbox entries, filtered by the query parameters of FilterRequest.
+// Entries are annotated with their state in the workflow w.
+func ReadAll(db data.Data, w data.Workflow) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		pageStr := c.DefaultQuery("page", "0")
 		page, err := strconv.Atoi(pageStr)
@@ -133,53 +111,171 @@ func ReadAll(db data.Data) gin.HandlerFunc {
 			})
 			return
 		}
+		var req FilterRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		filter, status, err := req.filter(c, w)
+		if err != nil {
+			fail(c, status, err)
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
 		defer cancel()
-		forms, err := db.ReadAll(ctx, 20, int64(page))
+		forms, err := db.ReadAll(ctx, filter, 20, int64(page))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
+		auditQuery(c, "list", c.Request.URL.RawQuery)
+		now := time.Now().UTC()
+		for i := range forms {
+			w.Annotate(&forms[i], now)
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"page":        page,
-			"page_count":  int64(db.Count(ctx) / 20),
+			"page_count":  int64(db.Count(ctx, filter) / 20),
 			"entry_count": len(forms),
 			"entries":     forms,
 		})
 	}
 }
 
-// Read returns a Gin middleware that fetches a mailbox entry by its ID.
-func Read(db data.Data) gin.HandlerFunc {
+// Read returns a Gin middleware that fetches a mailbox entry by its ID,
+// annotated with its state in the workflow w.
+func Read(db data.Data, w data.Workflow) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
 		defer cancel()
 		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
 		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "read", id)
+		w.Annotate(&form, time.Now().UTC())
+		c.JSON(http.StatusOK, form)
+	}
+}
+
+// statusRequest defines the JSON body accepted by UpdateStatus.
+type statusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// UpdateStatus returns a Gin middleware that sets the status of a
+// mailbox entry, referenced by its ID, to read or unread, and notifies
+// n (if not nil) of the change.
+func UpdateStatus(db data.Data, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req statusRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if req.Status != data.StatusRead && req.Status != data.StatusUnread {
 			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
+				"error": "'status' must be one of read or unread",
 			})
 			return
 		}
-		c.JSON(http.StatusOK, form)
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if form.Status != req.Status {
+			_, err = patchEntry(ctx, db, n, id, data.Patch{Status: &req.Status},
+				notify.EventStatusChanged, c.GetString(UserKey))
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "status."+req.Status, id)
+		c.String(http.StatusOK, "")
 	}
 }
 
-// Delete returns a Gin middleware that deletes a mailbox entry by its ID.
-func Delete(db data.Data) gin.HandlerFunc {
+// Delete returns a Gin middleware that deletes a mailbox entry by its
+// ID and notifies n (if not nil) of the deleted entry.
+func Delete(db data.Data, n notify.Notifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
 		defer cancel()
-		if err := db.Delete(ctx, id); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-			})
+		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		err = db.Transact(ctx, func(ctx context.Context) error {
+			if err := db.Delete(ctx, id); err != nil {
+				return err
+			}
+			return Dispatch(ctx, n, notify.NewEvent(notify.EventDeleted, form,
+				c.GetString(UserKey)))
+		})
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
 			return
 		}
+		audit(c, "delete", id)
 		c.String(http.StatusOK, "")
 	}
 }
+
+// patchEntry applies p to the entry with the given id and notifies n
+// (if not nil) of the change, caused by user, with an event of the given
+// type, in the same transaction. It returns the changed entry.
+func patchEntry(ctx context.Context, db data.Data, n notify.Notifier, id string,
+	p data.Patch, eventType, user string) (data.Form, error) {
+	var form data.Form
+	err := db.Transact(ctx, func(ctx context.Context) error {
+		var err error
+		if form, err = db.Patch(ctx, id, p); err != nil {
+			return err
+		}
+		return Dispatch(ctx, n, notify.NewEvent(eventType, form, user))
+	})
+	return form, err
+}
+
+// reject notifies n (if not nil) of a rejected submission. Queues
+// only store jobs for it for the targets that want rejections, i.e.
+// digests, so that spam does not fill the outbox. Since nothing is
+// saved, failures are only logged.
+func reject(ctx context.Context, n notify.Notifier, form data.Form) {
+	Dispatch(ctx, n, notify.NewEvent(notify.EventRejected, form.Submission(), ""))
+}
+
+// Dispatch hands the events to n (if not nil) at once, which queues
+// them for delivery, and waits until they are queued. Callers dispatch
+// the events of a change in the transaction that makes it, so that the
+// change is undone if they cannot be queued. Failures are logged and
+// returned as ErrDispatch.
+func Dispatch(ctx context.Context, n notify.Notifier, events ...notify.Event) error {
+	if n == nil || len(events) == 0 {
+		return nil
+	}
+	if err := notify.NotifyAll(ctx, n, events); err != nil {
+		log.Printf("[NOTIFY] event=%s id=%s: %s", events[0].Type,
+			events[0].Entry.ID, err)
+		return ErrDispatch
+	}
+	return nil
+}
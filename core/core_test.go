@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve routes a request with the JSON body (if not nil) to h, mounted
+// at route, as a user authenticated with the given context values.
+func serve(h gin.HandlerFunc, method, route, target string, body any,
+	values map[string]any) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(w)
+	r.Handle(method, route, func(c *gin.Context) {
+		for key, value := range values {
+			c.Set(key, value)
+		}
+	}, h)
+	var raw []byte
+	if body != nil {
+		raw, _ = json.Marshal(body)
+	}
+	r.ServeHTTP(w, httptest.NewRequest(method, target, bytes.NewReader(raw)))
+	return w
+}
+
+// failingNotifier fails to queue every event, but counts them.
+type failingNotifier struct {
+	events []notify.Event
+}
+
+func (n *failingNotifier) Notify(_ context.Context, e notify.Event) error {
+	n.events = append(n.events, e)
+	return errors.New("outbox unavailable")
+}
+
+func TestNotifyFailure(t *testing.T) {
+	submission := data.Form{From: "jane@example.com", Subject: "Hello", Message: "Hi there"}
+	tests := []struct {
+		name    string
+		handler func(data.Data, notify.Notifier) gin.HandlerFunc
+		method  string
+		route   string
+		body    any
+	}{
+		{"create", Create, "POST", "/", submission},
+		{"delete", Delete, "DELETE", "/:id", nil},
+		{"status", UpdateStatus, "PUT", "/:id", statusRequest{data.StatusRead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(submission)
+			forms, _ := db.ReadAll(context.Background(), data.Filter{}, 1, 0)
+			n := &failingNotifier{}
+			target := strings.Replace(tt.route, ":id", forms[0].ID, 1)
+
+			// Changes whose notifications cannot be queued fail and
+			// are undone, so that clients may retry them.
+			r := gin.New()
+			r.Handle(tt.method, tt.route, Envelope(), tt.handler(db, n))
+			var raw []byte
+			if tt.body != nil {
+				raw, _ = json.Marshal(tt.body)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, target, bytes.NewReader(raw)))
+			if w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want %d: %s", w.Code,
+					http.StatusServiceUnavailable, w.Body)
+			}
+			if len(n.events) != 1 {
+				t.Errorf("notified %d events, want 1", len(n.events))
+			}
+			got, _ := db.ReadAll(context.Background(), data.Filter{}, 10, 0)
+			if len(got) != 1 || got[0].Status != data.StatusUnread {
+				t.Errorf("entries = %+v, want the unchanged submission", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"time"
+)
+
+// EventsKeepalive is the interval between comments sent to keep idle
+// event streams open through proxies.
+var EventsKeepalive = 30 * time.Second
+
+// Events returns a Gin middleware that streams changes to entries as
+// server-sent events. Clients resume after the change named by the
+// Last-Event-ID header or the "last_event_id" query parameter. Tokens
+// restricted to a mailbox only receive the changes to its entries, and
+// not the deletions of entries whose mailbox is unknown. Entries are
+// streamed without their notes, and without their assignee and history
+// unless the "workflow" query parameter is true; clients fetch entries
+// to see them.
+func Events(changes data.Changes) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		after := c.GetHeader("Last-Event-ID")
+		if after == "" {
+			after = c.Query("last_event_id")
+		}
+		workflow := c.Query("workflow") == "true"
+		ctx := c.Request.Context()
+		feed, err := changes.Subscribe(ctx, after)
+		if err != nil {
+			fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		auditQuery(c, "events", after)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		ticker := time.NewTicker(EventsKeepalive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fmt.Fprint(c.Writer, ": ping\n\n")
+			case change, ok := <-feed:
+				if !ok {
+					return
+				}
+				// Deleted entries may no longer name their mailbox,
+				// in which case mailbox-restricted callers miss them.
+				if !canAccess(c, change.Entry.Mailbox) {
+					continue
+				}
+				change.Entry = change.Entry.Redacted(workflow)
+				body, err := json.Marshal(change)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n",
+					change.ID, change.Type, body)
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stream opens the event stream of Events(b), as a token restricted to
+// mailbox if it is not empty, and returns the changes it streams.
+func stream(t *testing.T, b *notify.Broadcaster, mailbox, lastEventID string) <-chan data.Change {
+	t.Helper()
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		if mailbox != "" {
+			c.Set(MailboxKey, mailbox)
+		}
+	}, Events(b))
+	server := httptest.NewServer(r)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan data.Change, 16)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			payload, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var change data.Change
+			if json.Unmarshal([]byte(payload), &change) == nil {
+				changes <- change
+			}
+		}
+	}()
+	return changes
+}
+
+// next returns the next streamed change.
+func next(t *testing.T, changes <-chan data.Change) data.Change {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change was streamed")
+		return data.Change{}
+	}
+}
+
+func TestEventsRestricted(t *testing.T) {
+	b := notify.NewBroadcaster()
+	sales, all := stream(t, b, "sales", ""), stream(t, b, "", "")
+	ctx := context.Background()
+	for _, form := range []data.Form{
+		{ID: "1", Mailbox: "support"},
+		{ID: "2", Mailbox: "sales", Notes: []data.Note{{Body: "internal"}}},
+		{ID: "3", Mailbox: "support"},
+		{ID: "4", Mailbox: "sales"},
+	} {
+		b.Notify(ctx, notify.NewEvent(notify.EventCreated, form, ""))
+	}
+
+	// Streams restricted to a mailbox skip the changes to others.
+	for _, want := range []string{"2", "4"} {
+		change := next(t, sales)
+		if change.Entry.ID != want || change.Entry.Mailbox != "sales" {
+			t.Fatalf("streamed %+v, want entry %s of sales", change.Entry, want)
+		}
+		if len(change.Entry.Notes) != 0 {
+			t.Error("notes were streamed")
+		}
+	}
+	for _, want := range []string{"1", "2", "3", "4"} {
+		if change := next(t, all); change.Entry.ID != want {
+			t.Fatalf("streamed entry %s, want %s", change.Entry.ID, want)
+		}
+	}
+}
+
+func TestEventsResume(t *testing.T) {
+	b := notify.NewBroadcaster()
+	all := stream(t, b, "", "")
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		b.Notify(ctx, notify.NewEvent(notify.EventCreated,
+			data.Form{ID: id, Mailbox: "sales"}, ""))
+	}
+	first := next(t, all)
+
+	// Clients that reconnect receive the changes they missed, still
+	// filtered by mailbox.
+	b.Notify(ctx, notify.NewEvent(notify.EventCreated,
+		data.Form{ID: "4", Mailbox: "support"}, ""))
+	resumed := stream(t, b, "sales", first.ID)
+	for _, want := range []string{"2", "3"} {
+		if change := next(t, resumed); change.Entry.ID != want {
+			t.Fatalf("resumed with entry %s, want %s", change.Entry.ID, want)
+		}
+	}
+	b.Notify(ctx, notify.NewEvent(notify.EventDeleted,
+		data.Form{ID: "5", Mailbox: "sales"}, ""))
+	if change := next(t, resumed); change.Entry.ID != "5" || change.Type != data.ChangeDeleted {
+		t.Errorf("streamed %+v, want the deletion of entry 5", change)
+	}
+}
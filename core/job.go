@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"strconv"
+)
+
+// ReadAllJobs returns a Gin middleware that fetches paginated batches
+// of outbox jobs, most recent first. The "status" query parameter
+// restricts results to pending, running, succeeded or dead jobs.
+func ReadAllJobs(jobs data.Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid page number",
+			})
+			return
+		}
+		status := c.Query("status")
+		switch status {
+		case "", data.JobPending, data.JobRunning, data.JobSucceeded, data.JobDead:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "'status' must be one of pending, running, succeeded or dead",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		list, err := jobs.ReadAll(ctx, status, 20, int64(page))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"page":       page,
+			"page_count": int64(jobs.Count(ctx, status) / 20),
+			"job_count":  len(list),
+			"jobs":       list,
+		})
+	}
+}
+
+// ReadJob returns a Gin middleware that fetches an outbox job,
+// including its payload, by its ID.
+func ReadJob(jobs data.Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		job, err := jobs.Read(ctx, c.Param("id"))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// RetryJob returns a Gin middleware that requeues a dead outbox job,
+// referenced by its ID, and responds with its updated record.
+func RetryJob(queue *notify.Queue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		job, err := queue.Retry(ctx, id)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "job.retry", id)
+		c.JSON(http.StatusOK, job)
+	}
+}
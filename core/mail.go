@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/inbound"
+	"github.com/zeim839/mailbox/notify"
+	"log"
+	"strings"
+)
+
+// AcceptMail returns a function that reports whether the SMTP listener
+// accepts mail for a recipient. Recipients maps lowercase addresses to
+// mailboxes; thread reply addresses are accepted too.
+func AcceptMail(threads *inbound.ThreadAddress, recipients map[string]string) func(string) bool {
+	return func(rcpt string) bool {
+		if _, ok := recipients[strings.ToLower(rcpt)]; ok {
+			return true
+		}
+		if threads != nil {
+			_, ok := threads.Match(rcpt)
+			return ok
+		}
+		return false
+	}
+}
+
+// ReceiveMail returns an SMTP handler that files received email. Mail
+// sent to a thread's reply address is appended to that thread; other
+// mail becomes a new entry in the mailbox of each recipient, subject to
+// the same validation as web submissions. The notifier n (if not nil)
+// is notified of new entries and replies.
+func ReceiveMail(db data.Data, threads *inbound.ThreadAddress,
+	recipients map[string]string, n notify.Notifier) func(context.Context, inbound.Envelope, inbound.Email) error {
+	return func(ctx context.Context, env inbound.Envelope, email inbound.Email) error {
+		// Accept and drop automatic replies and bounces, so that
+		// senders do not retry or bounce them in turn.
+		if email.Automated {
+			log.Printf("[INBOUND] dropped automated email from %s", env.From)
+			return nil
+		}
+
+		// The envelope is authoritative: Bcc'd or forwarded mail
+		// does not name its recipient in the headers.
+		email.To = env.To
+		if threads != nil {
+			if _, ok := threads.MatchAny(env.To); ok {
+				_, err := FileReply(ctx, db, threads, n, email)
+				if errors.Is(err, data.ErrMongoNotFound) ||
+					errors.Is(err, ErrInboundEmpty) {
+					return inbound.Reject(err)
+				}
+				return err
+			}
+		}
+
+		mailboxes := map[string]bool{}
+		for _, rcpt := range env.To {
+			mailbox, ok := recipients[strings.ToLower(rcpt)]
+			if !ok || mailboxes[mailbox] {
+				continue
+			}
+			mailboxes[mailbox] = true
+			form := email.Form(mailbox)
+			if err := form.Validate(); err != nil {
+				reject(ctx, n, form)
+				return inbound.Reject(err)
+			}
+			if _, err := Submit(ctx, db, n, form); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
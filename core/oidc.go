@@ -0,0 +1,441 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOIDCMalformed is returned when a bearer token is not a
+	// well-formed JWT.
+	ErrOIDCMalformed = errors.New("malformed identity token")
+
+	// ErrOIDCSignature is returned when a JWT's signature cannot be
+	// verified with the issuer's keys.
+	ErrOIDCSignature = errors.New("invalid identity token signature")
+
+	// ErrOIDCClaims is returned when a JWT's issuer, audience or
+	// validity period do not check out.
+	ErrOIDCClaims = errors.New("identity token was not issued for this server or has expired")
+)
+
+const (
+	// jwksTTL is how long fetched signing keys are trusted before
+	// they are fetched again.
+	jwksTTL = time.Hour
+
+	// jwksMinRefresh rate-limits refetching keys when a token names
+	// an unknown key ID.
+	jwksMinRefresh = time.Minute
+
+	// clockLeeway tolerates clock drift between issuer and server.
+	clockLeeway = time.Minute
+
+	// oidcSession is stored under SessionKey for requests bearing
+	// an identity token, which the server cannot revoke.
+	oidcSession = "oidc"
+
+	// OIDCPrefix namespaces the usernames of identity provider users,
+	// so that they never match local accounts, whose names cannot
+	// contain a colon.
+	OIDCPrefix = "oidc:"
+)
+
+// OIDCDiscovery is the subset of an OpenID provider's discovery
+// document used by Mailbox.
+type OIDCDiscovery struct {
+	Issuer                      string `json:"issuer"`
+	JWKSURI                     string `json:"jwks_uri"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// DiscoverOIDC fetches the discovery document of the given issuer.
+func DiscoverOIDC(client *http.Client, issuer string) (OIDCDiscovery, error) {
+	var doc OIDCDiscovery
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := client.Get(url)
+	if err != nil {
+		return doc, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return doc, fmt.Errorf("oidc discovery: %s responded %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return doc, fmt.Errorf("oidc discovery: %s", err)
+	}
+	if doc.Issuer != issuer {
+		return doc, fmt.Errorf("oidc discovery: issuer mismatch %q", doc.Issuer)
+	}
+	return doc, nil
+}
+
+// OIDCVerifier verifies JWTs issued by an OpenID Connect provider.
+// The provider's signing keys are discovered and cached lazily.
+type OIDCVerifier struct {
+	Issuer      string
+	Audience    string
+	GroupsClaim string
+
+	// Roles maps identity provider groups to Mailbox roles.
+	Roles map[string]string
+
+	client     *http.Client
+	mu         sync.RWMutex
+	keys       map[string]crypto.PublicKey
+	fetchedAt  time.Time
+	refreshing *keyRefresh
+}
+
+// keyRefresh is a fetch of the issuer's signing keys, which concurrent
+// lookups of unknown or stale keys wait for instead of fetching the
+// keys again.
+type keyRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// NewOIDCVerifier initializes a verifier for tokens issued by issuer
+// to audience.
+func NewOIDCVerifier(issuer, audience, groupsClaim string, roles map[string]string) *OIDCVerifier {
+	return &OIDCVerifier{
+		Issuer:      issuer,
+		Audience:    audience,
+		GroupsClaim: groupsClaim,
+		Roles:       roles,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// OIDCAuthMw returns a Gin middleware that authenticates requests
+// bearing an identity token issued by the verifier's provider. The
+// caller's role is derived from their groups, and they are identified
+// by their issuer and subject, prefixed with OIDCPrefix.
+func OIDCAuthMw(v *OIDCVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.Header("WWW-Authenticate", `Bearer realm="Restricted"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: scheme must be Bearer",
+			})
+			return
+		}
+
+		claims, err := v.Verify(parts[1])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: " + err.Error(),
+			})
+			return
+		}
+
+		role := v.Role(claims)
+		if role == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: none of your groups grant access to this mailbox",
+			})
+			return
+		}
+
+		c.Set(UserKey, OIDCPrefix+v.Subject(claims))
+		c.Set(NameKey, v.Name(claims))
+		c.Set(ScopesKey, data.User{Role: role}.Scopes())
+		c.Set(SessionKey, oidcSession)
+		c.Next()
+	}
+}
+
+// OIDCConfig returns a Gin middleware that tells clients which
+// provider and client ID to log in with.
+func OIDCConfig(issuer, clientID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"issuer":    issuer,
+			"client_id": clientID,
+		})
+	}
+}
+
+// IsJWT reports whether a bearer string looks like a JWT rather than
+// a Mailbox token.
+func IsJWT(bearer string) bool {
+	return strings.Count(bearer, ".") == 2
+}
+
+// Verify checks the signature and claims of the raw JWT and returns
+// its claims.
+func (v *OIDCVerifier) Verify(raw string) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrOIDCMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrOIDCMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrOIDCMalformed
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], signature) {
+		return nil, ErrOIDCSignature
+	}
+
+	claims := map[string]any{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrOIDCMalformed
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Subject returns the stable identifier of the token's subject, made
+// of its issuer and subject claims. Unlike the subject's names, it can
+// neither change nor be claimed by another subject.
+func (v *OIDCVerifier) Subject(claims map[string]any) string {
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	return iss + "#" + sub
+}
+
+// Name returns the name that the token's subject is displayed by.
+func (v *OIDCVerifier) Name(claims map[string]any) string {
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Role maps the groups listed in the token's claims to the most
+// privileged matching Mailbox role. It returns an empty string if no
+// group is mapped.
+func (v *OIDCVerifier) Role(claims map[string]any) string {
+	groups := map[string]bool{}
+	switch g := claims[v.GroupsClaim].(type) {
+	case string:
+		groups[g] = true
+	case []any:
+		for _, item := range g {
+			if name, ok := item.(string); ok {
+				groups[name] = true
+			}
+		}
+	}
+	for _, role := range []string{data.RoleAdmin, data.RoleResponder, data.RoleViewer} {
+		for group, mapped := range v.Roles {
+			if mapped == role && groups[group] {
+				return role
+			}
+		}
+	}
+	return ""
+}
+
+func (v *OIDCVerifier) checkClaims(claims map[string]any) error {
+	if iss, _ := claims["iss"].(string); iss != v.Issuer {
+		return ErrOIDCClaims
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return ErrOIDCClaims
+	}
+	audOK := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audOK = aud == v.Audience
+	case []any:
+		for _, a := range aud {
+			if a == v.Audience {
+				audOK = true
+			}
+		}
+	}
+	if !audOK {
+		return ErrOIDCClaims
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockLeeway)) {
+		return ErrOIDCClaims
+	}
+	if nbf, ok := claims["nbf"].(float64); ok &&
+		now.Add(clockLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return ErrOIDCClaims
+	}
+	return nil
+}
+
+// key returns the issuer's public key with the given ID, refreshing
+// the cached key set when it is stale or does not contain the ID. If
+// the refresh fails, the cached keys are kept and used.
+func (v *OIDCVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetchedAt)
+	v.mu.RUnlock()
+	if ok && age < jwksTTL {
+		return key, nil
+	}
+	if age >= jwksMinRefresh {
+		if err := v.refresh(); err != nil {
+			if ok {
+				log.Printf("[OIDC] keeping cached keys: %s", err)
+				return key, nil
+			}
+			return nil, err
+		}
+	}
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	return nil, ErrOIDCSignature
+}
+
+// refresh fetches the issuer's signing keys, or waits for the fetch
+// already in progress, unless they were fetched in the meantime. Keys
+// are fetched without holding v.mu, so that cached keys can be looked
+// up meanwhile.
+func (v *OIDCVerifier) refresh() error {
+	v.mu.Lock()
+	if time.Since(v.fetchedAt) < jwksMinRefresh {
+		v.mu.Unlock()
+		return nil
+	}
+	if r := v.refreshing; r != nil {
+		v.mu.Unlock()
+		<-r.done
+		return r.err
+	}
+	r := &keyRefresh{done: make(chan struct{})}
+	v.refreshing = r
+	v.mu.Unlock()
+
+	keys, err := v.fetchKeys()
+	v.mu.Lock()
+	if err == nil {
+		v.keys, v.fetchedAt = keys, time.Now()
+	}
+	r.err, v.refreshing = err, nil
+	v.mu.Unlock()
+	close(r.done)
+	return err
+}
+
+func (v *OIDCVerifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	doc, err := DiscoverOIDC(v.client, v.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Get(doc.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc jwks: %s responded %s", doc.JWKSURI, resp.Status)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %s", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	return keys, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
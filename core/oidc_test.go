@@ -0,0 +1,275 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/zeim839/mailbox/data"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// oidcProvider is a test identity provider that serves its discovery
+// document and signing keys.
+type oidcProvider struct {
+	*httptest.Server
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+
+	// failing makes the provider fail to serve its signing keys.
+	failing atomic.Bool
+
+	// fetches counts the requests for its signing keys.
+	fetches atomic.Int32
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &oidcProvider{rsa: rsaKey, ec: ecKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:  p.URL,
+			JWKSURI: p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		if p.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"temporarily unavailable"}`))
+			return
+		}
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()),
+				"e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N.Bytes()),
+				"e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		}})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// sign returns a JWT carrying the claims, signed with the key of the
+// given ID and algorithm.
+func (p *oidcProvider) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsa, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, p.ec, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	p := newOIDCProvider(t)
+	now := time.Now()
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":                p.URL,
+			"aud":                "mailbox",
+			"sub":                "1234",
+			"preferred_username": "alice",
+			"exp":                now.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"rs256", p.sign(t, "RS256", "rsa", claims(nil)), nil},
+		{"es256", p.sign(t, "ES256", "ec", claims(nil)), nil},
+		{"audience list", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"aud": []string{"other", "mailbox"}})), nil},
+		{"clock leeway", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"exp": now.Add(-30 * time.Second).Unix()})), nil},
+		{"wrong audience", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"aud": "other"})), ErrOIDCClaims},
+		{"wrong issuer", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"iss": "https://evil.example.com"})), ErrOIDCClaims},
+		{"expired", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"exp": now.Add(-time.Hour).Unix()})), ErrOIDCClaims},
+		{"no subject", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"sub": nil})), ErrOIDCClaims},
+		{"no expiry", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"exp": nil})), ErrOIDCClaims},
+		{"not yet valid", p.sign(t, "RS256", "rsa", claims(map[string]any{
+			"nbf": now.Add(time.Hour).Unix()})), ErrOIDCClaims},
+		{"unknown key", p.sign(t, "RS256", "other", claims(nil)), ErrOIDCSignature},
+		{"encryption key", p.sign(t, "RS256", "enc", claims(nil)), ErrOIDCSignature},
+		{"algorithm mismatch", p.sign(t, "ES256", "rsa", claims(nil)), ErrOIDCSignature},
+		{"alg none", "eyJhbGciOiJub25lIiwia2lkIjoicnNhIn0." +
+			base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x"}`)) + ".",
+			ErrOIDCSignature},
+		{"malformed", "not-a-jwt", ErrOIDCMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewOIDCVerifier(p.URL, "mailbox", "groups", nil)
+			got, err := v.Verify(tt.token)
+			if err != tt.err {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if v.Name(got) != "alice" {
+				t.Errorf("Name() = %q, want alice", v.Name(got))
+			}
+			if want := p.URL + "#1234"; v.Subject(got) != want {
+				t.Errorf("Subject() = %q, want %q", v.Subject(got), want)
+			}
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		v := NewOIDCVerifier(p.URL, "mailbox", "groups", nil)
+		token := p.sign(t, "RS256", "rsa", claims(nil))
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + p.URL +
+			`","aud":"mailbox","preferred_username":"admin","exp":9999999999}`))
+		parts := strings.Split(token, ".")
+		if _, err := v.Verify(parts[0] + "." + payload + "." + parts[2]); err != ErrOIDCSignature {
+			t.Errorf("Verify() error = %v, want %v", err, ErrOIDCSignature)
+		}
+	})
+}
+
+func TestOIDCKeyRefresh(t *testing.T) {
+	p := newOIDCProvider(t)
+	token := p.sign(t, "RS256", "rsa", map[string]any{
+		"iss":                p.URL,
+		"aud":                "mailbox",
+		"sub":                "1234",
+		"preferred_username": "alice",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	})
+
+	p.failing.Store(true)
+	v := NewOIDCVerifier(p.URL, "mailbox", "groups", nil)
+	if _, err := v.Verify(token); err == nil {
+		t.Fatal("Verify() succeeded without signing keys")
+	}
+
+	p.failing.Store(false)
+	v = NewOIDCVerifier(p.URL, "mailbox", "groups", nil)
+	if _, err := v.Verify(token); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// A failed refresh of stale keys keeps the cached ones.
+	p.failing.Store(true)
+	v.fetchedAt = time.Now().Add(-jwksTTL)
+	if _, err := v.Verify(token); err != nil {
+		t.Fatalf("Verify() error = %v after a failed refresh", err)
+	}
+	if len(v.keys) == 0 {
+		t.Error("failed refresh discarded the cached keys")
+	}
+}
+
+func TestOIDCConcurrentRefresh(t *testing.T) {
+	p := newOIDCProvider(t)
+	token := p.sign(t, "RS256", "rsa", map[string]any{
+		"iss": p.URL,
+		"aud": "mailbox",
+		"sub": "1234",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	// Concurrent lookups of uncached keys share a single fetch.
+	v := NewOIDCVerifier(p.URL, "mailbox", "groups", nil)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(token); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("signing keys fetched %d times, want 1", n)
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	v := NewOIDCVerifier("https://idp.example.com", "mailbox", "groups", map[string]string{
+		"staff":   data.RoleViewer,
+		"support": data.RoleResponder,
+		"ops":     data.RoleAdmin,
+	})
+	tests := []struct {
+		name   string
+		groups any
+		want   string
+	}{
+		{"single group", "support", data.RoleResponder},
+		{"most privileged", []any{"staff", "ops", "support"}, data.RoleAdmin},
+		{"unmapped", []any{"guests"}, ""},
+		{"no groups", nil, ""},
+		{"wrong type", 42.0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]any{}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			if got := v.Role(claims); got != tt.want {
+				t.Errorf("Role() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APITitle is the title of the API document.
+var APITitle = "Mailbox API"
+
+// OpenAPI returns a Gin middleware that serves an OpenAPI 3 document
+// describing the routes under APIPrefix.
+func OpenAPI(routes []Route) gin.HandlerFunc {
+	doc := openAPIDocument(routes)
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// openAPIDocument describes the routes. Schemas are derived from the
+// routes' samples, and named structs are shared as components.
+func openAPIDocument(routes []Route) gin.H {
+	schemas := schemaSet{
+		"Error": gin.H{
+			"type": "object",
+			"properties": gin.H{
+				"error": gin.H{
+					"type":     "object",
+					"required": []string{"status", "code", "message"},
+					"properties": gin.H{
+						"status":  gin.H{"type": "integer"},
+						"code":    gin.H{"type": "string"},
+						"message": gin.H{"type": "string"},
+						"details": gin.H{"type": "object"},
+					},
+				},
+			},
+		},
+	}
+	paths := gin.H{}
+	for _, route := range routes {
+		path, params := openAPIPath(route.Path)
+		names := []string{}
+		for name := range route.Query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			params = append(params, gin.H{
+				"name":   name,
+				"in":     "query",
+				"schema": schemas.sample(route.Query[name]),
+			})
+		}
+		op := gin.H{
+			"summary": route.Summary,
+			"tags":    []string{strings.Split(strings.Trim(route.Path, "/"), "/")[0]},
+			"responses": gin.H{
+				"200":     openAPIResponse(schemas, route),
+				"default": gin.H{"$ref": "#/components/responses/Error"},
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.Request != nil {
+			op["requestBody"] = gin.H{
+				"required": true,
+				"content": gin.H{"application/json": gin.H{
+					"schema": schemas.sample(route.Request),
+				}},
+			}
+		}
+		if route.Public {
+			op["security"] = []gin.H{}
+		} else if route.Scope != "" {
+			op["description"] = "Requires the `" + route.Scope + "` scope."
+		}
+		if _, ok := paths[path]; !ok {
+			paths[path] = gin.H{}
+		}
+		paths[path].(gin.H)[strings.ToLower(route.Method)] = op
+	}
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   APITitle,
+			"version": strings.TrimPrefix(APIPrefix, "/api/"),
+		},
+		"servers":  []gin.H{{"url": APIPrefix}},
+		"security": []gin.H{{"bearer": []string{}}, {"basic": []string{}}},
+		"paths":    paths,
+		"components": gin.H{
+			"schemas": schemas,
+			"securitySchemes": gin.H{
+				"bearer": gin.H{"type": "http", "scheme": "bearer"},
+				"basic":  gin.H{"type": "http", "scheme": "basic"},
+			},
+			"responses": gin.H{
+				"Error": gin.H{
+					"description": "Failure",
+					"content": gin.H{"application/json": gin.H{
+						"schema": gin.H{"$ref": "#/components/schemas/Error"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts a Gin route path to an OpenAPI path template,
+// returning the path parameters.
+func openAPIPath(path string) (string, []gin.H) {
+	params := []gin.H{}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+		params = append(params, gin.H{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   gin.H{"type": "string"},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// openAPIResponse describes the successful response of a route.
+func openAPIResponse(schemas schemaSet, route Route) gin.H {
+	if route.Stream {
+		return gin.H{
+			"description": "Server-sent events",
+			"content": gin.H{"text/event-stream": gin.H{
+				"schema": schemas.sample(route.Response),
+			}},
+		}
+	}
+	payload := gin.H{"nullable": true}
+	if route.Response != nil {
+		payload = schemas.sample(route.Response)
+	}
+	return gin.H{
+		"description": "Success",
+		"content": gin.H{"application/json": gin.H{
+			"schema": gin.H{
+				"type":       "object",
+				"properties": gin.H{"data": payload},
+			},
+		}},
+	}
+}
+
+// schemaSet holds the named schemas of an API document.
+type schemaSet gin.H
+
+// sample returns the schema of a sample value.
+func (s schemaSet) sample(v any) gin.H {
+	obj, ok := v.(gin.H)
+	if !ok {
+		return s.of(reflect.TypeOf(v))
+	}
+	props := gin.H{}
+	for name, value := range obj {
+		props[name] = s.sample(value)
+	}
+	return gin.H{"type": "object", "properties": props}
+}
+
+// of returns the schema of a type. Named structs are added to the set
+// and referenced.
+func (s schemaSet) of(t reflect.Type) gin.H {
+	if t == nil {
+		return gin.H{}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gin.H{"type": "string", "format": "byte"}
+		}
+		return gin.H{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			// Reserve the name first, in case the type refers to
+			// itself.
+			s[t.Name()] = gin.H{}
+			s[t.Name()] = s.object(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return gin.H{}
+}
+
+// object returns the schema of a struct's JSON encoding.
+func (s schemaSet) object(t reflect.Type) gin.H {
+	props, required := gin.H{}, []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := s.object(field.Type)
+			for k, v := range embedded["properties"].(gin.H) {
+				props[k] = v
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		props[name] = s.of(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+	schema := gin.H{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
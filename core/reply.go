@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/inbound"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// replyRequest defines the JSON body accepted by Reply.
+type replyRequest struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body" binding:"required"`
+}
+
+// Reply returns a Gin middleware that emails a reply to the submitter
+// of the entry referenced by the "id" route parameter, through the
+// server's SMTP relay. The reply is recorded on the entry, which is
+// marked as read, and n (if not nil) is notified. If threads is not
+// nil, the submitter's answers are addressed to the entry's thread.
+func Reply(db data.Data, mailer *notify.Mailer, threads *inbound.ThreadAddress,
+	n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mailer == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "replies require an SMTP relay, but none is configured",
+			})
+			return
+		}
+		var req replyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if strings.TrimSpace(req.Body) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "'body' field is required",
+			})
+			return
+		}
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		form, err := db.Read(ctx, id)
+		cancel()
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if strings.TrimSpace(req.Subject) == "" {
+			req.Subject = "Re: " + form.Subject
+		}
+		msg := notify.Message{
+			To:      []string{form.From},
+			Subject: req.Subject,
+			Body:    req.Body,
+		}
+		if threads != nil {
+			msg.ReplyTo = threads.For(form.ID)
+		}
+		sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = mailer.Send(sendCtx, msg)
+		cancel()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "failed to send reply: " + err.Error(),
+			})
+			return
+		}
+		reply := data.Reply{
+			Author:  c.GetString(UserKey),
+			From:    mailer.From,
+			To:      form.From,
+			Subject: req.Subject,
+			Body:    req.Body,
+			Sent:    time.Now().UTC(),
+		}
+		status := data.StatusRead
+		ctx, cancel = context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		_, err = patchEntry(ctx, db, n, id, data.Patch{
+			Status:  &status,
+			Replies: []data.Reply{reply},
+		}, notify.EventReplied, c.GetString(UserKey))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "reply was sent but could not be recorded: " + err.Error(),
+			})
+			return
+		}
+		audit(c, "reply", id)
+		c.JSON(http.StatusOK, reply)
+	}
+}
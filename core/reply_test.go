@@ -0,0 +1,183 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"github.com/zeim839/mailbox/inbound"
+	"github.com/zeim839/mailbox/notify"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpSink is a local SMTP relay that records the messages it receives,
+// or refuses them if failing.
+type smtpSink struct {
+	listener net.Listener
+	failing  bool
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func newSMTPSink(t *testing.T, failing bool) *smtpSink {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{listener: l, failing: failing}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+// Mailer returns a Mailer that sends to the sink.
+func (s *smtpSink) Mailer() *notify.Mailer {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return &notify.Mailer{
+		Host:     host,
+		Port:     port,
+		From:     "Mailbox <mailbox@example.com>",
+		Security: notify.SecurityNone,
+	}
+}
+
+// Messages returns the raw messages received so far.
+func (s *smtpSink) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.messages...)
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "MAIL FROM:") && s.failing:
+			reply("451 try again later")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var body strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				body.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, body.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales",
+		From: "jane@example.com", Subject: "Hello"}
+	threads, err := inbound.NewThreadAddress("reply@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		relay    bool
+		failing  bool
+		notifier notify.Notifier
+		mailbox  string
+		body     replyRequest
+		code     int
+		sent     int
+		want     string
+	}{
+		{"replied", true, false, &recorder{}, "", replyRequest{Body: "Thanks!"}, http.StatusOK, 1, ""},
+		{"no relay", false, false, &recorder{}, "", replyRequest{Body: "Thanks!"},
+			http.StatusBadRequest, 0, "require an SMTP relay"},
+		{"empty body", true, false, &recorder{}, "", replyRequest{Body: " "},
+			http.StatusBadRequest, 0, "'body'"},
+		{"restricted mailbox", true, false, &recorder{}, "support",
+			replyRequest{Body: "Thanks!"}, http.StatusBadRequest, 0, ""},
+		{"send failure", true, true, &recorder{}, "", replyRequest{Body: "Thanks!"},
+			http.StatusBadRequest, 0, "failed to send reply"},
+		{"record failure", true, false, &failingNotifier{}, "",
+			replyRequest{Body: "Thanks!"}, http.StatusBadRequest, 1, "could not be recorded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(form)
+			sink := newSMTPSink(t, tt.failing)
+			var mailer *notify.Mailer
+			if tt.relay {
+				mailer = sink.Mailer()
+			}
+			values := map[string]any{UserKey: "alice"}
+			if tt.mailbox != "" {
+				values[MailboxKey] = tt.mailbox
+			}
+			w := serve(Reply(db, mailer, threads, tt.notifier), "POST", "/:id",
+				"/"+form.ID, tt.body, values)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %s, want it to contain %q", w.Body, tt.want)
+			}
+			messages := sink.Messages()
+			if len(messages) != tt.sent {
+				t.Fatalf("sent %d messages, want %d", len(messages), tt.sent)
+			}
+
+			// Replies are only recorded once sent, and are undone
+			// with the entry's status if they cannot be recorded.
+			got, _ := db.Read(context.Background(), form.ID)
+			recorded := tt.code == http.StatusOK
+			if (len(got.Replies) == 1) != recorded || (got.Status == data.StatusRead) != recorded {
+				t.Errorf("entry has %d replies and status %q", len(got.Replies), got.Status)
+			}
+			if !recorded {
+				return
+			}
+			reply := got.Replies[0]
+			if reply.Author != "alice" || reply.To != form.From || reply.Subject != "Re: Hello" {
+				t.Errorf("recorded %+v", reply)
+			}
+			if !strings.Contains(messages[0], "Reply-To: "+threads.For(form.ID)) {
+				t.Errorf("message is not addressed to the thread:\n%s", messages[0])
+			}
+			events := tt.notifier.(*recorder).events
+			if len(events) != 1 || events[0].Type != notify.EventReplied {
+				t.Errorf("notified %+v, want a single %s event", events, notify.EventReplied)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"time"
+)
+
+// TOTPIssuer names the service in users' authenticator apps.
+var TOTPIssuer = "Mailbox"
+
+// loginRequest defines the JSON body accepted by Login.
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// codeRequest defines the JSON body accepted by EnableTOTP.
+type codeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Login returns a Gin middleware that exchanges a username, password
+// and, for users with two-factor authentication enabled, a TOTP or
+// recovery code for a session token valid for ttl.
+func Login(users data.Users, tokens data.Tokens, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req loginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, status, err := checkPassword(ctx, users, req.Username, req.Password)
+		if err != nil {
+			fail(c, status, err)
+			return
+		}
+		if user.TOTPEnabled {
+			if req.Code == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":         "Unauthorized: authentication code required",
+					"totp_required": true,
+				})
+				return
+			}
+			if !user.CheckSecondFactor(ctx, users, req.Code) {
+				users.LoginFailed(ctx, user.Username)
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":         "Unauthorized: invalid authentication code",
+					"totp_required": true,
+				})
+				return
+			}
+		}
+		if user.FailedLogins > 0 {
+			if err := users.LoginSucceeded(ctx, user.Username); err != nil {
+				fail(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		session, bearer, err := data.NewSession(user.Username, ttl)
+		if err == nil {
+			err = tokens.Create(ctx, session)
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Set(UserKey, user.Username)
+		audit(c, "login", session.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"token":   bearer,
+			"expires": session.Expires,
+		})
+	}
+}
+
+// Logout returns a Gin middleware that revokes the session token that
+// authenticated the request.
+func Logout(tokens data.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetString(SessionKey)
+		if id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "request was not authenticated by a session",
+			})
+			return
+		}
+		if id == oidcSession {
+			c.String(http.StatusOK, "")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if err := tokens.Delete(ctx, id); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "logout", id)
+		c.String(http.StatusOK, "")
+	}
+}
+
+// EnrollTOTP returns a Gin middleware that starts two-factor
+// enrollment for the user referenced by the "username" route
+// parameter. Users may only enroll themselves.
+func EnrollTOTP(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("username")
+		if !isSelf(c, username) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: users may only enroll themselves",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, err := users.Read(ctx, username)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		secret, err := user.EnrollTOTP()
+		if err == nil {
+			err = users.SetTOTP(ctx, user)
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"secret": secret,
+			"url":    data.TOTPURL(TOTPIssuer, user.Username, secret),
+		})
+	}
+}
+
+// EnableTOTP returns a Gin middleware that completes two-factor
+// enrollment once the user proves their authenticator works. The
+// response carries the user's recovery codes.
+func EnableTOTP(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("username")
+		if !isSelf(c, username) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: users may only enroll themselves",
+			})
+			return
+		}
+		var req codeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, err := users.Read(ctx, username)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		codes, err := user.EnableTOTP(req.Code)
+		if err == nil {
+			err = users.SetTOTP(ctx, user)
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "totp.enable", username)
+		c.JSON(http.StatusOK, gin.H{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// DisableTOTP returns a Gin middleware that turns off two-factor
+// authentication for the user referenced by the "username" route
+// parameter. Admins may disable it for users who lost their device.
+func DisableTOTP(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("username")
+		if !isSelf(c, username) && !hasScope(c, data.ScopeAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: missing scope " + data.ScopeAdmin,
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, err := users.Read(ctx, username)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		user.DisableTOTP()
+		if err := users.SetTOTP(ctx, user); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "totp.disable", username)
+		c.String(http.StatusOK, "")
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// stateRequest defines the JSON body accepted by UpdateState.
+type stateRequest struct {
+	State string `json:"state" binding:"required"`
+}
+
+// UpdateState returns a Gin middleware that moves the entry referenced
+// by the "id" route parameter to another state of the workflow w, and
+// notifies n (if not nil) of the change. The change is recorded in the
+// entry's history, and must be one of the workflow's transitions. If
+// the entry's state changes in the meantime, it fails with a conflict.
+// It responds with the entry.
+func UpdateState(db data.Data, w data.Workflow, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req stateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if !w.Valid(req.State) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "'state' must be one of " + strings.Join(w.States, ", "),
+			})
+			return
+		}
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		form.State = w.State(form)
+		if form.State != req.State && !w.Allowed(form.State, req.State) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": fmt.Sprintf("cannot move an entry from %s to %s",
+					form.State, req.State),
+			})
+			return
+		}
+		if form.State != req.State {
+			form, err = patchEntry(ctx, db, n, id, data.Patch{
+				State: &req.State,
+				History: []data.Revision{data.NewRevision("state",
+					form.State, req.State, c.GetString(UserKey))},
+				IfStates: w.Match(form.State),
+			}, notify.EventUpdated, c.GetString(UserKey))
+			if errors.Is(err, data.ErrMongoConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "the entry's state changed in the meantime, please try again",
+				})
+				return
+			}
+			if err != nil {
+				fail(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		audit(c, "state."+req.State, id)
+		w.Annotate(&form, time.Now().UTC())
+		c.JSON(http.StatusOK, form)
+	}
+}
+
+// ReadWorkflow returns a Gin middleware that describes the workflow w.
+// The SLA is given in seconds, or zero if disabled.
+func ReadWorkflow(w data.Workflow) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transitions := w.Transitions
+		if transitions == nil {
+			transitions = map[string][]string{}
+		}
+		closed := w.Closed
+		if closed == nil {
+			closed = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"states":      w.States,
+			"initial":     w.Initial(),
+			"transitions": transitions,
+			"closed":      closed,
+			"sla":         int64(w.SLA.Seconds()),
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateState(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales", State: "new"}
+	tests := []struct {
+		name  string
+		state string
+		code  int
+		want  string
+	}{
+		{"allowed", "in-progress", http.StatusOK, "in-progress"},
+		{"unchanged", "new", http.StatusOK, "new"},
+		{"unknown state", "lost", http.StatusBadRequest, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(form)
+			w := serve(UpdateState(db, data.DefaultWorkflow(), nil), "PUT", "/:id",
+				"/"+form.ID, stateRequest{tt.state}, map[string]any{UserKey: "alice"})
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			got, _ := db.Read(context.Background(), form.ID)
+			if got.State != tt.want {
+				t.Errorf("state = %q, want %q", got.State, tt.want)
+			}
+		})
+	}
+
+	// Moving an entry whose state changed since it was read fails,
+	// rather than applying a transition from the wrong state.
+	t.Run("moved meanwhile", func(t *testing.T) {
+		closed := form
+		closed.State = "closed"
+		db := staleData{datatest.NewData(closed), form}
+		w := serve(UpdateState(db, data.DefaultWorkflow(), nil), "PUT", "/:id",
+			"/"+form.ID, stateRequest{"in-progress"}, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+		}
+		got, _ := db.Data.Read(context.Background(), form.ID)
+		if got.State != "closed" || len(got.History) != 0 {
+			t.Errorf("entry moved to %q with %d revisions", got.State, len(got.History))
+		}
+	})
+}
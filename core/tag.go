@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"slices"
+)
+
+// tagRequest defines the JSON body accepted by AddTags.
+type tagRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// AddTags returns a Gin middleware that adds tags to the entry
+// referenced by the "id" route parameter, and notifies n (if not nil)
+// of the change. It responds with the entry's tags.
+func AddTags(db data.Data, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req tagRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		tagEntry(c, db, n, req.Tags, nil)
+	}
+}
+
+// RemoveTag returns a Gin middleware that removes the tag referenced
+// by the "tag" route parameter from the entry referenced by the "id"
+// route parameter, and notifies n (if not nil) of the change. It
+// responds with the entry's tags.
+func RemoveTag(db data.Data, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tagEntry(c, db, n, nil, []string{c.Param("tag")})
+	}
+}
+
+// tagEntry adds and removes tags of the entry referenced by the "id"
+// route parameter. The entry is read only to check access: its tags
+// are patched, lest concurrent changes to them be lost.
+func tagEntry(c *gin.Context, db data.Data, n notify.Notifier, add, remove []string) {
+	if err := data.ValidateTags(append(add, remove...)); err != nil {
+		fail(c, http.StatusBadRequest, err)
+		return
+	}
+	id := c.Param("id")
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	form, err := db.Read(ctx, id)
+	if err == nil && !canAccess(c, form.Mailbox) {
+		err = data.ErrMongoNotFound
+	}
+	if err != nil {
+		fail(c, http.StatusBadRequest, err)
+		return
+	}
+	tags := form.Tags
+	err = db.Transact(ctx, func(ctx context.Context) error {
+		var err error
+		form, err = db.Patch(ctx, id, data.Patch{AddTags: add, RemoveTags: remove})
+		if err != nil || slices.Equal(tags, form.Tags) {
+			return err
+		}
+		return Dispatch(ctx, n, notify.NewEvent(notify.EventUpdated, form,
+			c.GetString(UserKey)))
+	})
+	if err != nil {
+		fail(c, http.StatusBadRequest, err)
+		return
+	}
+	audit(c, "tag", id)
+	tags = form.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// ReadTags returns a Gin middleware that lists the tags of the entries
+// matching the query parameters of FilterRequest, whose states belong
+// to the workflow w.
+func ReadTags(db data.Data, w data.Workflow) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req FilterRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		filter, status, err := req.filter(c, w)
+		if err != nil {
+			fail(c, status, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		tags, err := db.Tags(ctx, filter)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		auditQuery(c, "tags", c.Request.URL.RawQuery)
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
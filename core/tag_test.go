@@ -0,0 +1,116 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTagEntry(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales",
+		Tags: []string{"lead", "vip"}}
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		target  string
+		body    any
+		mailbox string
+		code    int
+		tags    []string
+		events  int
+	}{
+		{"add", "POST", "/:id", "/" + form.ID, tagRequest{[]string{"urgent", "lead"}},
+			"", http.StatusOK, []string{"lead", "urgent", "vip"}, 1},
+		{"add existing", "POST", "/:id", "/" + form.ID, tagRequest{[]string{"vip"}},
+			"", http.StatusOK, []string{"lead", "vip"}, 0},
+		{"add invalid", "POST", "/:id", "/" + form.ID, tagRequest{[]string{"Not a tag"}},
+			"", http.StatusBadRequest, []string{"lead", "vip"}, 0},
+		{"remove", "DELETE", "/:id/:tag", "/" + form.ID + "/lead", nil,
+			"", http.StatusOK, []string{"vip"}, 1},
+		{"remove missing", "DELETE", "/:id/:tag", "/" + form.ID + "/urgent", nil,
+			"", http.StatusOK, []string{"lead", "vip"}, 0},
+		{"restricted mailbox", "DELETE", "/:id/:tag", "/" + form.ID + "/lead", nil,
+			"support", http.StatusBadRequest, []string{"lead", "vip"}, 0},
+		{"not found", "POST", "/:id", "/000000000000000000000002",
+			tagRequest{[]string{"urgent"}}, "", http.StatusBadRequest,
+			[]string{"lead", "vip"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(form)
+			n := &recorder{}
+			h := RemoveTag(db, n)
+			if tt.method == "POST" {
+				h = AddTags(db, n)
+			}
+			values := map[string]any{}
+			if tt.mailbox != "" {
+				values[MailboxKey] = tt.mailbox
+			}
+			w := serve(h, tt.method, tt.route, tt.target, tt.body, values)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if w.Code == http.StatusOK {
+				var resp struct{ Tags []string }
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(resp.Tags, tt.tags) {
+					t.Errorf("responded with tags %v, want %v", resp.Tags, tt.tags)
+				}
+			}
+			wantTags(t, db, form.ID, tt.tags...)
+			if len(n.events) != tt.events {
+				t.Errorf("notified %d events, want %d", len(n.events), tt.events)
+			}
+		})
+	}
+}
+
+func TestReadTags(t *testing.T) {
+	db := datatest.NewData(
+		data.Form{Mailbox: "sales", Tags: []string{"lead", "vip"}},
+		data.Form{Mailbox: "support", Tags: []string{"bug", "vip"}},
+	)
+	tests := []struct {
+		name    string
+		target  string
+		mailbox string
+		code    int
+		tags    []string
+	}{
+		{"all", "/", "", http.StatusOK, []string{"bug", "lead", "vip"}},
+		{"mailbox", "/?mailbox=sales", "", http.StatusOK, []string{"lead", "vip"}},
+		{"restricted", "/", "support", http.StatusOK, []string{"bug", "vip"}},
+		{"outside restricted", "/?mailbox=sales", "support", http.StatusForbidden, nil},
+		{"invalid state", "/?state=lost", "", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]any{}
+			if tt.mailbox != "" {
+				values[MailboxKey] = tt.mailbox
+			}
+			h := ReadTags(db, data.DefaultWorkflow())
+			w := serve(h, "GET", "/", tt.target, nil, values)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp struct{ Tags []string }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resp.Tags, tt.tags) {
+				t.Errorf("tags = %v, want %v", resp.Tags, tt.tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/inbound"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxInboundSize is the largest raw email accepted by Inbound.
+const maxInboundSize = 10 << 20
+
+var (
+	// ErrInboundNoThread is returned when an inbound email is not
+	// addressed to an entry's thread.
+	ErrInboundNoThread = errors.New("email is not addressed to a known thread")
+
+	// ErrInboundAutomated is returned when an inbound email is an
+	// automatic reply or a bounce, which are never filed.
+	ErrInboundAutomated = errors.New("automated email ignored")
+
+	// ErrInboundEmpty is returned when an inbound email has neither
+	// text nor attachments.
+	ErrInboundEmpty = errors.New("email has no content")
+)
+
+// ReadThread returns a Gin middleware that fetches the conversation of
+// the entry referenced by the "id" route parameter, starting with the
+// original submission.
+func ReadThread(db data.Data) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		form, err := db.Read(ctx, id)
+		if err == nil && !canAccess(c, form.Mailbox) {
+			err = data.ErrMongoNotFound
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		thread := form.Thread()
+		audit(c, "read", id)
+		c.JSON(http.StatusOK, gin.H{
+			"entry_id":      id,
+			"message_count": len(thread),
+			"messages":      thread,
+		})
+	}
+}
+
+// Inbound returns a Gin middleware that files a raw RFC 5322 email,
+// sent as the request body, into the thread of the entry whose reply
+// address it was sent to.
+func Inbound(db data.Data, threads *inbound.ThreadAddress, n notify.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if threads == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "threads require a reply address, but none is configured",
+			})
+			return
+		}
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxInboundSize)
+		email, err := inbound.Parse(body)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		id, err := FileReply(ctx, db, threads, n, email)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "inbound", id)
+		c.JSON(http.StatusOK, gin.H{
+			"entry_id": id,
+		})
+	}
+}
+
+// FileReply appends an inbound email to the thread of the entry whose
+// reply address it was sent to, marks the entry as unread and notifies
+// n (if not nil). It returns the entry's ID, or ErrInboundNoThread if
+// the email was not sent to a thread.
+func FileReply(ctx context.Context, db data.Data, threads *inbound.ThreadAddress,
+	n notify.Notifier, email inbound.Email) (string, error) {
+	id, ok := threads.MatchAny(email.To)
+	if !ok {
+		return "", ErrInboundNoThread
+	}
+	if email.Automated {
+		return "", ErrInboundAutomated
+	}
+	text := inbound.StripQuoted(email.Text)
+	if text == "" {
+		text = email.Text
+	}
+	if strings.TrimSpace(text) == "" && len(email.Attachments) == 0 {
+		return "", ErrInboundEmpty
+	}
+	status := data.StatusUnread
+	_, err := patchEntry(ctx, db, n, id, data.Patch{Status: &status, Replies: []data.Reply{{
+		Inbound:     true,
+		From:        email.From,
+		To:          threads.For(id),
+		Subject:     email.Subject,
+		Body:        text,
+		Sent:        time.Now().UTC(),
+		Attachments: email.Attachments,
+	}}}, notify.EventReplied, "")
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"github.com/zeim839/mailbox/inbound"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFileReply(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales",
+		Status: data.StatusRead}
+	threads, err := inbound.NewThreadAddress("reply@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := []string{"someone@example.com", threads.For(form.ID)}
+	tests := []struct {
+		name  string
+		email inbound.Email
+		err   error
+		body  string
+	}{
+		{"filed", inbound.Email{To: to, Text: "Sounds good.\n\nOn Monday, you wrote:\n> Hello"},
+			nil, "Sounds good."},
+		{"attachment only", inbound.Email{To: to,
+			Attachments: []data.Attachment{{Filename: "invoice.pdf"}}}, nil, ""},
+		{"no thread", inbound.Email{To: []string{"reply@example.com"}, Text: "Hi"},
+			ErrInboundNoThread, ""},
+		{"forged thread", inbound.Email{To: []string{"reply+" + form.ID + "-0000@example.com"},
+			Text: "Hi"}, ErrInboundNoThread, ""},
+		{"automated", inbound.Email{To: to, Text: "I am out of office", Automated: true},
+			ErrInboundAutomated, ""},
+		{"empty", inbound.Email{To: to, Text: " \n"}, ErrInboundEmpty, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(form)
+			n := &recorder{}
+			tt.email.From = "jane@example.com"
+			id, err := FileReply(context.Background(), db, threads, n, tt.email)
+			if err != tt.err {
+				t.Fatalf("FileReply() error = %v, want %v", err, tt.err)
+			}
+			got, _ := db.Read(context.Background(), form.ID)
+			if err != nil {
+				if len(got.Replies) != 0 || len(n.events) != 0 {
+					t.Errorf("filed %d replies and notified %d events", len(got.Replies),
+						len(n.events))
+				}
+				return
+			}
+			if id != form.ID || got.Status != data.StatusUnread || len(got.Replies) != 1 {
+				t.Fatalf("filed into %q: status %q with %d replies", id, got.Status,
+					len(got.Replies))
+			}
+			reply := got.Replies[0]
+			if !reply.Inbound || reply.Body != tt.body || reply.From != "jane@example.com" {
+				t.Errorf("filed %+v", reply)
+			}
+			if len(n.events) != 1 || n.events[0].Type != notify.EventReplied {
+				t.Errorf("notified %+v, want a single %s event", n.events, notify.EventReplied)
+			}
+		})
+	}
+}
+
+func TestInbound(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales"}
+	threads, err := inbound.NewThreadAddress("reply@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := func(headers string) string {
+		return "From: Jane <jane@example.com>\r\nTo: " + threads.For(form.ID) +
+			"\r\nSubject: Re: Hello\r\n" + headers + "\r\nThanks!\r\n"
+	}
+	tests := []struct {
+		name    string
+		threads *inbound.ThreadAddress
+		raw     string
+		code    int
+		want    string
+	}{
+		{"filed", threads, email(""), http.StatusOK, form.ID},
+		{"no reply address", nil, email(""), http.StatusBadRequest, "reply address"},
+		{"automated", threads, email("Auto-Submitted: auto-replied\r\n"),
+			http.StatusBadRequest, ErrInboundAutomated.Error()},
+		{"no sender", threads, "To: " + threads.For(form.ID) + "\r\n\r\nHi\r\n",
+			http.StatusBadRequest, inbound.ErrParseNoSender.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := datatest.NewData(form)
+			r := gin.New()
+			r.POST("/", Inbound(db, tt.threads, nil))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(tt.raw)))
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %s, want it to contain %q", w.Body, tt.want)
+			}
+			got, _ := db.Read(context.Background(), form.ID)
+			if filed := len(got.Replies) == 1; filed != (tt.code == http.StatusOK) {
+				t.Errorf("entry has %d replies", len(got.Replies))
+			}
+		})
+	}
+}
+
+func TestReadThread(t *testing.T) {
+	form := data.Form{ID: "000000000000000000000001", Mailbox: "sales",
+		Replies: []data.Reply{{Body: "Thanks!"}}}
+	tests := []struct {
+		mailbox string
+		code    int
+	}{
+		{"", http.StatusOK},
+		{"sales", http.StatusOK},
+		{"support", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		values := map[string]any{}
+		if tt.mailbox != "" {
+			values[MailboxKey] = tt.mailbox
+		}
+		w := serve(ReadThread(datatest.NewData(form)), "GET", "/:id", "/"+form.ID,
+			nil, values)
+		if w.Code != tt.code {
+			t.Errorf("restricted to %q: status = %d, want %d", tt.mailbox, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"time"
+)
+
+// tokenRequest defines the JSON body accepted by CreateToken.
+type tokenRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes" binding:"required"`
+	Mailbox   string   `json:"mailbox"`
+	ExpiresIn string   `json:"expires_in"`
+}
+
+// ReadAllTokens returns a Gin middleware that lists every API token.
+// Token secrets are never included.
+func ReadAllTokens(tokens data.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		list, err := tokens.ReadAll(ctx)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token_count": len(list),
+			"tokens":      list,
+		})
+	}
+}
+
+// CreateToken returns a Gin middleware that issues a new API token
+// owned by the authenticated user. The bearer string is only ever
+// returned by this route.
+func CreateToken(tokens data.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req tokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		var ttl time.Duration
+		if req.ExpiresIn != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "'expires_in' must be a positive duration, e.g. \"720h\"",
+				})
+				return
+			}
+		}
+		if c.GetString(SessionKey) == oidcSession {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: identity provider users cannot own API tokens",
+			})
+			return
+		}
+		if restricted := c.GetString(MailboxKey); restricted != "" {
+			if req.Mailbox != "" && req.Mailbox != restricted {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "Forbidden: token is restricted to mailbox " + restricted,
+				})
+				return
+			}
+			req.Mailbox = restricted
+		}
+		token, bearer, err := data.NewToken(req.Name, c.GetString(UserKey),
+			req.Mailbox, req.Scopes, ttl)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if err := tokens.Create(ctx, token); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "token.create", token.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"token":  bearer,
+			"detail": token,
+		})
+	}
+}
+
+// DeleteToken returns a Gin middleware that revokes the API token
+// referenced by the "id" route parameter.
+func DeleteToken(tokens data.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if err := tokens.Delete(ctx, id); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "token.revoke", id)
+		c.String(http.StatusOK, "")
+	}
+}
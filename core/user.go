@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+)
+
+// userRequest defines the JSON body accepted by the user management
+// routes.
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// roleRequest defines the JSON body accepted by UpdateRole.
+type roleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ReadAllUsers returns a Gin middleware that lists every registered
+// user.
+func ReadAllUsers(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		list, err := users.ReadAll(ctx)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"user_count": len(list),
+			"users":      list,
+		})
+	}
+}
+
+// CreateUser returns a Gin middleware that registers a new user. Users
+// are viewers unless another role is requested.
+func CreateUser(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req userRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if req.Role == "" {
+			req.Role = data.RoleViewer
+		}
+		user, err := data.NewUser(req.Username, req.Password, req.Role)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if err := users.Create(ctx, user); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "user.create", user.Username)
+		c.String(http.StatusOK, "")
+	}
+}
+
+// UpdatePassword returns a Gin middleware that replaces the password
+// of the user referenced by the "username" route parameter. Users may
+// change their own password when logged in with it; any other change
+// requires the admin scope.
+func UpdatePassword(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isSelf(c, c.Param("username")) && !hasScope(c, data.ScopeAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden: missing scope " + data.ScopeAdmin,
+			})
+			return
+		}
+		var req userRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, err := users.Read(ctx, c.Param("username"))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := user.SetPassword(req.Password); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := users.SetPassword(ctx, user.Username, user.Hash); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "user.passwd", user.Username)
+		c.String(http.StatusOK, "")
+	}
+}
+
+// UpdateRole returns a Gin middleware that changes the role of the
+// user referenced by the "username" route parameter.
+func UpdateRole(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req roleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		user, err := users.Read(ctx, c.Param("username"))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		user.Role = req.Role
+		if err := user.Validate(); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if req.Role != data.RoleAdmin && !adminRemains(ctx, users, user.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "cannot demote the last remaining admin",
+			})
+			return
+		}
+		if err := users.SetRole(ctx, user.Username, user.Role); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "user.role."+req.Role, user.Username)
+		c.String(http.StatusOK, "")
+	}
+}
+
+// DeleteUser returns a Gin middleware that removes the user referenced
+// by the "username" route parameter. The last remaining admin cannot
+// be removed, since that would lock every administrator out.
+func DeleteUser(users data.Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		username := c.Param("username")
+		if !adminRemains(ctx, users, username) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "cannot remove the last remaining admin",
+			})
+			return
+		}
+		if err := users.Delete(ctx, username); err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		audit(c, "user.delete", username)
+		c.String(http.StatusOK, "")
+	}
+}
+
+// adminRemains reports whether an admin other than the given user
+// exists.
+func adminRemains(ctx context.Context, users data.Users, except string) bool {
+	list, err := users.ReadAll(ctx)
+	if err != nil {
+		return false
+	}
+	for _, u := range list {
+		if u.Username != except && contains(u.Scopes(), data.ScopeAdmin) {
+			return true
+		}
+	}
+	return false
+}
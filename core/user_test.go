@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// staleUsers reads users as they were before they were locked out.
+type staleUsers struct {
+	*datatest.Users
+	stale data.User
+}
+
+func (u staleUsers) Read(context.Context, string) (data.User, error) {
+	return u.stale, nil
+}
+
+func TestUpdateUser(t *testing.T) {
+	admin, _ := data.NewUser("admin", "correct horse", data.RoleAdmin)
+	bob, _ := data.NewUser("bob", "correct horse", data.RoleViewer)
+	locked := bob
+	locked.LockedUntil = time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		route string
+		body  any
+		check func(t *testing.T, u data.User)
+	}{
+		{"role", "/users/:username/role", roleRequest{data.RoleResponder},
+			func(t *testing.T, u data.User) {
+				if u.Role != data.RoleResponder {
+					t.Errorf("role = %q, want %q", u.Role, data.RoleResponder)
+				}
+			}},
+		{"password", "/users/:username/password", userRequest{Password: "battery staple"},
+			func(t *testing.T, u data.User) {
+				if !u.CheckPassword("battery staple") {
+					t.Error("password was not changed")
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The user is locked out between being read and changed,
+			// and the change must not lift the lockout.
+			users := staleUsers{datatest.NewUsers(admin, locked), bob}
+			h := UpdateRole(users)
+			if tt.name == "password" {
+				h = UpdatePassword(users)
+			}
+			w := serve(h, "PUT", tt.route, "/users/bob/"+tt.name, tt.body,
+				map[string]any{UserKey: "admin", ScopesKey: []string{data.ScopeAdmin}})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			got, _ := users.Users.Read(context.Background(), "bob")
+			tt.check(t, got)
+			if !got.LockedUntil.Equal(locked.LockedUntil) {
+				t.Errorf("LockedUntil = %v, want %v", got.LockedUntil, locked.LockedUntil)
+			}
+		})
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	bob, _ := data.NewUser("bob", "correct horse", data.RoleViewer)
+	bob.EnrollTOTP()
+	bob.TOTPEnabled = true
+	locked := bob
+	locked.LockedUntil = time.Now().Add(time.Hour)
+
+	users := staleUsers{datatest.NewUsers(locked), bob}
+	w := serve(DisableTOTP(users), "DELETE", "/users/:username/totp", "/users/bob/totp",
+		nil, map[string]any{UserKey: "bob"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	got, _ := users.Users.Read(context.Background(), "bob")
+	if got.TOTPEnabled || got.TOTPSecret != "" {
+		t.Error("two-factor authentication was not disabled")
+	}
+	if !got.LockedUntil.Equal(locked.LockedUntil) {
+		t.Errorf("LockedUntil = %v, want %v", got.LockedUntil, locked.LockedUntil)
+	}
+}
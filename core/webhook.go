@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ReadAllDeliveries returns a Gin middleware that fetches paginated
+// batches of the webhook delivery log, most recent first. The
+// "status" query parameter restricts results to pending, succeeded or
+// failed deliveries.
+func ReadAllDeliveries(deliveries data.Deliveries) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid page number",
+			})
+			return
+		}
+		status := c.Query("status")
+		switch status {
+		case "", data.DeliveryPending, data.DeliverySucceeded, data.DeliveryFailed:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "'status' must be one of pending, succeeded or failed",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		list, err := deliveries.ReadAll(ctx, status, 20, int64(page))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"page":           page,
+			"page_count":     int64(deliveries.Count(ctx, status) / 20),
+			"delivery_count": len(list),
+			"deliveries":     list,
+		})
+	}
+}
+
+// ReadDelivery returns a Gin middleware that fetches a webhook
+// delivery, including its payload, by its ID.
+func ReadDelivery(deliveries data.Deliveries) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		d, err := deliveries.Read(ctx, c.Param("id"))
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// Redeliver returns a Gin middleware that resends a logged webhook
+// delivery, referenced by its ID, and responds with its updated
+// record. Failed attempts respond with the delivery's error.
+func Redeliver(hooks *notify.Webhooks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if hooks == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "webhooks are not configured",
+			})
+			return
+		}
+		id := c.Param("id")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		d, err := hooks.Redeliver(ctx, id)
+		audit(c, "webhook.redeliver", id)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
@@ -0,0 +1,22 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+// Acks defines the interface of the store that counts acknowledgements
+// sent to submitters, so that their rate limits survive restarts.
+type Acks interface {
+
+	// Reserve counts an acknowledgement to the address at the given
+	// time, unless the address was acknowledged within the interval
+	// or, if the limit is positive, that many acknowledgements were
+	// counted in the same clock hour. It reports whether it counted
+	// the acknowledgement.
+	Reserve(ctx.Context, string, time.Time, time.Duration, int) (bool, error)
+
+	// Release stops counting the acknowledgement to the address
+	// reserved at the given time, e.g. because it could not be sent.
+	Release(ctx.Context, string, time.Time) error
+}
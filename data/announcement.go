@@ -0,0 +1,53 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+// Announcements defines the interface of the store of entries waiting
+// to be announced in a chat service. Entries are announced in batches,
+// and stay in the store until the message announcing them is posted,
+// so that none are lost if posting fails or the server restarts.
+type Announcements interface {
+
+	// Add stores an announcement, unless one with the same ID is
+	// already stored.
+	Add(ctx.Context, Announcement) error
+
+	// Take claims up to limit due announcements to the named chat,
+	// oldest first, for the given lease, counting an attempt, and
+	// returns them. Announcements whose lease expired are due again.
+	Take(ctx.Context, string, int, time.Duration) ([]Announcement, error)
+
+	// Done removes the announcements with the given IDs, e.g. once
+	// they were posted.
+	Done(ctx.Context, ...string) error
+}
+
+// Announcement is an entry waiting to be announced in a chat.
+type Announcement struct {
+	ID       string    `json:"id" bson:"_id"`
+	Chat     string    `json:"chat" bson:"chat"`
+	Entry    Form      `json:"entry" bson:"entry"`
+	Attempts int       `json:"attempts" bson:"attempts"`
+	Created  time.Time `json:"created" bson:"created"`
+
+	// RunAt is when the announcement is next due, i.e. when the
+	// lease of its latest attempt expires.
+	RunAt time.Time `json:"run_at" bson:"run_at"`
+}
+
+// NewAnnouncement initializes an announcement of the entry in the
+// named chat. Its ID is derived from both, so that an entry notified
+// twice, e.g. by a redelivered outbox job, is announced once.
+func NewAnnouncement(chat string, entry Form) Announcement {
+	now := time.Now().UTC()
+	return Announcement{
+		ID:      chat + ":" + entry.ID,
+		Chat:    chat,
+		Entry:   entry,
+		Created: now,
+		RunAt:   now,
+	}
+}
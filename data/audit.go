@@ -0,0 +1,72 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+// Audits defines the interface of the audit log, an append-only record
+// of the actions that users performed. Records are never updated or
+// deleted.
+type Audits interface {
+
+	// Count the number of records matching the filter.
+	Count(ctx.Context, AuditFilter) int64
+
+	// ReadAll fetches the records matching the filter, most recent
+	// first. Results are paginated.
+	ReadAll(ctx.Context, AuditFilter, int64, int64) ([]AuditRecord, error)
+
+	// Create appends records to the log.
+	Create(ctx.Context, ...AuditRecord) error
+}
+
+// AuditFilter narrows down the audit records returned by ReadAll and
+// Count. Zero-valued fields match every record.
+type AuditFilter struct {
+	User    string
+	EntryID string
+
+	// Action matches the records of the action and of its
+	// sub-actions, e.g. "status" matches "status.read".
+	Action string
+
+	// After and Before bound the time of records: records created
+	// after After and no later than Before match.
+	After  time.Time
+	Before time.Time
+}
+
+// AuditRecord records an action performed by a user.
+type AuditRecord struct {
+	ID     string `json:"id" bson:"_id"`
+	User   string `json:"user" bson:"user"`
+	Action string `json:"action" bson:"action"`
+
+	// EntryID references the entry acted on or, for actions on other
+	// resources, such as users and tokens, their ID.
+	EntryID string `json:"entry_id" bson:"entry_id"`
+
+	// Detail describes what actions on no single resource, such as
+	// listings, acted on, e.g. their query.
+	Detail string    `json:"detail,omitempty" bson:"detail,omitempty"`
+	IP     string    `json:"ip" bson:"ip"`
+	Time   time.Time `json:"time" bson:"time"`
+}
+
+// NewAuditRecord initializes a record of an action performed by user
+// on the resource with the given id, from the given address.
+func NewAuditRecord(user, action, id, addr string) (AuditRecord, error) {
+	recordID, err := randomHex(8)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+	return AuditRecord{
+		ID:      recordID,
+		User:    user,
+		Action:  action,
+		EntryID: id,
+		IP:      addr,
+		Time:    time.Now().UTC(),
+	}, nil
+}
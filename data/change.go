@@ -0,0 +1,37 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+const (
+	// ChangeCreated is the type of changes that create an entry.
+	ChangeCreated = "created"
+
+	// ChangeUpdated is the type of changes that modify an entry,
+	// e.g. its status or conversation.
+	ChangeUpdated = "updated"
+
+	// ChangeDeleted is the type of changes that delete an entry.
+	ChangeDeleted = "deleted"
+)
+
+// Changes defines the interface of a feed of changes to entries.
+type Changes interface {
+
+	// Subscribe returns a channel of changes that follow the change
+	// with the given ID, or of new changes if the ID is empty or no
+	// longer known. The channel is closed when the context ends or
+	// the feed fails.
+	Subscribe(ctx.Context, string) (<-chan Change, error)
+}
+
+// Change describes a change to an entry. The entries of deleted
+// changes may only hold their ID.
+type Change struct {
+	ID    string    `json:"id"`
+	Type  string    `json:"type"`
+	Entry Form      `json:"entry"`
+	Time  time.Time `json:"time"`
+}
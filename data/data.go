@@ -4,10 +4,27 @@ import (
 	ctx "context"
 	"errors"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+)
+
+// DefaultMailbox is the mailbox that entries are filed into when a
+// submission does not name one.
+const DefaultMailbox = "default"
+
+const (
+	// StatusUnread marks entries that nobody has handled yet.
+	StatusUnread = "unread"
+
+	// StatusRead marks entries that have been handled.
+	StatusRead = "read"
 )
 
 var (
+	mailboxRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	tagRegex     = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
 	emailRegex   = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	subjectRegex = regexp.MustCompile(`^[A-Za-z0-9\s]{1,100}$`)
 	messageRegex = regexp.MustCompile(`^[\w\s.,!?()-]{1,1000}$`)
@@ -16,12 +33,13 @@ var (
 // Data defines the Mailbox database interface.
 type Data interface {
 
-	// Count returns the number of entries in the mailbo.
-	Count(ctx.Context) int64
+	// Count returns the number of entries matching the filter.
+	Count(ctx.Context, Filter) int64
 
-	// ReadAll fetches batches of entries of arbitrary size.
-	// See the implementation in mongo.go.
-	ReadAll(ctx.Context, int64, int64) ([]Form, error)
+	// ReadAll fetches batches of entries of arbitrary size that
+	// match the filter, most recent first. See the implementation in
+	// mongo.go.
+	ReadAll(ctx.Context, Filter, int64, int64) ([]Form, error)
 
 	// Read fetches a single entry by referencing it's ID.
 	Read(ctx.Context, string) (Form, error)
@@ -29,16 +47,197 @@ type Data interface {
 	// Create a new mailbox entry.
 	Create(ctx.Context, Form) (string, error)
 
+	// Update replaces the mailbox entry sharing the form's ID.
+	Update(ctx.Context, Form) error
+
+	// Patch applies field-level changes to the entry with the given
+	// ID, and returns the changed entry.
+	Patch(ctx.Context, string, Patch) (Form, error)
+
+	// PatchAll applies field-level changes to the entries with the
+	// given IDs at once, and returns the IDs of those it changed.
+	PatchAll(ctx.Context, []string, Patch) ([]string, error)
+
 	// Delete a mailbox entry by referencing its ID.
 	Delete(ctx.Context, string) error
+
+	// DeleteAll deletes the entries with the given IDs at once, and
+	// returns the IDs of those it found.
+	DeleteAll(ctx.Context, []string) ([]string, error)
+
+	// Mailboxes lists the names of the mailboxes holding entries.
+	Mailboxes(ctx.Context) ([]string, error)
+
+	// Tags lists the tags of the entries that match the filter.
+	Tags(ctx.Context, Filter) ([]string, error)
+
+	// Summarize counts the entries that match the filter, without
+	// fetching them, along with the senders of the most entries, up
+	// to the given number of senders.
+	Summarize(ctx.Context, Filter, int) (Summary, error)
+
+	// Transact calls fn in a transaction, if the database supports
+	// them: the changes that fn makes through the context it is given,
+	// with any of the stores, are saved together, or not at all if fn
+	// fails. Otherwise, they are saved as fn makes them.
+	Transact(ctx.Context, func(ctx.Context) error) error
+}
+
+// Filter narrows down the entries returned by ReadAll and Count.
+// Zero-valued fields match every entry.
+type Filter struct {
+	// IDs, if not nil, matches the entries with any of the IDs.
+	IDs []string
+
+	Mailbox  string
+	Status   string
+	Tag      string
+	Assignee string
+
+	// States matches the entries in any of the states. An empty state
+	// matches the entries without one.
+	States []string
+
+	// After and Before bound the creation time of entries: entries
+	// created after After and no later than Before match.
+	After  time.Time
+	Before time.Time
+}
+
+// Summary aggregates the entries that match a filter.
+type Summary struct {
+	Count  int `bson:"count"`
+	Unread int `bson:"unread"`
+
+	// Senders lists the senders of the most entries, ordered by
+	// their number of entries and then by address. Addresses are
+	// lowercase.
+	Senders []SenderCount `bson:"senders"`
+}
+
+// SenderCount counts the entries submitted by an address.
+type SenderCount struct {
+	Address string `bson:"_id"`
+	Count   int    `bson:"count"`
 }
 
 // Form defines a single mailbox entry.
 type Form struct {
-	ID      string `json:"id" bson:"_id,omitempty"`
-	From    string `json:"from" bson:"from" binding:"required"`
-	Subject string `json:"subject" bson:"subject" binding:"required"`
-	Message string `json:"message" bson:"message" binding:"required"`
+	ID      string    `json:"id" bson:"_id,omitempty"`
+	Mailbox string    `json:"mailbox" bson:"mailbox"`
+	Status  string    `json:"status" bson:"status"`
+	From    string    `json:"from" bson:"from" binding:"required"`
+	Subject string    `json:"subject" bson:"subject" binding:"required"`
+	Message string    `json:"message" bson:"message" binding:"required"`
+	Created time.Time `json:"created" bson:"created"`
+	Replies []Reply   `json:"replies,omitempty" bson:"replies,omitempty"`
+	Tags    []string  `json:"tags,omitempty" bson:"tags,omitempty"`
+
+	// Assignee is the username of the user handling the entry, and
+	// Notes are comments left by users, which submitters never see.
+	Assignee string `json:"assignee,omitempty" bson:"assignee,omitempty"`
+	Notes    []Note `json:"notes,omitempty" bson:"notes,omitempty"`
+
+	// State is the entry's workflow state, and History records the
+	// changes to its state and assignee. Overdue is computed from the
+	// Workflow when the entry is served, rather than stored.
+	State   string     `json:"state,omitempty" bson:"state,omitempty"`
+	History []Revision `json:"history,omitempty" bson:"history,omitempty"`
+	Overdue bool       `json:"overdue,omitempty" bson:"-"`
+
+	// Attachments of entries received by email.
+	Attachments []Attachment `json:"attachments,omitempty" bson:"attachments,omitempty"`
+}
+
+// Reply records an email sent in response to an entry, or a follow-up
+// received from its submitter. Together, an entry's replies form a
+// conversation.
+type Reply struct {
+	Inbound     bool         `json:"inbound" bson:"inbound"`
+	Author      string       `json:"author,omitempty" bson:"author,omitempty"`
+	From        string       `json:"from" bson:"from"`
+	To          string       `json:"to" bson:"to"`
+	Subject     string       `json:"subject" bson:"subject"`
+	Body        string       `json:"body" bson:"body"`
+	Sent        time.Time    `json:"sent" bson:"sent"`
+	Attachments []Attachment `json:"attachments,omitempty" bson:"attachments,omitempty"`
+}
+
+// Note is an internal comment on an entry.
+type Note struct {
+	Author  string    `json:"author" bson:"author"`
+	Body    string    `json:"body" bson:"body"`
+	Created time.Time `json:"created" bson:"created"`
+}
+
+// Revision records a change to a field of an entry.
+type Revision struct {
+	Field   string    `json:"field" bson:"field"`
+	From    string    `json:"from" bson:"from"`
+	To      string    `json:"to" bson:"to"`
+	Author  string    `json:"author" bson:"author"`
+	Changed time.Time `json:"changed" bson:"changed"`
+}
+
+// NewRevision records a change of the field from one value to another
+// by author, made now.
+func NewRevision(field, from, to, author string) Revision {
+	return Revision{
+		Field:   field,
+		From:    from,
+		To:      to,
+		Author:  author,
+		Changed: time.Now().UTC(),
+	}
+}
+
+// Patch describes field-level changes to an entry. Unlike replacing the
+// entry, patching it keeps the changes that others made to its other
+// fields in the meantime.
+type Patch struct {
+	// Status, Mailbox, Assignee and State set the fields, if not nil.
+	Status   *string
+	Mailbox  *string
+	Assignee *string
+	State    *string
+
+	// AddTags and RemoveTags add and remove tags. Tags in both are
+	// removed.
+	AddTags    []string
+	RemoveTags []string
+
+	// Notes, Replies and History are appended to the entry's.
+	Notes   []Note
+	Replies []Reply
+	History []Revision
+
+	// The remaining fields are conditions: entries that do not meet
+	// them fail Patch with ErrMongoConflict, and are skipped by
+	// PatchAll. IfStates, if not nil, requires the entry to be in any
+	// of the states, as Filter.States does. IfAssignee, if not nil,
+	// requires it to be assigned to the user, or unassigned if empty.
+	// MaxNotes, if not zero, requires it to have at most MaxNotes
+	// notes once Notes are appended.
+	IfStates   []string
+	IfAssignee *string
+	MaxNotes   int
+}
+
+// Validate a note's 'Body' field. Returns a human-friendly error
+// message.
+func (n Note) Validate() error {
+	if strings.TrimSpace(n.Body) == "" || len(n.Body) > 5000 {
+		return errors.New("'body' must be 1-5000 characters long")
+	}
+	return nil
+}
+
+// Attachment describes a file attached to an inbound email. Contents
+// are not stored.
+type Attachment struct {
+	Filename    string `json:"filename" bson:"filename"`
+	ContentType string `json:"content_type" bson:"content_type"`
+	Size        int    `json:"size" bson:"size"`
 }
 
 // FormWithCaptcha encapsulates a Form with a captcha token and
@@ -48,9 +247,90 @@ type FormWithCaptcha struct {
 	Captcha string `json:"captcha" binding:"required"`
 }
 
-// Validate a form's 'From', 'Subject', and 'Message' fields.
-// returns a human-friendly error message.
+// Submission returns a copy of the form that only retains the fields
+// a submitter may set. Server-managed fields are reset.
+func (f Form) Submission() Form {
+	return Form{
+		Mailbox: f.Mailbox,
+		From:    f.From,
+		Subject: f.Subject,
+		Message: f.Message,
+	}
+}
+
+// Redacted returns a copy of the form without its notes, which are
+// internal to Mailbox users, for sending outside of Mailbox. Unless
+// workflow is set, its assignee and history are removed as well.
+func (f Form) Redacted(workflow bool) Form {
+	f.Notes = nil
+	if !workflow {
+		f.Assignee, f.History = "", nil
+	}
+	return f
+}
+
+// Thread returns the entry's conversation in chronological order,
+// starting with the original submission.
+func (f Form) Thread() []Reply {
+	return append([]Reply{{
+		Inbound:     true,
+		From:        f.From,
+		Subject:     f.Subject,
+		Body:        f.Message,
+		Sent:        f.Created,
+		Attachments: f.Attachments,
+	}}, f.Replies...)
+}
+
+// ValidMailbox reports whether name is a valid mailbox name: 1-32
+// lowercase letters, numbers, '_' and '-'.
+func ValidMailbox(name string) bool {
+	return mailboxRegex.MatchString(name)
+}
+
+// ValidateTags checks that tags are 1-32 lowercase letters, numbers,
+// '_' and '-'. Returns a human-friendly error message.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if !tagRegex.MatchString(tag) {
+			return errors.New("tags must be 1-32 characters long and contain only lowercase letters, numbers, '_' and '-'")
+		}
+	}
+	return nil
+}
+
+// Tag adds and removes tags, keeping the form's tags sorted and free
+// of duplicates. It reports whether the tags changed.
+func (f *Form) Tag(add, remove []string) bool {
+	set := map[string]bool{}
+	for _, tag := range f.Tags {
+		set[tag] = true
+	}
+	for _, tag := range add {
+		set[tag] = true
+	}
+	for _, tag := range remove {
+		delete(set, tag)
+	}
+	tags := []string{}
+	for tag := range set {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	if slices.Equal(tags, f.Tags) {
+		return false
+	}
+	f.Tags = tags
+	return true
+}
+
+// Validate a form's 'Mailbox', 'From', 'Subject', and 'Message'
+// fields. returns a human-friendly error message.
 func (f Form) Validate() error {
+	if f.Mailbox != "" && !mailboxRegex.MatchString(f.Mailbox) {
+		return errors.New("'mailbox' field must be 1-32 characters long and contain only lowercase letters, numbers, '_' and '-'")
+	}
+
 	if strings.TrimSpace(f.From) == "" {
 		return errors.New("'from' field is required")
 	}
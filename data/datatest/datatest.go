@@ -0,0 +1,549 @@
+// Package datatest provides in-memory implementations of the Mailbox
+// database interfaces, for testing the packages built on them. They
+// apply the same conditions as the MongoDB implementations, but make
+// no attempt to be efficient.
+package datatest
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Data is an in-memory data.Data.
+type Data struct {
+	mu    sync.Mutex
+	forms map[string]data.Form
+}
+
+// NewData initializes a Data holding the given entries. Entries
+// without an ID are assigned one.
+func NewData(forms ...data.Form) *Data {
+	d := &Data{forms: map[string]data.Form{}}
+	for _, f := range forms {
+		if f.ID == "" {
+			f.ID = primitive.NewObjectID().Hex()
+		}
+		normalize(&f)
+		d.forms[f.ID] = f
+	}
+	return d
+}
+
+// normalize fills in the fields that MongoDB entries default.
+func normalize(f *data.Form) {
+	if f.Mailbox == "" {
+		f.Mailbox = data.DefaultMailbox
+	}
+	if f.Status == "" {
+		f.Status = data.StatusUnread
+	}
+	if f.Created.IsZero() {
+		f.Created = time.Now().UTC()
+	}
+	sort.Strings(f.Tags)
+}
+
+// clone copies the form's slices, so that callers cannot change stored
+// entries.
+func clone(f data.Form) data.Form {
+	f.Replies = slices.Clone(f.Replies)
+	f.Tags = slices.Clone(f.Tags)
+	f.Notes = slices.Clone(f.Notes)
+	f.History = slices.Clone(f.History)
+	f.Attachments = slices.Clone(f.Attachments)
+	return f
+}
+
+// match reports whether the form matches the filter.
+func match(f data.Form, filter data.Filter) bool {
+	switch {
+	case filter.IDs != nil && !slices.Contains(filter.IDs, f.ID),
+		filter.Mailbox != "" && f.Mailbox != filter.Mailbox,
+		filter.Status != "" && f.Status != filter.Status,
+		filter.Tag != "" && !slices.Contains(f.Tags, filter.Tag),
+		filter.Assignee != "" && f.Assignee != filter.Assignee,
+		len(filter.States) > 0 && !slices.Contains(filter.States, f.State),
+		!filter.After.IsZero() && !f.Created.After(filter.After),
+		!filter.Before.IsZero() && f.Created.After(filter.Before):
+		return false
+	}
+	return true
+}
+
+// matchPatch reports whether the form meets the patch's conditions.
+func matchPatch(f data.Form, p data.Patch) bool {
+	switch {
+	case p.IfStates != nil && !slices.Contains(p.IfStates, f.State),
+		p.IfAssignee != nil && f.Assignee != *p.IfAssignee,
+		p.MaxNotes != 0 && len(f.Notes)+len(p.Notes) > p.MaxNotes:
+		return false
+	}
+	return true
+}
+
+// apply applies the patch's changes to the form.
+func apply(f *data.Form, p data.Patch) {
+	for _, field := range []struct {
+		dst *string
+		src *string
+	}{{&f.Status, p.Status}, {&f.Mailbox, p.Mailbox}, {&f.Assignee, p.Assignee},
+		{&f.State, p.State}} {
+		if field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+	if len(p.AddTags) > 0 || len(p.RemoveTags) > 0 {
+		f.Tag(p.AddTags, p.RemoveTags)
+	}
+	f.Notes = append(f.Notes, p.Notes...)
+	f.Replies = append(f.Replies, p.Replies...)
+	f.History = append(f.History, p.History...)
+}
+
+// sorted returns the entries matching the filter, most recent first.
+func (d *Data) sorted(filter data.Filter) []data.Form {
+	forms := []data.Form{}
+	for _, f := range d.forms {
+		if match(f, filter) {
+			forms = append(forms, clone(f))
+		}
+	}
+	sort.Slice(forms, func(i, j int) bool {
+		if forms[i].Created.Equal(forms[j].Created) {
+			return forms[i].ID > forms[j].ID
+		}
+		return forms[i].Created.After(forms[j].Created)
+	})
+	return forms
+}
+
+func (d *Data) Count(_ context.Context, filter data.Filter) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return int64(len(d.sorted(filter)))
+}
+
+func (d *Data) ReadAll(_ context.Context, filter data.Filter, batch, page int64) ([]data.Form, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	forms := d.sorted(filter)
+	start := min(batch*page, int64(len(forms)))
+	end := min(start+batch, int64(len(forms)))
+	return forms[start:end], nil
+}
+
+func (d *Data) Read(_ context.Context, id string) (data.Form, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return data.Form{}, data.ErrMongoInvalidID
+	}
+	f, ok := d.forms[id]
+	if !ok {
+		return data.Form{}, data.ErrMongoNotFound
+	}
+	return clone(f), nil
+}
+
+func (d *Data) Create(_ context.Context, f data.Form) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f = clone(f)
+	f.ID = primitive.NewObjectID().Hex()
+	normalize(&f)
+	d.forms[f.ID] = f
+	return f.ID, nil
+}
+
+func (d *Data) Update(_ context.Context, f data.Form) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.forms[f.ID]; !ok {
+		return data.ErrMongoNotFound
+	}
+	f = clone(f)
+	normalize(&f)
+	d.forms[f.ID] = f
+	return nil
+}
+
+func (d *Data) Patch(_ context.Context, id string, p data.Patch) (data.Form, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.forms[id]
+	if !ok {
+		return data.Form{}, data.ErrMongoNotFound
+	}
+	if !matchPatch(f, p) {
+		return data.Form{}, data.ErrMongoConflict
+	}
+	f = clone(f)
+	apply(&f, p)
+	d.forms[id] = f
+	return clone(f), nil
+}
+
+func (d *Data) PatchAll(_ context.Context, ids []string, p data.Patch) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := []string{}
+	for _, id := range ids {
+		f, ok := d.forms[id]
+		if !ok || !matchPatch(f, p) || slices.Contains(found, id) {
+			continue
+		}
+		f = clone(f)
+		apply(&f, p)
+		d.forms[id] = f
+		found = append(found, id)
+	}
+	return found, nil
+}
+
+// Transact restores the entries as they were before fn if it fails.
+// Changes made concurrently with fn are undone too.
+func (d *Data) Transact(ctx context.Context, fn func(context.Context) error) error {
+	d.mu.Lock()
+	saved := map[string]data.Form{}
+	for id, f := range d.forms {
+		saved[id] = clone(f)
+	}
+	d.mu.Unlock()
+	if err := fn(ctx); err != nil {
+		d.mu.Lock()
+		d.forms = saved
+		d.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (d *Data) Delete(_ context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.forms[id]; !ok {
+		return data.ErrMongoNotFound
+	}
+	delete(d.forms, id)
+	return nil
+}
+
+func (d *Data) DeleteAll(_ context.Context, ids []string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := []string{}
+	for _, id := range ids {
+		if _, ok := d.forms[id]; ok {
+			delete(d.forms, id)
+			found = append(found, id)
+		}
+	}
+	return found, nil
+}
+
+func (d *Data) Mailboxes(context.Context) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	mailboxes := []string{}
+	for _, f := range d.forms {
+		if !slices.Contains(mailboxes, f.Mailbox) {
+			mailboxes = append(mailboxes, f.Mailbox)
+		}
+	}
+	sort.Strings(mailboxes)
+	return mailboxes, nil
+}
+
+func (d *Data) Tags(_ context.Context, filter data.Filter) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tags := []string{}
+	for _, f := range d.sorted(filter) {
+		for _, tag := range f.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (d *Data) Summarize(_ context.Context, filter data.Filter, senders int) (data.Summary, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	summary := data.Summary{Senders: []data.SenderCount{}}
+	counts := map[string]int{}
+	for _, f := range d.sorted(filter) {
+		summary.Count++
+		if f.Status != data.StatusRead {
+			summary.Unread++
+		}
+		counts[strings.ToLower(f.From)]++
+	}
+	for address, count := range counts {
+		summary.Senders = append(summary.Senders, data.SenderCount{Address: address, Count: count})
+	}
+	sort.Slice(summary.Senders, func(i, j int) bool {
+		a, b := summary.Senders[i], summary.Senders[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Address < b.Address
+	})
+	summary.Senders = summary.Senders[:min(max(senders, 0), len(summary.Senders))]
+	return summary, nil
+}
+
+// Users is an in-memory data.Users.
+type Users struct {
+	mu    sync.Mutex
+	users map[string]data.User
+}
+
+// NewUsers initializes a Users holding the given users.
+func NewUsers(users ...data.User) *Users {
+	u := &Users{users: map[string]data.User{}}
+	for _, user := range users {
+		u.users[user.Username] = user
+	}
+	return u
+}
+
+func (u *Users) Count(context.Context) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return int64(len(u.users))
+}
+
+func (u *Users) ReadAll(context.Context) ([]data.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	users := []data.User{}
+	for _, user := range u.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (u *Users) Read(_ context.Context, username string) (data.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[username]
+	if !ok {
+		return data.User{}, data.ErrMongoNotFound
+	}
+	user.RecoveryCodes = slices.Clone(user.RecoveryCodes)
+	return user, nil
+}
+
+func (u *Users) Create(_ context.Context, user data.User) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.users[user.Username]; ok {
+		return data.ErrMongoDuplicate
+	}
+	u.users[user.Username] = user
+	return nil
+}
+
+func (u *Users) Delete(_ context.Context, username string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.users[username]; !ok {
+		return data.ErrMongoNotFound
+	}
+	delete(u.users, username)
+	return nil
+}
+
+func (u *Users) SetPassword(_ context.Context, username, hash string) error {
+	return u.change(username, func(user *data.User) { user.Hash = hash })
+}
+
+func (u *Users) SetRole(_ context.Context, username, role string) error {
+	return u.change(username, func(user *data.User) { user.Role = role })
+}
+
+func (u *Users) SetTOTP(_ context.Context, totp data.User) error {
+	return u.change(totp.Username, func(user *data.User) {
+		user.TOTPEnabled = totp.TOTPEnabled
+		user.TOTPSecret = totp.TOTPSecret
+		user.TOTPLastStep = totp.TOTPLastStep
+		user.RecoveryCodes = slices.Clone(totp.RecoveryCodes)
+	})
+}
+
+// change applies fn to the stored user with the given username.
+func (u *Users) change(username string, fn func(*data.User)) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[username]
+	if !ok {
+		return data.ErrMongoNotFound
+	}
+	fn(&user)
+	u.users[username] = user
+	return nil
+}
+
+func (u *Users) UseTOTPStep(_ context.Context, username string, step int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[username]
+	if !ok || user.TOTPLastStep >= step {
+		return data.ErrMongoConflict
+	}
+	user.TOTPLastStep = step
+	u.users[username] = user
+	return nil
+}
+
+func (u *Users) UseRecoveryCode(_ context.Context, username, hash string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[username]
+	i := slices.Index(user.RecoveryCodes, hash)
+	if !ok || i < 0 {
+		return data.ErrMongoConflict
+	}
+	user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), i, i+1)
+	u.users[username] = user
+	return nil
+}
+
+// LoginFailed counts a failed login, locking the user out for 15
+// minutes after 5 in a row, as MongoUsers does.
+func (u *Users) LoginFailed(_ context.Context, username string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[username]
+	if !ok {
+		return data.ErrMongoNotFound
+	}
+	user.FailedLogins++
+	if user.FailedLogins >= 5 {
+		user.FailedLogins = 0
+		user.LockedUntil = time.Now().Add(15 * time.Minute)
+	}
+	u.users[username] = user
+	return nil
+}
+
+func (u *Users) LoginSucceeded(_ context.Context, username string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[username]
+	if !ok {
+		return data.ErrMongoNotFound
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = time.Time{}
+	u.users[username] = user
+	return nil
+}
+
+// UIDs is an in-memory data.UIDs.
+type UIDs struct {
+	mu       sync.Mutex
+	next     map[string]uint32
+	assigned map[string]map[string]uint32
+}
+
+// NewUIDs initializes an empty UIDs.
+func NewUIDs() *UIDs {
+	return &UIDs{next: map[string]uint32{}, assigned: map[string]map[string]uint32{}}
+}
+
+func (u *UIDs) Assign(_ context.Context, mailbox string, ids []string) (data.UIDMap, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.assigned[mailbox] == nil {
+		u.assigned[mailbox] = map[string]uint32{}
+		u.next[mailbox] = 1
+	}
+	result := data.UIDMap{Validity: 1, UIDs: make([]uint32, len(ids))}
+	uids := map[string]uint32{}
+	for i, id := range ids {
+		uid, ok := u.assigned[mailbox][id]
+		if !ok {
+			uid = u.next[mailbox]
+			u.next[mailbox]++
+		}
+		uids[id] = uid
+		result.UIDs[i] = uid
+	}
+	u.assigned[mailbox] = uids
+	result.Next = u.next[mailbox]
+	return result, nil
+}
+
+// Audits is an in-memory data.Audits.
+type Audits struct {
+	mu      sync.Mutex
+	records []data.AuditRecord
+}
+
+// NewAudits initializes an empty Audits.
+func NewAudits() *Audits {
+	return &Audits{}
+}
+
+// matchAudit reports whether the record matches the filter.
+func matchAudit(r data.AuditRecord, f data.AuditFilter) bool {
+	switch {
+	case f.User != "" && r.User != f.User,
+		f.EntryID != "" && r.EntryID != f.EntryID,
+		f.Action != "" && r.Action != f.Action &&
+			!strings.HasPrefix(r.Action, f.Action+"."),
+		!f.After.IsZero() && !r.Time.After(f.After),
+		!f.Before.IsZero() && r.Time.After(f.Before):
+		return false
+	}
+	return true
+}
+
+func (a *Audits) Count(_ context.Context, f data.AuditFilter) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	count := int64(0)
+	for _, r := range a.records {
+		if matchAudit(r, f) {
+			count++
+		}
+	}
+	return count
+}
+
+func (a *Audits) ReadAll(_ context.Context, f data.AuditFilter, batch, page int64) ([]data.AuditRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	records := []data.AuditRecord{}
+	for _, r := range a.records {
+		if matchAudit(r, f) {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.After(records[j].Time)
+	})
+	start := min(batch*page, int64(len(records)))
+	end := min(start+batch, int64(len(records)))
+	return records[start:end], nil
+}
+
+func (a *Audits) Create(_ context.Context, records ...data.AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, records...)
+	return nil
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+const (
+	// DeliveryPending marks a webhook delivery that is still being
+	// attempted.
+	DeliveryPending = "pending"
+
+	// DeliverySucceeded marks a webhook delivery that the receiver
+	// acknowledged with a 2xx response.
+	DeliverySucceeded = "succeeded"
+
+	// DeliveryFailed marks a webhook delivery whose attempts were all
+	// unsuccessful.
+	DeliveryFailed = "failed"
+)
+
+// Deliveries defines the webhook delivery log interface.
+type Deliveries interface {
+
+	// Count the number of deliveries with the given status, or of
+	// all deliveries if status is empty.
+	Count(ctx.Context, string) int64
+
+	// ReadAll fetches deliveries with the given status (or all
+	// deliveries if status is empty), most recent first. Results
+	// are paginated.
+	ReadAll(ctx.Context, string, int64, int64) ([]Delivery, error)
+
+	// Read fetches a single delivery by referencing its ID.
+	Read(ctx.Context, string) (Delivery, error)
+
+	// Create a new delivery record.
+	Create(ctx.Context, Delivery) error
+
+	// Update replaces the delivery record with the same ID.
+	Update(ctx.Context, Delivery) error
+}
+
+// Delivery records an event sent to a webhook endpoint and the outcome
+// of the latest attempt to send it.
+type Delivery struct {
+	ID         string    `json:"id" bson:"_id"`
+	Event      string    `json:"event" bson:"event"`
+	EntryID    string    `json:"entry_id" bson:"entry_id"`
+	URL        string    `json:"url" bson:"url"`
+	Payload    string    `json:"payload" bson:"payload"`
+	Status     string    `json:"status" bson:"status"`
+	Attempts   int       `json:"attempts" bson:"attempts"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	Created    time.Time `json:"created" bson:"created"`
+	Updated    time.Time `json:"updated" bson:"updated"`
+}
+
+// NewDelivery initializes a pending delivery of the JSON payload
+// describing event to url.
+func NewDelivery(event, entryID, url string, payload []byte) (Delivery, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Delivery{}, err
+	}
+	now := time.Now().UTC()
+	return Delivery{
+		ID:      id,
+		Event:   event,
+		EntryID: entryID,
+		URL:     url,
+		Payload: string(payload),
+		Status:  DeliveryPending,
+		Created: now,
+		Updated: now,
+	}, nil
+}
+
+// Attempted records the outcome of an attempt to deliver. The status
+// code is zero if no response was received. Unless final, a failed
+// attempt leaves the delivery pending.
+func (d *Delivery) Attempted(statusCode int, err error, final bool) {
+	d.Attempts++
+	d.StatusCode = statusCode
+	d.Updated = time.Now().UTC()
+	d.Error = ""
+	switch {
+	case err == nil:
+		d.Status = DeliverySucceeded
+	case final:
+		d.Status = DeliveryFailed
+		d.Error = err.Error()
+	default:
+		d.Status = DeliveryPending
+		d.Error = err.Error()
+	}
+}
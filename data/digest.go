@@ -0,0 +1,33 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+// Digests defines the interface of the store that keeps the state of
+// scheduled digests, so that restarts neither resend nor skip them.
+type Digests interface {
+
+	// Read fetches the digest state of a mailbox. It returns
+	// ErrMongoNotFound if no digest was recorded yet.
+	Read(ctx.Context, string) (Digest, error)
+
+	// Complete records that the mailbox's digest was sent for the
+	// period ending at the given time, and deducts the rejections
+	// that it reported.
+	Complete(ctx.Context, string, time.Time, int64) error
+
+	// Reject counts a rejected submission to the mailbox.
+	Reject(ctx.Context, string) error
+}
+
+// Digest is the state of a mailbox's scheduled digest.
+type Digest struct {
+	Mailbox string    `json:"mailbox" bson:"_id"`
+	LastRun time.Time `json:"last_run" bson:"last_run"`
+
+	// Rejected counts the submissions rejected since the last
+	// digest.
+	Rejected int64 `json:"rejected" bson:"rejected"`
+}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	ctx "context"
+	"time"
+)
+
+const (
+	// JobPending marks a job that waits for its next attempt.
+	JobPending = "pending"
+
+	// JobRunning marks a job claimed by a worker.
+	JobRunning = "running"
+
+	// JobSucceeded marks a job that was delivered.
+	JobSucceeded = "succeeded"
+
+	// JobDead marks a job whose attempts were all unsuccessful. Dead
+	// jobs are only retried on request.
+	JobDead = "dead"
+)
+
+// JobRetention is how long succeeded jobs are kept, e.g. for inspection,
+// before they are deleted. Dead jobs are kept until they are retried.
+var JobRetention = 24 * time.Hour
+
+// Jobs defines the interface of the outbox, a persistent queue of
+// events to deliver to notifiers.
+type Jobs interface {
+
+	// Count the number of jobs with the given status, or of all jobs
+	// if status is empty.
+	Count(ctx.Context, string) int64
+
+	// ReadAll fetches jobs with the given status (or all jobs if
+	// status is empty), most recent first. Results are paginated.
+	ReadAll(ctx.Context, string, int64, int64) ([]Job, error)
+
+	// Read fetches a single job by referencing its ID.
+	Read(ctx.Context, string) (Job, error)
+
+	// Create new jobs at once.
+	Create(ctx.Context, ...Job) error
+
+	// Update replaces the job with the same ID.
+	Update(ctx.Context, Job) error
+
+	// Claim atomically marks the due job that has waited longest as
+	// running for the given lease, counting an attempt, and returns
+	// it. Running jobs whose lease expired are due again. It returns
+	// ErrMongoNotFound if no job is due.
+	Claim(ctx.Context, time.Duration) (Job, error)
+}
+
+// Job is an event queued for delivery to a notifier.
+type Job struct {
+	ID       string    `json:"id" bson:"_id"`
+	Target   string    `json:"target" bson:"target"`
+	Event    string    `json:"event" bson:"event"`
+	EntryID  string    `json:"entry_id" bson:"entry_id"`
+	Payload  string    `json:"payload" bson:"payload"`
+	Status   string    `json:"status" bson:"status"`
+	Attempts int       `json:"attempts" bson:"attempts"`
+	Error    string    `json:"error,omitempty" bson:"error,omitempty"`
+	Created  time.Time `json:"created" bson:"created"`
+	Updated  time.Time `json:"updated" bson:"updated"`
+
+	// RunAt is when a pending job is next attempted, or when the
+	// lease of a running job expires.
+	RunAt time.Time `json:"run_at" bson:"run_at"`
+}
+
+// NewJob initializes a pending job that delivers the JSON payload
+// describing event to the named target.
+func NewJob(target, event, entryID string, payload []byte) (Job, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now().UTC()
+	return Job{
+		ID:      id,
+		Target:  target,
+		Event:   event,
+		EntryID: entryID,
+		Payload: string(payload),
+		Status:  JobPending,
+		Created: now,
+		Updated: now,
+		RunAt:   now,
+	}, nil
+}
+
+// Attempted records the outcome of the job's latest attempt. Failed
+// jobs are retried after the given delay, or dead-lettered if final.
+func (j *Job) Attempted(err error, final bool, delay time.Duration) {
+	now := time.Now().UTC()
+	j.Updated = now
+	j.Error = ""
+	switch {
+	case err == nil:
+		j.Status = JobSucceeded
+	case final:
+		j.Status = JobDead
+		j.Error = err.Error()
+	default:
+		j.Status = JobPending
+		j.Error = err.Error()
+		j.RunAt = now.Add(delay)
+	}
+}
+
+// Requeue makes the job pending again, with a fresh set of attempts.
+func (j *Job) Requeue() {
+	now := time.Now().UTC()
+	j.Status = JobPending
+	j.Attempts = 0
+	j.Error = ""
+	j.Updated = now
+	j.RunAt = now
+}
@@ -3,10 +3,14 @@ package data
 import (
 	"context"
 	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongodb "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"sync"
+	"time"
 )
 
 var (
@@ -22,6 +26,10 @@ var (
 	// create a new mailbox entry.
 	ErrMongoFailCreate = errors.New("could not submit form, please try again later")
 
+	// ErrMongoFailUpdate is returned when MongoDB fails to
+	// update a mailbox entry.
+	ErrMongoFailUpdate = errors.New("could not update form, please try again later")
+
 	// ErrMongoFailDelete is returned when MongoDB fails to
 	// delete a mailbox entry.
 	ErrMongoFailDelete = errors.New("could not delete form, please try again later")
@@ -33,11 +41,24 @@ var (
 	// ErrMongoInternal is returned when an internal database
 	// error occurs.
 	ErrMongoInternal = errors.New("internal server error")
+
+	// ErrMongoDuplicate is returned when creating a document
+	// whose ID is already taken.
+	ErrMongoDuplicate = errors.New("resource already exists")
+
+	// ErrMongoConflict is returned when a conditional update does
+	// not apply, because the document changed in the meantime.
+	ErrMongoConflict = errors.New("the resource was changed concurrently, please try again")
 )
 
 // Mongo implements the Data interface with a MongoDB backend.
 type Mongo struct {
 	coll *mongodb.Collection
+
+	// txnOnce checks whether the server supports transactions, i.e.
+	// is part of a replica set or sharded cluster.
+	txnOnce sync.Once
+	txn     bool
 }
 
 // NewMongo initializes a new Mongo Data instance.
@@ -48,8 +69,193 @@ func NewMongo(coll *mongodb.Collection) (Data, error) {
 	return &Mongo{coll: coll}, nil
 }
 
+// mongoFilter translates a Filter into a MongoDB query. Entries
+// created before mailboxes (or statuses) were introduced have no
+// mailbox (or status) field and belong to the default mailbox (and are
+// unread).
+func mongoFilter(f Filter) bson.D {
+	query := bson.D{}
+	if f.IDs != nil {
+		query = append(query, bson.E{Key: "_id", Value: bson.D{
+			{Key: "$in", Value: mongoIDs(f.IDs)},
+		}})
+	}
+	switch f.Mailbox {
+	case "":
+	case DefaultMailbox:
+		query = append(query, bson.E{Key: "mailbox", Value: bson.D{
+			{Key: "$in", Value: bson.A{DefaultMailbox, nil, ""}},
+		}})
+	default:
+		query = append(query, bson.E{Key: "mailbox", Value: f.Mailbox})
+	}
+	switch f.Status {
+	case "":
+	case StatusUnread:
+		query = append(query, bson.E{Key: "status", Value: bson.D{
+			{Key: "$in", Value: bson.A{StatusUnread, nil, ""}},
+		}})
+	default:
+		query = append(query, bson.E{Key: "status", Value: f.Status})
+	}
+	if f.Tag != "" {
+		query = append(query, bson.E{Key: "tags", Value: f.Tag})
+	}
+	if f.Assignee != "" {
+		query = append(query, bson.E{Key: "assignee", Value: f.Assignee})
+	}
+	if len(f.States) > 0 {
+		query = append(query, mongoStates(f.States))
+	}
+	created := bson.D{}
+	if !f.After.IsZero() {
+		created = append(created, bson.E{Key: "$gt", Value: f.After})
+	}
+	if !f.Before.IsZero() {
+		created = append(created, bson.E{Key: "$lte", Value: f.Before})
+	}
+	if len(created) > 0 {
+		query = append(query, bson.E{Key: "created", Value: created})
+	}
+	return query
+}
+
+// mongoIDs translates entry IDs into MongoDB IDs, dropping invalid ones.
+func mongoIDs(ids []string) bson.A {
+	objIDs := bson.A{}
+	for _, id := range ids {
+		if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objIDs = append(objIDs, objID)
+		}
+	}
+	return objIDs
+}
+
+// mongoStates matches the entries in any of the states, where an empty
+// state matches the entries without one.
+func mongoStates(states []string) bson.E {
+	values := bson.A{}
+	for _, state := range states {
+		if state == "" {
+			values = append(values, nil)
+		}
+		values = append(values, state)
+	}
+	return bson.E{Key: "state", Value: bson.D{{Key: "$in", Value: values}}}
+}
+
+// mongoUpdate translates a Patch into a single MongoDB update, so that
+// its changes apply atomically. It is an aggregation pipeline, since
+// update operators cannot add and remove tags in the same update, or
+// nil if the patch changes nothing. Values are wrapped in $literal,
+// lest strings starting with '$' be read as field paths.
+func mongoUpdate(p Patch) bson.A {
+	set := bson.D{}
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{{"status", p.Status}, {"mailbox", p.Mailbox}, {"assignee", p.Assignee},
+		{"state", p.State}} {
+		if field.value != nil {
+			set = append(set, bson.E{Key: field.key, Value: bson.D{
+				{Key: "$literal", Value: *field.value},
+			}})
+		}
+	}
+	for _, field := range []struct {
+		key    string
+		values any
+		count  int
+	}{{"notes", p.Notes, len(p.Notes)}, {"replies", p.Replies, len(p.Replies)},
+		{"history", p.History, len(p.History)}} {
+		if field.count > 0 {
+			set = append(set, bson.E{Key: field.key, Value: bson.D{
+				{Key: "$concatArrays", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$" + field.key, bson.A{}}}},
+					bson.D{{Key: "$literal", Value: field.values}},
+				}},
+			}})
+		}
+	}
+	if len(p.AddTags) > 0 || len(p.RemoveTags) > 0 {
+		// Tags in both are removed, and the result is free of
+		// duplicates. Reads sort tags.
+		set = append(set, bson.E{Key: "tags", Value: bson.D{
+			{Key: "$setDifference", Value: bson.A{
+				bson.D{{Key: "$setUnion", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$tags", bson.A{}}}},
+					bson.D{{Key: "$literal", Value: nonNil(p.AddTags)}},
+				}}},
+				bson.D{{Key: "$literal", Value: nonNil(p.RemoveTags)}},
+			}},
+		}})
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return bson.A{bson.D{{Key: "$set", Value: set}}}
+}
+
+// nonNil returns s, or an empty slice if s is nil, which MongoDB would
+// store as null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// patchFilter restricts query to the entries that meet the patch's
+// conditions.
+func patchFilter(query bson.D, p Patch) bson.D {
+	if p.IfStates != nil {
+		query = append(query, mongoStates(p.IfStates))
+	}
+	if p.IfAssignee != nil {
+		if *p.IfAssignee == "" {
+			query = append(query, bson.E{Key: "assignee", Value: bson.D{
+				{Key: "$in", Value: bson.A{"", nil}},
+			}})
+		} else {
+			query = append(query, bson.E{Key: "assignee", Value: *p.IfAssignee})
+		}
+	}
+	if p.MaxNotes != 0 {
+		// The entry has room for the notes if it lacks the note at
+		// index MaxNotes - len(Notes).
+		if room := p.MaxNotes - len(p.Notes); room >= 0 {
+			query = append(query, bson.E{Key: fmt.Sprintf("notes.%d", room),
+				Value: bson.D{{Key: "$exists", Value: false}}})
+		} else {
+			query = append(query, bson.E{Key: "$expr", Value: false})
+		}
+	}
+	return query
+}
+
+// normalize fills in fields that may be absent from older documents.
+// The creation time of older entries is recovered from their ID.
+func normalize(f *Form) {
+	if f.Mailbox == "" {
+		f.Mailbox = DefaultMailbox
+	}
+	if f.Status == "" {
+		f.Status = StatusUnread
+	}
+	sort.Strings(f.Tags)
+	if f.Created.IsZero() {
+		if objID, err := primitive.ObjectIDFromHex(f.ID); err == nil {
+			f.Created = objID.Timestamp().UTC()
+		}
+	}
+}
+
 // Create a new mailbox entry with the given context and form.
 func (m *Mongo) Create(ctx context.Context, f Form) (string, error) {
+	normalize(&f)
+	if f.Created.IsZero() {
+		f.Created = time.Now().UTC()
+	}
 	res, err := m.coll.InsertOne(ctx, f)
 	if err != nil {
 		return "", ErrMongoFailCreate
@@ -57,20 +263,26 @@ func (m *Mongo) Create(ctx context.Context, f Form) (string, error) {
 	return res.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-// Count the number of elements in the Mongo mailbox collection.
-func (m *Mongo) Count(ctx context.Context) int64 {
-	count, err := m.coll.CountDocuments(ctx, bson.D{})
+// Count the number of elements in the Mongo mailbox collection that
+// match the filter.
+func (m *Mongo) Count(ctx context.Context, f Filter) int64 {
+	count, err := m.coll.CountDocuments(ctx, mongoFilter(f))
 	if err != nil {
 		return 0
 	}
 	return count
 }
 
-// ReadAll returns paginated mailbox entries. It fetches up to 'batch'
-// number of elements, after skipping the first (batch * page) elements.
-func (m *Mongo) ReadAll(ctx context.Context, batch, page int64) ([]Form, error) {
-	cursor, err := m.coll.Find(ctx, bson.D{},
-		options.Find().SetLimit(batch).SetSkip(page*batch))
+// ReadAll returns paginated mailbox entries that match the filter,
+// most recent first. It fetches up to 'batch' number of elements, after
+// skipping the first (batch * page) elements. Entries created at the
+// same time are ordered by ID, so that pages neither repeat nor skip
+// entries.
+func (m *Mongo) ReadAll(ctx context.Context, f Filter, batch, page int64) ([]Form, error) {
+	cursor, err := m.coll.Find(ctx, mongoFilter(f),
+		options.Find().
+			SetSort(bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(batch).SetSkip(page*batch))
 
 	if err != nil {
 		return []Form{}, ErrMongoNotFound
@@ -81,6 +293,10 @@ func (m *Mongo) ReadAll(ctx context.Context, batch, page int64) ([]Form, error)
 		return []Form{}, ErrMongoInternal
 	}
 
+	for i := range result {
+		normalize(&result[i])
+	}
+
 	return result, nil
 }
 
@@ -103,9 +319,151 @@ func (m *Mongo) Read(ctx context.Context, id string) (Form, error) {
 		return Form{}, ErrMongoInternal
 	}
 
+	normalize(&form)
 	return form, nil
 }
 
+// Update replaces the mailbox entry with the given form's id.
+func (m *Mongo) Update(ctx context.Context, f Form) error {
+	objID, err := primitive.ObjectIDFromHex(f.ID)
+	if err != nil {
+		return ErrMongoInvalidID
+	}
+
+	normalize(&f)
+	f.ID = ""
+	res, err := m.coll.ReplaceOne(ctx,
+		bson.D{{Key: "_id", Value: objID}}, f)
+
+	if err != nil {
+		return ErrMongoFailUpdate
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
+
+// Patch applies field-level changes to the mailbox entry with the given
+// id, and returns the changed entry.
+func (m *Mongo) Patch(ctx context.Context, id string, p Patch) (Form, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Form{}, ErrMongoInvalidID
+	}
+	filter := patchFilter(bson.D{{Key: "_id", Value: objID}}, p)
+
+	var form Form
+	if update := mongoUpdate(p); update != nil {
+		err = m.coll.FindOneAndUpdate(ctx, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&form)
+	} else {
+		err = m.coll.FindOne(ctx, filter).Decode(&form)
+	}
+
+	if err == mongodb.ErrNoDocuments {
+		if len(filter) > 1 {
+			count, countErr := m.coll.CountDocuments(ctx,
+				bson.D{{Key: "_id", Value: objID}})
+			if countErr == nil && count > 0 {
+				return Form{}, ErrMongoConflict
+			}
+		}
+		return Form{}, ErrMongoNotFound
+	}
+	if err != nil {
+		return Form{}, ErrMongoFailUpdate
+	}
+
+	normalize(&form)
+	return form, nil
+}
+
+// PatchAll applies field-level changes to the mailbox entries with the
+// given ids that meet the patch's conditions, and returns the ids of
+// the entries that it changed. The changes are applied by a single
+// update, whose filter repeats the conditions, so that entries that
+// stopped meeting them after they were found are left unchanged. The
+// update marks the entries it changes with a field unique to it, by
+// which they are then found again and unmarked.
+func (m *Mongo) PatchAll(ctx context.Context, ids []string, p Patch) ([]string, error) {
+	found, err := m.find(ctx, patchFilter(mongoFilter(Filter{IDs: ids}), p))
+	if err != nil || len(found) == 0 {
+		return []string{}, err
+	}
+	update := mongoUpdate(p)
+	if update == nil {
+		return hexIDs(found), nil
+	}
+	marker := "_patch_" + primitive.NewObjectID().Hex()
+	update = append(update, bson.D{{Key: "$set", Value: bson.D{{Key: marker, Value: true}}}})
+	filter := patchFilter(bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: found}}}}, p)
+	if _, err := m.coll.UpdateMany(ctx, filter, update); err != nil {
+		return []string{}, ErrMongoFailUpdate
+	}
+	marked := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: found}}},
+		{Key: marker, Value: true},
+	}
+	changed, err := m.find(ctx, marked)
+	if err != nil {
+		return []string{}, err
+	}
+	// Markers left behind are harmless, as entries are decoded
+	// without them.
+	m.coll.UpdateMany(ctx, marked, bson.D{{Key: "$unset",
+		Value: bson.D{{Key: marker, Value: ""}}}})
+	return hexIDs(changed), nil
+}
+
+// DeleteAll deletes the mailbox entries with the given ids, and returns
+// the ids of the entries that it found.
+func (m *Mongo) DeleteAll(ctx context.Context, ids []string) ([]string, error) {
+	found, err := m.find(ctx, mongoFilter(Filter{IDs: ids}))
+	if err != nil || len(found) == 0 {
+		return []string{}, err
+	}
+	_, err = m.coll.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{
+		{Key: "$in", Value: found},
+	}}})
+	if err != nil {
+		return []string{}, ErrMongoFailDelete
+	}
+	return hexIDs(found), nil
+}
+
+// find returns the IDs of the entries that match the query.
+func (m *Mongo) find(ctx context.Context, query bson.D) (bson.A, error) {
+	cursor, err := m.coll.Find(ctx, query,
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, ErrMongoInternal
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, ErrMongoInternal
+	}
+	found := bson.A{}
+	for _, doc := range docs {
+		found = append(found, doc.ID)
+	}
+	return found, nil
+}
+
+// hexIDs translates MongoDB IDs into entry IDs.
+func hexIDs(objIDs bson.A) []string {
+	ids := []string{}
+	for _, objID := range objIDs {
+		ids = append(ids, objID.(primitive.ObjectID).Hex())
+	}
+	return ids
+}
+
 // Delete the mailbox entry with the given id.
 func (m *Mongo) Delete(ctx context.Context, id string) error {
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -126,3 +484,127 @@ func (m *Mongo) Delete(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// Mailboxes returns the sorted names of the mailboxes holding entries.
+func (m *Mongo) Mailboxes(ctx context.Context) ([]string, error) {
+	values, err := m.coll.Distinct(ctx, "mailbox", bson.D{})
+	if err != nil {
+		return []string{}, ErrMongoInternal
+	}
+	seen := map[string]bool{}
+	mailboxes := []string{}
+	for _, v := range values {
+		name, _ := v.(string)
+		if name == "" {
+			name = DefaultMailbox
+		}
+		if !seen[name] {
+			seen[name] = true
+			mailboxes = append(mailboxes, name)
+		}
+	}
+	sort.Strings(mailboxes)
+	return mailboxes, nil
+}
+
+// Tags returns the sorted tags of the entries that match the filter.
+func (m *Mongo) Tags(ctx context.Context, f Filter) ([]string, error) {
+	values, err := m.coll.Distinct(ctx, "tags", mongoFilter(f))
+	if err != nil {
+		return []string{}, ErrMongoInternal
+	}
+	tags := []string{}
+	for _, v := range values {
+		if tag, ok := v.(string); ok && tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Summarize aggregates the entries that match the filter in a single
+// pass. Entries without a status are unread, as normalize assumes.
+func (m *Mongo) Summarize(ctx context.Context, f Filter, senders int) (Summary, error) {
+	count := func(match bson.D) bson.A {
+		return bson.A{
+			bson.D{{Key: "$match", Value: match}},
+			bson.D{{Key: "$count", Value: "n"}},
+		}
+	}
+	cursor, err := m.coll.Aggregate(ctx, mongodb.Pipeline{
+		{{Key: "$match", Value: mongoFilter(f)}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "count", Value: count(bson.D{})},
+			{Key: "unread", Value: count(bson.D{
+				{Key: "status", Value: bson.D{{Key: "$ne", Value: StatusRead}}},
+			})},
+			{Key: "senders", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: bson.D{{Key: "$toLower", Value: "$from"}}},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{
+					{Key: "count", Value: -1}, {Key: "_id", Value: 1},
+				}}},
+				bson.D{{Key: "$limit", Value: max(senders, 1)}},
+			}},
+		}}},
+	})
+	if err != nil {
+		return Summary{}, ErrMongoInternal
+	}
+	var result []struct {
+		Count   []struct{ N int } `bson:"count"`
+		Unread  []struct{ N int } `bson:"unread"`
+		Senders []SenderCount     `bson:"senders"`
+	}
+	if err := cursor.All(ctx, &result); err != nil || len(result) != 1 {
+		return Summary{}, ErrMongoInternal
+	}
+	summary := Summary{Senders: result[0].Senders}
+	if len(result[0].Count) > 0 {
+		summary.Count = result[0].Count[0].N
+	}
+	if len(result[0].Unread) > 0 {
+		summary.Unread = result[0].Unread[0].N
+	}
+	if summary.Senders == nil || senders <= 0 {
+		summary.Senders = []SenderCount{}
+	}
+	return summary, nil
+}
+
+// Transact calls fn in a transaction on replica sets and sharded
+// clusters, and without one on standalone servers, which do not support
+// transactions. Transactions span the stores whose collections belong
+// to the same client.
+func (m *Mongo) Transact(ctx context.Context, fn func(context.Context) error) error {
+	if !m.transactions(ctx) {
+		return fn(ctx)
+	}
+	session, err := m.coll.Database().Client().StartSession()
+	if err != nil {
+		return ErrMongoInternal
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongodb.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// transactions reports whether the server supports transactions. It is
+// asked once.
+func (m *Mongo) transactions(ctx context.Context) bool {
+	m.txnOnce.Do(func() {
+		var hello struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		err := m.coll.Database().RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).
+			Decode(&hello)
+		m.txn = err == nil && (hello.SetName != "" || hello.Msg == "isdbgrid")
+	})
+	return m.txn
+}
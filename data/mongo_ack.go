@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MongoAcks implements the Acks interface with a MongoDB backend. It
+// keeps a document per acknowledged address, holding the time of its
+// latest acknowledgement, and a counter per clock hour.
+type MongoAcks struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoAcks initializes a new MongoAcks instance, and creates the
+// index that expires documents once they no longer limit anything.
+func NewMongoAcks(coll *mongodb.Collection) (Acks, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := coll.Indexes().CreateOne(ctx, mongodb.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoAcks{coll: coll}, nil
+}
+
+// ackAddressID and ackHourID return the IDs of the documents that
+// limit acknowledgements to an address and within an hour.
+func ackAddressID(address string) string {
+	return "address:" + strings.ToLower(address)
+}
+
+func ackHourID(t time.Time) string {
+	return "hour:" + strconv.FormatInt(t.Unix()/3600, 10)
+}
+
+// Reserve counts an acknowledgement to the address, first against the
+// address' interval and then against the hourly limit. Both are
+// conditional upserts, which fail with a duplicate key error when the
+// existing document does not match, so that concurrent reservations
+// cannot exceed the limits.
+func (m *MongoAcks) Reserve(ctx context.Context, address string, at time.Time,
+	interval time.Duration, maxHourly int) (bool, error) {
+	// MongoDB stores times with millisecond precision.
+	at = at.UTC().Truncate(time.Millisecond)
+	_, err := m.coll.UpdateOne(ctx,
+		bson.D{
+			{Key: "_id", Value: ackAddressID(address)},
+			{Key: "sent", Value: bson.D{{Key: "$lte", Value: at.Add(-interval)}}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "sent", Value: at},
+			{Key: "expires", Value: at.Add(interval)},
+		}}},
+		options.Update().SetUpsert(true))
+	if mongodb.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrMongoFailUpdate
+	}
+	if maxHourly <= 0 {
+		return true, nil
+	}
+
+	_, err = m.coll.UpdateOne(ctx,
+		bson.D{
+			{Key: "_id", Value: ackHourID(at)},
+			{Key: "count", Value: bson.D{{Key: "$lt", Value: maxHourly}}},
+		},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+			{Key: "$set", Value: bson.D{
+				{Key: "expires", Value: at.Truncate(time.Hour).Add(time.Hour)},
+			}},
+		},
+		options.Update().SetUpsert(true))
+	if err == nil {
+		return true, nil
+	}
+	m.releaseAddress(ctx, address, at)
+	if mongodb.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return false, ErrMongoFailUpdate
+}
+
+// Release stops counting the acknowledgement to the address reserved
+// at the given time.
+func (m *MongoAcks) Release(ctx context.Context, address string, at time.Time) error {
+	at = at.UTC().Truncate(time.Millisecond)
+	if err := m.releaseAddress(ctx, address, at); err != nil {
+		return err
+	}
+	_, err := m.coll.UpdateOne(ctx,
+		bson.D{
+			{Key: "_id", Value: ackHourID(at)},
+			{Key: "count", Value: bson.D{{Key: "$gt", Value: 0}}},
+		},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}}})
+	if err != nil {
+		return ErrMongoFailUpdate
+	}
+	return nil
+}
+
+// releaseAddress deletes the address' document if it still records the
+// acknowledgement reserved at the given time.
+func (m *MongoAcks) releaseAddress(ctx context.Context, address string, at time.Time) error {
+	_, err := m.coll.DeleteOne(ctx, bson.D{
+		{Key: "_id", Value: ackAddressID(address)},
+		{Key: "sent", Value: at},
+	})
+	if err != nil {
+		return ErrMongoFailDelete
+	}
+	return nil
+}
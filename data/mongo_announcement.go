@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoAnnouncements implements the Announcements interface with a
+// MongoDB backend.
+type MongoAnnouncements struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoAnnouncements initializes a new MongoAnnouncements instance,
+// and creates the index for taking due announcements.
+func NewMongoAnnouncements(coll *mongodb.Collection) (Announcements, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := coll.Indexes().CreateOne(ctx, mongodb.IndexModel{
+		Keys: bson.D{{Key: "chat", Value: 1}, {Key: "run_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoAnnouncements{coll: coll}, nil
+}
+
+// Add stores an announcement. Announcements that are already stored
+// are left as they are.
+func (m *MongoAnnouncements) Add(ctx context.Context, a Announcement) error {
+	_, err := m.coll.InsertOne(ctx, a)
+	if err != nil && !mongodb.IsDuplicateKeyError(err) {
+		return ErrMongoFailCreate
+	}
+	return nil
+}
+
+// Take claims up to limit due announcements to the named chat. Due
+// announcements are found first, and then claimed with a conditional
+// update that marks them with a random claim, so that announcements
+// taken concurrently by another server are skipped.
+func (m *MongoAnnouncements) Take(ctx context.Context, chat string, limit int,
+	lease time.Duration) ([]Announcement, error) {
+	now := time.Now().UTC()
+	cursor, err := m.coll.Find(ctx,
+		bson.D{
+			{Key: "chat", Value: chat},
+			{Key: "run_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "created", Value: 1}}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, ErrMongoInternal
+	}
+	var due []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &due); err != nil {
+		return nil, ErrMongoInternal
+	}
+	if len(due) == 0 {
+		return []Announcement{}, nil
+	}
+	ids := make(bson.A, len(due))
+	for i, d := range due {
+		ids[i] = d.ID
+	}
+
+	claim, err := randomHex(8)
+	if err != nil {
+		return nil, ErrMongoInternal
+	}
+	_, err = m.coll.UpdateMany(ctx,
+		bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+			{Key: "run_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "run_at", Value: now.Add(lease)},
+				{Key: "claim", Value: claim},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		})
+	if err != nil {
+		return nil, ErrMongoFailUpdate
+	}
+
+	cursor, err = m.coll.Find(ctx,
+		bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+			{Key: "claim", Value: claim},
+		},
+		options.Find().SetSort(bson.D{{Key: "created", Value: 1}}))
+	if err != nil {
+		return nil, ErrMongoInternal
+	}
+	result := []Announcement{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, ErrMongoInternal
+	}
+	return result, nil
+}
+
+// Done removes the announcements with the given IDs.
+func (m *MongoAnnouncements) Done(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := m.coll.DeleteMany(ctx, bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+	})
+	if err != nil {
+		return ErrMongoFailDelete
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+)
+
+// MongoAudits implements the Audits interface with a MongoDB backend.
+type MongoAudits struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoAudits initializes a new MongoAudits instance.
+func NewMongoAudits(coll *mongodb.Collection) (Audits, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoAudits{coll: coll}, nil
+}
+
+// auditFilter translates an AuditFilter into a MongoDB query.
+func auditFilter(f AuditFilter) bson.D {
+	query := bson.D{}
+	if f.User != "" {
+		query = append(query, bson.E{Key: "user", Value: f.User})
+	}
+	if f.EntryID != "" {
+		query = append(query, bson.E{Key: "entry_id", Value: f.EntryID})
+	}
+	if f.Action != "" {
+		query = append(query, bson.E{Key: "action", Value: primitive.Regex{
+			Pattern: "^" + regexp.QuoteMeta(f.Action) + `(\.|$)`,
+		}})
+	}
+	t := bson.D{}
+	if !f.After.IsZero() {
+		t = append(t, bson.E{Key: "$gt", Value: f.After})
+	}
+	if !f.Before.IsZero() {
+		t = append(t, bson.E{Key: "$lte", Value: f.Before})
+	}
+	if len(t) > 0 {
+		query = append(query, bson.E{Key: "time", Value: t})
+	}
+	return query
+}
+
+// Count the number of records matching the filter.
+func (m *MongoAudits) Count(ctx context.Context, f AuditFilter) int64 {
+	count, err := m.coll.CountDocuments(ctx, auditFilter(f))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// ReadAll returns paginated records matching the filter, most recent
+// first.
+func (m *MongoAudits) ReadAll(ctx context.Context, f AuditFilter, batch, page int64) ([]AuditRecord, error) {
+	cursor, err := m.coll.Find(ctx, auditFilter(f),
+		options.Find().
+			SetSort(bson.D{{Key: "time", Value: -1}}).
+			SetLimit(batch).SetSkip(page*batch))
+
+	if err != nil {
+		return []AuditRecord{}, ErrMongoNotFound
+	}
+
+	result := []AuditRecord{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return []AuditRecord{}, ErrMongoInternal
+	}
+
+	return result, nil
+}
+
+// Create appends the records to the log at once.
+func (m *MongoAudits) Create(ctx context.Context, records ...AuditRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	docs := make([]any, len(records))
+	for i, r := range records {
+		docs[i] = r
+	}
+	if _, err := m.coll.InsertMany(ctx, docs); err != nil {
+		if mongodb.IsDuplicateKeyError(err) {
+			return ErrMongoDuplicate
+		}
+		return ErrMongoInternal
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoChanges implements the Changes interface with MongoDB change
+// streams, which require a replica set. Change IDs are resume tokens.
+type MongoChanges struct {
+	coll *mongodb.Collection
+}
+
+// mongoChangeEvent is the subset of a change stream event that is
+// decoded.
+type mongoChangeEvent struct {
+	OperationType string              `bson:"operationType"`
+	FullDocument  *Form               `bson:"fullDocument"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+// NewMongoChanges initializes a new MongoChanges instance.
+func NewMongoChanges(coll *mongodb.Collection) (Changes, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoChanges{coll: coll}, nil
+}
+
+// Subscribe watches the collection for changes, resuming after the
+// given change if its resume token is still in the oplog.
+func (m *MongoChanges) Subscribe(ctx context.Context, after string) (<-chan Change, error) {
+	var stream *mongodb.ChangeStream
+	var err error
+	if after != "" {
+		stream, err = m.coll.Watch(ctx, mongodb.Pipeline{},
+			options.ChangeStream().
+				SetFullDocument(options.UpdateLookup).
+				SetResumeAfter(bson.D{{Key: "_data", Value: after}}))
+	}
+
+	// Resume tokens expire with the oplog, in which case the stream
+	// starts afresh.
+	if after == "" || err != nil {
+		stream, err = m.coll.Watch(ctx, mongodb.Pipeline{},
+			options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	}
+	if err != nil {
+		return nil, ErrMongoInternal
+	}
+
+	changes := make(chan Change)
+	go func() {
+		defer close(changes)
+		defer stream.Close(context.Background())
+		for stream.Next(ctx) {
+			var event mongoChangeEvent
+			if err := stream.Decode(&event); err != nil {
+				continue
+			}
+			change := Change{
+				ID:    stream.ResumeToken().Lookup("_data").StringValue(),
+				Entry: Form{ID: event.DocumentKey.ID.Hex()},
+				Time:  time.Unix(int64(event.ClusterTime.T), 0).UTC(),
+			}
+			switch event.OperationType {
+			case "insert":
+				change.Type = ChangeCreated
+			case "update", "replace":
+				change.Type = ChangeUpdated
+			case "delete":
+				change.Type = ChangeDeleted
+			default:
+				continue
+			}
+			if event.FullDocument != nil {
+				change.Entry = *event.FullDocument
+				normalize(&change.Entry)
+			}
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
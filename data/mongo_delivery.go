@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDeliveries implements the Deliveries interface with a MongoDB
+// backend.
+type MongoDeliveries struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoDeliveries initializes a new MongoDeliveries instance.
+func NewMongoDeliveries(coll *mongodb.Collection) (Deliveries, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoDeliveries{coll: coll}, nil
+}
+
+// deliveryFilter matches deliveries with the given status, or every
+// delivery if status is empty.
+func deliveryFilter(status string) bson.D {
+	if status == "" {
+		return bson.D{}
+	}
+	return bson.D{{Key: "status", Value: status}}
+}
+
+// Count the number of deliveries with the given status.
+func (m *MongoDeliveries) Count(ctx context.Context, status string) int64 {
+	count, err := m.coll.CountDocuments(ctx, deliveryFilter(status))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// ReadAll returns paginated deliveries with the given status, most
+// recent first.
+func (m *MongoDeliveries) ReadAll(ctx context.Context, status string, batch, page int64) ([]Delivery, error) {
+	cursor, err := m.coll.Find(ctx, deliveryFilter(status),
+		options.Find().
+			SetSort(bson.D{{Key: "created", Value: -1}}).
+			SetLimit(batch).SetSkip(page*batch))
+
+	if err != nil {
+		return []Delivery{}, ErrMongoNotFound
+	}
+
+	result := []Delivery{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return []Delivery{}, ErrMongoInternal
+	}
+
+	return result, nil
+}
+
+// Read the delivery with the given id.
+func (m *MongoDeliveries) Read(ctx context.Context, id string) (Delivery, error) {
+	var d Delivery
+	err := m.coll.FindOne(ctx,
+		bson.D{{Key: "_id", Value: id}}).
+		Decode(&d)
+
+	if err != nil {
+		if err == mongodb.ErrNoDocuments {
+			return Delivery{}, ErrMongoNotFound
+		}
+		return Delivery{}, ErrMongoInternal
+	}
+
+	return d, nil
+}
+
+// Create a new delivery record.
+func (m *MongoDeliveries) Create(ctx context.Context, d Delivery) error {
+	if _, err := m.coll.InsertOne(ctx, d); err != nil {
+		if mongodb.IsDuplicateKeyError(err) {
+			return ErrMongoDuplicate
+		}
+		return ErrMongoInternal
+	}
+	return nil
+}
+
+// Update replaces the delivery record with the same id.
+func (m *MongoDeliveries) Update(ctx context.Context, d Delivery) error {
+	res, err := m.coll.ReplaceOne(ctx,
+		bson.D{{Key: "_id", Value: d.ID}}, d)
+
+	if err != nil {
+		return ErrMongoFailUpdate
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoDigests implements the Digests interface with a MongoDB
+// backend.
+type MongoDigests struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoDigests initializes a new MongoDigests instance.
+func NewMongoDigests(coll *mongodb.Collection) (Digests, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoDigests{coll: coll}, nil
+}
+
+// Read the digest state of the given mailbox.
+func (m *MongoDigests) Read(ctx context.Context, mailbox string) (Digest, error) {
+	var d Digest
+	err := m.coll.FindOne(ctx, bson.D{{Key: "_id", Value: mailbox}}).Decode(&d)
+	if err != nil {
+		if err == mongodb.ErrNoDocuments {
+			return Digest{}, ErrMongoNotFound
+		}
+		return Digest{}, ErrMongoInternal
+	}
+	return d, nil
+}
+
+// Complete sets the last run of the mailbox's digest and deducts the
+// reported rejections, keeping those counted in the meantime.
+func (m *MongoDigests) Complete(ctx context.Context, mailbox string, run time.Time, rejected int64) error {
+	_, err := m.coll.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: mailbox}},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "last_run", Value: run}}},
+			{Key: "$inc", Value: bson.D{{Key: "rejected", Value: -rejected}}},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return ErrMongoFailUpdate
+	}
+	return nil
+}
+
+// Reject increments the rejection counter of the mailbox.
+func (m *MongoDigests) Reject(ctx context.Context, mailbox string) error {
+	_, err := m.coll.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: mailbox}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "rejected", Value: 1}}}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return ErrMongoFailUpdate
+	}
+	return nil
+}
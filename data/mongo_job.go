@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoJobs implements the Jobs interface with a MongoDB backend.
+type MongoJobs struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoJobs initializes a new MongoJobs instance, and creates the
+// indexes that it relies on: one for claiming due jobs, and one that
+// expires succeeded jobs after JobRetention.
+func NewMongoJobs(coll *mongodb.Collection) (Jobs, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := coll.Indexes().CreateMany(ctx, []mongodb.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "updated", Value: 1}},
+			Options: options.Index().
+				SetExpireAfterSeconds(int32(JobRetention.Seconds())).
+				SetPartialFilterExpression(bson.D{{Key: "status", Value: JobSucceeded}}),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoJobs{coll: coll}, nil
+}
+
+// jobFilter matches jobs with the given status, or every job if
+// status is empty.
+func jobFilter(status string) bson.D {
+	if status == "" {
+		return bson.D{}
+	}
+	return bson.D{{Key: "status", Value: status}}
+}
+
+// Count the number of jobs with the given status.
+func (m *MongoJobs) Count(ctx context.Context, status string) int64 {
+	count, err := m.coll.CountDocuments(ctx, jobFilter(status))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// ReadAll returns paginated jobs with the given status, most recent
+// first.
+func (m *MongoJobs) ReadAll(ctx context.Context, status string, batch, page int64) ([]Job, error) {
+	cursor, err := m.coll.Find(ctx, jobFilter(status),
+		options.Find().
+			SetSort(bson.D{{Key: "created", Value: -1}}).
+			SetLimit(batch).SetSkip(page*batch))
+
+	if err != nil {
+		return []Job{}, ErrMongoNotFound
+	}
+
+	result := []Job{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return []Job{}, ErrMongoInternal
+	}
+
+	return result, nil
+}
+
+// Read the job with the given id.
+func (m *MongoJobs) Read(ctx context.Context, id string) (Job, error) {
+	var j Job
+	err := m.coll.FindOne(ctx,
+		bson.D{{Key: "_id", Value: id}}).
+		Decode(&j)
+
+	if err != nil {
+		if err == mongodb.ErrNoDocuments {
+			return Job{}, ErrMongoNotFound
+		}
+		return Job{}, ErrMongoInternal
+	}
+
+	return j, nil
+}
+
+// Create new jobs at once.
+func (m *MongoJobs) Create(ctx context.Context, jobs ...Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	docs := make([]any, len(jobs))
+	for i, j := range jobs {
+		docs[i] = j
+	}
+	if _, err := m.coll.InsertMany(ctx, docs); err != nil {
+		if mongodb.IsDuplicateKeyError(err) {
+			return ErrMongoDuplicate
+		}
+		return ErrMongoInternal
+	}
+	return nil
+}
+
+// Update replaces the job with the same id.
+func (m *MongoJobs) Update(ctx context.Context, j Job) error {
+	res, err := m.coll.ReplaceOne(ctx,
+		bson.D{{Key: "_id", Value: j.ID}}, j)
+
+	if err != nil {
+		return ErrMongoFailUpdate
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
+
+// Claim marks the due job that has waited longest as running.
+func (m *MongoJobs) Claim(ctx context.Context, lease time.Duration) (Job, error) {
+	now := time.Now().UTC()
+	var j Job
+	err := m.coll.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{JobPending, JobRunning}}}},
+			{Key: "run_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: JobRunning},
+				{Key: "run_at", Value: now.Add(lease)},
+				{Key: "updated", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "run_at", Value: 1}}).
+			SetReturnDocument(options.After)).
+		Decode(&j)
+
+	if err != nil {
+		if err == mongodb.ErrNoDocuments {
+			return Job{}, ErrMongoNotFound
+		}
+		return Job{}, ErrMongoInternal
+	}
+
+	return j, nil
+}
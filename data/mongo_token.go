@@ -0,0 +1,79 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoTokens implements the Tokens interface with a MongoDB backend.
+type MongoTokens struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoTokens initializes a new MongoTokens instance.
+func NewMongoTokens(coll *mongodb.Collection) (Tokens, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoTokens{coll: coll}, nil
+}
+
+// ReadAll returns every token in the collection.
+func (m *MongoTokens) ReadAll(ctx context.Context) ([]Token, error) {
+	cursor, err := m.coll.Find(ctx, bson.D{})
+	if err != nil {
+		return []Token{}, ErrMongoNotFound
+	}
+
+	result := []Token{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return []Token{}, ErrMongoInternal
+	}
+
+	return result, nil
+}
+
+// Read the token with the given id.
+func (m *MongoTokens) Read(ctx context.Context, id string) (Token, error) {
+	var token Token
+	err := m.coll.FindOne(ctx,
+		bson.D{{Key: "_id", Value: id}}).
+		Decode(&token)
+
+	if err != nil {
+		if err == mongodb.ErrNoDocuments {
+			return Token{}, ErrMongoNotFound
+		}
+		return Token{}, ErrMongoInternal
+	}
+
+	return token, nil
+}
+
+// Create a new token.
+func (m *MongoTokens) Create(ctx context.Context, t Token) error {
+	if _, err := m.coll.InsertOne(ctx, t); err != nil {
+		if mongodb.IsDuplicateKeyError(err) {
+			return ErrMongoDuplicate
+		}
+		return ErrMongoInternal
+	}
+	return nil
+}
+
+// Delete the token with the given id.
+func (m *MongoTokens) Delete(ctx context.Context, id string) error {
+	res, err := m.coll.DeleteOne(ctx,
+		bson.D{{Key: "_id", Value: id}})
+
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// maxUIDAttempts bounds the number of times Assign retries after
+// losing a race with a concurrent assignment.
+const maxUIDAttempts = 5
+
+// ErrMongoUIDConflict is returned when UIDs could not be assigned
+// because of concurrent assignments.
+var ErrMongoUIDConflict = errors.New("could not assign uids, please try again later")
+
+// MongoUIDs implements the UIDs interface with a MongoDB backend. Each
+// mailbox is stored as a single document that maps entry IDs to UIDs.
+type MongoUIDs struct {
+	coll *mongodb.Collection
+}
+
+// mongoUIDDoc is the document holding the UIDs of a mailbox. Version
+// is incremented by every update, which guards against concurrent
+// assignments.
+type mongoUIDDoc struct {
+	Mailbox  string            `bson:"_id"`
+	Validity uint32            `bson:"validity"`
+	Next     uint32            `bson:"next"`
+	Version  int64             `bson:"version"`
+	UIDs     map[string]uint32 `bson:"uids"`
+}
+
+// NewMongoUIDs initializes a new MongoUIDs instance.
+func NewMongoUIDs(coll *mongodb.Collection) (UIDs, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoUIDs{coll: coll}, nil
+}
+
+// Assign returns the UIDs of the given entries of the mailbox,
+// assigning new ones to entries that have none.
+func (m *MongoUIDs) Assign(ctx context.Context, mailbox string, ids []string) (UIDMap, error) {
+	for attempt := 0; attempt < maxUIDAttempts; attempt++ {
+		var doc mongoUIDDoc
+		err := m.coll.FindOne(ctx, bson.D{{Key: "_id", Value: mailbox}}).
+			Decode(&doc)
+		if err == mongodb.ErrNoDocuments {
+			doc = mongoUIDDoc{
+				Mailbox:  mailbox,
+				Validity: uint32(time.Now().Unix()),
+				Next:     1,
+				UIDs:     map[string]uint32{},
+			}
+			if _, err := m.coll.InsertOne(ctx, doc); err != nil {
+				if mongodb.IsDuplicateKeyError(err) {
+					continue
+				}
+				return UIDMap{}, ErrMongoInternal
+			}
+		} else if err != nil {
+			return UIDMap{}, ErrMongoInternal
+		}
+
+		result := UIDMap{Validity: doc.Validity, UIDs: make([]uint32, len(ids))}
+		uids := make(map[string]uint32, len(ids))
+		next := doc.Next
+		for i, id := range ids {
+			uid, ok := doc.UIDs[id]
+			if !ok {
+				uid = next
+				next++
+			}
+			uids[id] = uid
+			result.UIDs[i] = uid
+		}
+		result.Next = next
+		if next == doc.Next && len(uids) == len(doc.UIDs) {
+			return result, nil
+		}
+
+		res, err := m.coll.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: mailbox}, {Key: "version", Value: doc.Version}},
+			bson.D{
+				{Key: "$set", Value: bson.D{{Key: "next", Value: next}, {Key: "uids", Value: uids}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			})
+		if err != nil {
+			return UIDMap{}, ErrMongoInternal
+		}
+		if res.MatchedCount == 1 {
+			return result, nil
+		}
+	}
+	return UIDMap{}, ErrMongoUIDConflict
+}
@@ -0,0 +1,240 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodb "go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// MongoUsers implements the Users interface with a MongoDB backend.
+type MongoUsers struct {
+	coll *mongodb.Collection
+}
+
+// NewMongoUsers initializes a new MongoUsers instance.
+func NewMongoUsers(coll *mongodb.Collection) (Users, error) {
+	if coll == nil {
+		return nil, ErrMongoNilColl
+	}
+	return &MongoUsers{coll: coll}, nil
+}
+
+// Count the number of users in the Mongo users collection.
+func (m *MongoUsers) Count(ctx context.Context) int64 {
+	count, err := m.coll.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// ReadAll returns every user in the collection.
+func (m *MongoUsers) ReadAll(ctx context.Context) ([]User, error) {
+	cursor, err := m.coll.Find(ctx, bson.D{})
+	if err != nil {
+		return []User{}, ErrMongoNotFound
+	}
+
+	result := []User{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return []User{}, ErrMongoInternal
+	}
+
+	return result, nil
+}
+
+// Read the user with the given username.
+func (m *MongoUsers) Read(ctx context.Context, username string) (User, error) {
+	var user User
+	err := m.coll.FindOne(ctx,
+		bson.D{{Key: "_id", Value: username}}).
+		Decode(&user)
+
+	if err != nil {
+		if err == mongodb.ErrNoDocuments {
+			return User{}, ErrMongoNotFound
+		}
+		return User{}, ErrMongoInternal
+	}
+
+	return user, nil
+}
+
+// Create a new user.
+func (m *MongoUsers) Create(ctx context.Context, u User) error {
+	if _, err := m.coll.InsertOne(ctx, u); err != nil {
+		if mongodb.IsDuplicateKeyError(err) {
+			return ErrMongoDuplicate
+		}
+		return ErrMongoInternal
+	}
+	return nil
+}
+
+// Delete the user with the given username.
+func (m *MongoUsers) Delete(ctx context.Context, username string) error {
+	res, err := m.coll.DeleteOne(ctx,
+		bson.D{{Key: "_id", Value: username}})
+
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
+
+// SetPassword replaces the password hash of the user with the given
+// username.
+func (m *MongoUsers) SetPassword(ctx context.Context, username, hash string) error {
+	return m.set(ctx, username, bson.D{{Key: "hash", Value: hash}})
+}
+
+// SetRole changes the role of the user with the given username.
+func (m *MongoUsers) SetRole(ctx context.Context, username, role string) error {
+	return m.set(ctx, username, bson.D{{Key: "role", Value: role}})
+}
+
+// SetTOTP replaces the two-factor authentication fields of the user
+// sharing u's username. Empty fields are removed.
+func (m *MongoUsers) SetTOTP(ctx context.Context, u User) error {
+	set := bson.D{{Key: "totp_enabled", Value: u.TOTPEnabled}}
+	unset := bson.D{}
+	for _, field := range []struct {
+		key   string
+		value any
+		empty bool
+	}{{"totp_secret", u.TOTPSecret, u.TOTPSecret == ""},
+		{"totp_last_step", u.TOTPLastStep, u.TOTPLastStep == 0},
+		{"recovery_codes", u.RecoveryCodes, len(u.RecoveryCodes) == 0}} {
+		if field.empty {
+			unset = append(unset, bson.E{Key: field.key, Value: ""})
+		} else {
+			set = append(set, bson.E{Key: field.key, Value: field.value})
+		}
+	}
+	update := bson.D{{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return m.update(ctx, u.Username, update)
+}
+
+// set sets the fields of the user with the given username, so that
+// concurrent changes to its other fields, e.g. by a failed login, are
+// kept.
+func (m *MongoUsers) set(ctx context.Context, username string, fields bson.D) error {
+	return m.update(ctx, username, bson.D{{Key: "$set", Value: fields}})
+}
+
+// update applies update to the user with the given username.
+func (m *MongoUsers) update(ctx context.Context, username string, update bson.D) error {
+	res, err := m.coll.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: username}}, update)
+
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the user's accepted TOTP step, unless the same or
+// a later step was recorded before.
+func (m *MongoUsers) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	return m.updateIf(ctx, bson.D{
+		{Key: "_id", Value: username},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "totp_last_step", Value: bson.D{{Key: "$lt", Value: step}}}},
+			bson.D{{Key: "totp_last_step", Value: bson.D{{Key: "$exists", Value: false}}}},
+		}},
+	}, bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_step", Value: step}}}})
+}
+
+// UseRecoveryCode removes the recovery code hash from the user, if the
+// user holds it.
+func (m *MongoUsers) UseRecoveryCode(ctx context.Context, username, hash string) error {
+	return m.updateIf(ctx, bson.D{
+		{Key: "_id", Value: username},
+		{Key: "recovery_codes", Value: hash},
+	}, bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_codes", Value: hash}}}})
+}
+
+// LoginFailed increments the user's failed login count, and locks the
+// user out once it reaches maxFailedLogins.
+func (m *MongoUsers) LoginFailed(ctx context.Context, username string) error {
+	res, err := m.coll.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: username}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "failed_logins", Value: 1}}}})
+
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	// Of concurrent failures that reach the limit, whichever resets
+	// the count first locks the user out.
+	_, err = m.coll.UpdateOne(ctx,
+		bson.D{
+			{Key: "_id", Value: username},
+			{Key: "failed_logins", Value: bson.D{{Key: "$gte", Value: maxFailedLogins}}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "locked_until", Value: time.Now().Add(lockoutDuration).UTC()},
+			}},
+			{Key: "$unset", Value: bson.D{{Key: "failed_logins", Value: ""}}},
+		})
+
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	return nil
+}
+
+// LoginSucceeded clears the user's failed login count and lockout.
+func (m *MongoUsers) LoginSucceeded(ctx context.Context, username string) error {
+	res, err := m.coll.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: username}},
+		bson.D{{Key: "$unset", Value: bson.D{
+			{Key: "failed_logins", Value: ""},
+			{Key: "locked_until", Value: ""},
+		}}})
+
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoNotFound
+	}
+
+	return nil
+}
+
+// updateIf applies update to the user matching filter. It returns
+// ErrMongoConflict if no user matches.
+func (m *MongoUsers) updateIf(ctx context.Context, filter, update bson.D) error {
+	res, err := m.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return ErrMongoInternal
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrMongoConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	ctx "context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeRead permits listing and reading entries.
+	ScopeRead = "read"
+
+	// ScopeStatus permits changing the status of entries.
+	ScopeStatus = "status"
+
+	// ScopeReply permits emailing replies to submitters.
+	ScopeReply = "reply"
+
+	// ScopeDelete permits deleting entries.
+	ScopeDelete = "delete"
+
+	// ScopeAdmin permits every action, including user and token
+	// management.
+	ScopeAdmin = "admin"
+)
+
+// tokenPrefix marks a string as a Mailbox API token.
+const tokenPrefix = "mbx"
+
+// Tokens defines the Mailbox API token store interface.
+type Tokens interface {
+
+	// ReadAll fetches every stored token.
+	ReadAll(ctx.Context) ([]Token, error)
+
+	// Read fetches a single token by referencing its ID.
+	Read(ctx.Context, string) (Token, error)
+
+	// Create a new token.
+	Create(ctx.Context, Token) error
+
+	// Delete a token by referencing its ID.
+	Delete(ctx.Context, string) error
+}
+
+// Token defines a bearer token used by automated API clients, or a
+// short-lived session of an interactive user. Only the SHA-256 hash
+// of the token's secret is stored.
+type Token struct {
+	ID      string    `json:"id" bson:"_id"`
+	Name    string    `json:"name" bson:"name"`
+	Session bool      `json:"session" bson:"session"`
+	Owner   string    `json:"owner" bson:"owner"`
+	Hash    string    `json:"-" bson:"hash"`
+	Scopes  []string  `json:"scopes" bson:"scopes"`
+	Mailbox string    `json:"mailbox,omitempty" bson:"mailbox,omitempty"`
+	Created time.Time `json:"created" bson:"created"`
+	Expires time.Time `json:"expires,omitempty" bson:"expires,omitempty"`
+}
+
+// NewToken initializes a token and returns it alongside the secret
+// bearer string that clients present. The bearer string cannot be
+// recovered from the token afterwards. A zero ttl never expires.
+func NewToken(name, owner, mailbox string, scopes []string, ttl time.Duration) (Token, string, error) {
+	t := Token{
+		Name:    name,
+		Owner:   owner,
+		Scopes:  scopes,
+		Mailbox: mailbox,
+		Created: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+	if err := t.Validate(); err != nil {
+		return Token{}, "", err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+	t.ID = id
+	t.Hash = hashSecret(secret)
+	return t, strings.Join([]string{tokenPrefix, id, secret}, "_"), nil
+}
+
+// NewSession initializes a session token, granting the owner's own
+// permissions for the given duration. It returns the token alongside
+// its bearer string.
+func NewSession(owner string, ttl time.Duration) (Token, string, error) {
+	t, bearer, err := NewToken("session", owner, "", []string{ScopeAdmin}, ttl)
+	t.Session = true
+	return t, bearer, err
+}
+
+// ParseToken splits a bearer string into its token ID and secret.
+func ParseToken(bearer string) (id, secret string, err error) {
+	parts := strings.Split(bearer, "_")
+	if len(parts) != 3 || parts[0] != tokenPrefix {
+		return "", "", errors.New("malformed token")
+	}
+	return parts[1], parts[2], nil
+}
+
+// Validate a token's 'Name', 'Scopes' and 'Mailbox' fields. Returns
+// a human-friendly error message.
+func (t Token) Validate() error {
+	if strings.TrimSpace(t.Name) == "" || len(t.Name) > 64 {
+		return errors.New("'name' must be 1-64 characters long")
+	}
+	if len(t.Scopes) == 0 {
+		return errors.New("'scopes' must contain at least one scope")
+	}
+	for _, scope := range t.Scopes {
+		switch scope {
+		case ScopeRead, ScopeStatus, ScopeReply, ScopeDelete, ScopeAdmin:
+		default:
+			return errors.New("unknown scope: " + scope)
+		}
+	}
+	if t.Mailbox != "" && !mailboxRegex.MatchString(t.Mailbox) {
+		return errors.New("'mailbox' must be a valid mailbox name")
+	}
+	return nil
+}
+
+// Check reports whether secret belongs to the token and the token has
+// not expired. The comparison is constant-time.
+func (t Token) Check(secret string) bool {
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(t.Hash)) != 1 {
+		return false
+	}
+	return !t.Expired()
+}
+
+// Expired reports whether the token's expiry date has passed.
+func (t Token) Expired() bool {
+	return !t.Expires.IsZero() && time.Now().After(t.Expires)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
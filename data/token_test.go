@@ -0,0 +1,82 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		mailbox string
+		scopes  []string
+		wantErr bool
+	}{
+		{"valid", "ci", "", []string{ScopeRead}, false},
+		{"restricted", "ci", "sales", []string{ScopeRead, ScopeStatus}, false},
+		{"empty name", " ", "", []string{ScopeRead}, true},
+		{"no scopes", "ci", "", nil, true},
+		{"unknown scope", "ci", "", []string{"write"}, true},
+		{"invalid mailbox", "ci", "Sales", []string{ScopeRead}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, bearer, err := NewToken(tt.token, "alice", tt.mailbox, tt.scopes, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			id, secret, err := ParseToken(bearer)
+			if err != nil {
+				t.Fatalf("ParseToken() error = %v", err)
+			}
+			if id != token.ID {
+				t.Errorf("ParseToken() id = %q, want %q", id, token.ID)
+			}
+			if !token.Check(secret) {
+				t.Error("Check() = false for the token's secret")
+			}
+			if token.Check(secret + "0") {
+				t.Error("Check() = true for a wrong secret")
+			}
+		})
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		bearer  string
+		wantErr bool
+	}{
+		{"mbx_0123456789abcdef_secret", false},
+		{"abc_0123456789abcdef_secret", true},
+		{"mbx_0123456789abcdef", true},
+		{"mbx_a_b_c", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bearer, func(t *testing.T) {
+			if _, _, err := ParseToken(tt.bearer); (err != nil) != tt.wantErr {
+				t.Errorf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	token, bearer, err := NewToken("ci", "alice", "", []string{ScopeRead}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secret, _ := ParseToken(bearer)
+	if token.Expired() || !token.Check(secret) {
+		t.Fatal("fresh token is expired")
+	}
+	token.Expires = time.Now().Add(-time.Minute)
+	if !token.Expired() || token.Check(secret) {
+		t.Error("token is valid past its expiry")
+	}
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// totpPeriod is the lifetime of a single TOTP code.
+	totpPeriod = 30
+
+	// totpSkew is the number of periods before and after the
+	// current one whose codes are still accepted.
+	totpSkew = 1
+
+	// recoveryCodeCount is the number of recovery codes issued when
+	// enrolling in two-factor authentication.
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret generates a random base32-encoded TOTP secret.
+func NewTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPURL returns the otpauth:// URL that authenticator apps enroll
+// from, usually by scanning it as a QR code.
+func TOTPURL(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// totpStep returns the TOTP time step that matches code at time t, or
+// -1 if no step within the allowed skew matches.
+func totpStep(secret, code string, t time.Time) int64 {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != 6 {
+		return -1
+	}
+	now := t.Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+// totpCode computes the RFC 6238 code of key at the given time step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// newRecoveryCodes generates a set of single-use recovery codes and
+// their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomHex(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashSecret(code))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors.
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPStep(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		at   int64
+		want int64
+	}{
+		{"rfc 6238 at 59", "287082", 59, 1},
+		{"rfc 6238 at 1111111109", "081804", 1111111109, 37037036},
+		{"previous period", "081804", 1111111109 + totpPeriod, 37037036},
+		{"next period", "081804", 1111111109 - totpPeriod, 37037036},
+		{"expired", "081804", 1111111109 + 2*totpPeriod, -1},
+		{"wrong code", "000000", 1111111109, -1},
+		{"short code", "81804", 1111111109, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := totpStep(rfcSecret, tt.code, time.Unix(tt.at, 0)); got != tt.want {
+				t.Errorf("totpStep() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// memUsers is an in-memory Users store that applies the conditional
+// updates of MongoUsers.
+type memUsers struct {
+	users map[string]User
+}
+
+func (m *memUsers) Count(context.Context) int64 { return int64(len(m.users)) }
+
+func (m *memUsers) ReadAll(context.Context) ([]User, error) {
+	users := []User{}
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (m *memUsers) Read(_ context.Context, username string) (User, error) {
+	u, ok := m.users[username]
+	if !ok {
+		return User{}, ErrMongoNotFound
+	}
+	return u, nil
+}
+
+func (m *memUsers) Create(_ context.Context, u User) error {
+	m.users[u.Username] = u
+	return nil
+}
+
+func (m *memUsers) SetTOTP(_ context.Context, totp User) error {
+	u := m.users[totp.Username]
+	u.TOTPEnabled, u.TOTPSecret = totp.TOTPEnabled, totp.TOTPSecret
+	u.TOTPLastStep, u.RecoveryCodes = totp.TOTPLastStep, totp.RecoveryCodes
+	m.users[u.Username] = u
+	return nil
+}
+
+func (m *memUsers) Delete(_ context.Context, username string) error {
+	delete(m.users, username)
+	return nil
+}
+
+func (m *memUsers) SetPassword(_ context.Context, username, hash string) error {
+	u := m.users[username]
+	u.Hash = hash
+	m.users[username] = u
+	return nil
+}
+
+func (m *memUsers) SetRole(_ context.Context, username, role string) error {
+	u := m.users[username]
+	u.Role = role
+	m.users[username] = u
+	return nil
+}
+
+func (m *memUsers) UseTOTPStep(_ context.Context, username string, step int64) error {
+	u := m.users[username]
+	if u.TOTPLastStep >= step {
+		return ErrMongoConflict
+	}
+	u.TOTPLastStep = step
+	m.users[username] = u
+	return nil
+}
+
+func (m *memUsers) UseRecoveryCode(_ context.Context, username, hash string) error {
+	u := m.users[username]
+	i := slices.Index(u.RecoveryCodes, hash)
+	if i < 0 {
+		return ErrMongoConflict
+	}
+	u.RecoveryCodes = slices.Delete(slices.Clone(u.RecoveryCodes), i, i+1)
+	m.users[username] = u
+	return nil
+}
+
+func (m *memUsers) LoginFailed(_ context.Context, username string) error {
+	u := m.users[username]
+	u.FailedLogins++
+	if u.FailedLogins >= maxFailedLogins {
+		u.FailedLogins = 0
+		u.LockedUntil = time.Now().Add(lockoutDuration)
+	}
+	m.users[username] = u
+	return nil
+}
+
+func (m *memUsers) LoginSucceeded(_ context.Context, username string) error {
+	u := m.users[username]
+	u.FailedLogins = 0
+	u.LockedUntil = time.Time{}
+	m.users[username] = u
+	return nil
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	u, err := NewUser("alice", "correct horse", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := u.EnrollTOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	step := time.Now().Unix() / totpPeriod
+	codes, err := u.EnableTOTP(totpCode(key, step-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &memUsers{users: map[string]User{u.Username: u}}
+
+	// Every check reads the stored user, as Login does.
+	check := func(code string) bool {
+		user, _ := users.Read(context.Background(), u.Username)
+		return user.CheckSecondFactor(context.Background(), users, code)
+	}
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"enrollment code replayed", totpCode(key, step-1), false},
+		{"current code", totpCode(key, step), true},
+		{"current code replayed", totpCode(key, step), false},
+		{"older code", totpCode(key, step-1), false},
+		{"recovery code", codes[0], true},
+		{"recovery code replayed", codes[0], false},
+		{"other recovery code", codes[1], true},
+		{"wrong code", "000000-0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := check(tt.code); got != tt.want {
+				t.Errorf("CheckSecondFactor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if n := len(users.users[u.Username].RecoveryCodes); n != recoveryCodeCount-2 {
+		t.Errorf("%d recovery codes left, want %d", n, recoveryCodeCount-2)
+	}
+}
+
+func TestCheckSecondFactorStale(t *testing.T) {
+	secret, _ := NewTOTPSecret()
+	key, _ := totpEncoding.DecodeString(secret)
+	step := time.Now().Unix() / totpPeriod
+	u := User{Username: "alice", TOTPEnabled: true, TOTPSecret: secret,
+		RecoveryCodes: []string{hashSecret("abcde-12345")}}
+	users := &memUsers{users: map[string]User{u.Username: u}}
+
+	// Two logins read the user before either consumes its code: only
+	// the first may succeed.
+	for _, code := range []string{totpCode(key, step), "abcde-12345"} {
+		if !u.CheckSecondFactor(context.Background(), users, code) {
+			t.Fatalf("CheckSecondFactor(%q) = false on first use", code)
+		}
+		if u.CheckSecondFactor(context.Background(), users, code) {
+			t.Errorf("CheckSecondFactor(%q) = true on concurrent reuse", code)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package data
+
+import (
+	ctx "context"
+)
+
+// UIDs defines the interface of the store that assigns IMAP unique
+// identifiers to entries. UIDs are strictly ascending within a mailbox
+// and are never reused.
+type UIDs interface {
+
+	// Assign returns the UIDs of the given entries of a mailbox,
+	// assigning new UIDs, in order, to entries that have none. The
+	// IDs must list every entry of the mailbox; UIDs of entries that
+	// no longer exist are released. It also returns the mailbox's
+	// UID validity and the next UID to be assigned.
+	Assign(ctx.Context, string, []string) (UIDMap, error)
+}
+
+// UIDMap describes the UIDs of a mailbox.
+type UIDMap struct {
+	Validity uint32
+	Next     uint32
+	UIDs     []uint32
+}
@@ -0,0 +1,242 @@
+package data
+
+import (
+	ctx "context"
+	"crypto/subtle"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"time"
+)
+
+const (
+	// RoleViewer may list and read entries.
+	RoleViewer = "viewer"
+
+	// RoleResponder may additionally change the status of entries.
+	RoleResponder = "responder"
+
+	// RoleAdmin may perform every action.
+	RoleAdmin = "admin"
+)
+
+// roleScopes maps each role to the scopes it grants.
+var roleScopes = map[string][]string{
+	RoleViewer:    {ScopeRead},
+	RoleResponder: {ScopeRead, ScopeStatus, ScopeReply},
+	RoleAdmin:     {ScopeAdmin},
+}
+
+const (
+	// maxFailedLogins is the number of consecutive failed logins,
+	// whether by wrong password or second factor, after which a user
+	// is locked out.
+	maxFailedLogins = 5
+
+	// lockoutDuration is how long a locked out user must wait
+	// before logging in again.
+	lockoutDuration = 15 * time.Minute
+)
+
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,32}$`)
+
+// dummyHash is compared against when authenticating a user that does
+// not exist, so that unknown usernames take as long to reject as
+// wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("mailbox"), bcrypt.DefaultCost)
+
+// Users defines the Mailbox user store interface.
+type Users interface {
+
+	// Count returns the number of registered users.
+	Count(ctx.Context) int64
+
+	// ReadAll fetches every registered user.
+	ReadAll(ctx.Context) ([]User, error)
+
+	// Read fetches a single user by referencing its username.
+	Read(ctx.Context, string) (User, error)
+
+	// Create a new user.
+	Create(ctx.Context, User) error
+
+	// Delete a user by referencing its username.
+	Delete(ctx.Context, string) error
+
+	// SetPassword replaces the password hash of the user referenced
+	// by its username, leaving the user's other fields unchanged.
+	SetPassword(ctx.Context, string, string) error
+
+	// SetRole changes the role of the user referenced by its
+	// username, leaving the user's other fields unchanged.
+	SetRole(ctx.Context, string, string) error
+
+	// SetTOTP replaces the two-factor authentication fields of the
+	// user sharing the given user's username, i.e. whether it is
+	// enabled, the secret, the last step and the recovery codes,
+	// leaving the user's other fields unchanged.
+	SetTOTP(ctx.Context, User) error
+
+	// UseTOTPStep records that the user's TOTP code of the given time
+	// step was accepted. It returns ErrMongoConflict if a code of the
+	// same or a later step already was.
+	UseTOTPStep(ctx.Context, string, int64) error
+
+	// UseRecoveryCode removes the recovery code hash from the user. It
+	// returns ErrMongoConflict if the user does not hold it, e.g.
+	// because it was used concurrently.
+	UseRecoveryCode(ctx.Context, string, string) error
+
+	// LoginFailed counts a failed login of the user, locking them
+	// out once too many have failed in a row.
+	LoginFailed(ctx.Context, string) error
+
+	// LoginSucceeded resets the user's failed login count.
+	LoginSucceeded(ctx.Context, string) error
+}
+
+// User defines a Mailbox administrator account. Passwords are never
+// stored in plaintext, only their bcrypt hash. Users may enroll in
+// TOTP two-factor authentication, in which case they are issued
+// single-use recovery codes, of which only hashes are stored.
+type User struct {
+	Username      string    `json:"username" bson:"_id"`
+	Hash          string    `json:"-" bson:"hash"`
+	Role          string    `json:"role" bson:"role"`
+	Created       time.Time `json:"created" bson:"created"`
+	TOTPEnabled   bool      `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret    string    `json:"-" bson:"totp_secret,omitempty"`
+	TOTPLastStep  int64     `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes []string  `json:"-" bson:"recovery_codes,omitempty"`
+	FailedLogins  int       `json:"-" bson:"failed_logins,omitempty"`
+	LockedUntil   time.Time `json:"-" bson:"locked_until,omitempty"`
+}
+
+// NewUser initializes a user with the given credentials and role.
+func NewUser(username, password, role string) (User, error) {
+	u := User{Username: username, Role: role, Created: time.Now().UTC()}
+	if err := u.Validate(); err != nil {
+		return User{}, err
+	}
+	if err := u.SetPassword(password); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// Validate a user's 'Username' and 'Role' fields. Returns a
+// human-friendly error message.
+func (u User) Validate() error {
+	if !usernameRegex.MatchString(u.Username) {
+		return errors.New("'username' must be 1-32 characters long and contain only letters, numbers, '.', '_' and '-'")
+	}
+	if _, ok := roleScopes[u.Role]; !ok {
+		return errors.New("'role' must be one of viewer, responder or admin")
+	}
+	return nil
+}
+
+// Scopes returns the scopes granted by the user's role. Accounts
+// created before roles were introduced are administrators.
+func (u User) Scopes() []string {
+	if u.Role == "" {
+		return roleScopes[RoleAdmin]
+	}
+	return roleScopes[u.Role]
+}
+
+// SetPassword replaces the user's password hash.
+func (u *User) SetPassword(password string) error {
+	if len(password) < 8 {
+		return errors.New("'password' must be at least 8 characters long")
+	}
+	if len(password) > 72 {
+		return errors.New("'password' must be at most 72 characters long")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.Hash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether password matches the user's password
+// hash. The comparison is constant-time.
+func (u User) CheckPassword(password string) bool {
+	hash := []byte(u.Hash)
+	if len(hash) == 0 {
+		hash = dummyHash
+	}
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	return err == nil && len(u.Hash) > 0
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. Two-factor
+// authentication is not enforced until EnableTOTP confirms that the
+// user's authenticator produces valid codes.
+func (u *User) EnrollTOTP() (string, error) {
+	if u.TOTPEnabled {
+		return "", errors.New("two-factor authentication is already enabled")
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	u.TOTPSecret = secret
+	return secret, nil
+}
+
+// EnableTOTP enforces two-factor authentication once code proves that
+// enrollment succeeded. It returns the user's recovery codes.
+func (u *User) EnableTOTP(code string) ([]string, error) {
+	if u.TOTPEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	if u.TOTPSecret == "" {
+		return nil, errors.New("two-factor authentication enrollment has not started")
+	}
+	step := totpStep(u.TOTPSecret, code, time.Now())
+	if step < 0 {
+		return nil, errors.New("invalid authentication code")
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	u.TOTPEnabled = true
+	u.TOTPLastStep = step
+	u.RecoveryCodes = hashes
+	return codes, nil
+}
+
+// DisableTOTP removes the user's TOTP secret and recovery codes.
+func (u *User) DisableTOTP() {
+	u.TOTPEnabled = false
+	u.TOTPSecret = ""
+	u.TOTPLastStep = 0
+	u.RecoveryCodes = nil
+}
+
+// CheckSecondFactor reports whether code is a valid TOTP code or an
+// unused recovery code of the user. Codes cannot be replayed: accepted
+// TOTP codes and recovery codes are consumed in users, conditionally on
+// nobody having consumed them concurrently.
+func (u User) CheckSecondFactor(c ctx.Context, users Users, code string) bool {
+	if step := totpStep(u.TOTPSecret, code, time.Now()); step > u.TOTPLastStep {
+		return users.UseTOTPStep(c, u.Username, step) == nil
+	}
+	hash := hashSecret(code)
+	for _, h := range u.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			return users.UseRecoveryCode(c, u.Username, h) == nil
+		}
+	}
+	return false
+}
+
+// Locked reports whether the user is locked out after too many failed
+// logins.
+func (u User) Locked() bool {
+	return time.Now().Before(u.LockedUntil)
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		role     string
+		wantErr  bool
+	}{
+		{"valid", "alice", "correct horse", RoleAdmin, false},
+		{"dotted username", "alice.smith", "correct horse", RoleViewer, false},
+		{"empty username", "", "correct horse", RoleAdmin, true},
+		{"invalid username", "alice smith", "correct horse", RoleAdmin, true},
+		{"long username", strings.Repeat("a", 33), "correct horse", RoleAdmin, true},
+		{"unknown role", "alice", "correct horse", "owner", true},
+		{"short password", "alice", "secret", RoleAdmin, true},
+		{"long password", "alice", strings.Repeat("a", 73), RoleAdmin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := NewUser(tt.username, tt.password, tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if u.Hash == "" || u.Hash == tt.password {
+				t.Errorf("Hash = %q, want a bcrypt hash", u.Hash)
+			}
+			if u.Created.IsZero() {
+				t.Error("Created is not set")
+			}
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	u, err := NewUser("alice", "correct horse", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		user     User
+		password string
+		want     bool
+	}{
+		{"correct", u, "correct horse", true},
+		{"wrong", u, "battery staple", false},
+		{"empty", u, "", false},
+		{"no hash", User{Username: "bob"}, "mailbox", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.CheckPassword(tt.password); got != tt.want {
+				t.Errorf("CheckPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var stateRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// DefaultStates are the workflow states of entries, unless configured
+// otherwise. Entries start in the first state.
+var DefaultStates = []string{"new", "in-progress", "waiting-on-customer",
+	"resolved", "closed"}
+
+// DefaultTransitions maps each of the DefaultStates to the states that
+// entries may move to from it.
+var DefaultTransitions = map[string][]string{
+	"new":                 {"in-progress", "waiting-on-customer", "resolved", "closed"},
+	"in-progress":         {"waiting-on-customer", "resolved", "closed"},
+	"waiting-on-customer": {"in-progress", "resolved", "closed"},
+	"resolved":            {"in-progress", "closed"},
+	"closed":              {"in-progress"},
+}
+
+// DefaultClosed are the DefaultStates in which entries are no longer
+// open.
+var DefaultClosed = []string{"resolved", "closed"}
+
+// Workflow defines the states that entries move through as they are
+// handled, and the transitions allowed between them.
+type Workflow struct {
+	// States lists every state. Entries start in the first state.
+	States []string
+
+	// Transitions maps states to the states that entries may move to
+	// from them. The "*" key lists the states that may be reached from
+	// any state.
+	Transitions map[string][]string
+
+	// Closed lists the states in which entries are no longer open.
+	Closed []string
+
+	// SLA is how long entries may stay open before they are overdue.
+	// Zero disables the SLA.
+	SLA time.Duration
+}
+
+// DefaultWorkflow returns the workflow of the DefaultStates, without an
+// SLA.
+func DefaultWorkflow() Workflow {
+	return Workflow{
+		States:      DefaultStates,
+		Transitions: DefaultTransitions,
+		Closed:      DefaultClosed,
+	}
+}
+
+// Validate the workflow's states and transitions. Returns a
+// human-friendly error message.
+func (w Workflow) Validate() error {
+	if len(w.States) == 0 {
+		return errors.New("a workflow requires at least one state")
+	}
+	for i, state := range w.States {
+		if !stateRegex.MatchString(state) {
+			return fmt.Errorf("invalid state %q: states must be 1-32 lowercase letters, numbers, '_' or '-'", state)
+		}
+		if slices.Contains(w.States[:i], state) {
+			return fmt.Errorf("duplicate state %q", state)
+		}
+	}
+	for from, to := range w.Transitions {
+		if from != "*" && !w.Valid(from) {
+			return fmt.Errorf("transition from unknown state %q", from)
+		}
+		for _, state := range to {
+			if !w.Valid(state) {
+				return fmt.Errorf("transition to unknown state %q", state)
+			}
+		}
+	}
+	for _, state := range w.Closed {
+		if !w.Valid(state) {
+			return fmt.Errorf("unknown closed state %q", state)
+		}
+	}
+	if w.SLA < 0 {
+		return errors.New("the SLA must not be negative")
+	}
+	return nil
+}
+
+// Initial returns the state that entries start in.
+func (w Workflow) Initial() string {
+	if len(w.States) == 0 {
+		return ""
+	}
+	return w.States[0]
+}
+
+// Valid reports whether the state belongs to the workflow.
+func (w Workflow) Valid(state string) bool {
+	return slices.Contains(w.States, state)
+}
+
+// Allowed reports whether entries may move from one state to another.
+func (w Workflow) Allowed(from, to string) bool {
+	return w.Valid(to) && (slices.Contains(w.Transitions[from], to) ||
+		slices.Contains(w.Transitions["*"], to))
+}
+
+// Open reports whether entries in the state are still open.
+func (w Workflow) Open(state string) bool {
+	return !slices.Contains(w.Closed, state)
+}
+
+// State returns the state of the entry. Entries without one are in the
+// initial state.
+func (w Workflow) State(f Form) string {
+	if f.State == "" {
+		return w.Initial()
+	}
+	return f.State
+}
+
+// Overdue reports whether the entry has been open for longer than the
+// SLA at the given time.
+func (w Workflow) Overdue(f Form, now time.Time) bool {
+	return w.SLA > 0 && w.Open(w.State(f)) && now.Sub(f.Created) > w.SLA
+}
+
+// Annotate fills in the entry's state and whether it is overdue at the
+// given time.
+func (w Workflow) Annotate(f *Form, now time.Time) {
+	f.State = w.State(*f)
+	f.Overdue = w.Overdue(*f, now)
+}
+
+// Match returns the values of Filter.States that match the entries in
+// the state, including those without a state if it is the initial one.
+func (w Workflow) Match(state string) []string {
+	if state == w.Initial() {
+		return []string{state, ""}
+	}
+	return []string{state}
+}
+
+// FilterOverdue narrows down the filter to the entries that are overdue
+// at the given time. It returns false if no entry can be overdue.
+func (w Workflow) FilterOverdue(f *Filter, now time.Time) bool {
+	if w.SLA <= 0 {
+		return false
+	}
+	open := []string{}
+	for _, state := range w.States {
+		if !w.Open(state) {
+			continue
+		}
+		if len(f.States) > 0 && !slices.Contains(f.States, state) {
+			continue
+		}
+		open = append(open, w.Match(state)...)
+	}
+	if len(open) == 0 {
+		return false
+	}
+	f.States = open
+	before := now.Add(-w.SLA)
+	if f.Before.IsZero() || before.Before(f.Before) {
+		f.Before = before
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWorkflowValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		w       Workflow
+		wantErr bool
+	}{
+		{"default", DefaultWorkflow(), false},
+		{"single state", Workflow{States: []string{"open"}}, false},
+		{"any to any", Workflow{States: []string{"open", "done"},
+			Transitions: map[string][]string{"*": {"open", "done"}}}, false},
+		{"no states", Workflow{}, true},
+		{"invalid state", Workflow{States: []string{"Open"}}, true},
+		{"duplicate state", Workflow{States: []string{"open", "open"}}, true},
+		{"transition from unknown", Workflow{States: []string{"open"},
+			Transitions: map[string][]string{"done": {"open"}}}, true},
+		{"transition to unknown", Workflow{States: []string{"open"},
+			Transitions: map[string][]string{"open": {"done"}}}, true},
+		{"unknown closed state", Workflow{States: []string{"open"},
+			Closed: []string{"done"}}, true},
+		{"negative sla", Workflow{States: []string{"open"}, SLA: -time.Hour}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.w.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorkflowAllowed(t *testing.T) {
+	w := Workflow{
+		States: []string{"open", "waiting", "done"},
+		Transitions: map[string][]string{
+			"open":    {"waiting", "done"},
+			"waiting": {"done"},
+			"*":       {"open"},
+		},
+	}
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"open", "waiting", true},
+		{"open", "done", true},
+		{"waiting", "done", true},
+		{"waiting", "open", true},
+		{"done", "open", true},
+		{"done", "waiting", false},
+		{"waiting", "waiting", false},
+		{"open", "unknown", false},
+		{"unknown", "open", true},
+		{"unknown", "done", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := w.Allowed(tt.from, tt.to); got != tt.want {
+				t.Errorf("Allowed(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowOverdue(t *testing.T) {
+	w := DefaultWorkflow()
+	w.SLA = 48 * time.Hour
+	now := time.Now()
+	tests := []struct {
+		name string
+		form Form
+		want bool
+	}{
+		{"open and late", Form{State: "in-progress", Created: now.Add(-72 * time.Hour)}, true},
+		{"initial and late", Form{Created: now.Add(-72 * time.Hour)}, true},
+		{"open and on time", Form{State: "new", Created: now.Add(-time.Hour)}, false},
+		{"closed and late", Form{State: "resolved", Created: now.Add(-72 * time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.Overdue(tt.form, now); got != tt.want {
+				t.Errorf("Overdue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowFilterOverdue(t *testing.T) {
+	w := DefaultWorkflow()
+	now := time.Now()
+	if w.FilterOverdue(&Filter{}, now) {
+		t.Error("FilterOverdue() = true without an SLA")
+	}
+
+	w.SLA = time.Hour
+	f := Filter{}
+	if !w.FilterOverdue(&f, now) {
+		t.Fatal("FilterOverdue() = false with an SLA")
+	}
+	want := []string{"new", "", "in-progress", "waiting-on-customer"}
+	if !slices.Equal(f.States, want) {
+		t.Errorf("States = %q, want %q", f.States, want)
+	}
+	if !f.Before.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Before = %s, want %s", f.Before, now.Add(-time.Hour))
+	}
+
+	f = Filter{States: []string{"resolved"}}
+	if w.FilterOverdue(&f, now) {
+		t.Error("FilterOverdue() = true for a closed state")
+	}
+}
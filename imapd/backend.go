@@ -0,0 +1,194 @@
+// Package imapd exposes mailbox entries to regular mail clients over
+// IMAP4rev1. Each mailbox is presented as a folder, with the default
+// mailbox as the INBOX.
+package imapd
+
+import (
+	"context"
+	"errors"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/server"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"strings"
+	"time"
+)
+
+// Timeout is the time to wait before canceling the database
+// transactions of a command. Selecting a folder reads every entry of
+// its mailbox.
+var Timeout = 30 * time.Second
+
+var (
+	// ErrReadOnly is returned by commands that would create, rename
+	// or copy folders and messages, which entries do not support.
+	ErrReadOnly = errors.New("mailboxes cannot be modified over IMAP")
+
+	// ErrPermission is returned when the user's role does not allow
+	// a change.
+	ErrPermission = errors.New("permission denied")
+
+	// ErrSecondFactor is returned when a user with two-factor
+	// authentication logs in, since IMAP cannot carry a second factor.
+	ErrSecondFactor = errors.New("two-factor authentication is enabled, IMAP login is not available")
+
+	// ErrLocked is returned when a user is locked out after too many
+	// failed logins.
+	ErrLocked = errors.New("too many failed logins, please try again later")
+)
+
+// Backend implements an IMAP backend on top of the mailbox database.
+// Users are authenticated against the user store.
+type Backend struct {
+	db     data.Data
+	users  data.Users
+	uids   data.UIDs
+	domain string
+	n      notify.Notifier
+}
+
+// NewBackend initializes a Backend. Messages are addressed to
+// "<mailbox>@<domain>". The notifier n (if not nil) is notified of
+// status changes and deletions.
+func NewBackend(db data.Data, users data.Users, uids data.UIDs, domain string,
+	n notify.Notifier) *Backend {
+	return &Backend{db: db, users: users, uids: uids, domain: domain, n: n}
+}
+
+// NewServer initializes an IMAP server for the backend, listening on
+// addr.
+func NewServer(b *Backend, addr string) *server.Server {
+	s := server.New(b)
+	s.Addr = addr
+	return s
+}
+
+// Login authenticates a user with its password. Users with two-factor
+// authentication enabled and users locked out after too many failed
+// logins are rejected.
+func (b *Backend) Login(conn *imap.ConnInfo, username, password string) (backend.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	// An unknown user yields an empty User, whose password check
+	// still costs a full bcrypt comparison.
+	u, err := b.users.Read(ctx, username)
+	if err != nil {
+		u.CheckPassword(password)
+		return nil, backend.ErrInvalidCredentials
+	}
+	if u.Locked() {
+		return nil, ErrLocked
+	}
+	if !u.CheckPassword(password) {
+		// Wrong passwords count towards the lockout.
+		b.users.LoginFailed(ctx, u.Username)
+		return nil, backend.ErrInvalidCredentials
+	}
+	if u.TOTPEnabled {
+		return nil, ErrSecondFactor
+	}
+	if u.FailedLogins > 0 {
+		b.users.LoginSucceeded(ctx, u.Username)
+	}
+	addr := ""
+	if conn != nil && conn.RemoteAddr != nil {
+		addr = conn.RemoteAddr.String()
+	}
+	return &user{b: b, name: u.Username, scopes: u.Scopes(), addr: addr}, nil
+}
+
+// user is an authenticated IMAP session.
+type user struct {
+	b      *Backend
+	name   string
+	scopes []string
+	addr   string
+}
+
+func (u *user) Username() string {
+	return u.name
+}
+
+// can reports whether the user's role grants the scope.
+func (u *user) can(scope string) bool {
+	for _, s := range u.scopes {
+		if s == scope || s == data.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ListMailboxes lists a folder per mailbox. Every folder counts as
+// subscribed.
+func (u *user) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	names, err := u.b.db.Mailboxes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mailboxes := []backend.Mailbox{newMailbox(u, data.DefaultMailbox)}
+	for _, name := range names {
+		if name != data.DefaultMailbox {
+			mailboxes = append(mailboxes, newMailbox(u, name))
+		}
+	}
+	return mailboxes, nil
+}
+
+// GetMailbox returns the folder with the given name. The INBOX is
+// always present, even if the default mailbox is empty.
+func (u *user) GetMailbox(name string) (backend.Mailbox, error) {
+	box := mailboxName(name)
+	if box == data.DefaultMailbox {
+		return newMailbox(u, box), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	names, err := u.b.db.Mailboxes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		if n == box {
+			return newMailbox(u, box), nil
+		}
+	}
+	return nil, backend.ErrNoSuchMailbox
+}
+
+func (u *user) CreateMailbox(name string) error {
+	return ErrReadOnly
+}
+
+func (u *user) DeleteMailbox(name string) error {
+	return ErrReadOnly
+}
+
+func (u *user) RenameMailbox(existingName, newName string) error {
+	return ErrReadOnly
+}
+
+func (u *user) Logout() error {
+	return nil
+}
+
+// folderName returns the name of the folder presenting a mailbox.
+func folderName(mailbox string) string {
+	if mailbox == data.DefaultMailbox {
+		return "INBOX"
+	}
+	return mailbox
+}
+
+// mailboxName returns the mailbox presented by a folder. The INBOX
+// name is case-insensitive.
+func mailboxName(folder string) string {
+	if strings.EqualFold(folder, "INBOX") {
+		return data.DefaultMailbox
+	}
+	return folder
+}
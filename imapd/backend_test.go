@@ -0,0 +1,88 @@
+package imapd
+
+import (
+	"context"
+	"github.com/emersion/go-imap/backend"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"testing"
+	"time"
+)
+
+// newTestUser returns a user of the given role, stored in users.
+func newTestUser(t *testing.T, users *datatest.Users, username, role string) data.User {
+	t.Helper()
+	u, err := data.NewUser(username, "correct horse", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestLogin(t *testing.T) {
+	users := datatest.NewUsers()
+	newTestUser(t, users, "alice", data.RoleViewer)
+	totp := newTestUser(t, users, "bob", data.RoleAdmin)
+	totp.TOTPEnabled = true
+	users.SetTOTP(context.Background(), totp)
+	locked, _ := data.NewUser("carol", "correct horse", data.RoleAdmin)
+	locked.LockedUntil = time.Now().Add(time.Hour)
+	users.Create(context.Background(), locked)
+	b := NewBackend(datatest.NewData(), users, datatest.NewUIDs(), "example.com", nil)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{"valid", "alice", "correct horse", nil},
+		{"wrong password", "alice", "battery staple", backend.ErrInvalidCredentials},
+		{"unknown user", "dave", "correct horse", backend.ErrInvalidCredentials},
+		{"two-factor", "bob", "correct horse", ErrSecondFactor},
+		{"locked out", "carol", "correct horse", ErrLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := b.Login(nil, tt.username, tt.password)
+			if err != tt.err {
+				t.Fatalf("Login() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && u.Username() != tt.username {
+				t.Errorf("Username() = %q, want %q", u.Username(), tt.username)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	users := datatest.NewUsers()
+	newTestUser(t, users, "alice", data.RoleViewer)
+	b := NewBackend(datatest.NewData(), users, datatest.NewUIDs(), "example.com", nil)
+
+	for i := 0; i < 5; i++ {
+		if _, err := b.Login(nil, "alice", "battery staple"); err != backend.ErrInvalidCredentials {
+			t.Fatalf("attempt %d: Login() error = %v", i, err)
+		}
+	}
+	if _, err := b.Login(nil, "alice", "correct horse"); err != ErrLocked {
+		t.Errorf("Login() error = %v after repeated failures, want %v", err, ErrLocked)
+	}
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+	users := datatest.NewUsers()
+	newTestUser(t, users, "alice", data.RoleViewer)
+	b := NewBackend(datatest.NewData(), users, datatest.NewUIDs(), "example.com", nil)
+
+	b.Login(nil, "alice", "battery staple")
+	if _, err := b.Login(nil, "alice", "correct horse"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if u, _ := users.Read(context.Background(), "alice"); u.FailedLogins != 0 {
+		t.Errorf("FailedLogins = %d after a successful login, want 0", u.FailedLogins)
+	}
+}
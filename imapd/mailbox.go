@@ -0,0 +1,294 @@
+package imapd
+
+import (
+	"context"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/zeim839/mailbox/core"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"sort"
+	"time"
+)
+
+// Delimiter separates the levels of folder names. Mailboxes are flat.
+const Delimiter = "/"
+
+// mailbox is a folder presenting the entries of a mailbox. Its entries
+// are loaded once, when the folder is first used, so sequence numbers
+// remain stable for the duration of a selection. Entries created
+// afterwards appear once the folder is selected again.
+type mailbox struct {
+	u       *user
+	name    string
+	loaded  bool
+	uids    data.UIDMap
+	entries []*entry
+}
+
+func newMailbox(u *user, name string) *mailbox {
+	return &mailbox{u: u, name: name}
+}
+
+func (m *mailbox) Name() string {
+	return folderName(m.name)
+}
+
+func (m *mailbox) Info() (*imap.MailboxInfo, error) {
+	return &imap.MailboxInfo{
+		Delimiter: Delimiter,
+		Name:      m.Name(),
+	}, nil
+}
+
+// load reads the mailbox's entries and their UIDs, in ascending UID
+// order.
+func (m *mailbox) load() error {
+	if m.loaded {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	filter := data.Filter{Mailbox: m.name}
+	forms, err := m.u.b.db.ReadAll(ctx, filter, m.u.b.db.Count(ctx, filter), 0)
+	if err != nil && err != data.ErrMongoNotFound {
+		return err
+	}
+	sort.SliceStable(forms, func(i, j int) bool {
+		if forms[i].Created.Equal(forms[j].Created) {
+			return forms[i].ID < forms[j].ID
+		}
+		return forms[i].Created.Before(forms[j].Created)
+	})
+	ids := make([]string, len(forms))
+	for i, form := range forms {
+		ids[i] = form.ID
+	}
+	uids, err := m.u.b.uids.Assign(ctx, m.name, ids)
+	if err != nil {
+		return err
+	}
+	m.entries = make([]*entry, len(forms))
+	for i, form := range forms {
+		m.entries[i] = &entry{uid: uids.UIDs[i], form: form}
+	}
+	sort.Slice(m.entries, func(i, j int) bool {
+		return m.entries[i].uid < m.entries[j].uid
+	})
+	m.uids, m.loaded = uids, true
+	return nil
+}
+
+// Status describes the folder. Users who may not change the status of
+// entries open it read-only.
+func (m *mailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	status := imap.NewMailboxStatus(m.Name(), items)
+	status.Flags = []string{imap.SeenFlag, imap.AnsweredFlag, imap.DeletedFlag}
+	status.PermanentFlags = []string{imap.SeenFlag, imap.DeletedFlag}
+	status.ReadOnly = !m.u.can(data.ScopeStatus)
+	var unseen uint32
+	for i, e := range m.entries {
+		if e.form.Status != data.StatusRead {
+			if unseen == 0 {
+				status.UnseenSeqNum = uint32(i + 1)
+			}
+			unseen++
+		}
+	}
+	for _, item := range items {
+		switch item {
+		case imap.StatusMessages:
+			status.Messages = uint32(len(m.entries))
+		case imap.StatusUidNext:
+			status.UidNext = m.uids.Next
+		case imap.StatusUidValidity:
+			status.UidValidity = m.uids.Validity
+		case imap.StatusRecent:
+			status.Recent = 0
+		case imap.StatusUnseen:
+			status.Unseen = unseen
+		}
+	}
+	return status, nil
+}
+
+func (m *mailbox) SetSubscribed(subscribed bool) error {
+	return nil
+}
+
+func (m *mailbox) Check() error {
+	return nil
+}
+
+// each calls fn with the sequence number of every entry in seqSet.
+func (m *mailbox) each(uid bool, seqSet *imap.SeqSet, fn func(uint32, *entry) error) error {
+	if err := m.load(); err != nil {
+		return err
+	}
+	for i, e := range m.entries {
+		seqNum := uint32(i + 1)
+		id := seqNum
+		if uid {
+			id = e.uid
+		}
+		if !seqSet.Contains(id) {
+			continue
+		}
+		if err := fn(seqNum, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListMessages fetches entries. Fetching the body of an unread entry,
+// other than with BODY.PEEK, marks it as read.
+func (m *mailbox) ListMessages(uid bool, seqSet *imap.SeqSet, items []imap.FetchItem,
+	ch chan<- *imap.Message) error {
+	defer close(ch)
+	return m.each(uid, seqSet, func(seqNum uint32, e *entry) error {
+		if m.u.can(data.ScopeStatus) && e.form.Status != data.StatusRead &&
+			readsBody(items) {
+			if err := m.setStatus(e, data.StatusRead); err != nil {
+				return err
+			}
+		}
+		msg, err := e.fetch(seqNum, m.u.b.domain, items)
+		if err != nil {
+			return err
+		}
+		ch <- msg
+		return nil
+	})
+}
+
+// readsBody reports whether items fetch a body section without
+// peeking.
+func readsBody(items []imap.FetchItem) bool {
+	for _, item := range items {
+		section, err := imap.ParseBodySectionName(item)
+		if err == nil && !section.Peek {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]uint32, error) {
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for i, e := range m.entries {
+		seqNum := uint32(i + 1)
+		ok, err := e.match(seqNum, m.u.b.domain, criteria)
+		if err != nil || !ok {
+			continue
+		}
+		if uid {
+			ids = append(ids, e.uid)
+		} else {
+			ids = append(ids, seqNum)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	return ErrReadOnly
+}
+
+// UpdateMessagesFlags maps \Seen to the read status of entries and
+// marks entries for deletion with \Deleted. Other flags are ignored.
+func (m *mailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, op imap.FlagsOp,
+	flags []string) error {
+	return m.each(uid, seqSet, func(_ uint32, e *entry) error {
+		updated := backendutil.UpdateFlags(e.flags(), op, flags)
+		deleted := contains(updated, imap.DeletedFlag)
+		if deleted && !m.u.can(data.ScopeDelete) {
+			return ErrPermission
+		}
+		e.deleted = deleted
+		status := data.StatusUnread
+		if contains(updated, imap.SeenFlag) {
+			status = data.StatusRead
+		}
+		return m.setStatus(e, status)
+	})
+}
+
+func (m *mailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	return ErrReadOnly
+}
+
+// Expunge deletes the entries marked for deletion.
+func (m *mailbox) Expunge() error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	kept := m.entries[:0]
+	var err error
+	for _, e := range m.entries {
+		if !e.deleted || err != nil {
+			kept = append(kept, e)
+			continue
+		}
+		err = m.u.b.db.Transact(ctx, func(ctx context.Context) error {
+			err := m.u.b.db.Delete(ctx, e.form.ID)
+			if err != nil && err != data.ErrMongoNotFound {
+				return err
+			}
+			return core.Dispatch(ctx, m.u.b.n, notify.NewEvent(notify.EventDeleted,
+				e.form, m.u.name))
+		})
+		if err != nil {
+			kept = append(kept, e)
+			continue
+		}
+		core.Audit(m.u.name, "delete", e.form.ID, m.u.addr)
+	}
+	m.entries = kept
+	return err
+}
+
+// setStatus changes the status of an entry, notifying the backend's
+// notifier of the change.
+func (m *mailbox) setStatus(e *entry, status string) error {
+	if e.form.Status == status {
+		return nil
+	}
+	if !m.u.can(data.ScopeStatus) {
+		return ErrPermission
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	// Patch the stored entry rather than replace it with the
+	// selection's copy, which may be outdated.
+	err := m.u.b.db.Transact(ctx, func(ctx context.Context) error {
+		form, err := m.u.b.db.Patch(ctx, e.form.ID, data.Patch{Status: &status})
+		if err != nil {
+			return err
+		}
+		return core.Dispatch(ctx, m.u.b.n, notify.NewEvent(notify.EventStatusChanged,
+			form, m.u.name))
+	})
+	if err != nil {
+		return err
+	}
+	e.form.Status = status
+	core.Audit(m.u.name, "status."+status, e.form.ID, m.u.addr)
+	return nil
+}
+
+// contains reports whether flags holds flag.
+func contains(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package imapd
+
+import (
+	"context"
+	"github.com/emersion/go-imap"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"testing"
+	"time"
+)
+
+// selectInbox logs a user of the given role in and selects the INBOX of
+// a backend holding the entries.
+func selectInbox(t *testing.T, role string, forms ...data.Form) (*mailbox, *datatest.Data) {
+	t.Helper()
+	db := datatest.NewData(forms...)
+	users := datatest.NewUsers()
+	newTestUser(t, users, "alice", role)
+	b := NewBackend(db, users, datatest.NewUIDs(), "example.com", nil)
+	u, err := b.Login(nil, "alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := u.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := box.(*mailbox)
+	if err := m.load(); err != nil {
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+// testForm returns an unread entry of the default mailbox.
+func testForm(subject string, created time.Time) data.Form {
+	return data.Form{
+		From:    "jane@example.com",
+		Subject: subject,
+		Message: "Hi there",
+		Created: created,
+	}
+}
+
+// fetch fetches the items of every message of the folder.
+func fetch(t *testing.T, m *mailbox, items ...imap.FetchItem) []*imap.Message {
+	t.Helper()
+	seqSet, _ := imap.ParseSeqSet("1:*")
+	ch := make(chan *imap.Message, len(m.entries))
+	if err := m.ListMessages(false, seqSet, items, ch); err != nil {
+		t.Fatalf("ListMessages() error = %v", err)
+	}
+	msgs := []*imap.Message{}
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Now().UTC()
+	read := testForm("Second", now)
+	read.Status = data.StatusRead
+	m, _ := selectInbox(t, data.RoleViewer, testForm("First", now.Add(-time.Hour)), read)
+
+	status, err := m.Status([]imap.StatusItem{imap.StatusMessages, imap.StatusUnseen,
+		imap.StatusUidNext})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Messages != 2 || status.Unseen != 1 || status.UidNext != 3 {
+		t.Errorf("Status() = %d messages, %d unseen, next uid %d, want 2, 1, 3",
+			status.Messages, status.Unseen, status.UidNext)
+	}
+	if !status.ReadOnly {
+		t.Error("Status() is not read-only for a viewer")
+	}
+}
+
+func TestListMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		item     imap.FetchItem
+		wantRead bool
+	}{
+		{"peek", data.RoleResponder, "BODY.PEEK[]", false},
+		{"body", data.RoleResponder, "BODY[]", true},
+		{"viewer body", data.RoleViewer, "BODY[]", false},
+		{"flags", data.RoleResponder, imap.FetchFlags, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := selectInbox(t, tt.role, testForm("Hello", time.Now()))
+			id := m.entries[0].form.ID
+
+			// A note added after the folder was selected must
+			// survive the status change.
+			note := data.Note{Author: "bob", Body: "Called them", Created: time.Now()}
+			db.Patch(context.Background(), id, data.Patch{Notes: []data.Note{note}})
+
+			msgs := fetch(t, m, tt.item)
+			if len(msgs) != 1 {
+				t.Fatalf("fetched %d messages, want 1", len(msgs))
+			}
+			form, _ := db.Read(context.Background(), id)
+			if read := form.Status == data.StatusRead; read != tt.wantRead {
+				t.Errorf("read = %v, want %v", read, tt.wantRead)
+			}
+			if len(form.Notes) != 1 {
+				t.Errorf("entry has %d notes, want 1", len(form.Notes))
+			}
+		})
+	}
+}
+
+func TestUpdateMessagesFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		flags    []string
+		err      error
+		wantRead bool
+	}{
+		{"seen", data.RoleResponder, []string{imap.SeenFlag}, nil, true},
+		{"seen as viewer", data.RoleViewer, []string{imap.SeenFlag}, ErrPermission, false},
+		{"deleted as responder", data.RoleResponder, []string{imap.DeletedFlag},
+			ErrPermission, false},
+		{"deleted as admin", data.RoleAdmin, []string{imap.DeletedFlag}, nil, false},
+		{"other flags", data.RoleViewer, []string{imap.FlaggedFlag}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, db := selectInbox(t, tt.role, testForm("Hello", time.Now()))
+			seqSet, _ := imap.ParseSeqSet("1")
+			err := m.UpdateMessagesFlags(false, seqSet, imap.AddFlags, tt.flags)
+			if err != tt.err {
+				t.Fatalf("UpdateMessagesFlags() error = %v, want %v", err, tt.err)
+			}
+			form, _ := db.Read(context.Background(), m.entries[0].form.ID)
+			if read := form.Status == data.StatusRead; read != tt.wantRead {
+				t.Errorf("read = %v, want %v", read, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestExpunge(t *testing.T) {
+	now := time.Now().UTC()
+	m, db := selectInbox(t, data.RoleAdmin, testForm("First", now.Add(-time.Hour)),
+		testForm("Second", now))
+	seqSet, _ := imap.ParseSeqSet("1")
+	if err := m.UpdateMessagesFlags(false, seqSet, imap.AddFlags,
+		[]string{imap.DeletedFlag}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Expunge(); err != nil {
+		t.Fatalf("Expunge() error = %v", err)
+	}
+	if len(m.entries) != 1 || m.entries[0].form.Subject != "Second" {
+		t.Errorf("folder holds %d entries after expunging the first", len(m.entries))
+	}
+	if n := db.Count(context.Background(), data.Filter{}); n != 1 {
+		t.Errorf("database holds %d entries, want 1", n)
+	}
+}
@@ -0,0 +1,128 @@
+package imapd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/notify"
+	"time"
+)
+
+// entry is an entry of a selected folder.
+type entry struct {
+	uid     uint32
+	form    data.Form
+	deleted bool
+	raw     []byte
+}
+
+// flags returns the IMAP flags of the entry. Read entries are \Seen
+// and entries that were replied to are \Answered.
+func (e *entry) flags() []string {
+	flags := []string{}
+	if e.form.Status == data.StatusRead {
+		flags = append(flags, imap.SeenFlag)
+	}
+	for _, r := range e.form.Replies {
+		if !r.Inbound {
+			flags = append(flags, imap.AnsweredFlag)
+			break
+		}
+	}
+	if e.deleted {
+		flags = append(flags, imap.DeletedFlag)
+	}
+	return flags
+}
+
+// bytes returns the entry in RFC 5322 format. Messages must never
+// change, so the conversation is left out.
+func (e *entry) bytes(domain string) []byte {
+	if e.raw != nil {
+		return e.raw
+	}
+	body := e.form.Message
+	if len(e.form.Attachments) > 0 {
+		body += "\n\nAttachments (not stored):\n"
+		for _, a := range e.form.Attachments {
+			body += fmt.Sprintf("- %s (%s, %d bytes)\n", a.Filename,
+				a.ContentType, a.Size)
+		}
+	}
+	msg := notify.Message{
+		To:      []string{e.form.Mailbox + "@" + domain},
+		Subject: e.form.Subject,
+		Body:    body,
+		Headers: map[string]string{
+			"Date":            e.form.Created.Format(time.RFC1123Z),
+			"Message-ID":      "<" + e.form.ID + "@" + domain + ">",
+			"X-Mailbox-Entry": e.form.ID,
+		},
+	}
+	e.raw = msg.Bytes(e.form.From)
+	return e.raw
+}
+
+// header parses the entry's header, returning the reader positioned at
+// the start of its body.
+func (e *entry) header(domain string) (textproto.Header, *bufio.Reader, error) {
+	body := bufio.NewReader(bytes.NewReader(e.bytes(domain)))
+	hdr, err := textproto.ReadHeader(body)
+	return hdr, body, err
+}
+
+// fetch returns the requested items of the entry.
+func (e *entry) fetch(seqNum uint32, domain string, items []imap.FetchItem) (*imap.Message, error) {
+	fetched := imap.NewMessage(seqNum, items)
+	for _, item := range items {
+		switch item {
+		case imap.FetchEnvelope:
+			hdr, _, err := e.header(domain)
+			if err != nil {
+				return nil, err
+			}
+			fetched.Envelope, _ = backendutil.FetchEnvelope(hdr)
+		case imap.FetchBody, imap.FetchBodyStructure:
+			hdr, body, err := e.header(domain)
+			if err != nil {
+				return nil, err
+			}
+			fetched.BodyStructure, _ = backendutil.FetchBodyStructure(hdr,
+				body, item == imap.FetchBodyStructure)
+		case imap.FetchFlags:
+			fetched.Flags = e.flags()
+		case imap.FetchInternalDate:
+			fetched.InternalDate = e.form.Created
+		case imap.FetchRFC822Size:
+			fetched.Size = uint32(len(e.bytes(domain)))
+		case imap.FetchUid:
+			fetched.Uid = e.uid
+		default:
+			section, err := imap.ParseBodySectionName(item)
+			if err != nil {
+				break
+			}
+			hdr, body, err := e.header(domain)
+			if err != nil {
+				return nil, err
+			}
+			l, _ := backendutil.FetchBodySection(hdr, body, section)
+			fetched.Body[section] = l
+		}
+	}
+	return fetched, nil
+}
+
+// match reports whether the entry matches the search criteria.
+func (e *entry) match(seqNum uint32, domain string, c *imap.SearchCriteria) (bool, error) {
+	m, err := message.Read(bytes.NewReader(e.bytes(domain)))
+	if err != nil {
+		return false, err
+	}
+	return backendutil.Match(m, seqNum, e.uid, e.form.Created, e.flags(), c)
+}
@@ -0,0 +1,330 @@
+// Package inbound receives email and converts it into mailbox entries.
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"golang.org/x/net/html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// maxParts bounds the number of MIME parts parsed from one message.
+const maxParts = 100
+
+// ErrParseNoSender is returned when a message has no valid From
+// address.
+var ErrParseNoSender = errors.New("message has no valid sender")
+
+// Email is a parsed inbound email.
+type Email struct {
+	From        string
+	To          []string
+	Subject     string
+	MessageID   string
+	InReplyTo   string
+	Text        string
+	Attachments []data.Attachment
+
+	// Automated reports whether the message declares itself as
+	// automatically generated (e.g. a bounce or an auto-reply).
+	Automated bool
+}
+
+// Parse reads an RFC 5322 message. The body is converted to plain
+// text, preferring text/plain parts and falling back to text/html.
+// Attachments are described but their contents are discarded.
+func Parse(r io.Reader) (Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Email{}, err
+	}
+	dec := new(mime.WordDecoder)
+	header := func(key string) string {
+		value := msg.Header.Get(key)
+		if decoded, err := dec.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+
+	e := Email{
+		Subject:   strings.TrimSpace(header("Subject")),
+		MessageID: strings.TrimSpace(msg.Header.Get("Message-ID")),
+		InReplyTo: strings.TrimSpace(msg.Header.Get("In-Reply-To")),
+	}
+	from, err := mail.ParseAddress(header("From"))
+	if err != nil {
+		return Email{}, ErrParseNoSender
+	}
+	e.From = from.Address
+	for _, key := range []string{"To", "Cc", "Delivered-To"} {
+		if list, err := msg.Header.AddressList(key); err == nil {
+			for _, addr := range list {
+				e.To = append(e.To, addr.Address)
+			}
+		}
+	}
+	auto := strings.ToLower(msg.Header.Get("Auto-Submitted"))
+	e.Automated = (auto != "" && auto != "no") ||
+		msg.Header.Get("X-Autoreply") != "" ||
+		msg.Header.Get("X-Autorespond") != "" ||
+		strings.Contains(strings.ToLower(msg.Header.Get("Content-Type")), "multipart/report")
+
+	var plain, rich string
+	parts := 0
+	err = walk(msg.Header, msg.Body, &parts, func(mediaType, filename string, body []byte) {
+		switch {
+		case filename != "":
+			e.Attachments = append(e.Attachments, data.Attachment{
+				Filename:    filename,
+				ContentType: mediaType,
+				Size:        len(body),
+			})
+		case mediaType == "text/plain" && plain == "":
+			plain = string(body)
+		case mediaType == "text/html" && rich == "":
+			rich = HTMLToText(string(body))
+		}
+	})
+	if err != nil {
+		return Email{}, err
+	}
+	e.Text = plain
+	if strings.TrimSpace(e.Text) == "" {
+		e.Text = rich
+	}
+	e.Text = strings.TrimSpace(strings.ReplaceAll(e.Text, "\r\n", "\n"))
+	return e, nil
+}
+
+// Form maps the email to a mailbox entry. Web submissions only allow
+// a restricted set of characters, so other characters in the subject
+// and message are replaced with spaces and long messages are cut off.
+// The entry still has to pass validation.
+func (e Email) Form(mailbox string) data.Form {
+	subject := fit(e.Subject, unsafeSubject, 100)
+	if subject == "" {
+		subject = "No subject"
+	}
+	message := fit(e.Text, unsafeMessage, 1000)
+	if message == "" && len(e.Attachments) > 0 {
+		message = "(attachments only)"
+	}
+	return data.Form{
+		Mailbox:     mailbox,
+		From:        e.From,
+		Subject:     subject,
+		Message:     message,
+		Attachments: e.Attachments,
+	}
+}
+
+var (
+	// unsafeSubject matches characters that subjects may not hold.
+	unsafeSubject = regexp.MustCompile(`[^A-Za-z0-9\s]+`)
+
+	// unsafeMessage matches characters that messages may not hold.
+	unsafeMessage = regexp.MustCompile(`[^\w\s.,!?()-]+`)
+
+	// runsOfSpaces matches repeated spaces and tabs.
+	runsOfSpaces = regexp.MustCompile(`[ \t]{2,}`)
+)
+
+// fit replaces the characters of s matched by unsafe with spaces and
+// truncates the result to n characters.
+func fit(s string, unsafe *regexp.Regexp, n int) string {
+	s = unsafe.ReplaceAllString(s, " ")
+	s = strings.TrimSpace(runsOfSpaces.ReplaceAllString(s, " "))
+	if len(s) > n {
+		s = strings.TrimSpace(s[:n-3]) + "..."
+	}
+	return s
+}
+
+// header is the subset of a MIME header used while walking parts.
+type header interface {
+	Get(string) string
+}
+
+// walk visits every leaf part of a MIME body, decoding its transfer
+// encoding and charset.
+func walk(h header, body io.Reader, parts *int, visit func(mediaType, filename string, body []byte)) error {
+	if *parts++; *parts > maxParts {
+		return errors.New("message has too many parts")
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walk(p.Header, p, parts, visit); err != nil {
+				return err
+			}
+		}
+	}
+
+	var r io.Reader = body
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, newlineStripper{body})
+	case "quoted-printable":
+		r = quotedprintable.NewReader(body)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	filename := ""
+	if _, dparams, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		filename = dparams["filename"]
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename == "" && !strings.HasPrefix(mediaType, "text/") {
+		filename = "attachment"
+	}
+	if filename == "" {
+		raw = decodeCharset(params["charset"], raw)
+	}
+	visit(mediaType, filename, raw)
+	return nil
+}
+
+// newlineStripper removes line breaks from base64 bodies.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+// decodeCharset converts Latin-1 text to UTF-8. Other charsets are
+// assumed to be UTF-8 compatible.
+func decodeCharset(charset string, raw []byte) []byte {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		var buf bytes.Buffer
+		for _, b := range raw {
+			buf.WriteRune(rune(b))
+		}
+		return buf.Bytes()
+	}
+	return raw
+}
+
+var (
+	// spaces matches runs of whitespace, which HTML collapses.
+	spaces = regexp.MustCompile(`\s+`)
+
+	// blankLines matches runs of three or more line breaks, allowing
+	// for spaces left over from collapsed whitespace.
+	blankLines = regexp.MustCompile(`[ \t]*(\n[ \t]*){3,}`)
+
+	// lineSpaces matches whitespace at the start or end of a line.
+	lineSpaces = regexp.MustCompile(`(?m)^[ \t]+|[ \t]+$`)
+)
+
+// HTMLToText renders an HTML document as plain text. Block elements
+// become line breaks, links keep their target, and scripts and styles
+// are dropped.
+func HTMLToText(doc string) string {
+	z := html.NewTokenizer(strings.NewReader(doc))
+	var buf strings.Builder
+	skip := 0
+	href := ""
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			text := lineSpaces.ReplaceAllString(buf.String(), "")
+			text = blankLines.ReplaceAllString(text, "\n\n")
+			return strings.TrimSpace(text)
+		case html.TextToken:
+			if skip == 0 {
+				buf.WriteString(spaces.ReplaceAllString(html.UnescapeString(string(z.Raw())), " "))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "script", "style", "head", "title":
+				skip++
+			case "br":
+				buf.WriteString("\n")
+			case "p", "div", "tr", "table", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				buf.WriteString("\n\n")
+			case "li":
+				buf.WriteString("\n- ")
+			case "a":
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					if string(key) == "href" {
+						href = string(val)
+					}
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style", "head", "title":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "tr", "table", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				buf.WriteString("\n\n")
+			case "a":
+				if href != "" && !strings.HasPrefix(href, "#") &&
+					!strings.HasPrefix(href, "mailto:") {
+					buf.WriteString(" (" + href + ")")
+				}
+				href = ""
+			}
+		}
+	}
+}
+
+// quoteHeader matches the attribution line that mail clients insert
+// above quoted text, e.g. "On Mon, Jan 1, 2024, Alice wrote:".
+var quoteHeader = regexp.MustCompile(`(?m)^(On .+wrote:|-----Original Message-----|From: .+)\s*$`)
+
+// StripQuoted removes the quoted history that mail clients append to
+// replies, keeping only the new text.
+func StripQuoted(text string) string {
+	if loc := quoteHeader.FindStringIndex(text); loc != nil && loc[0] > 0 {
+		text = text[:loc[0]]
+	}
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, ">") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,145 @@
+package inbound
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	multipart := "From: Jane Doe <jane@example.com>\r\n" +
+		"To: support@example.com\r\n" +
+		"Cc: Sales <sales@example.com>\r\n" +
+		"Subject: =?UTF-8?Q?R=C3=A9sum=C3=A9?=\r\n" +
+		"Message-ID: <1@example.com>\r\n" +
+		"In-Reply-To: <0@example.com>\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Rich</p>\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=C3=A9 hours?\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=\"cv.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"JVBERi0xLjQ=\r\n" +
+		"--outer--\r\n"
+
+	e, err := Parse(strings.NewReader(multipart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.From != "jane@example.com" || e.Subject != "Résumé" ||
+		e.MessageID != "<1@example.com>" || e.InReplyTo != "<0@example.com>" {
+		t.Errorf("headers = %+v", e)
+	}
+	if strings.Join(e.To, ",") != "support@example.com,sales@example.com" {
+		t.Errorf("To = %v", e.To)
+	}
+	if e.Text != "Café hours?" {
+		t.Errorf("Text = %q, want the plain text part", e.Text)
+	}
+	if len(e.Attachments) != 1 || e.Attachments[0].Filename != "cv.pdf" ||
+		e.Attachments[0].Size != 8 {
+		t.Errorf("Attachments = %+v", e.Attachments)
+	}
+	if e.Automated {
+		t.Error("Automated = true, want false")
+	}
+
+	tests := []struct {
+		name      string
+		raw       string
+		text      string
+		automated bool
+		err       error
+	}{
+		{"html only", "From: jane@example.com\r\nContent-Type: text/html\r\n\r\n" +
+			"<p>Hello <a href=\"https://example.com\">there</a></p>", "Hello there (https://example.com)",
+			false, nil},
+		{"auto reply", "From: jane@example.com\r\nAuto-Submitted: auto-replied\r\n\r\nAway",
+			"Away", true, nil},
+		{"no sender", "Subject: Hi\r\n\r\nHello", "", false, ErrParseNoSender},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(strings.NewReader(tt.raw))
+			if err != tt.err {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+			if e.Text != tt.text || e.Automated != tt.automated {
+				t.Errorf("Text = %q, Automated = %v, want %q, %v", e.Text, e.Automated,
+					tt.text, tt.automated)
+			}
+		})
+	}
+}
+
+func TestForm(t *testing.T) {
+	e := Email{From: "jane@example.com", Subject: "Hi\x00there", Text: strings.Repeat("a", 2000)}
+	f := e.Form("support")
+	if f.Mailbox != "support" || f.From != e.From {
+		t.Errorf("Form() = %+v", f)
+	}
+	if strings.ContainsRune(f.Subject, 0) {
+		t.Errorf("Subject = %q, want unsafe characters replaced", f.Subject)
+	}
+	if len(f.Message) > 1000 {
+		t.Errorf("Message is %d characters long, want at most 1000", len(f.Message))
+	}
+	if f := (Email{From: "jane@example.com"}).Form("support"); f.Subject != "No subject" {
+		t.Errorf("Subject = %q, want No subject", f.Subject)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"paragraphs", "<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"line breaks", "One<br>Two", "One\nTwo"},
+		{"list", "<ul><li>One</li><li>Two</li></ul>", "- One\n- Two"},
+		{"scripts", "<head><title>T</title><style>p{}</style></head>Body<script>x()</script>", "Body"},
+		{"entities", "Fish &amp; chips", "Fish & chips"},
+		{"mailto", "<a href=\"mailto:jane@example.com\">Jane</a>", "Jane"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.doc); got != tt.want {
+				t.Errorf("HTMLToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"attribution", "Thanks!\n\nOn Mon, Jan 1, 2024, Alice wrote:\n> Hello", "Thanks!"},
+		{"outlook", "Thanks!\n-----Original Message-----\nFrom: Alice", "Thanks!"},
+		{"quoted lines", "> Hello\nThanks!", "Thanks!"},
+		{"nothing quoted", "Thanks!", "Thanks!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripQuoted(tt.text); got != tt.want {
+				t.Errorf("StripQuoted() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRecipients bounds the number of recipients of one message.
+	maxRecipients = 100
+
+	// maxConnections bounds the number of concurrent sessions.
+	maxConnections = 100
+
+	// commandTimeout is how long a client may stay idle.
+	commandTimeout = 5 * time.Minute
+)
+
+// Envelope describes the SMTP transaction that delivered a message.
+type Envelope struct {
+	From       string
+	To         []string
+	RemoteAddr string
+}
+
+// Error is returned by handlers to reject a message with a specific
+// SMTP reply. Other errors are reported as temporary failures, which
+// senders retry.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Reject returns a permanent *Error, which senders bounce.
+func Reject(err error) error {
+	return &Error{Code: 550, Message: err.Error()}
+}
+
+// Server is a minimal ESMTP server that receives mail for a set of
+// accepted recipients. It does not relay mail.
+type Server struct {
+	// Addr is the TCP address to listen on, e.g. ":2525".
+	Addr string
+
+	// Domain is the host name announced in greetings.
+	Domain string
+
+	// MaxSize is the largest accepted message, in bytes.
+	MaxSize int64
+
+	// TLSConfig enables STARTTLS if not nil.
+	TLSConfig *tls.Config
+
+	// Accept reports whether mail for the recipient is accepted.
+	Accept func(rcpt string) bool
+
+	// Handler files a received message.
+	Handler func(context.Context, Envelope, Email) error
+
+	sem chan struct{}
+}
+
+// ListenAndServe listens on the server's address and serves sessions
+// until the listener fails.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts sessions on l.
+func (s *Server) Serve(l net.Listener) error {
+	s.sem = make(chan struct{}, maxConnections)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(time.Second)
+				continue
+			}
+			return err
+		}
+		select {
+		case s.sem <- struct{}{}:
+			go func() {
+				defer func() { <-s.sem }()
+				s.serve(conn)
+			}()
+		default:
+			fmt.Fprintf(conn, "421 4.3.2 %s too many connections, try again later\r\n", s.Domain)
+			conn.Close()
+		}
+	}
+}
+
+// session holds the state of one SMTP connection.
+type session struct {
+	s    *Server
+	conn net.Conn
+	text *textproto.Conn
+	tls  bool
+	helo bool
+	env  Envelope
+}
+
+func (s *Server) serve(conn net.Conn) {
+	sess := &session{s: s, conn: conn, text: textproto.NewConn(conn)}
+	defer sess.text.Close()
+	sess.reply(220, s.Domain+" ESMTP Mailbox")
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess.helo = true
+			sess.reset()
+			sess.reply(250, s.Domain)
+		case "EHLO":
+			sess.helo = true
+			sess.reset()
+			ext := []string{s.Domain, "8BITMIME", "PIPELINING",
+				fmt.Sprintf("SIZE %d", s.MaxSize)}
+			if s.TLSConfig != nil && !sess.tls {
+				ext = append(ext, "STARTTLS")
+			}
+			sess.reply(250, ext...)
+		case "STARTTLS":
+			if s.TLSConfig == nil || sess.tls {
+				sess.reply(502, "5.5.1 STARTTLS not available")
+				continue
+			}
+			sess.reply(220, "2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			sess.conn, sess.text = tlsConn, textproto.NewConn(tlsConn)
+			sess.tls, sess.helo = true, false
+			sess.reset()
+		case "MAIL":
+			sess.mail(arg)
+		case "RCPT":
+			sess.rcpt(arg)
+		case "DATA":
+			sess.data()
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "2.0.0 OK")
+		case "NOOP":
+			sess.reply(250, "2.0.0 OK")
+		case "VRFY":
+			sess.reply(252, "2.5.0 Cannot verify user")
+		case "QUIT":
+			sess.reply(221, "2.0.0 Bye")
+			return
+		default:
+			sess.reply(502, "5.5.2 Command not implemented")
+		}
+	}
+}
+
+func (sess *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := " "
+		if i < len(lines)-1 {
+			sep = "-"
+		}
+		sess.text.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+func (sess *session) reset() {
+	sess.env = Envelope{RemoteAddr: sess.conn.RemoteAddr().String()}
+}
+
+func (sess *session) mail(arg string) {
+	if !sess.helo {
+		sess.reply(503, "5.5.1 Say EHLO first")
+		return
+	}
+	if sess.env.From != "" {
+		sess.reply(503, "5.5.1 Sender already specified")
+		return
+	}
+	from, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		sess.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, p := range params {
+		key, value, _ := strings.Cut(strings.ToUpper(p), "=")
+		if size, err := strconv.ParseInt(value, 10, 64); key == "SIZE" &&
+			err == nil && size > sess.s.MaxSize {
+			sess.reply(552, "5.3.4 Message too big")
+			return
+		}
+	}
+	if from == "" {
+		from = "<>" // Null reverse-path of bounces.
+	}
+	sess.env.From = from
+	sess.reply(250, "2.1.0 OK")
+}
+
+func (sess *session) rcpt(arg string) {
+	if sess.env.From == "" {
+		sess.reply(503, "5.5.1 Need MAIL first")
+		return
+	}
+	to, _, ok := parsePath(arg, "TO:")
+	if !ok || to == "" {
+		sess.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(sess.env.To) >= maxRecipients {
+		sess.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+	if !sess.s.Accept(to) {
+		sess.reply(550, "5.1.1 No such user here")
+		return
+	}
+	sess.env.To = append(sess.env.To, to)
+	sess.reply(250, "2.1.5 OK")
+}
+
+func (sess *session) data() {
+	if len(sess.env.To) == 0 {
+		sess.reply(503, "5.5.1 Need RCPT first")
+		return
+	}
+	sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+	dot := sess.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dot, sess.s.MaxSize+1))
+	if err != nil {
+		return
+	}
+	env := sess.env
+	sess.reset()
+	if int64(len(raw)) > sess.s.MaxSize {
+		io.Copy(io.Discard, dot)
+		sess.reply(552, "5.3.4 Message too big")
+		return
+	}
+	email, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		sess.reply(550, "5.6.0 "+err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := sess.s.Handler(ctx, env, email); err != nil {
+		var smtpErr *Error
+		if errors.As(err, &smtpErr) {
+			sess.reply(smtpErr.Code, smtpErr.Message)
+			return
+		}
+		log.Printf("[INBOUND] from=%s: %s", env.From, err)
+		sess.reply(451, "4.3.0 Temporary failure, please try again later")
+		return
+	}
+	sess.reply(250, "2.0.0 OK: queued")
+}
+
+// parsePath parses the "FROM:<address> PARAMS" argument of MAIL and
+// RCPT commands.
+func parsePath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	fields := strings.Fields(strings.TrimSpace(arg[len(prefix):]))
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	path := fields[0]
+	if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+		return "", nil, false
+	}
+	path = path[1 : len(path)-1]
+	if path == "" {
+		return "", fields[1:], true
+	}
+	addr, err := mail.ParseAddress("<" + path + ">")
+	if err != nil {
+		return "", nil, false
+	}
+	return addr.Address, fields[1:], true
+}
@@ -0,0 +1,159 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newServer serves sessions accepting mail for support@example.com,
+// filing messages with handler, and returns the server's address.
+func newServer(t *testing.T, handler func(context.Context, Envelope, Email) error) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Domain:  "mx.example.com",
+		MaxSize: 1024,
+		Accept: func(rcpt string) bool {
+			return strings.EqualFold(rcpt, "support@example.com")
+		},
+		Handler: handler,
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+// send delivers the message from sender to the recipients, returning
+// the code of the first reply that refused it (if any).
+func send(t *testing.T, addr, from string, to []string, msg string) int {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	err = c.Mail(from)
+	for _, rcpt := range to {
+		if err == nil {
+			err = c.Rcpt(rcpt)
+		}
+	}
+	if err == nil {
+		w, dataErr := c.Data()
+		if dataErr != nil {
+			err = dataErr
+		} else {
+			w.Write([]byte(msg))
+			err = w.Close()
+		}
+	}
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Quit()
+	return 0
+}
+
+func TestServer(t *testing.T) {
+	var mu sync.Mutex
+	var received []Envelope
+	addr := newServer(t, func(_ context.Context, env Envelope, e Email) error {
+		switch e.Subject {
+		case "Spam":
+			return Reject(errors.New("5.7.1 Message refused"))
+		case "Outage":
+			return errors.New("database unavailable")
+		}
+		mu.Lock()
+		received = append(received, env)
+		mu.Unlock()
+		return nil
+	})
+	message := func(subject string) string {
+		return "From: jane@example.com\r\nSubject: " + subject + "\r\n\r\nHello\r\n"
+	}
+	tests := []struct {
+		name string
+		to   []string
+		msg  string
+		code int
+	}{
+		{"accepted", []string{"Support@example.com"}, message("Hello"), 0},
+		{"unknown recipient", []string{"sales@example.com"}, message("Hello"), 550},
+		{"rejected", []string{"support@example.com"}, message("Spam"), 550},
+		{"temporary failure", []string{"support@example.com"}, message("Outage"), 451},
+		{"too big", []string{"support@example.com"}, message(strings.Repeat("a", 2048)), 552},
+		{"no sender", []string{"support@example.com"}, "Subject: Hello\r\n\r\nHello\r\n", 550},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := send(t, addr, "jane@example.com", tt.to, tt.msg); code != tt.code {
+				t.Errorf("reply code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("received %d messages, want 1", len(received))
+	}
+	if env := received[0]; env.From != "jane@example.com" ||
+		len(env.To) != 1 || env.To[0] != "Support@example.com" || env.RemoteAddr == "" {
+		t.Errorf("envelope = %+v", env)
+	}
+}
+
+func TestSession(t *testing.T) {
+	addr := newServer(t, func(context.Context, Envelope, Email) error { return nil })
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cmd  string
+		code int
+	}{
+		{"MAIL FROM:<jane@example.com>", 503},
+		{"HELO client.example.com", 250},
+		{"RCPT TO:<support@example.com>", 503},
+		{"MAIL jane@example.com", 501},
+		{"MAIL FROM:<jane@example.com> SIZE=4096", 552},
+		{"MAIL FROM:<>", 250},
+		{"MAIL FROM:<jane@example.com>", 503},
+		{"DATA", 503},
+		{"RSET", 250},
+		{"STARTTLS", 502},
+		{"TURN", 502},
+		{"QUIT", 221},
+	}
+	for _, tt := range tests {
+		id, err := conn.Cmd("%s", tt.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.StartResponse(id)
+		code, msg, _ := conn.ReadResponse(0)
+		conn.EndResponse(id)
+		if code != tt.code {
+			t.Errorf("%s: %d %s, want %d", tt.cmd, code, msg, tt.code)
+		}
+	}
+}
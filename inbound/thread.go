@@ -0,0 +1,86 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// tokenLength is the number of hex characters of an entry signature
+// included in thread addresses.
+const tokenLength = 16
+
+// ErrThreadAddress is returned when a thread address is not a valid
+// email address.
+var ErrThreadAddress = errors.New("reply address must be a valid email address")
+
+// ThreadAddress derives per-entry reply addresses from a base address,
+// e.g. "reply+<id>-<signature>@example.com" from "reply@example.com".
+// Signatures prevent senders from appending messages to arbitrary
+// entries.
+type ThreadAddress struct {
+	local  string
+	domain string
+	secret []byte
+}
+
+// NewThreadAddress initializes a ThreadAddress for the given base
+// address, signing entry IDs with secret.
+func NewThreadAddress(address, secret string) (*ThreadAddress, error) {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return nil, ErrThreadAddress
+	}
+	local, domain, ok := strings.Cut(addr.Address, "@")
+	if !ok || strings.Contains(local, "+") {
+		return nil, ErrThreadAddress
+	}
+	return &ThreadAddress{
+		local:  local,
+		domain: strings.ToLower(domain),
+		secret: []byte(secret),
+	}, nil
+}
+
+// For returns the reply address of the entry with the given ID.
+func (t *ThreadAddress) For(id string) string {
+	return t.local + "+" + id + "-" + t.sign(id) + "@" + t.domain
+}
+
+// Match returns the entry ID encoded in address, if address is a
+// validly signed reply address.
+func (t *ThreadAddress) Match(address string) (string, bool) {
+	local, domain, ok := strings.Cut(strings.ToLower(address), "@")
+	if !ok || domain != t.domain {
+		return "", false
+	}
+	base, tag, ok := strings.Cut(local, "+")
+	if !ok || base != strings.ToLower(t.local) {
+		return "", false
+	}
+	id, sig, ok := strings.Cut(tag, "-")
+	if !ok || !hmac.Equal([]byte(sig), []byte(t.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+// MatchAny returns the entry ID encoded in the first of addresses that
+// is a validly signed reply address.
+func (t *ThreadAddress) MatchAny(addresses []string) (string, bool) {
+	for _, address := range addresses {
+		if id, ok := t.Match(address); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (t *ThreadAddress) sign(id string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))[:tokenLength]
+}
@@ -0,0 +1,44 @@
+package inbound
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThreadAddress(t *testing.T) {
+	for _, address := range []string{"not an address", "reply+tag@example.com"} {
+		if _, err := NewThreadAddress(address, "secret"); err != ErrThreadAddress {
+			t.Errorf("NewThreadAddress(%q) error = %v, want %v", address, err, ErrThreadAddress)
+		}
+	}
+
+	addr, err := NewThreadAddress("Mailbox <Reply@Example.com>", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewThreadAddress("reply@example.com", "other")
+	valid := addr.For("1234")
+	tests := []struct {
+		name    string
+		address string
+		ok      bool
+	}{
+		{"valid", valid, true},
+		{"case insensitive", strings.ToUpper(valid), true},
+		{"other secret", other.For("1234"), false},
+		{"other id", strings.Replace(valid, "1234", "1235", 1), false},
+		{"other domain", strings.Replace(valid, "example.com", "example.org", 1), false},
+		{"base address", "reply@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := addr.Match(tt.address)
+			if ok != tt.ok || (ok && id != "1234") {
+				t.Errorf("Match(%q) = %q, %v, want 1234, %v", tt.address, id, ok, tt.ok)
+			}
+		})
+	}
+	if id, ok := addr.MatchAny([]string{"support@example.com", valid}); !ok || id != "1234" {
+		t.Errorf("MatchAny() = %q, %v, want 1234, true", id, ok)
+	}
+}
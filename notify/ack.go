@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultAck is the acknowledgement template used for mailboxes
+// without their own. The first line defines the subject.
+const DefaultAck = `Subject: Re: {{.Subject}}
+
+Hello,
+
+Thank you for your message. It has been received and we will get back
+to you as soon as possible.
+
+This is an automated reply, please do not respond to it. A copy of your
+message follows.
+
+> Subject: {{.Subject}}
+>
+{{quote .Message}}
+`
+
+// ErrAckTemplate is returned when an acknowledgement template does not
+// begin with a "Subject:" line followed by a blank line.
+var ErrAckTemplate = errors.New("acknowledgement templates must begin with a \"Subject:\" line and a blank line")
+
+// automatedSenders lists the local parts of addresses that must never
+// receive automatic replies.
+var automatedSenders = map[string]bool{
+	"mailer-daemon": true,
+	"postmaster":    true,
+	"noreply":       true,
+	"no-reply":      true,
+	"donotreply":    true,
+	"do-not-reply":  true,
+	"bounce":        true,
+	"bounces":       true,
+	"listserv":      true,
+	"majordomo":     true,
+}
+
+// ackTemplate holds the parsed subject and body of an acknowledgement.
+type ackTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// Acknowledger replies to submitters to confirm that their message was
+// received. Replies are never sent to automated senders or to the
+// relay's own address, and each address receives at most one reply
+// per interval. Replies are counted in a persistent store, so that
+// restarts do not reset the limits.
+type Acknowledger struct {
+	mailer    *Mailer
+	acks      data.Acks
+	templates map[string]ackTemplate
+	fallback  ackTemplate
+	mailboxes []string
+	interval  time.Duration
+	maxHourly int
+}
+
+// NewAcknowledger initializes an Acknowledger. Templates are read from
+// "<mailbox>.tmpl" files in dir (if not empty); other mailboxes use
+// DefaultAck. Only the given mailboxes are acknowledged, or every
+// mailbox if mailboxes is empty. No more than maxHourly replies are
+// sent per clock hour, which bounds the damage of a captcha bypass.
+// Replies are counted in acks.
+func NewAcknowledger(mailer *Mailer, acks data.Acks, dir string, mailboxes []string,
+	interval time.Duration, maxHourly int) (*Acknowledger, error) {
+	fallback, err := parseAck("default", DefaultAck)
+	if err != nil {
+		return nil, err
+	}
+	templates := map[string]ackTemplate{}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			mailbox := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+			if templates[mailbox], err = parseAck(mailbox, string(raw)); err != nil {
+				return nil, errors.Join(errors.New(file), err)
+			}
+		}
+	}
+	return &Acknowledger{
+		mailer:    mailer,
+		acks:      acks,
+		templates: templates,
+		fallback:  fallback,
+		mailboxes: mailboxes,
+		interval:  interval,
+		maxHourly: maxHourly,
+	}, nil
+}
+
+// Wants reports whether e is an EventCreated event of an entry in a
+// mailbox whose submitters are acknowledged.
+func (a *Acknowledger) Wants(e Event) bool {
+	return e.Type == EventCreated && a.wants(e.Entry.Mailbox)
+}
+
+// Notify acknowledges the entry of an EventCreated event. Other events
+// are ignored, as are entries that fail the loop and rate guards.
+// Replies only count against the rate limits once they are sent, and
+// entries skipped by the rate limits are never acknowledged.
+func (a *Acknowledger) Notify(ctx context.Context, e Event) error {
+	if !a.Wants(e) {
+		return nil
+	}
+	addr, err := mail.ParseAddress(e.Entry.From)
+	if err != nil || a.automated(addr.Address) {
+		return nil
+	}
+	msg, err := a.Render(e.Entry)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{addr.Address}
+	sent := time.Now()
+	ok, err := a.acks.Reserve(ctx, addr.Address, sent, a.interval, a.maxHourly)
+	if err != nil || !ok {
+		return err
+	}
+	if err := a.mailer.Send(ctx, msg); err != nil {
+		return errors.Join(err, a.acks.Release(ctx, addr.Address, sent))
+	}
+	return nil
+}
+
+// Render executes the acknowledgement template of the form's mailbox.
+func (a *Acknowledger) Render(form data.Form) (Message, error) {
+	tmpl, ok := a.templates[form.Mailbox]
+	if !ok {
+		tmpl = a.fallback
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, form); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.body.Execute(&body, form); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+		Headers: map[string]string{
+			// RFC 3834 marks the message as an automatic reply,
+			// which well-behaved autoresponders never answer.
+			"Auto-Submitted":           "auto-replied",
+			"X-Auto-Response-Suppress": "All",
+		},
+	}, nil
+}
+
+// wants reports whether entries in mailbox are acknowledged.
+func (a *Acknowledger) wants(mailbox string) bool {
+	if len(a.mailboxes) == 0 {
+		return true
+	}
+	for _, m := range a.mailboxes {
+		if m == mailbox {
+			return true
+		}
+	}
+	return false
+}
+
+// automated reports whether replying to address risks a mail loop.
+func (a *Acknowledger) automated(address string) bool {
+	address = strings.ToLower(address)
+	if from, err := mail.ParseAddress(a.mailer.From); err == nil &&
+		strings.ToLower(from.Address) == address {
+		return true
+	}
+	local, _, _ := strings.Cut(address, "@")
+	return automatedSenders[local] ||
+		strings.HasPrefix(local, "owner-") ||
+		strings.HasSuffix(local, "-request") ||
+		strings.HasSuffix(local, "-bounces")
+}
+
+// parseAck parses an acknowledgement template.
+func parseAck(name, raw string) (ackTemplate, error) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	header, body, ok := strings.Cut(raw, "\n\n")
+	subject, found := strings.CutPrefix(header, "Subject:")
+	if !ok || !found || strings.Contains(header, "\n") {
+		return ackTemplate{}, ErrAckTemplate
+	}
+	funcs := template.FuncMap{"quote": quote}
+	subjectTmpl, err := template.New(name + ".subject").Funcs(funcs).Parse(subject)
+	if err != nil {
+		return ackTemplate{}, err
+	}
+	bodyTmpl, err := template.New(name).Funcs(funcs).Parse(body)
+	if err != nil {
+		return ackTemplate{}, err
+	}
+	return ackTemplate{subject: subjectTmpl, body: bodyTmpl}, nil
+}
+
+// quote prefixes every line of s with "> ".
+func quote(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memAcks is an in-memory Acks store that applies the limits of
+// MongoAcks.
+type memAcks struct {
+	mu    sync.Mutex
+	sent  map[string]time.Time
+	hours map[int64]int
+}
+
+func newMemAcks() *memAcks {
+	return &memAcks{sent: map[string]time.Time{}, hours: map[int64]int{}}
+}
+
+func (m *memAcks) Reserve(_ context.Context, address string, at time.Time,
+	interval time.Duration, maxHourly int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	address = strings.ToLower(address)
+	if last, ok := m.sent[address]; ok && at.Sub(last) < interval {
+		return false, nil
+	}
+	hour := at.Unix() / 3600
+	if maxHourly > 0 && m.hours[hour] >= maxHourly {
+		return false, nil
+	}
+	m.sent[address] = at
+	m.hours[hour]++
+	return true, nil
+}
+
+func (m *memAcks) Release(_ context.Context, address string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	address = strings.ToLower(address)
+	if m.sent[address].Equal(at) {
+		delete(m.sent, address)
+		m.hours[at.Unix()/3600]--
+	}
+	return nil
+}
+
+// ackStep is an acknowledgement requested by a submitter, which is
+// expected to be sent or not.
+type ackStep struct {
+	from    string
+	failing bool
+	sent    bool
+}
+
+func TestAcknowledger(t *testing.T) {
+	created := func(from string) Event {
+		return NewEvent(EventCreated, data.Form{Mailbox: "default", From: from,
+			Subject: "Hello", Message: "Hi there"}, "")
+	}
+	tests := []struct {
+		name      string
+		maxHourly int
+		steps     []ackStep
+	}{
+		{"acknowledges", 0, []ackStep{
+			{"jane@example.com", false, true},
+		}},
+		{"automated sender", 0, []ackStep{
+			{"no-reply@example.com", false, false},
+			{"list-bounces@example.com", false, false},
+			{"mailbox@example.com", false, false},
+		}},
+		{"once per interval", 0, []ackStep{
+			{"jane@example.com", false, true},
+			{"JANE@example.com", false, false},
+			{"john@example.com", false, true},
+		}},
+		{"hourly limit", 2, []ackStep{
+			{"a@example.com", false, true},
+			{"b@example.com", false, true},
+			{"c@example.com", false, false},
+		}},
+		{"failed sends are not counted", 1, []ackStep{
+			{"jane@example.com", true, false},
+			{"jane@example.com", false, true},
+			{"john@example.com", false, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t)
+			ack, err := NewAcknowledger(sink.Mailer(), newMemAcks(), "", nil, time.Hour, tt.maxHourly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, step := range tt.steps {
+				sink.failing.Store(step.failing)
+				before, _ := sink.Messages()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				err := ack.Notify(ctx, created(step.from))
+				cancel()
+				if step.failing != (err != nil) {
+					t.Fatalf("step %d: Notify() error = %v", i, err)
+				}
+				after, _ := sink.Messages()
+				if sent := len(after) > len(before); sent != step.sent {
+					t.Fatalf("step %d: sent = %v, want %v", i, sent, step.sent)
+				}
+				if step.sent && !strings.Contains(after[len(after)-1].Data,
+					"Auto-Submitted: auto-replied") {
+					t.Errorf("step %d: acknowledgement is not marked as automatic", i)
+				}
+			}
+		})
+	}
+}
+
+func TestAcknowledgerRestart(t *testing.T) {
+	sink := newSMTPSink(t)
+	acks := newMemAcks()
+	e := NewEvent(EventCreated, data.Form{Mailbox: "default", From: "jane@example.com",
+		Subject: "Hello", Message: "Hi there"}, "")
+	for i := 0; i < 2; i++ {
+		// Every iteration stands for a server run sharing the store.
+		ack, err := NewAcknowledger(sink.Mailer(), acks, "", nil, time.Hour, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ack.Notify(context.Background(), e); err != nil {
+			t.Fatalf("run %d: Notify() error = %v", i, err)
+		}
+	}
+	if msgs, _ := sink.Messages(); len(msgs) != 1 {
+		t.Errorf("sent %d acknowledgements, want 1", len(msgs))
+	}
+}
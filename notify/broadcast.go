@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// broadcastHistory is the number of changes kept for
+	// subscribers that resume.
+	broadcastHistory = 1000
+
+	// broadcastBuffer is the number of changes buffered per
+	// subscriber. Subscribers that fall further behind are dropped,
+	// and may resume from their last change.
+	broadcastBuffer = 64
+)
+
+// Broadcaster is an in-process feed of changes to entries, used when
+// the database cannot provide one. It implements data.Changes and is
+// fed by its Notify method. Change IDs are only valid until restart.
+type Broadcaster struct {
+	mu      sync.Mutex
+	boot    string
+	seq     uint64
+	history []data.Change
+	subs    map[chan data.Change]bool
+}
+
+// NewBroadcaster initializes a Broadcaster.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		boot: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs: map[chan data.Change]bool{},
+	}
+}
+
+// Notify publishes the change described by an event. Events that do
+// not change entries are ignored.
+func (b *Broadcaster) Notify(ctx context.Context, e Event) error {
+	var changeType string
+	switch e.Type {
+	case EventCreated:
+		changeType = data.ChangeCreated
+	case EventStatusChanged, EventUpdated, EventReplied:
+		changeType = data.ChangeUpdated
+	case EventDeleted:
+		changeType = data.ChangeDeleted
+	default:
+		return nil
+	}
+
+	entry := e.Entry
+	if entry.Mailbox == "" {
+		entry.Mailbox = data.DefaultMailbox
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	change := data.Change{
+		ID:    fmt.Sprintf("%s-%d", b.boot, b.seq),
+		Type:  changeType,
+		Entry: entry,
+		Time:  e.Time,
+	}
+	b.history = append(b.history, change)
+	if len(b.history) > broadcastHistory {
+		b.history = b.history[len(b.history)-broadcastHistory:]
+	}
+	for sub := range b.subs {
+		select {
+		case sub <- change:
+		default:
+			delete(b.subs, sub)
+			close(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel of the changes that follow the change
+// with the given ID, if it is still in the history, and of new
+// changes.
+func (b *Broadcaster) Subscribe(ctx context.Context, after string) (<-chan data.Change, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var missed []data.Change
+	if seq, ok := b.parse(after); ok {
+		for i, change := range b.history {
+			if s, _ := b.parse(change.ID); s > seq {
+				missed = b.history[i:]
+				break
+			}
+		}
+	}
+	sub := make(chan data.Change, broadcastBuffer+len(missed))
+	for _, change := range missed {
+		sub <- change
+	}
+	b.subs[sub] = true
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.subs[sub] {
+			delete(b.subs, sub)
+			close(sub)
+		}
+	}()
+	return sub, nil
+}
+
+// parse returns the sequence number of a change ID issued since the
+// last restart.
+func (b *Broadcaster) parse(id string) (uint64, bool) {
+	boot, seq, ok := strings.Cut(id, "-")
+	if !ok || boot != b.boot {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"testing"
+	"time"
+)
+
+// receive reads n changes from feed, failing if it is closed or slow.
+func receive(t *testing.T, feed <-chan data.Change, n int) []data.Change {
+	t.Helper()
+	changes := []data.Change{}
+	for range n {
+		select {
+		case change, ok := <-feed:
+			if !ok {
+				t.Fatalf("feed closed after %d changes, want %d", len(changes), n)
+			}
+			changes = append(changes, change)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d changes, want %d", len(changes), n)
+		}
+	}
+	return changes
+}
+
+// publish notifies b of the creation of entries with the given IDs.
+func publish(t *testing.T, b *Broadcaster, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := b.Notify(context.Background(), NewEvent(EventCreated,
+			data.Form{ID: id}, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func entryIDs(changes []data.Change) []string {
+	ids := []string{}
+	for _, change := range changes {
+		ids = append(ids, change.Entry.ID)
+	}
+	return ids
+}
+
+func TestBroadcasterResume(t *testing.T) {
+	tests := []struct {
+		name  string
+		after func(seen []data.Change) string
+		want  []string
+	}{
+		{"resumed", func(seen []data.Change) string { return seen[0].ID },
+			[]string{"b", "c", "d"}},
+		{"up to date", func(seen []data.Change) string { return seen[2].ID },
+			[]string{"d"}},
+		{"new", func([]data.Change) string { return "" }, []string{"d"}},
+		{"previous boot", func([]data.Change) string { return "0-1" }, []string{"d"}},
+		{"malformed", func([]data.Change) string { return "abc" }, []string{"d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroadcaster()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			feed, _ := b.Subscribe(ctx, "")
+			publish(t, b, "a", "b", "c")
+			seen := receive(t, feed, 3)
+
+			resumed, _ := b.Subscribe(ctx, tt.after(seen))
+			publish(t, b, "d")
+			got := entryIDs(receive(t, resumed, len(tt.want)))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("received %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBroadcasterSlowSubscriber(t *testing.T) {
+	b := NewBroadcaster()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slow, _ := b.Subscribe(ctx, "")
+	fast, _ := b.Subscribe(ctx, "")
+
+	// Subscribers that fall behind by more than the buffer are dropped,
+	// without holding up the others.
+	for i := range broadcastBuffer + 1 {
+		publish(t, b, string(rune('a'+i%26)))
+		receive(t, fast, 1)
+	}
+	buffered := receive(t, slow, broadcastBuffer)
+	if _, ok := <-slow; ok {
+		t.Fatal("slow subscriber was not dropped")
+	}
+	b.mu.Lock()
+	if n := len(b.subs); n != 1 {
+		t.Errorf("%d subscribers left, want 1", n)
+	}
+	b.mu.Unlock()
+
+	// Dropped subscribers resume from their last change.
+	resumed, _ := b.Subscribe(ctx, buffered[len(buffered)-1].ID)
+	missed := receive(t, resumed, 1)
+	if want := b.history[broadcastBuffer].ID; missed[0].ID != want {
+		t.Errorf("resumed from %s, want %s", missed[0].ID, want)
+	}
+}
+
+func TestBroadcasterNotify(t *testing.T) {
+	b := NewBroadcaster()
+	ctx, cancel := context.WithCancel(context.Background())
+	feed, _ := b.Subscribe(ctx, "")
+	events := []Event{
+		NewEvent(EventRejected, data.Form{ID: "a"}, ""),
+		NewEvent(EventReplied, data.Form{ID: "b"}, ""),
+		NewEvent(EventDeleted, data.Form{ID: "c", Mailbox: "sales"}, ""),
+	}
+	for _, e := range events {
+		b.Notify(ctx, e)
+	}
+	changes := receive(t, feed, 2)
+	if changes[0].Type != data.ChangeUpdated || changes[0].Entry.Mailbox != data.DefaultMailbox {
+		t.Errorf("published %+v, want an update of the default mailbox", changes[0])
+	}
+	if changes[1].Type != data.ChangeDeleted || changes[1].Entry.Mailbox != "sales" {
+		t.Errorf("published %+v, want a deletion in sales", changes[1])
+	}
+
+	// Feeds are closed once their context ends.
+	cancel()
+	select {
+	case _, ok := <-feed:
+		if ok {
+			t.Error("received a change after canceling")
+		}
+	case <-time.After(time.Second):
+		t.Error("feed was not closed")
+	}
+}
@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// chatMaxEntries is the number of entries detailed in a single
+	// chat message. Larger batches are summarized.
+	chatMaxEntries = 10
+
+	// chatMaxText is the number of characters of an entry's message
+	// quoted in chat.
+	chatMaxText = 500
+
+	// chatTake is the number of pending entries announced by a single
+	// message. The rest are announced by the next.
+	chatTake = 100
+
+	// chatAttempts is the number of times a message announcing an
+	// entry is posted before the entry is dropped.
+	chatAttempts = 10
+
+	// chatLease is how long announcements are claimed while their
+	// message is posted. Announcements of failed messages are retried
+	// once it expires.
+	chatLease = 2 * time.Minute
+
+	// chatPoll is how often the flusher checks for announcements that
+	// are due without being notified of them, e.g. because they are
+	// retried or were added by another server.
+	chatPoll = 10 * time.Second
+)
+
+// ChatSender formats entries as a rich message and posts it to a chat
+// service.
+type ChatSender interface {
+
+	// Send posts a single message announcing the given entries.
+	Send(context.Context, []data.Form) error
+}
+
+// ChatNotifier announces new entries in a chat service. Notified
+// entries are stored as pending announcements, which Run posts in
+// batches, so that at most one message is posted per interval.
+type ChatNotifier struct {
+	name      string
+	sender    ChatSender
+	store     data.Announcements
+	mailboxes []string
+	interval  time.Duration
+	wake      chan struct{}
+}
+
+// NewChatNotifier initializes a notifier that posts through sender,
+// keeping pending announcements in store. Only entries in the given
+// mailboxes are announced, or entries in any mailbox if mailboxes is
+// empty.
+func NewChatNotifier(name string, sender ChatSender, store data.Announcements,
+	mailboxes []string, interval time.Duration) *ChatNotifier {
+	return &ChatNotifier{
+		name:      name,
+		sender:    sender,
+		store:     store,
+		mailboxes: mailboxes,
+		interval:  interval,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify stores the entry of an EventCreated event for announcement,
+// and returns without waiting for it to be posted. Other events are
+// ignored.
+func (c *ChatNotifier) Notify(ctx context.Context, e Event) error {
+	if !c.Wants(e) {
+		return nil
+	}
+	if err := c.store.Add(ctx, data.NewAnnouncement(c.name, e.Entry)); err != nil {
+		return fmt.Errorf("chat %s: %w", c.name, err)
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Wants reports whether e is an EventCreated event of an entry that is
+// announced.
+func (c *ChatNotifier) Wants(e Event) bool {
+	return e.Type == EventCreated && c.wants(e.Entry.Mailbox)
+}
+
+// wants reports whether entries in mailbox are announced.
+func (c *ChatNotifier) wants(mailbox string) bool {
+	if len(c.mailboxes) == 0 {
+		return true
+	}
+	for _, m := range c.mailboxes {
+		if m == mailbox {
+			return true
+		}
+	}
+	return false
+}
+
+// Run posts pending announcements until ctx is canceled, waiting at
+// least the interval between messages. Announcements added while it
+// waits are posted along with the next message.
+func (c *ChatNotifier) Run(ctx context.Context) {
+	poll := time.NewTicker(chatPoll)
+	defer poll.Stop()
+	var last time.Time
+	for {
+		if wait := c.interval - time.Since(last); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+		if c.flush(ctx) {
+			last = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// flush posts a message announcing the due announcements, and removes
+// them once it was posted. Announcements of a failed message are
+// retried once their lease expires, unless they were attempted
+// chatAttempts times. It reports whether a message was attempted.
+func (c *ChatNotifier) flush(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	pending, err := c.store.Take(ctx, c.name, chatTake, chatLease)
+	if err != nil {
+		log.Printf("[NOTIFY] chat=%s: %s", c.name, err)
+		return false
+	}
+	if len(pending) == 0 {
+		return false
+	}
+	forms := make([]data.Form, len(pending))
+	ids, dropped := make([]string, len(pending)), []string{}
+	for i, a := range pending {
+		forms[i], ids[i] = a.Entry, a.ID
+		if a.Attempts >= chatAttempts {
+			dropped = append(dropped, a.ID)
+		}
+	}
+	if err := c.sender.Send(ctx, forms); err != nil {
+		log.Printf("[NOTIFY] chat=%s entries=%d: %s", c.name, len(forms), err)
+		if len(dropped) == 0 {
+			return true
+		}
+		log.Printf("[NOTIFY] chat=%s: dropping %d entries after %d attempts",
+			c.name, len(dropped), chatAttempts)
+		ids = dropped
+	}
+	if err := c.store.Done(ctx, ids...); err != nil {
+		log.Printf("[NOTIFY] chat=%s: %s", c.name, err)
+	}
+	return true
+}
+
+// chatSummary returns a plaintext headline for a batch of entries.
+func chatSummary(forms []data.Form) string {
+	if len(forms) == 1 {
+		return fmt.Sprintf("New message in mailbox %q from %s",
+			forms[0].Mailbox, forms[0].From)
+	}
+	return fmt.Sprintf("%d new messages", len(forms))
+}
+
+// chatOverflow returns a note on the entries of a batch that were not
+// detailed, or an empty string.
+func chatOverflow(forms []data.Form) string {
+	if len(forms) <= chatMaxEntries {
+		return ""
+	}
+	return fmt.Sprintf("…and %d more", len(forms)-chatMaxEntries)
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// postJSON sends payload to url with the given method and checks for
+// a 2xx response.
+func postJSON(ctx context.Context, client *http.Client, method, url string,
+	header http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
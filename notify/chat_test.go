@@ -0,0 +1,322 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memAnnouncements is an in-memory store of pending announcements.
+type memAnnouncements struct {
+	mu            sync.Mutex
+	announcements map[string]data.Announcement
+}
+
+func newMemAnnouncements() *memAnnouncements {
+	return &memAnnouncements{announcements: map[string]data.Announcement{}}
+}
+
+func (m *memAnnouncements) Add(_ context.Context, a data.Announcement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.announcements[a.ID]; !ok {
+		m.announcements[a.ID] = a
+	}
+	return nil
+}
+
+func (m *memAnnouncements) Take(_ context.Context, chat string, limit int,
+	lease time.Duration) ([]data.Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	due := []data.Announcement{}
+	for _, a := range m.announcements {
+		if a.Chat == chat && !a.RunAt.After(now) {
+			due = append(due, a)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Created.Before(due[j].Created) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].RunAt = now.Add(lease)
+		due[i].Attempts++
+		m.announcements[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *memAnnouncements) Done(_ context.Context, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.announcements, id)
+	}
+	return nil
+}
+
+func (m *memAnnouncements) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.announcements)
+}
+
+// elapse makes every announcement due, as if its lease had expired.
+func (m *memAnnouncements) elapse() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, a := range m.announcements {
+		a.RunAt = time.Now().UTC().Add(-time.Second)
+		m.announcements[id] = a
+	}
+}
+
+// chatRecorder is a ChatSender that records the batches it posts, and
+// fails while err is set.
+type chatRecorder struct {
+	mu      sync.Mutex
+	err     error
+	batches [][]data.Form
+	sent    chan struct{}
+}
+
+func newChatRecorder() *chatRecorder {
+	return &chatRecorder{sent: make(chan struct{}, 16)}
+}
+
+func (r *chatRecorder) Send(_ context.Context, forms []data.Form) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.batches = append(r.batches, forms)
+	r.sent <- struct{}{}
+	return nil
+}
+
+// created returns EventCreated events of entries with the given IDs.
+func created(ids ...string) []Event {
+	events := []Event{}
+	for _, id := range ids {
+		events = append(events, NewEvent(EventCreated,
+			data.Form{ID: id, Mailbox: "support"}, ""))
+	}
+	return events
+}
+
+func TestChatNotify(t *testing.T) {
+	store, sender := newMemAnnouncements(), newChatRecorder()
+	c := NewChatNotifier("slack", sender, store, []string{"support"}, time.Hour)
+	ctx := context.Background()
+	for _, e := range append(created("a", "b", "a"),
+		NewEvent(EventCreated, data.Form{ID: "c", Mailbox: "sales"}, ""),
+		NewEvent(EventDeleted, data.Form{ID: "d", Mailbox: "support"}, "")) {
+		if err := c.Notify(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Notify stores announcements without posting them, once per entry.
+	if n := store.len(); n != 2 {
+		t.Errorf("stored %d announcements, want 2", n)
+	}
+	if len(sender.batches) != 0 {
+		t.Errorf("Notify() posted %d messages, want none", len(sender.batches))
+	}
+}
+
+func TestChatFlush(t *testing.T) {
+	store, sender := newMemAnnouncements(), newChatRecorder()
+	c := NewChatNotifier("slack", sender, store, nil, time.Hour)
+	ctx := context.Background()
+	for _, e := range created("a", "b", "c") {
+		c.Notify(ctx, e)
+	}
+	if !c.flush(ctx) {
+		t.Fatal("flush() posted nothing")
+	}
+	if len(sender.batches) != 1 || len(sender.batches[0]) != 3 {
+		t.Fatalf("posted %v, want a single message of 3 entries", sender.batches)
+	}
+	if n := store.len(); n != 0 {
+		t.Errorf("%d announcements are left after posting", n)
+	}
+	if c.flush(ctx) {
+		t.Error("flush() posted a message without pending announcements")
+	}
+}
+
+func TestChatFlushRetry(t *testing.T) {
+	store, sender := newMemAnnouncements(), newChatRecorder()
+	sender.err = errors.New("unavailable")
+	c := NewChatNotifier("slack", sender, store, nil, time.Hour)
+	ctx := context.Background()
+	c.Notify(ctx, created("a")[0])
+
+	// Failed announcements are kept, and retried once their lease
+	// expires.
+	c.flush(ctx)
+	if n := store.len(); n != 1 {
+		t.Fatalf("%d announcements are left after failing, want 1", n)
+	}
+	if c.flush(ctx) {
+		t.Error("flush() retried an announcement before its lease expired")
+	}
+	store.elapse()
+	sender.err = nil
+	c.flush(ctx)
+	if len(sender.batches) != 1 || store.len() != 0 {
+		t.Errorf("posted %d messages leaving %d announcements, want 1 leaving none",
+			len(sender.batches), store.len())
+	}
+
+	// Announcements are dropped after their last attempt.
+	sender.err = errors.New("unavailable")
+	c.Notify(ctx, created("b")[0])
+	for range chatAttempts {
+		store.elapse()
+		c.flush(ctx)
+	}
+	if n := store.len(); n != 0 {
+		t.Errorf("%d announcements are left after %d attempts", n, chatAttempts)
+	}
+}
+
+func TestChatRun(t *testing.T) {
+	store, sender := newMemAnnouncements(), newChatRecorder()
+	interval := 200 * time.Millisecond
+	c := NewChatNotifier("slack", sender, store, nil, interval)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	wait := func() time.Time {
+		t.Helper()
+		select {
+		case <-sender.sent:
+			return time.Now()
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message was posted")
+			return time.Time{}
+		}
+	}
+	c.Notify(ctx, created("a")[0])
+	first := wait()
+
+	// Entries notified within the interval are batched into the next
+	// message, which waits for the interval to pass.
+	for _, e := range created("b", "c") {
+		c.Notify(ctx, e)
+	}
+	if gap := wait().Sub(first); gap < interval {
+		t.Errorf("posted again after %s, want at least %s", gap, interval)
+	}
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if len(sender.batches) != 2 || len(sender.batches[1]) != 2 {
+		t.Errorf("posted %v, want the second message to batch 2 entries", sender.batches)
+	}
+}
+
+// hostile is an entry whose fields try to mention everyone and inject
+// markup.
+var hostile = data.Form{
+	ID:      "abc",
+	Mailbox: "<!channel>",
+	From:    "<@U123>",
+	Subject: "**urgent** <b>@room</b> @everyone",
+	Message: "[click](https://evil.example) <!here> `code`",
+}
+
+// chatPayload posts forms through sender to r and returns the JSON
+// payload that it received.
+func chatPayload(t *testing.T, r *receiver, sender ChatSender, forms ...data.Form) map[string]any {
+	t.Helper()
+	if err := sender.Send(context.Background(), forms); err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(r.bodies[len(r.bodies)-1], &payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestSlackChatEscape(t *testing.T) {
+	r := newReceiver(t)
+	payload := chatPayload(t, r, NewSlackChat(r.URL), hostile)
+	attachment := payload["attachments"].([]any)[0].(map[string]any)
+	mailbox := attachment["fields"].([]any)[0].(map[string]any)["value"]
+	texts := []any{payload["text"], mailbox}
+	for _, key := range []string{"fallback", "author_name", "title", "text"} {
+		texts = append(texts, attachment[key])
+	}
+	for _, text := range texts {
+		if strings.ContainsAny(text.(string), "<>") {
+			t.Errorf("%q is not escaped", text)
+		}
+	}
+	if mailbox != "&lt;!channel&gt;" {
+		t.Errorf("Mailbox = %q, want it escaped", mailbox)
+	}
+}
+
+func TestDiscordChatEscape(t *testing.T) {
+	r := newReceiver(t)
+	payload := chatPayload(t, r, NewDiscordChat(r.URL), hostile)
+	mentions, _ := payload["allowed_mentions"].(map[string]any)
+	if parse, ok := mentions["parse"].([]any); !ok || len(parse) != 0 {
+		t.Errorf("allowed_mentions = %v, want no mentions", payload["allowed_mentions"])
+	}
+	embed := payload["embeds"].([]any)[0].(map[string]any)
+	tests := []struct{ field, want string }{
+		{"title", `\*\*urgent\*\* \<b\>@room\</b\> @everyone`},
+		{"description", "\\[click\\](https://evil.example) \\<!here\\> \\`code\\`"},
+	}
+	for _, tt := range tests {
+		if got := embed[tt.field]; got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestMatrixChatEscape(t *testing.T) {
+	r := newReceiver(t)
+	payload := chatPayload(t, r, NewMatrixChat(r.URL, "token", "!room:example.org"), hostile)
+	if mentions, ok := payload["m.mentions"].(map[string]any); !ok || len(mentions) != 0 {
+		t.Errorf("m.mentions = %v, want no mentions", payload["m.mentions"])
+	}
+	rich := payload["formatted_body"].(string)
+	if strings.Contains(rich, "<b>@room</b>") || strings.Contains(rich, "<!channel>") {
+		t.Errorf("formatted_body %q contains unescaped markup", rich)
+	}
+	if !strings.Contains(rich, "&lt;b&gt;@room&lt;/b&gt;") {
+		t.Errorf("formatted_body %q does not escape the subject", rich)
+	}
+	if got := r.requests[0].Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q, want Bearer token", got)
+	}
+}
+
+func TestChatOverflow(t *testing.T) {
+	forms := make([]data.Form, chatMaxEntries+3)
+	for i := range forms {
+		forms[i] = data.Form{ID: string(rune('a' + i))}
+	}
+	r := newReceiver(t)
+	payload := chatPayload(t, r, NewDiscordChat(r.URL), forms...)
+	if n := len(payload["embeds"].([]any)); n != chatMaxEntries {
+		t.Errorf("detailed %d entries, want %d", n, chatMaxEntries)
+	}
+	if got := payload["content"].(string); !strings.Contains(got, "and 3 more") {
+		t.Errorf("content = %q, want it to summarize 3 more entries", got)
+	}
+}
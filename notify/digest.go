@@ -0,0 +1,282 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DigestDaily sends a digest every day.
+	DigestDaily = "daily"
+
+	// DigestWeekly sends a digest every week.
+	DigestWeekly = "weekly"
+)
+
+// digestTick is how often the scheduler checks for due digests.
+const digestTick = time.Minute
+
+// digestMaxEntries bounds the number of entries listed in a digest,
+// and digestMaxSenders the number of senders.
+const (
+	digestMaxEntries = 50
+	digestMaxSenders = 20
+)
+
+// DefaultDigestSubject is the digest subject template used when none
+// is configured.
+const DefaultDigestSubject = `[Mailbox] {{.Period}} digest for "{{.Mailbox}}": {{.Count}} new`
+
+// DefaultDigestBody is the digest body template used when none is
+// configured.
+const DefaultDigestBody = `{{.Period}} digest for mailbox "{{.Mailbox}}"
+From {{.Since.Format "2006-01-02 15:04"}} to {{.Until.Format "2006-01-02 15:04"}}.
+
+New entries:  {{.Count}}
+Still unread: {{.Unread}}
+Rejected:     {{.Rejected}}
+{{if .Senders}}
+Senders:
+{{range .Senders}}  {{printf "%4d" .Count}}  {{.Address}}
+{{end}}{{end}}{{if .Entries}}
+Entries:
+{{range .Entries}}  {{.Created.Format "01-02 15:04"}}  {{.From}}: {{.Subject}}
+{{end}}{{if .More}}  ...and {{.More}} more
+{{end}}{{end}}`
+
+// ErrDigestSchedule is returned when a digest schedule is neither
+// daily nor weekly.
+var ErrDigestSchedule = errors.New("digest schedule must be one of daily or weekly")
+
+// DigestSender counts the entries submitted by an address.
+type DigestSender struct {
+	Address string
+	Count   int
+}
+
+// DigestData is the data that digest templates are executed with.
+type DigestData struct {
+	Mailbox  string
+	Period   string
+	Since    time.Time
+	Until    time.Time
+	Count    int
+	Unread   int
+	Rejected int64
+	Senders  []DigestSender
+	Entries  []data.Form
+	More     int
+}
+
+// Digester periodically emails a summary of the entries created in
+// each scheduled mailbox. Daily digests are sent every day at the
+// configured time of day, weekly digests on the configured weekday.
+// It also counts rejected submissions, which digests report.
+type Digester struct {
+	mailer     *Mailer
+	db         data.Data
+	state      data.Digests
+	schedules  map[string]string
+	recipients map[string][]string
+	at         time.Duration
+	weekday    time.Weekday
+	subject    *template.Template
+	body       *template.Template
+}
+
+// NewDigester initializes a Digester. Schedules maps mailboxes to
+// DigestDaily or DigestWeekly. Recipients maps mailboxes to email
+// addresses, the "*" key listing recipients for mailboxes without
+// their own. Digests are sent at the time of day at, in local time.
+// Subject and body are text/template templates executed with a
+// DigestData.
+func NewDigester(mailer *Mailer, db data.Data, state data.Digests,
+	schedules map[string]string, recipients map[string][]string,
+	at time.Duration, weekday time.Weekday, subject, body string) (*Digester, error) {
+	for _, schedule := range schedules {
+		if schedule != DigestDaily && schedule != DigestWeekly {
+			return nil, ErrDigestSchedule
+		}
+	}
+	subjectTmpl, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, err
+	}
+	bodyTmpl, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Digester{
+		mailer:     mailer,
+		db:         db,
+		state:      state,
+		schedules:  schedules,
+		recipients: recipients,
+		at:         at,
+		weekday:    weekday,
+		subject:    subjectTmpl,
+		body:       bodyTmpl,
+	}, nil
+}
+
+// Wants reports whether e is an EventRejected event of a mailbox with
+// a digest.
+func (d *Digester) Wants(e Event) bool {
+	_, ok := d.schedules[digestMailbox(e.Entry)]
+	return e.Type == EventRejected && ok
+}
+
+// Notify counts the rejected submission of an EventRejected event.
+// Other events are ignored.
+func (d *Digester) Notify(ctx context.Context, e Event) error {
+	if !d.Wants(e) {
+		return nil
+	}
+	return d.state.Reject(ctx, digestMailbox(e.Entry))
+}
+
+// digestMailbox returns the mailbox of the entry, which is the default
+// mailbox if it is unnamed.
+func digestMailbox(f data.Form) string {
+	if f.Mailbox == "" {
+		return data.DefaultMailbox
+	}
+	return f.Mailbox
+}
+
+// Run sends due digests until ctx ends.
+func (d *Digester) Run(ctx context.Context) {
+	ticker := time.NewTicker(digestTick)
+	defer ticker.Stop()
+	for {
+		for mailbox := range d.schedules {
+			if err := d.run(ctx, mailbox, time.Now()); err != nil {
+				log.Printf("[DIGEST] mailbox=%s: %s", mailbox, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run sends the mailbox's digest if one was due since the last run.
+// Missed digests are merged into one, covering every entry since the
+// last digest that was sent.
+func (d *Digester) run(ctx context.Context, mailbox string, now time.Time) error {
+	until := d.previous(d.schedules[mailbox], now)
+	state, err := d.state.Read(ctx, mailbox)
+	if err != nil && err != data.ErrMongoNotFound {
+		return err
+	}
+
+	// The first digest covers the entries created since the
+	// schedule was enabled.
+	if state.LastRun.IsZero() {
+		return d.state.Complete(ctx, mailbox, until, 0)
+	}
+	if !state.LastRun.Before(until) {
+		return nil
+	}
+	if err := d.Send(ctx, mailbox, state.LastRun, until, state.Rejected); err != nil {
+		return err
+	}
+	return d.state.Complete(ctx, mailbox, until, state.Rejected)
+}
+
+// previous returns the latest scheduled time no later than now.
+func (d *Digester) previous(schedule string, now time.Time) time.Time {
+	y, m, day := now.Date()
+	t := time.Date(y, m, day, int(d.at/time.Hour), int(d.at%time.Hour/time.Minute),
+		0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	if schedule == DigestWeekly {
+		t = t.AddDate(0, 0, -((int(t.Weekday()) - int(d.weekday) + 7) % 7))
+	}
+	return t
+}
+
+// Send emails the digest of the entries created in mailbox between
+// since and until to the mailbox's recipients.
+func (d *Digester) Send(ctx context.Context, mailbox string, since, until time.Time,
+	rejected int64) error {
+	to, ok := d.recipients[mailbox]
+	if !ok {
+		to = d.recipients["*"]
+	}
+	if len(to) == 0 {
+		return nil
+	}
+	digest, err := d.summarize(ctx, mailbox, since, until, rejected)
+	if err != nil {
+		return err
+	}
+	msg, err := d.Render(digest)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return retry(ctx, 3, func() error {
+		return d.mailer.Send(ctx, msg)
+	})
+}
+
+// summarize computes the digest of the entries created in mailbox
+// between since and until. Counts are aggregated by the database, and
+// only the most recent entries are fetched to be listed.
+func (d *Digester) summarize(ctx context.Context, mailbox string, since, until time.Time,
+	rejected int64) (DigestData, error) {
+	filter := data.Filter{Mailbox: mailbox, After: since, Before: until}
+	summary, err := d.db.Summarize(ctx, filter, digestMaxSenders)
+	if err != nil {
+		return DigestData{}, err
+	}
+	entries, err := d.db.ReadAll(ctx, filter, digestMaxEntries, 0)
+	if err != nil && err != data.ErrMongoNotFound {
+		return DigestData{}, err
+	}
+	digest := DigestData{
+		Mailbox:  mailbox,
+		Period:   strings.ToUpper(d.schedules[mailbox][:1]) + d.schedules[mailbox][1:],
+		Since:    since,
+		Until:    until,
+		Count:    summary.Count,
+		Unread:   summary.Unread,
+		Rejected: rejected,
+		Senders:  []DigestSender{},
+		Entries:  entries,
+		More:     max(summary.Count-len(entries), 0),
+	}
+	for _, s := range summary.Senders {
+		digest.Senders = append(digest.Senders, DigestSender{s.Address, s.Count})
+	}
+	return digest, nil
+}
+
+// Render executes the subject and body templates for the digest.
+func (d *Digester) Render(digest DigestData) (Message, error) {
+	var subject, body bytes.Buffer
+	if err := d.subject.Execute(&subject, digest); err != nil {
+		return Message{}, err
+	}
+	if err := d.body.Execute(&body, digest); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+		Headers: map[string]string{
+			"Auto-Submitted": "auto-generated",
+		},
+	}, nil
+}
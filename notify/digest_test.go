@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/data/datatest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memDigests is an in-memory store of digest states.
+type memDigests struct {
+	mu      sync.Mutex
+	digests map[string]data.Digest
+}
+
+func newMemDigests() *memDigests {
+	return &memDigests{digests: map[string]data.Digest{}}
+}
+
+func (m *memDigests) Read(_ context.Context, mailbox string) (data.Digest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.digests[mailbox]
+	if !ok {
+		return data.Digest{}, data.ErrMongoNotFound
+	}
+	return d, nil
+}
+
+func (m *memDigests) Complete(_ context.Context, mailbox string, run time.Time, rejected int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.digests[mailbox]
+	d.Mailbox, d.LastRun = mailbox, run
+	d.Rejected -= rejected
+	m.digests[mailbox] = d
+	return nil
+}
+
+func (m *memDigests) Reject(_ context.Context, mailbox string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.digests[mailbox]
+	d.Mailbox = mailbox
+	d.Rejected++
+	m.digests[mailbox] = d
+	return nil
+}
+
+// newTestDigester initializes a Digester of the daily "support" and
+// weekly "sales" mailboxes, sent at 08:00 and on Mondays.
+func newTestDigester(t *testing.T, mailer *Mailer, db data.Data, state data.Digests) *Digester {
+	t.Helper()
+	d, err := NewDigester(mailer, db, state,
+		map[string]string{"support": DigestDaily, "sales": DigestWeekly},
+		map[string][]string{"*": {"team@example.com"}},
+		8*time.Hour, time.Monday, DefaultDigestSubject, DefaultDigestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDigestPrevious(t *testing.T) {
+	d := newTestDigester(t, nil, nil, nil)
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %s", err)
+	}
+	// 2026-10-19 is a Monday. New York moved its clocks forward on
+	// 2026-03-08.
+	tests := []struct {
+		name     string
+		schedule string
+		now      time.Time
+		want     time.Time
+	}{
+		{"daily, before the time", DigestDaily,
+			time.Date(2026, 10, 19, 7, 59, 0, 0, time.UTC),
+			time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)},
+		{"daily, at the time", DigestDaily,
+			time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"daily, across months", DigestDaily,
+			time.Date(2026, 11, 1, 0, 30, 0, 0, time.UTC),
+			time.Date(2026, 10, 31, 8, 0, 0, 0, time.UTC)},
+		{"weekly, on the day", DigestWeekly,
+			time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"weekly, earlier on the day", DigestWeekly,
+			time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)},
+		{"weekly, later in the week", DigestWeekly,
+			time.Date(2026, 10, 25, 23, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"weekly, across years", DigestWeekly,
+			time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 12, 28, 8, 0, 0, 0, time.UTC)},
+		{"local time", DigestDaily,
+			time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC).In(ny),
+			time.Date(2026, 10, 18, 8, 0, 0, 0, ny)},
+		{"daylight saving time", DigestDaily,
+			time.Date(2026, 3, 8, 9, 0, 0, 0, ny),
+			time.Date(2026, 3, 8, 8, 0, 0, 0, ny)},
+		{"after daylight saving time", DigestDaily,
+			time.Date(2026, 3, 9, 7, 0, 0, 0, ny),
+			time.Date(2026, 3, 8, 8, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := d.previous(tt.schedule, tt.now)
+			if !got.Equal(tt.want) {
+				t.Errorf("previous(%s, %s) = %s, want %s", tt.schedule, tt.now, got, tt.want)
+			}
+			if hour, min, _ := got.Clock(); hour != 8 || min != 0 {
+				t.Errorf("previous() = %s, want 08:00 local time", got)
+			}
+		})
+	}
+}
+
+func TestDigestRun(t *testing.T) {
+	// Mondays at 08:00, with entries on the preceding days.
+	monday := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	entries := []data.Form{}
+	for day := 1; day <= 7; day++ {
+		for _, mailbox := range []string{"support", "sales"} {
+			entries = append(entries, data.Form{Mailbox: mailbox,
+				From: fmt.Sprintf("user%d@example.com", day), Subject: "Hello",
+				Created: monday.AddDate(0, 0, -day).Add(time.Hour)})
+		}
+	}
+	tests := []struct {
+		name    string
+		mailbox string
+		lastRun time.Time
+		now     time.Time
+		sent    bool
+		count   int
+		lastNow time.Time
+	}{
+		{"first run", "support", time.Time{}, monday.Add(time.Hour), false, 0, monday},
+		{"not due", "support", monday, monday.Add(23 * time.Hour), false, 0, monday},
+		{"daily", "support", monday.AddDate(0, 0, -1), monday, true, 1, monday},
+		{"missed days are merged", "support", monday.AddDate(0, 0, -3),
+			monday.Add(time.Minute), true, 3, monday},
+		{"weekly not due", "sales", monday, monday.AddDate(0, 0, 6), false, 0, monday},
+		{"weekly", "sales", monday.AddDate(0, 0, -7), monday.Add(time.Hour), true, 7, monday},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t)
+			state := newMemDigests()
+			if !tt.lastRun.IsZero() {
+				state.Complete(context.Background(), tt.mailbox, tt.lastRun, 0)
+				state.Reject(context.Background(), tt.mailbox)
+			}
+			d := newTestDigester(t, sink.Mailer(), datatest.NewData(entries...), state)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := d.run(ctx, tt.mailbox, tt.now); err != nil {
+				t.Fatal(err)
+			}
+			messages, _ := sink.Messages()
+			if (len(messages) == 1) != tt.sent {
+				t.Fatalf("sent %d digests, want sent = %v", len(messages), tt.sent)
+			}
+			got, _ := state.Read(ctx, tt.mailbox)
+			if !got.LastRun.Equal(tt.lastNow) {
+				t.Errorf("LastRun = %s, want %s", got.LastRun, tt.lastNow)
+			}
+			if !tt.sent {
+				return
+			}
+			if got.Rejected != 0 {
+				t.Errorf("%d rejections are left after the digest reported them", got.Rejected)
+			}
+			for _, want := range []string{
+				fmt.Sprintf("New entries:  %d", tt.count),
+				"Rejected:     1",
+			} {
+				if !strings.Contains(messages[0].Data, want) {
+					t.Errorf("digest does not contain %q:\n%s", want, messages[0].Data)
+				}
+			}
+		})
+	}
+}
+
+func TestDigestSummarize(t *testing.T) {
+	since := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	entries := []data.Form{}
+	for i := range digestMaxEntries + 5 {
+		entry := data.Form{Mailbox: "support", From: "Jane@example.com",
+			Subject: "Hello", Created: since.Add(time.Duration(i+1) * time.Minute)}
+		if i%2 == 0 {
+			entry.From, entry.Status = fmt.Sprintf("user%d@example.com", i), data.StatusRead
+		}
+		entries = append(entries, entry)
+	}
+	// Entries of other mailboxes and periods are left out.
+	entries = append(entries,
+		data.Form{Mailbox: "sales", From: "bob@example.com", Created: since.Add(time.Hour)},
+		data.Form{Mailbox: "support", From: "bob@example.com", Created: since.Add(-time.Hour)})
+
+	d := newTestDigester(t, nil, datatest.NewData(entries...), newMemDigests())
+	digest, err := d.summarize(context.Background(), "support", since,
+		since.AddDate(0, 0, 1), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest.Count != digestMaxEntries+5 || digest.Unread != 27 || digest.Rejected != 4 {
+		t.Errorf("counted %d entries, %d unread and %d rejected", digest.Count,
+			digest.Unread, digest.Rejected)
+	}
+	if len(digest.Entries) != digestMaxEntries || digest.More != 5 {
+		t.Errorf("listed %d entries and %d more, want %d and 5", len(digest.Entries),
+			digest.More, digestMaxEntries)
+	}
+	if len(digest.Senders) != digestMaxSenders {
+		t.Fatalf("listed %d senders, want %d", len(digest.Senders), digestMaxSenders)
+	}
+	if top := digest.Senders[0]; top.Address != "jane@example.com" || top.Count != 27 {
+		t.Errorf("top sender = %+v, want jane@example.com with 27 entries", top)
+	}
+	if digest.Period != "Daily" {
+		t.Errorf("Period = %q, want Daily", digest.Period)
+	}
+}
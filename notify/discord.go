@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// discordEscaper escapes Discord's markdown, so submitted text is shown
+// as it was written, and cannot hide links or render as mentions.
+var discordEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`,
+	"~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`, "#", `\#`, "[", `\[`,
+	"]", `\]`, "<", `\<`)
+
+// DiscordChat posts messages to a Discord webhook.
+type DiscordChat struct {
+	URL    string
+	client *http.Client
+}
+
+// NewDiscordChat initializes a sender for the Discord webhook at url.
+func NewDiscordChat(url string) *DiscordChat {
+	return &DiscordChat{URL: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Author      map[string]any `json:"author,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+// Send posts a message announcing forms. Discord allows at most ten
+// embeds per message, so larger batches are summarized.
+func (d *DiscordChat) Send(ctx context.Context, forms []data.Form) error {
+	embeds := []discordEmbed{}
+	for i, f := range forms {
+		if i == chatMaxEntries {
+			break
+		}
+		embeds = append(embeds, discordEmbed{
+			Title:       truncate(discordEscaper.Replace(f.Subject), 256),
+			Description: truncate(discordEscaper.Replace(f.Message), chatMaxText),
+			Color:       0x3b82f6,
+			Author:      map[string]any{"name": truncate(f.From, 256)},
+			Fields: []discordField{
+				{Name: "Mailbox", Value: discordEscaper.Replace(f.Mailbox), Inline: true},
+				{Name: "ID", Value: discordEscaper.Replace(f.ID), Inline: true},
+			},
+		})
+	}
+	content := discordEscaper.Replace(chatSummary(forms))
+	if more := chatOverflow(forms); more != "" {
+		content += " (" + more + ")"
+	}
+	return postJSON(ctx, d.client, "POST", d.URL, nil, map[string]any{
+		"content": content,
+		"embeds":  embeds,
+		// Never let submitted text mention users or roles.
+		"allowed_mentions": map[string]any{"parse": []string{}},
+	})
+}
@@ -0,0 +1,182 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SecurityStartTLS upgrades plaintext SMTP connections with
+	// STARTTLS, usually on port 587.
+	SecurityStartTLS = "starttls"
+
+	// SecurityTLS connects with implicit TLS, usually on port 465.
+	SecurityTLS = "tls"
+
+	// SecurityNone sends mail in plaintext. It should only be used
+	// with local relays and test sinks.
+	SecurityNone = "none"
+)
+
+var (
+	// ErrMailerNoRecipients is returned when sending a message
+	// without recipients.
+	ErrMailerNoRecipients = errors.New("message has no recipients")
+
+	// ErrMailerSecurity is returned when a mailer's security mode is
+	// not one of starttls, tls or none.
+	ErrMailerSecurity = errors.New("smtp security must be one of starttls, tls or none")
+)
+
+// Message defines an outgoing plaintext email.
+type Message struct {
+	To      []string
+	ReplyTo string
+	Subject string
+	Body    string
+
+	// Headers are added to the message verbatim.
+	Headers map[string]string
+}
+
+// Mailer sends email through an SMTP relay.
+type Mailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	Security string
+}
+
+// Send delivers the message through the relay.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrMailerNoRecipients
+	}
+	switch m.Security {
+	case SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return ErrMailerSecurity
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %s", err)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: m.Host}
+	var conn net.Conn
+	if m.Security == SecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).
+			DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.Security == SecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes(m.From)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Bytes renders the message in RFC 5322 format, sent by from.
+func (msg Message) Bytes(from string) []byte {
+	headers := map[string]string{
+		"From":                      from,
+		"To":                        strings.Join(msg.To, ", "),
+		"Subject":                   mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":                      time.Now().Format(time.RFC1123Z),
+		"Message-ID":                newMessageID(from),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	if msg.ReplyTo != "" {
+		headers["Reply-To"] = msg.ReplyTo
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headers[k])
+	}
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// newMessageID generates a unique Message-ID in the sender's domain.
+func newMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">"
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MatrixChat posts messages to a Matrix room as the user that owns the
+// access token.
+type MatrixChat struct {
+	Homeserver string
+	Token      string
+	Room       string
+	client     *http.Client
+}
+
+// NewMatrixChat initializes a sender for the given room, which must
+// already have been joined by the token's user.
+func NewMatrixChat(homeserver, token, room string) *MatrixChat {
+	return &MatrixChat{
+		Homeserver: strings.TrimSuffix(homeserver, "/"),
+		Token:      token,
+		Room:       room,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts an m.room.message announcing forms, with an HTML body for
+// clients that render it.
+func (m *MatrixChat) Send(ctx context.Context, forms []data.Form) error {
+	var plain, rich strings.Builder
+	plain.WriteString(chatSummary(forms) + "\n")
+	rich.WriteString("<p><strong>" + html.EscapeString(chatSummary(forms)) + "</strong></p>")
+	for i, f := range forms {
+		if i == chatMaxEntries {
+			break
+		}
+		text := truncate(f.Message, chatMaxText)
+		fmt.Fprintf(&plain, "\n[%s] %s — %s\n%s\n", f.Mailbox, f.From,
+			f.Subject, text)
+		fmt.Fprintf(&rich, "<p><strong>%s</strong><br>%s · <code>%s</code></p><blockquote>%s</blockquote>",
+			html.EscapeString(f.Subject), html.EscapeString(f.From),
+			html.EscapeString(f.Mailbox),
+			strings.ReplaceAll(html.EscapeString(text), "\n", "<br>"))
+	}
+	if more := chatOverflow(forms); more != "" {
+		plain.WriteString("\n" + more)
+		rich.WriteString("<p>" + html.EscapeString(more) + "</p>")
+	}
+
+	// Deriving the transaction ID from the batch makes retried
+	// requests idempotent.
+	txn := fmt.Sprintf("mailbox-%s-%s-%d", forms[0].ID,
+		forms[len(forms)-1].ID, len(forms))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.Homeserver, url.PathEscape(m.Room), txn)
+	header := http.Header{"Authorization": {"Bearer " + m.Token}}
+	return postJSON(ctx, m.client, "PUT", endpoint, header, map[string]any{
+		"msgtype":        "m.text",
+		"body":           plain.String(),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": rich.String(),
+		// Clients and servers that support intentional mentions then
+		// never notify anyone of submitted text, e.g. of "@room".
+		"m.mentions": map[string]any{},
+	})
+}
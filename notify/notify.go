@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"sync"
+	"time"
+)
+
+const (
+	// EventCreated is emitted when a new entry is submitted.
+	EventCreated = "created"
+
+	// EventDeleted is emitted when an entry is deleted.
+	EventDeleted = "deleted"
+
+	// EventStatusChanged is emitted when an entry is marked as read
+	// or unread.
+	EventStatusChanged = "status_changed"
+
+	// EventUpdated is emitted when an entry is moved to another
+	// mailbox, its tags or assignee change, or a note is added.
+	EventUpdated = "updated"
+
+	// EventReplied is emitted when a reply is sent to an entry's
+	// submitter, or a follow-up from them is received.
+	EventReplied = "replied"
+
+	// EventRejected is emitted when a submission fails validation or
+	// its captcha. The entry is not stored and has no ID.
+	EventRejected = "rejected"
+)
+
+// Event describes a change to a mailbox entry.
+type Event struct {
+	Type  string    `json:"type"`
+	Entry data.Form `json:"entry"`
+	User  string    `json:"user,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// NewEvent initializes an event of the given type for entry, caused by
+// user (if any).
+func NewEvent(eventType string, entry data.Form, user string) Event {
+	return Event{
+		Type:  eventType,
+		Entry: entry,
+		User:  user,
+		Time:  time.Now().UTC(),
+	}
+}
+
+// Notifier defines an event notification target.
+type Notifier interface {
+
+	// Notify delivers the event. Notifiers ignore event types that
+	// they are not interested in.
+	Notify(context.Context, Event) error
+}
+
+// Selective is a Notifier that is only interested in some events.
+// Queues do not store jobs for the events that their targets are not
+// interested in, e.g. so that rejected submissions do not fill the
+// outbox.
+type Selective interface {
+	Notifier
+
+	// Wants reports whether the notifier delivers the event.
+	Wants(Event) bool
+}
+
+// wants reports whether n delivers the event.
+func wants(n Notifier, e Event) bool {
+	s, ok := n.(Selective)
+	return !ok || s.Wants(e)
+}
+
+// BatchNotifier is a Notifier that delivers several events at once.
+type BatchNotifier interface {
+	Notifier
+
+	// NotifyAll delivers the events.
+	NotifyAll(context.Context, []Event) error
+}
+
+// NotifyAll delivers the events to n, at once if n is a BatchNotifier
+// and one by one otherwise.
+func NotifyAll(ctx context.Context, n Notifier, events []Event) error {
+	if b, ok := n.(BatchNotifier); ok {
+		return b.NotifyAll(ctx, events)
+	}
+	var errs []error
+	for _, e := range events {
+		if err := n.Notify(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Multi fans events out to several notifiers.
+type Multi []Notifier
+
+// Notify delivers the event to every notifier concurrently, so that a
+// slow or retrying notifier does not hold up the others. It returns
+// the errors of those that failed.
+func (m Multi) Notify(ctx context.Context, e Event) error {
+	return m.NotifyAll(ctx, []Event{e})
+}
+
+// NotifyAll delivers the events to every notifier concurrently, as
+// Notify does.
+func (m Multi) NotifyAll(ctx context.Context, events []Event) error {
+	errs := make([]error, len(m))
+	var wg sync.WaitGroup
+	for i, n := range m {
+		wg.Add(1)
+		go func(i int, n Notifier) {
+			defer wg.Done()
+			errs[i] = NotifyAll(ctx, n, events)
+		}(i, n)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// retry calls fn up to attempts times, doubling the delay between
+// attempts starting from one second, until it succeeds or ctx ends.
+func retry(ctx context.Context, attempts int, fn func() error) error {
+	delay := time.Second
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if i == attempts-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
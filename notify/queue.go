@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"log"
+	"time"
+)
+
+const (
+	// queuePoll is how often idle workers look for due jobs.
+	queuePoll = 5 * time.Second
+
+	// queueTimeout bounds a single delivery attempt.
+	queueTimeout = 2 * time.Minute
+
+	// queueLease is how long a job stays claimed by a worker. It
+	// outlasts queueTimeout, so that only jobs of crashed workers
+	// are claimed twice.
+	queueLease = 5 * time.Minute
+
+	// queueBackoff is the delay before the first retry of a job. It
+	// doubles with every attempt, up to queueMaxBackoff.
+	queueBackoff    = 10 * time.Second
+	queueMaxBackoff = time.Hour
+)
+
+// ErrQueueNotDead is returned when retrying a job that is not dead.
+var ErrQueueNotDead = errors.New("only dead jobs can be retried")
+
+// Queue delivers events to notifiers through a persistent outbox.
+// Notifying a queue stores a job per target notifier, which worker
+// goroutines then deliver. Failed deliveries are retried with
+// exponential backoff, and jobs that fail every attempt are kept as
+// dead letters. Since jobs outlive restarts and crashed workers, every
+// queued event is attempted until it is delivered or dead-lettered,
+// provided that its targets only report success once they delivered
+// it.
+type Queue struct {
+	jobs     data.Jobs
+	attempts int
+	targets  map[string]Notifier
+	wake     chan struct{}
+}
+
+// NewQueue initializes a Queue whose jobs are attempted up to attempts
+// times.
+func NewQueue(jobs data.Jobs, attempts int) *Queue {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Queue{
+		jobs:     jobs,
+		attempts: attempts,
+		targets:  map[string]Notifier{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register adds a target notifier under the given name, which jobs
+// refer to. Targets must be registered before the queue is run.
+func (q *Queue) Register(name string, n Notifier) {
+	q.targets[name] = n
+}
+
+// For returns a Notifier that queues events for the named targets.
+func (q *Queue) For(names ...string) Notifier {
+	return &queued{q: q, names: names}
+}
+
+// queued is a Notifier that queues events for a set of targets.
+type queued struct {
+	q     *Queue
+	names []string
+}
+
+func (n *queued) Notify(ctx context.Context, e Event) error {
+	return n.q.Enqueue(ctx, []Event{e}, n.names...)
+}
+
+func (n *queued) NotifyAll(ctx context.Context, events []Event) error {
+	return n.q.Enqueue(ctx, events, n.names...)
+}
+
+// Enqueue stores a job per named target for each of the events at
+// once, and wakes an idle worker. Selective targets are only sent the
+// events they want. Once it returns without an error, the events are
+// delivered even if the server restarts.
+func (q *Queue) Enqueue(ctx context.Context, events []Event, names ...string) error {
+	jobs := []data.Job{}
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if n, ok := q.targets[name]; ok && !wants(n, e) {
+				continue
+			}
+			job, err := data.NewJob(name, e.Type, e.Entry.ID, payload)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	if err := q.jobs.Create(ctx, jobs...); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run starts the given number of workers, which deliver jobs until ctx
+// ends.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+// work delivers due jobs, waiting for new ones when there are none.
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(queuePoll)
+	defer ticker.Stop()
+	for {
+		claimCtx, cancel := context.WithTimeout(ctx, queuePoll)
+		job, err := q.jobs.Claim(claimCtx, queueLease)
+		cancel()
+		if err == nil {
+			q.deliver(ctx, job)
+			continue
+		}
+		if err != data.ErrMongoNotFound {
+			log.Printf("[QUEUE] %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver attempts a claimed job and records the outcome.
+func (q *Queue) deliver(ctx context.Context, job data.Job) {
+	err := q.attempt(ctx, job)
+	final := job.Attempts >= q.attempts
+	job.Attempted(err, final, backoff(job.Attempts))
+	if err != nil {
+		log.Printf("[QUEUE] job=%s target=%s attempt=%d: %s", job.ID,
+			job.Target, job.Attempts, err)
+	}
+	updateCtx, cancel := context.WithTimeout(context.Background(), queuePoll)
+	defer cancel()
+	if err := q.jobs.Update(updateCtx, job); err != nil {
+		log.Printf("[QUEUE] job=%s: %s", job.ID, err)
+	}
+}
+
+// attempt delivers the job's event to its target.
+func (q *Queue) attempt(ctx context.Context, job data.Job) error {
+	n, ok := q.targets[job.Target]
+	if !ok {
+		return fmt.Errorf("unknown target %q", job.Target)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(job.Payload), &e); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, queueTimeout)
+	defer cancel()
+	return n.Notify(ctx, e)
+}
+
+// Retry requeues a dead job, referenced by its ID, with a fresh set of
+// attempts, and returns it.
+func (q *Queue) Retry(ctx context.Context, id string) (data.Job, error) {
+	job, err := q.jobs.Read(ctx, id)
+	if err != nil {
+		return data.Job{}, err
+	}
+	if job.Status != data.JobDead {
+		return data.Job{}, ErrQueueNotDead
+	}
+	job.Requeue()
+	if err := q.jobs.Update(ctx, job); err != nil {
+		return data.Job{}, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// backoff returns the delay before the retry that follows the given
+// number of attempts.
+func backoff(attempts int) time.Duration {
+	delay := queueBackoff
+	for i := 1; i < attempts && delay < queueMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, queueMaxBackoff)
+}
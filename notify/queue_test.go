@@ -0,0 +1,330 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memJobs is an in-memory outbox.
+type memJobs struct {
+	mu   sync.Mutex
+	jobs map[string]data.Job
+}
+
+func newMemJobs() *memJobs {
+	return &memJobs{jobs: map[string]data.Job{}}
+}
+
+func (m *memJobs) Count(_ context.Context, status string) int64 {
+	jobs, _ := m.ReadAll(context.Background(), status, 0, 0)
+	return int64(len(jobs))
+}
+
+func (m *memJobs) ReadAll(_ context.Context, status string, _, _ int64) ([]data.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := []data.Job{}
+	for _, job := range m.jobs {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.After(jobs[j].Created) })
+	return jobs, nil
+}
+
+func (m *memJobs) Read(_ context.Context, id string) (data.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return data.Job{}, data.ErrMongoNotFound
+	}
+	return job, nil
+}
+
+func (m *memJobs) Create(_ context.Context, jobs ...data.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range jobs {
+		m.jobs[job.ID] = job
+	}
+	return nil
+}
+
+func (m *memJobs) Update(_ context.Context, job data.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[job.ID]; !ok {
+		return data.ErrMongoNotFound
+	}
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *memJobs) Claim(_ context.Context, lease time.Duration) (data.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	var due *data.Job
+	for _, job := range m.jobs {
+		if job.Status != data.JobPending && job.Status != data.JobRunning {
+			continue
+		}
+		if job.RunAt.After(now) || (due != nil && !job.RunAt.Before(due.RunAt)) {
+			continue
+		}
+		due = &job
+	}
+	if due == nil {
+		return data.Job{}, data.ErrMongoNotFound
+	}
+	due.Status = data.JobRunning
+	due.RunAt = now.Add(lease)
+	due.Updated = now
+	due.Attempts++
+	m.jobs[due.ID] = *due
+	return *due, nil
+}
+
+// elapse makes every job due, as if its backoff or lease had passed.
+func (m *memJobs) elapse() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, job := range m.jobs {
+		job.RunAt = time.Now().UTC().Add(-time.Second)
+		m.jobs[id] = job
+	}
+}
+
+// flaky is a Notifier that fails a number of times before delivering.
+type flaky struct {
+	failures  int
+	delivered []Event
+}
+
+func (n *flaky) Notify(_ context.Context, e Event) error {
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("unavailable")
+	}
+	n.delivered = append(n.delivered, e)
+	return nil
+}
+
+// drain claims and delivers jobs until none are left, letting backoffs
+// elapse, and returns the number of attempts made.
+func drain(t *testing.T, q *Queue, jobs *memJobs) int {
+	t.Helper()
+	ctx := context.Background()
+	for attempts := 0; attempts < 100; attempts++ {
+		job, err := jobs.Claim(ctx, queueLease)
+		if err == data.ErrMongoNotFound {
+			jobs.elapse()
+			job, err = jobs.Claim(ctx, queueLease)
+		}
+		if err == data.ErrMongoNotFound {
+			return attempts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.deliver(ctx, job)
+	}
+	t.Fatal("the queue did not drain")
+	return 0
+}
+
+func TestQueueDeliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		failures     int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"delivered", 3, 0, data.JobSucceeded, 1},
+		{"retried", 3, 2, data.JobSucceeded, 3},
+		{"dead-lettered", 3, 3, data.JobDead, 3},
+		{"single attempt", 1, 1, data.JobDead, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMemJobs()
+			target := &flaky{failures: tt.failures}
+			q := NewQueue(jobs, tt.attempts)
+			q.Register("target", target)
+			event := NewEvent(EventCreated, data.Form{ID: "abc", Subject: "Hello"}, "")
+			if err := q.For("target").Notify(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+			if n := drain(t, q, jobs); n != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", n, tt.wantAttempts)
+			}
+			all, _ := jobs.ReadAll(context.Background(), "", 0, 0)
+			if len(all) != 1 {
+				t.Fatalf("queued %d jobs, want 1", len(all))
+			}
+			job := all[0]
+			if job.Status != tt.wantStatus || job.Attempts != tt.wantAttempts {
+				t.Errorf("job is %s after %d attempts, want %s after %d", job.Status,
+					job.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if (job.Error != "") != (tt.wantStatus == data.JobDead) {
+				t.Errorf("Error = %q", job.Error)
+			}
+			for _, e := range target.delivered {
+				if e.Entry.ID != "abc" {
+					t.Errorf("delivered entry %q, want abc", e.Entry.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	jobs := newMemJobs()
+	q := NewQueue(jobs, 3)
+	q.Register("target", &flaky{failures: 1})
+	if err := q.Enqueue(context.Background(), []Event{NewEvent(EventCreated,
+		data.Form{ID: "abc"}, "")}, "target"); err != nil {
+		t.Fatal(err)
+	}
+	job, err := jobs.Claim(context.Background(), queueLease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Claim(context.Background(), queueLease); err != data.ErrMongoNotFound {
+		t.Fatalf("claimed a running job twice: %v", err)
+	}
+	q.deliver(context.Background(), job)
+	job, _ = jobs.Read(context.Background(), job.ID)
+	if job.Status != data.JobPending {
+		t.Fatalf("Status = %s, want %s", job.Status, data.JobPending)
+	}
+	if wait := time.Until(job.RunAt); wait < queueBackoff-time.Second || wait > queueBackoff {
+		t.Errorf("retried in %s, want %s", wait, queueBackoff)
+	}
+	if _, err := jobs.Claim(context.Background(), queueLease); err != data.ErrMongoNotFound {
+		t.Errorf("claimed a job before its backoff elapsed: %v", err)
+	}
+}
+
+func TestQueueEnqueue(t *testing.T) {
+	jobs := newMemJobs()
+	q := NewQueue(jobs, 3)
+	events := []Event{
+		NewEvent(EventCreated, data.Form{ID: "a"}, ""),
+		NewEvent(EventCreated, data.Form{ID: "b"}, ""),
+	}
+	if err := q.For("email", "chat").(BatchNotifier).NotifyAll(context.Background(),
+		events); err != nil {
+		t.Fatal(err)
+	}
+	if n := jobs.Count(context.Background(), data.JobPending); n != 4 {
+		t.Errorf("queued %d jobs, want 4", n)
+	}
+}
+
+// picky is a Notifier that only wants events of one type.
+type picky struct {
+	flaky
+	eventType string
+}
+
+func (n *picky) Wants(e Event) bool {
+	return e.Type == n.eventType
+}
+
+func TestQueueSelective(t *testing.T) {
+	jobs := newMemJobs()
+	q := NewQueue(jobs, 3)
+	q.Register("digest", &picky{eventType: EventRejected})
+	q.Register("chat", &picky{eventType: EventCreated})
+	ctx := context.Background()
+
+	// Rejections are only queued for the targets that want them.
+	if err := q.For("digest", "chat").Notify(ctx, NewEvent(EventRejected,
+		data.Form{}, "")); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := jobs.ReadAll(ctx, "", 0, 0)
+	if len(all) != 1 || all[0].Target != "digest" {
+		t.Fatalf("queued %+v, want a single job for the digest", all)
+	}
+
+	// Events that no target wants are not queued at all.
+	if err := q.For("chat").Notify(ctx, NewEvent(EventDeleted,
+		data.Form{ID: "abc"}, "")); err != nil {
+		t.Fatal(err)
+	}
+	if n := jobs.Count(ctx, ""); n != 1 {
+		t.Errorf("queued %d jobs, want 1", n)
+	}
+}
+
+func TestQueueRetry(t *testing.T) {
+	tests := []struct {
+		status string
+		err    error
+	}{
+		{data.JobDead, nil},
+		{data.JobPending, ErrQueueNotDead},
+		{data.JobRunning, ErrQueueNotDead},
+		{data.JobSucceeded, ErrQueueNotDead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			jobs := newMemJobs()
+			job, _ := data.NewJob("target", EventCreated, "abc", []byte("{}"))
+			job.Status, job.Attempts, job.Error = tt.status, 3, "unavailable"
+			jobs.Create(context.Background(), job)
+
+			got, err := NewQueue(jobs, 3).Retry(context.Background(), job.ID)
+			if err != tt.err {
+				t.Fatalf("Retry() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != data.JobPending || got.Attempts != 0 || got.Error != "" {
+				t.Errorf("Retry() = %+v, want a fresh pending job", got)
+			}
+			if _, err := jobs.Claim(context.Background(), queueLease); err != nil {
+				t.Errorf("Claim() error = %v, want the requeued job", err)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := NewQueue(newMemJobs(), 3).Retry(context.Background(), "missing")
+		if err != data.ErrMongoNotFound {
+			t.Errorf("Retry() error = %v, want %v", err, data.ErrMongoNotFound)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, queueBackoff},
+		{1, queueBackoff},
+		{2, 2 * queueBackoff},
+		{3, 4 * queueBackoff},
+		{9, 256 * queueBackoff},
+		{10, queueMaxBackoff},
+		{100, queueMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
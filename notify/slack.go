@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// slackEscaper escapes the control characters of Slack's message
+// formatting, so submitted text cannot trigger mentions or links.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// SlackChat posts messages to a Slack or Mattermost incoming webhook.
+// Mattermost accepts Slack's message attachments, so the same format
+// serves both.
+type SlackChat struct {
+	URL    string
+	client *http.Client
+}
+
+// NewSlackChat initializes a sender for the incoming webhook at url.
+func NewSlackChat(url string) *SlackChat {
+	return &SlackChat{URL: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Fallback   string       `json:"fallback"`
+	Color      string       `json:"color"`
+	AuthorName string       `json:"author_name,omitempty"`
+	Title      string       `json:"title,omitempty"`
+	Text       string       `json:"text,omitempty"`
+	Fields     []slackField `json:"fields,omitempty"`
+}
+
+// Send posts a message announcing forms.
+func (s *SlackChat) Send(ctx context.Context, forms []data.Form) error {
+	attachments := []slackAttachment{}
+	for i, f := range forms {
+		if i == chatMaxEntries {
+			break
+		}
+		attachments = append(attachments, slackAttachment{
+			Fallback:   slackEscaper.Replace(f.From + ": " + f.Subject),
+			Color:      "#3b82f6",
+			AuthorName: slackEscaper.Replace(f.From),
+			Title:      slackEscaper.Replace(f.Subject),
+			Text:       slackEscaper.Replace(truncate(f.Message, chatMaxText)),
+			Fields: []slackField{
+				{Title: "Mailbox", Value: slackEscaper.Replace(f.Mailbox), Short: true},
+				{Title: "ID", Value: slackEscaper.Replace(f.ID), Short: true},
+			},
+		})
+	}
+	text := slackEscaper.Replace(chatSummary(forms))
+	if more := chatOverflow(forms); more != "" {
+		attachments = append(attachments, slackAttachment{
+			Fallback: more,
+			Text:     more,
+		})
+	}
+	return postJSON(ctx, s.client, "POST", s.URL, nil, map[string]any{
+		"text":        text,
+		"attachments": attachments,
+	})
+}
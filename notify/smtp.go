@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"github.com/zeim839/mailbox/data"
+	"text/template"
+)
+
+// DefaultSubject is the subject template used when none is configured.
+const DefaultSubject = "[Mailbox] {{.Subject}}"
+
+// DefaultBody is the body template used when none is configured.
+const DefaultBody = `New message in mailbox "{{.Mailbox}}".
+
+From:    {{.From}}
+Subject: {{.Subject}}
+ID:      {{.ID}}
+
+{{.Message}}
+`
+
+// SMTPNotifier emails new submissions to the recipients of the
+// mailbox they were submitted to. Replying to the notification replies
+// to the submitter.
+type SMTPNotifier struct {
+	mailer     *Mailer
+	recipients map[string][]string
+	subject    *template.Template
+	body       *template.Template
+}
+
+// NewSMTPNotifier initializes an SMTPNotifier. Recipients maps mailbox
+// names to email addresses; the "*" key lists recipients for mailboxes
+// without their own. Subject and body are text/template templates
+// executed with the submitted data.Form.
+func NewSMTPNotifier(mailer *Mailer, recipients map[string][]string,
+	subject, body string) (*SMTPNotifier, error) {
+	subjectTmpl, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, err
+	}
+	bodyTmpl, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &SMTPNotifier{
+		mailer:     mailer,
+		recipients: recipients,
+		subject:    subjectTmpl,
+		body:       bodyTmpl,
+	}, nil
+}
+
+// Wants reports whether e is an EventCreated event of an entry whose
+// mailbox has recipients.
+func (s *SMTPNotifier) Wants(e Event) bool {
+	return e.Type == EventCreated && len(s.Recipients(e.Entry.Mailbox)) > 0
+}
+
+// Notify emails the entry of an EventCreated event to its mailbox's
+// recipients. Other events are ignored.
+func (s *SMTPNotifier) Notify(ctx context.Context, e Event) error {
+	if !s.Wants(e) {
+		return nil
+	}
+	to := s.Recipients(e.Entry.Mailbox)
+	msg, err := s.Render(e.Entry)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return s.mailer.Send(ctx, msg)
+}
+
+// Recipients returns the addresses notified of entries in mailbox.
+func (s *SMTPNotifier) Recipients(mailbox string) []string {
+	if mailbox == "" {
+		mailbox = data.DefaultMailbox
+	}
+	if to, ok := s.recipients[mailbox]; ok {
+		return to
+	}
+	return s.recipients["*"]
+}
+
+// Render executes the subject and body templates for form.
+func (s *SMTPNotifier) Render(form data.Form) (Message, error) {
+	var subject, body bytes.Buffer
+	if err := s.subject.Execute(&subject, form); err != nil {
+		return Message{}, err
+	}
+	if err := s.body.Execute(&body, form); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		ReplyTo: form.From,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/zeim839/mailbox/data"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sinkMessage is an email received by an smtpSink.
+type sinkMessage struct {
+	To   []string
+	Data string
+}
+
+// smtpSink is a local SMTP server that records the messages it
+// receives, or refuses them while failing.
+type smtpSink struct {
+	listener net.Listener
+	failing  atomic.Bool
+
+	mu       sync.Mutex
+	messages []sinkMessage
+	attempts int
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{listener: l}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+// Mailer returns a Mailer that sends to the sink.
+func (s *smtpSink) Mailer() *Mailer {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return &Mailer{
+		Host:     host,
+		Port:     port,
+		From:     "Mailbox <mailbox@example.com>",
+		Security: SecurityNone,
+	}
+}
+
+// Messages returns the messages received so far, and the number of
+// attempts at sending them.
+func (s *smtpSink) Messages() ([]sinkMessage, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.messages), s.attempts
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 sink ready")
+	var msg sinkMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.attempts++
+			s.mu.Unlock()
+			if s.failing.Load() {
+				reply("451 try again later")
+				continue
+			}
+			msg = sinkMessage{}
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			to := strings.TrimSpace(line)[len("RCPT TO:"):]
+			msg.To = append(msg.To, strings.Trim(to, "<>"))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var body strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				body.WriteString(line)
+			}
+			msg.Data = body.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	recipients := map[string][]string{
+		"*":     {"webmaster@example.com"},
+		"sales": {"sales@example.com", "ceo@example.com"},
+		"quiet": nil,
+	}
+	tests := []struct {
+		name    string
+		event   Event
+		failing bool
+		want    []string
+		wantErr bool
+	}{
+		{"mailbox recipients", NewEvent(EventCreated, data.Form{Mailbox: "sales",
+			From: "jane@example.com", Subject: "Quote"}, ""),
+			false, []string{"sales@example.com", "ceo@example.com"}, false},
+		{"fallback recipients", NewEvent(EventCreated, data.Form{Mailbox: "support",
+			From: "jane@example.com", Subject: "Help"}, ""),
+			false, []string{"webmaster@example.com"}, false},
+		{"legacy entry", NewEvent(EventCreated, data.Form{
+			From: "jane@example.com", Subject: "Hello"}, ""),
+			false, []string{"webmaster@example.com"}, false},
+		{"no recipients", NewEvent(EventCreated, data.Form{Mailbox: "quiet",
+			From: "jane@example.com", Subject: "Hello"}, ""), false, nil, false},
+		{"other event", NewEvent(EventDeleted, data.Form{Mailbox: "sales",
+			From: "jane@example.com", Subject: "Quote"}, "alice"), false, nil, false},
+		{"relay failure", NewEvent(EventCreated, data.Form{Mailbox: "sales",
+			From: "jane@example.com", Subject: "Quote"}, ""), true, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t)
+			sink.failing.Store(tt.failing)
+			n, err := NewSMTPNotifier(sink.Mailer(), recipients, DefaultSubject, DefaultBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := n.Notify(ctx, tt.event); (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			messages, attempts := sink.Messages()
+			if tt.failing && attempts != 1 {
+				t.Errorf("attempts = %d, want 1: retries are left to the outbox", attempts)
+			}
+			if tt.want == nil {
+				if len(messages) != 0 {
+					t.Errorf("sent %d messages, want none", len(messages))
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(messages))
+			}
+			if !slices.Equal(messages[0].To, tt.want) {
+				t.Errorf("To = %q, want %q", messages[0].To, tt.want)
+			}
+			if !strings.Contains(messages[0].Data, "Reply-To: "+tt.event.Entry.From) {
+				t.Errorf("message does not reply to the submitter:\n%s", messages[0].Data)
+			}
+		})
+	}
+}
+
+func TestMailerNoRecipients(t *testing.T) {
+	sink := newSMTPSink(t)
+	err := sink.Mailer().Send(context.Background(), Message{Subject: "Hello"})
+	if !errors.Is(err, ErrMailerNoRecipients) {
+		t.Errorf("Send() error = %v, want %v", err, ErrMailerNoRecipients)
+	}
+}
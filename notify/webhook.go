@@ -0,0 +1,227 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zeim839/mailbox/data"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderEvent names the event type of a webhook delivery.
+	HeaderEvent = "X-Mailbox-Event"
+
+	// HeaderDelivery carries the ID of a webhook delivery, which is
+	// unchanged when the delivery is retried.
+	HeaderDelivery = "X-Mailbox-Delivery"
+
+	// HeaderSignature carries the hex-encoded HMAC-SHA256 of the
+	// request body, keyed with the webhook secret and prefixed by
+	// "sha256=".
+	HeaderSignature = "X-Mailbox-Signature-256"
+)
+
+// ErrWebhookUnknown is returned when redelivering to an endpoint that
+// is no longer configured.
+var ErrWebhookUnknown = errors.New("webhook endpoint is no longer configured")
+
+// Webhook defines an endpoint that receives events as JSON POST
+// requests.
+type Webhook struct {
+	URL    string
+	Secret string
+
+	// Events lists the event types sent to the endpoint. Every
+	// event but EventRejected is sent if it is empty.
+	Events []string
+
+	// Workflow includes the entries' assignee and history in the
+	// events sent to the endpoint. Notes are never sent.
+	Workflow bool
+}
+
+// wants reports whether the endpoint subscribed to the event type.
+// Rejected submissions are mostly spam, so they are only sent when
+// subscribed to explicitly.
+func (w Webhook) wants(eventType string) bool {
+	if len(w.Events) == 0 {
+		return eventType != EventRejected
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhooks sends events to webhook endpoints, recording every delivery
+// in a persistent log.
+type Webhooks struct {
+	hooks    []Webhook
+	log      data.Deliveries
+	attempts int
+	client   *http.Client
+}
+
+// NewWebhooks initializes a webhook notifier. Deliveries are marked as
+// failed once they were attempted the given number of times, which
+// should match the attempts of the outbox that retries them.
+func NewWebhooks(hooks []Webhook, log data.Deliveries, attempts int) *Webhooks {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Webhooks{
+		hooks:    hooks,
+		log:      log,
+		attempts: attempts,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// For returns a Notifier that sends events to the endpoint hook, one
+// of the configured endpoints. Each endpoint is meant to be its own
+// outbox target, so that a failing endpoint is retried without sending
+// events to the others again.
+func (w *Webhooks) For(hook Webhook) Notifier {
+	return &webhook{w: w, hook: hook}
+}
+
+// webhook is a Notifier that sends events to a single endpoint.
+type webhook struct {
+	w    *Webhooks
+	hook Webhook
+}
+
+// Wants reports whether the endpoint subscribed to the event.
+func (n *webhook) Wants(e Event) bool {
+	return n.hook.wants(e.Type)
+}
+
+// Notify makes a single attempt at sending the event to the endpoint,
+// if it subscribed to it. Attempts at the same event share a delivery,
+// so that receivers can recognize retries.
+func (n *webhook) Notify(ctx context.Context, e Event) error {
+	if !n.Wants(e) {
+		return nil
+	}
+	d, err := n.w.delivery(ctx, n.hook, e)
+	if err != nil {
+		return err
+	}
+	if d.Status == data.DeliverySucceeded {
+		return nil
+	}
+	err = n.w.attempt(ctx, n.hook, &d, d.Attempts+1 >= n.w.attempts)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %s", n.hook.URL, err)
+	}
+	return nil
+}
+
+// delivery returns the logged delivery of the event to the endpoint,
+// logging a new one if it was never attempted. The logged payload is
+// redacted, as the endpoint is outside of Mailbox.
+func (w *Webhooks) delivery(ctx context.Context, hook Webhook, e Event) (data.Delivery, error) {
+	id := deliveryID(hook.URL, e)
+	d, err := w.log.Read(ctx, id)
+	if err != data.ErrMongoNotFound {
+		return d, err
+	}
+	e.Entry = e.Entry.Redacted(hook.Workflow)
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return data.Delivery{}, err
+	}
+	d, err = data.NewDelivery(e.Type, e.Entry.ID, hook.URL, payload)
+	if err != nil {
+		return data.Delivery{}, err
+	}
+	d.ID = id
+	if err := w.log.Create(ctx, d); err == data.ErrMongoDuplicate {
+		return w.log.Read(ctx, id)
+	} else if err != nil {
+		return data.Delivery{}, err
+	}
+	return d, nil
+}
+
+// deliveryID derives the ID of the delivery of an event to url from
+// the event, so that retrying the event reuses the delivery.
+func deliveryID(url string, e Event) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{url, e.Type, e.Entry.ID,
+		e.Time.Format(time.RFC3339Nano)}, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Redeliver makes a single new attempt at the logged delivery with the
+// given ID and returns its updated record.
+func (w *Webhooks) Redeliver(ctx context.Context, id string) (data.Delivery, error) {
+	d, err := w.log.Read(ctx, id)
+	if err != nil {
+		return d, err
+	}
+	for _, hook := range w.hooks {
+		if hook.URL == d.URL {
+			err := w.attempt(ctx, hook, &d, true)
+			return d, err
+		}
+	}
+	return d, ErrWebhookUnknown
+}
+
+// attempt POSTs the delivery's payload to the endpoint and logs the
+// outcome.
+func (w *Webhooks) attempt(ctx context.Context, hook Webhook, d *data.Delivery, final bool) error {
+	code, err := w.post(ctx, hook, *d)
+	d.Attempted(code, err, final)
+	if logErr := w.log.Update(ctx, *d); logErr != nil {
+		return errors.Join(err, logErr)
+	}
+	return err
+}
+
+// post sends a single request and returns the response status code.
+func (w *Webhooks) post(ctx context.Context, hook Webhook, d data.Delivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mailbox-Webhook")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	if hook.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a webhook body. Receivers
+// should recompute it with their copy of the secret and compare the
+// two in constant time.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,308 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/zeim839/mailbox/data"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memDeliveries is an in-memory webhook delivery log.
+type memDeliveries struct {
+	mu         sync.Mutex
+	deliveries map[string]data.Delivery
+}
+
+func newMemDeliveries() *memDeliveries {
+	return &memDeliveries{deliveries: map[string]data.Delivery{}}
+}
+
+func (m *memDeliveries) Count(_ context.Context, status string) int64 {
+	all, _ := m.ReadAll(context.Background(), status, 0, 0)
+	return int64(len(all))
+}
+
+func (m *memDeliveries) ReadAll(_ context.Context, status string, _, _ int64) ([]data.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	all := []data.Delivery{}
+	for _, d := range m.deliveries {
+		if status == "" || d.Status == status {
+			all = append(all, d)
+		}
+	}
+	return all, nil
+}
+
+func (m *memDeliveries) Read(_ context.Context, id string) (data.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return data.Delivery{}, data.ErrMongoNotFound
+	}
+	return d, nil
+}
+
+func (m *memDeliveries) Create(_ context.Context, d data.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.ID]; ok {
+		return data.ErrMongoDuplicate
+	}
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+func (m *memDeliveries) Update(_ context.Context, d data.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return data.ErrMongoNotFound
+	}
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+// receiver is a webhook endpoint that records the requests it receives
+// and responds with status.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T) *receiver {
+	t.Helper()
+	r := &receiver{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestWebhookRedacted(t *testing.T) {
+	form := data.Form{ID: "abc", Subject: "Hello", Assignee: "alice",
+		Notes:   []data.Note{{Author: "alice", Body: "internal"}},
+		History: []data.Revision{data.NewRevision("assignee", "", "alice", "alice")}}
+	tests := []struct {
+		name     string
+		workflow bool
+	}{
+		{"default", false},
+		{"workflow", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver(t)
+			w := NewWebhooks(nil, newMemDeliveries(), 1)
+			hook := Webhook{URL: r.URL, Workflow: tt.workflow}
+			if err := w.For(hook).Notify(context.Background(),
+				NewEvent(EventUpdated, form, "alice")); err != nil {
+				t.Fatal(err)
+			}
+			var got Event
+			if err := json.Unmarshal(r.bodies[0], &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Entry.Notes) != 0 {
+				t.Error("notes were sent to the endpoint")
+			}
+			sent := got.Entry.Assignee != "" || len(got.Entry.History) != 0
+			if sent != tt.workflow {
+				t.Errorf("sent assignee and history = %v, want %v", sent, tt.workflow)
+			}
+			if got.Entry.Subject != "Hello" {
+				t.Errorf("Subject = %q, want Hello", got.Entry.Subject)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// The HMAC-SHA256 test vector from Wikipedia.
+	got := Sign("key", []byte("The quick brown fox jumps over the lazy dog"))
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookHeaders(t *testing.T) {
+	r := newReceiver(t)
+	w := NewWebhooks(nil, newMemDeliveries(), 1)
+	event := NewEvent(EventCreated, data.Form{ID: "abc"}, "")
+	if err := w.For(Webhook{URL: r.URL, Secret: "s3cret"}).Notify(context.Background(),
+		event); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.For(Webhook{URL: r.URL}).Notify(context.Background(),
+		NewEvent(EventDeleted, data.Form{ID: "abc"}, "")); err != nil {
+		t.Fatal(err)
+	}
+	signed, unsigned := r.requests[0].Header, r.requests[1].Header
+	if got, want := signed.Get(HeaderSignature), Sign("s3cret", r.bodies[0]); got != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got, want)
+	}
+	if got := unsigned.Get(HeaderSignature); got != "" {
+		t.Errorf("%s = %q without a secret, want none", HeaderSignature, got)
+	}
+	if got := signed.Get(HeaderEvent); got != EventCreated {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got, EventCreated)
+	}
+	if got, want := signed.Get(HeaderDelivery), deliveryID(r.URL, event); got != want {
+		t.Errorf("%s = %q, want %q", HeaderDelivery, got, want)
+	}
+}
+
+func TestDeliveryID(t *testing.T) {
+	event := NewEvent(EventCreated, data.Form{ID: "abc"}, "")
+	id := deliveryID("https://example.org/hook", event)
+	if deliveryID("https://example.org/hook", event) != id {
+		t.Error("deliveryID() is not deterministic")
+	}
+	other := event
+	other.Time = event.Time.Add(time.Nanosecond)
+	for name, differs := range map[string]string{
+		"url":   deliveryID("https://example.org/other", event),
+		"type":  deliveryID("https://example.org/hook", NewEvent(EventDeleted, event.Entry, "")),
+		"entry": deliveryID("https://example.org/hook", NewEvent(EventCreated, data.Form{ID: "def"}, "")),
+		"time":  deliveryID("https://example.org/hook", other),
+	} {
+		if differs == id {
+			t.Errorf("deliveries of events with a different %s share ID %s", name, id)
+		}
+	}
+}
+
+func TestWebhookLog(t *testing.T) {
+	r := newReceiver(t)
+	r.status = http.StatusInternalServerError
+	deliveries := newMemDeliveries()
+	n := NewWebhooks(nil, deliveries, 3).For(Webhook{URL: r.URL})
+	event := NewEvent(EventCreated, data.Form{ID: "abc"}, "")
+	ctx := context.Background()
+	id := deliveryID(r.URL, event)
+
+	// Failed attempts share a pending delivery, until the last.
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err := n.Notify(ctx, event); err == nil {
+			t.Fatalf("attempt %d succeeded against a failing endpoint", attempt)
+		}
+		d, err := deliveries.Read(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := data.DeliveryPending
+		if attempt == 3 {
+			want = data.DeliveryFailed
+		}
+		if d.Status != want || d.Attempts != attempt || d.StatusCode != http.StatusInternalServerError {
+			t.Errorf("after attempt %d: %s with %d attempts and code %d, want %s", attempt,
+				d.Status, d.Attempts, d.StatusCode, want)
+		}
+	}
+	if n := deliveries.Count(ctx, ""); n != 1 {
+		t.Errorf("logged %d deliveries, want 1", n)
+	}
+	for i, req := range r.requests {
+		if got := req.Header.Get(HeaderDelivery); got != id {
+			t.Errorf("attempt %d was delivery %q, want %q", i+1, got, id)
+		}
+	}
+
+	// Successful deliveries are not sent again.
+	r.status = http.StatusOK
+	event = NewEvent(EventDeleted, data.Form{ID: "abc"}, "")
+	for range 2 {
+		if err := n.Notify(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, _ := deliveries.Read(ctx, deliveryID(r.URL, event))
+	if d.Status != data.DeliverySucceeded || d.Error != "" {
+		t.Errorf("delivery is %s (%q), want %s", d.Status, d.Error, data.DeliverySucceeded)
+	}
+	if len(r.requests) != 4 {
+		t.Errorf("sent %d requests, want 4", len(r.requests))
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	r := newReceiver(t)
+	r.status = http.StatusBadGateway
+	deliveries := newMemDeliveries()
+	hook := Webhook{URL: r.URL, Secret: "s3cret"}
+	w := NewWebhooks([]Webhook{hook}, deliveries, 1)
+	event := NewEvent(EventCreated, data.Form{ID: "abc", Subject: "Hello"}, "")
+	ctx := context.Background()
+	if err := w.For(hook).Notify(ctx, event); err == nil {
+		t.Fatal("Notify() succeeded against a failing endpoint")
+	}
+	id := deliveryID(r.URL, event)
+
+	// Redelivery resends the logged payload, as the same delivery.
+	r.status = http.StatusOK
+	d, err := w.Redeliver(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != data.DeliverySucceeded || d.Attempts != 2 {
+		t.Errorf("redelivery is %s after %d attempts, want %s after 2", d.Status,
+			d.Attempts, data.DeliverySucceeded)
+	}
+	if len(r.bodies) != 2 || string(r.bodies[1]) != string(r.bodies[0]) {
+		t.Fatalf("redelivered %q, want the original payload %q", r.bodies[1], r.bodies[0])
+	}
+	if got := r.requests[1].Header.Get(HeaderDelivery); got != id {
+		t.Errorf("redelivered as %q, want %q", got, id)
+	}
+	if got := r.requests[1].Header.Get(HeaderSignature); got != Sign("s3cret", r.bodies[0]) {
+		t.Errorf("redelivery signature = %q", got)
+	}
+	if logged, _ := deliveries.Read(ctx, id); logged.Status != data.DeliverySucceeded {
+		t.Errorf("logged delivery is %s, want %s", logged.Status, data.DeliverySucceeded)
+	}
+
+	if _, err := w.Redeliver(ctx, "missing"); err != data.ErrMongoNotFound {
+		t.Errorf("Redeliver(missing) error = %v, want %v", err, data.ErrMongoNotFound)
+	}
+	removed := NewWebhooks(nil, deliveries, 1)
+	if _, err := removed.Redeliver(ctx, id); err != ErrWebhookUnknown {
+		t.Errorf("Redeliver() to a removed endpoint error = %v, want %v", err,
+			ErrWebhookUnknown)
+	}
+}
+
+func TestWebhookWants(t *testing.T) {
+	tests := []struct {
+		events []string
+		event  string
+		want   bool
+	}{
+		{nil, EventCreated, true},
+		{nil, EventRejected, false},
+		{[]string{EventRejected}, EventRejected, true},
+		{[]string{EventDeleted}, EventCreated, false},
+	}
+	for _, tt := range tests {
+		n := NewWebhooks(nil, newMemDeliveries(), 1).For(Webhook{Events: tt.events})
+		if got := n.(Selective).Wants(Event{Type: tt.event}); got != tt.want {
+			t.Errorf("Wants(%s) with events %v = %v, want %v", tt.event, tt.events,
+				got, tt.want)
+		}
+	}
+}
@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/zeim839/mailbox/config"
 	"github.com/zeim839/mailbox/core"
 	"github.com/zeim839/mailbox/data"
+	"github.com/zeim839/mailbox/imapd"
+	"github.com/zeim839/mailbox/inbound"
+	"github.com/zeim839/mailbox/notify"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -33,13 +39,76 @@ func main() {
 	defer mongoclient.Disconnect(context.TODO())
 	log.Print("MongoDB successfully connected...")
 
-	// Create database controller.
+	// Create database controllers.
 	coll := mongoclient.Database("MAILBOX").Collection("entries")
 	mongo, _ := data.NewMongo(coll)
+	usersColl := mongoclient.Database("MAILBOX").Collection("users")
+	users, _ := data.NewMongoUsers(usersColl)
+	tokensColl := mongoclient.Database("MAILBOX").Collection("tokens")
+	tokens, _ := data.NewMongoTokens(tokensColl)
+	deliveriesColl := mongoclient.Database("MAILBOX").Collection("deliveries")
+	deliveries, _ := data.NewMongoDeliveries(deliveriesColl)
+	uidsColl := mongoclient.Database("MAILBOX").Collection("uids")
+	uids, _ := data.NewMongoUIDs(uidsColl)
+	digestsColl := mongoclient.Database("MAILBOX").Collection("digests")
+	digests, _ := data.NewMongoDigests(digestsColl)
+	jobsColl := mongoclient.Database("MAILBOX").Collection("jobs")
+	jobs, err := data.NewMongoJobs(jobsColl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	announcementsColl := mongoclient.Database("MAILBOX").Collection("announcements")
+	announcements, err := data.NewMongoAnnouncements(announcementsColl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auditsColl := mongoclient.Database("MAILBOX").Collection("audit")
+	audits, _ := data.NewMongoAudits(auditsColl)
+
+	// Record audited actions in the audit log, mirrored to a file as
+	// JSON lines if configured.
+	var mirror io.Writer
+	if config.AuditFile != "" {
+		file, err := os.OpenFile(config.AuditFile,
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		mirror = file
+		log.Printf("Audit log mirrored to %s", config.AuditFile)
+	}
+	core.SetAuditor(core.NewAuditor(audits, mirror))
+
+	// Seed the user store with the configured credentials.
+	if config.Username != "" && config.Password != "" &&
+		users.Count(context.TODO()) == 0 {
+		user, err := data.NewUser(config.Username, config.Password,
+			data.RoleAdmin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := users.Create(context.TODO(), user); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Created user %q from configuration", user.Username)
+	}
+
+	// Load the workflow that entries move through as they are handled.
+	workflow, err := config.Workflow()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if workflow.SLA > 0 {
+		log.Printf("Entries open for longer than %s are overdue", workflow.SLA)
+	}
 
 	// Set up Gin.
 	gin.SetMode(config.GinMode)
 	r := gin.Default()
+	if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatal(err)
+	}
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"POST, PUT, GET, DELETE"},
@@ -49,32 +118,428 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Set up notifications. Events are delivered to notifiers through
+	// a persistent outbox, so that none are lost while a target is
+	// down.
+	queue := notify.NewQueue(jobs, config.OutboxTries)
+	targets := []string{}
+	register := func(name string, n notify.Notifier) {
+		queue.Register(name, n)
+		targets = append(targets, name)
+	}
+	var mailer *notify.Mailer
+	if config.SMTPHost != "" {
+		mailer = &notify.Mailer{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.SMTPFrom,
+			Security: config.SMTPSecurity,
+		}
+	}
+	// Mailboxes with a digest are not notified of each entry.
+	recipients := config.NotifyRecipients()
+	for mailbox := range config.DigestSchedules() {
+		recipients[mailbox] = nil
+	}
+	if mailer != nil && len(config.NotifyRecipients()) > 0 {
+		subject, body := config.NotifySubject, config.NotifyBody
+		if subject == "" {
+			subject = notify.DefaultSubject
+		}
+		if body == "" {
+			body = notify.DefaultBody
+		}
+		smtp, err := notify.NewSMTPNotifier(mailer, recipients,
+			subject, body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		register("email", smtp)
+		log.Print("SMTP notifications successfully configured")
+	}
+	if len(config.DigestSchedules()) > 0 {
+		if mailer == nil {
+			log.Fatal("DIGESTS requires SMTP_HOST")
+		}
+		at, weekday, err := config.DigestSchedule()
+		if err != nil {
+			log.Fatal(err)
+		}
+		subject, body := config.DigestSubject, config.DigestBody
+		if subject == "" {
+			subject = notify.DefaultDigestSubject
+		}
+		if body == "" {
+			body = notify.DefaultDigestBody
+		}
+		digester, err := notify.NewDigester(mailer, mongo, digests,
+			config.DigestSchedules(), config.NotifyRecipients(), at, weekday,
+			subject, body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go digester.Run(context.Background())
+		register("digest", digester)
+		log.Print("Digests successfully configured")
+	}
+	var webhooks *notify.Webhooks
+	if urls, events := config.Webhooks(); len(urls) > 0 {
+		hooks := []notify.Webhook{}
+		for _, url := range urls {
+			hooks = append(hooks, notify.Webhook{
+				URL:      url,
+				Secret:   config.WebhookSecret,
+				Events:   events,
+				Workflow: config.WebhookFlow,
+			})
+		}
+		webhooks = notify.NewWebhooks(hooks, deliveries, config.OutboxTries)
+		for _, hook := range hooks {
+			register("webhook:"+hook.URL, webhooks.For(hook))
+		}
+		log.Printf("Webhooks successfully configured (%d endpoints)", len(hooks))
+	}
+	chats := map[string]notify.ChatSender{}
+	if config.SlackURL != "" {
+		chats["slack"] = notify.NewSlackChat(config.SlackURL)
+	}
+	if config.MattermostURL != "" {
+		chats["mattermost"] = notify.NewSlackChat(config.MattermostURL)
+	}
+	if config.DiscordURL != "" {
+		chats["discord"] = notify.NewDiscordChat(config.DiscordURL)
+	}
+	if config.MatrixServer != "" {
+		chats["matrix"] = notify.NewMatrixChat(config.MatrixServer,
+			config.MatrixToken, config.MatrixRoom)
+	}
+	for name, sender := range chats {
+		mailboxes, ok := config.ChatMailboxes(name)
+		if !ok {
+			log.Printf("Chat %s is configured but announces no mailboxes", name)
+			continue
+		}
+		chat := notify.NewChatNotifier(name, sender, announcements,
+			mailboxes, config.ChatInterval)
+		go chat.Run(context.Background())
+		register(name, chat)
+		log.Printf("Chat %s successfully configured", name)
+	}
+	notifiers := queue.For(targets...)
+
+	// Stream changes to entries from MongoDB where change streams are
+	// supported (i.e. on replica sets), and from the events of this
+	// process otherwise.
+	changes, _ := data.NewMongoChanges(coll)
+	probe, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if _, err := changes.Subscribe(probe, ""); err != nil {
+		broadcaster := notify.NewBroadcaster()
+		changes = broadcaster
+		notifiers = notify.Multi{notifiers, broadcaster}
+		log.Print("Change streams unavailable, broadcasting events in-process")
+	}
+	cancel()
+
+	// Replies are addressed to per-entry thread addresses, so that
+	// answers can be filed into the right conversation.
+	var threads *inbound.ThreadAddress
+	if config.ReplyAddress != "" {
+		if config.ReplySecret == "" {
+			log.Fatal("REPLY_ADDRESS requires REPLY_SECRET")
+		}
+		threads, err = inbound.NewThreadAddress(config.ReplyAddress,
+			config.ReplySecret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Print("Conversation threads successfully configured")
+	}
+
+	// Acknowledgements are only sent for submissions that passed a
+	// captcha, lest the form be abused to send mail to anyone.
+	submitted := notifiers
+	if config.AckEnabled {
+		if mailer == nil || config.CaptchaSecret == "" {
+			log.Fatal("acknowledgements require SMTP_HOST and CAPTCHA_SECRET")
+		}
+		acksColl := mongoclient.Database("MAILBOX").Collection("acks")
+		acks, err := data.NewMongoAcks(acksColl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ack, err := notify.NewAcknowledger(mailer, acks, config.AckTemplates,
+			config.AckMailboxList(), config.AckInterval, config.AckMaxHourly)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queue.Register("ack", ack)
+		submitted = queue.For(append(append([]string{}, targets...), "ack")...)
+		if broadcaster, ok := changes.(*notify.Broadcaster); ok {
+			submitted = notify.Multi{submitted, broadcaster}
+		}
+		log.Print("Acknowledgements successfully configured")
+	}
+	queue.Run(context.Background(), config.OutboxWorkers)
+
+	// Receive email through the embedded SMTP listener.
+	if config.InboundAddr != "" {
+		server := &inbound.Server{
+			Addr:    config.InboundAddr,
+			Domain:  config.InboundDomain,
+			MaxSize: config.InboundSize,
+			Accept:  core.AcceptMail(threads, config.InboundRecipients()),
+			Handler: core.ReceiveMail(mongo, threads,
+				config.InboundRecipients(), notifiers),
+		}
+		if config.InboundCert != "" {
+			cert, err := tls.LoadX509KeyPair(config.InboundCert,
+				config.InboundKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+		go func() {
+			log.Fatal(server.ListenAndServe())
+		}()
+		log.Printf("SMTP listener successfully started on %s", config.InboundAddr)
+	}
+
+	// Serve entries to mail clients over IMAP.
+	if config.IMAPAddr != "" {
+		server := imapd.NewServer(imapd.NewBackend(mongo, users, uids,
+			config.IMAPDomain, notifiers), config.IMAPAddr)
+		server.AllowInsecureAuth = config.IMAPInsecure
+		if config.IMAPCert != "" {
+			cert, err := tls.LoadX509KeyPair(config.IMAPCert, config.IMAPKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		} else if !config.IMAPInsecure {
+			log.Print("IMAP_TLS_CERT not configured, IMAP logins are disabled")
+		}
+		go func() {
+			log.Fatal(server.ListenAndServe())
+		}()
+		log.Printf("IMAP server successfully started on %s", config.IMAPAddr)
+	}
+
+	// Every route is described once: it is served under /api/v1,
+	// documented in the OpenAPI document and, if it predates the
+	// versioned API, served at its legacy path as a deprecated alias.
+	submit := core.Route{Method: "POST", Path: "/submissions",
+		Legacy: "/mailbox/submit", Public: true,
+		Summary: "Submit a contact form", Request: data.Form{},
+		Handler: core.Create(mongo, submitted)}
 	if config.CaptchaSecret != "" {
 		log.Print("Captcha successfully configured")
-		r.POST("/mailbox/submit", core.CreateWithCaptcha(mongo, config.CaptchaSecret))
+		submit.Request = data.FormWithCaptcha{}
+		submit.Handler = core.CreateWithCaptcha(mongo, config.CaptchaSecret,
+			submitted)
 	} else {
 		log.Print("Captcha not configured")
-		r.POST("/mailbox/submit", core.Create(mongo))
 	}
+	routes := []core.Route{submit, {Method: "POST", Path: "/login",
+		Legacy: "/mailbox/login", Public: true,
+		Summary:  "Exchange credentials for a session token",
+		Request:  gin.H{"username": "", "password": "", "code": ""},
+		Response: gin.H{"token": "", "expires": time.Time{}},
+		Handler:  core.Login(users, tokens, config.SessionTTL)}}
 
-	if config.Username != "" && config.Password != "" {
-		log.Print("Basic auth successfully configured")
-		r.GET("/mailbox/entry/:id", core.BasicAuthMw(config.Username,
-			config.Password), core.Read(mongo))
-		r.DELETE("/mailbox/entry/:id", core.BasicAuthMw(config.Username,
-			config.Password), core.Delete(mongo))
-		r.GET("/mailbox/entries/", core.BasicAuthMw(config.Username,
-			config.Password), core.ReadAll(mongo))
-	} else {
-		log.Print("Basic auth not configured")
-		r.GET("/mailbox/entry/:id", core.Read(mongo))
-		r.DELETE("/mailbox/entry/:id", core.Delete(mongo))
-		r.GET("/mailbox/entries/", core.ReadAll(mongo))
+	var verifier *core.OIDCVerifier
+	if config.OIDCIssuer != "" {
+		log.Print("OpenID Connect successfully configured")
+		verifier = core.NewOIDCVerifier(config.OIDCIssuer, config.OIDCAudience,
+			config.OIDCGroups, config.OIDCRoleMap())
+		routes = append(routes, core.Route{Method: "GET", Path: "/oidc",
+			Legacy: "/mailbox/oidc", Public: true,
+			Summary:  "Describe the OpenID Connect provider",
+			Response: gin.H{"issuer": "", "client_id": ""},
+			Handler:  core.OIDCConfig(config.OIDCIssuer, config.OIDCClientID)})
+	}
+
+	// Every non-public route requires authentication, so that a
+	// fresh deployment does not expose its admin routes. Without an
+	// account or an identity provider, nobody could log in.
+	if users.Count(context.TODO()) == 0 && verifier == nil {
+		log.Fatal("No user accounts: set USERNAME and PASSWORD to create an admin, or configure OIDC_ISSUER")
 	}
+	auth := core.AuthMw(users, tokens, verifier)
+	log.Print("Authentication successfully configured")
 
-	r.GET("/status", func(c *gin.Context) {
-		c.String(http.StatusOK, "ok")
-	})
+	// Route permissions. Viewers may read, responders may also
+	// change statuses and reply, and admins may do everything.
+	routes = append(routes, []core.Route{
+		{Method: "GET", Path: "/whoami", Legacy: "/mailbox/whoami",
+			Summary:  "Describe the authenticated caller",
+			Response: gin.H{"username": "", "scopes": []string{}, "mailbox": ""},
+			Handler:  core.WhoAmI()},
+		{Method: "POST", Path: "/logout", Legacy: "/mailbox/logout",
+			Summary: "Revoke the session token",
+			Handler: core.Logout(tokens)},
+		{Method: "GET", Path: "/entries", Legacy: "/mailbox/entries/",
+			Scope: data.ScopeRead, Summary: "List entries, most recent first",
+			Query: gin.H{"page": 0, "mailbox": "", "status": "", "tag": "",
+				"assignee": "", "state": "", "overdue": false},
+			Response: gin.H{"page": 0, "page_count": 0, "entry_count": 0,
+				"entries": []data.Form{}},
+			Handler: core.ReadAll(mongo, workflow)},
+		{Method: "GET", Path: "/entries/:id", Legacy: "/mailbox/entry/:id",
+			Scope: data.ScopeRead, Summary: "Fetch an entry",
+			Response: data.Form{}, Handler: core.Read(mongo, workflow)},
+		{Method: "PUT", Path: "/entries/:id/status", Legacy: "/mailbox/entry/:id/status",
+			Scope: data.ScopeStatus, Summary: "Mark an entry as read or unread",
+			Request: gin.H{"status": ""},
+			Handler: core.UpdateStatus(mongo, notifiers)},
+		{Method: "GET", Path: "/entries/:id/thread", Legacy: "/mailbox/entry/:id/thread",
+			Scope: data.ScopeRead, Summary: "Fetch an entry's conversation",
+			Response: gin.H{"entry_id": "", "message_count": 0,
+				"messages": []data.Reply{}},
+			Handler: core.ReadThread(mongo)},
+		{Method: "POST", Path: "/entries/:id/replies", Legacy: "/mailbox/entry/:id/reply",
+			Scope: data.ScopeReply, Summary: "Reply to an entry by email",
+			Request: gin.H{"subject": "", "body": ""},
+			Handler: core.Reply(mongo, mailer, threads, notifiers)},
+		{Method: "DELETE", Path: "/entries/:id", Legacy: "/mailbox/entry/:id",
+			Scope: data.ScopeDelete, Summary: "Delete an entry",
+			Handler: core.Delete(mongo, notifiers)},
+		{Method: "POST", Path: "/entries/:id/tags",
+			Scope: data.ScopeStatus, Summary: "Add tags to an entry",
+			Request: gin.H{"tags": []string{}}, Response: gin.H{"tags": []string{}},
+			Handler: core.AddTags(mongo, notifiers)},
+		{Method: "DELETE", Path: "/entries/:id/tags/:tag",
+			Scope: data.ScopeStatus, Summary: "Remove a tag from an entry",
+			Response: gin.H{"tags": []string{}},
+			Handler:  core.RemoveTag(mongo, notifiers)},
+		{Method: "PUT", Path: "/entries/:id/state",
+			Scope: data.ScopeStatus, Summary: "Move an entry to another workflow state",
+			Request: gin.H{"state": ""}, Response: data.Form{},
+			Handler: core.UpdateState(mongo, workflow, notifiers)},
+		{Method: "GET", Path: "/workflow",
+			Scope: data.ScopeRead, Summary: "Describe the workflow states and SLA",
+			Response: gin.H{"states": []string{}, "initial": "",
+				"transitions": map[string][]string{}, "closed": []string{}, "sla": 0},
+			Handler: core.ReadWorkflow(workflow)},
+		{Method: "PUT", Path: "/entries/:id/assignee",
+			Scope: data.ScopeStatus, Summary: "Assign an entry to a user",
+			Request: gin.H{"assignee": ""}, Response: gin.H{"assignee": ""},
+			Handler: core.Assign(mongo, users, notifiers)},
+		{Method: "POST", Path: "/entries/:id/notes",
+			Scope: data.ScopeStatus, Summary: "Add an internal note to an entry",
+			Request: gin.H{"body": ""}, Response: data.Note{},
+			Handler: core.AddNote(mongo, notifiers)},
+		{Method: "GET", Path: "/tags",
+			Scope: data.ScopeRead, Summary: "List the tags in use",
+			Query: gin.H{"mailbox": "", "status": ""}, Response: gin.H{"tags": []string{}},
+			Handler: core.ReadTags(mongo, workflow)},
+		{Method: "POST", Path: "/entries/bulk/delete",
+			Scope: data.ScopeDelete, Summary: "Delete entries by ID or filter",
+			Request: core.BulkRequest{}, Response: core.BulkResponse{},
+			Handler: core.BulkDelete(mongo, workflow, notifiers)},
+		{Method: "POST", Path: "/entries/bulk/status",
+			Scope: data.ScopeStatus, Summary: "Mark entries as read or unread by ID or filter",
+			Request: core.BulkRequest{}, Response: core.BulkResponse{},
+			Handler: core.BulkStatus(mongo, workflow, notifiers)},
+		{Method: "POST", Path: "/entries/bulk/tags",
+			Scope: data.ScopeStatus, Summary: "Add and remove tags of entries by ID or filter",
+			Request: core.BulkRequest{}, Response: core.BulkResponse{},
+			Handler: core.BulkTag(mongo, workflow, notifiers)},
+		{Method: "POST", Path: "/entries/bulk/move",
+			Scope: data.ScopeStatus, Summary: "Move entries to another mailbox by ID or filter",
+			Request: core.BulkRequest{}, Response: core.BulkResponse{},
+			Handler: core.BulkMove(mongo, workflow, notifiers)},
+		{Method: "POST", Path: "/inbound", Legacy: "/mailbox/inbound",
+			Scope: data.ScopeAdmin, Summary: "File a raw email into a conversation",
+			Response: gin.H{"entry_id": ""},
+			Handler:  core.Inbound(mongo, threads, notifiers)},
+		{Method: "GET", Path: "/events", Legacy: "/mailbox/events",
+			Scope: data.ScopeRead, Summary: "Stream changes to entries",
+			Query: gin.H{"last_event_id": ""}, Response: data.Change{}, Stream: true,
+			Handler: core.Events(changes)},
+		{Method: "GET", Path: "/users", Legacy: "/mailbox/users/",
+			Scope: data.ScopeAdmin, Summary: "List users",
+			Response: gin.H{"user_count": 0, "users": []data.User{}},
+			Handler:  core.ReadAllUsers(users)},
+		{Method: "POST", Path: "/users", Legacy: "/mailbox/users/",
+			Scope: data.ScopeAdmin, Summary: "Create a user",
+			Request: gin.H{"username": "", "password": "", "role": ""},
+			Handler: core.CreateUser(users)},
+		{Method: "PUT", Path: "/users/:username/password", Legacy: "/mailbox/user/:username/password",
+			Summary: "Change a user's password",
+			Request: gin.H{"password": ""},
+			Handler: core.UpdatePassword(users)},
+		{Method: "PUT", Path: "/users/:username/role", Legacy: "/mailbox/user/:username/role",
+			Scope: data.ScopeAdmin, Summary: "Change a user's role",
+			Request: gin.H{"role": ""}, Handler: core.UpdateRole(users)},
+		{Method: "DELETE", Path: "/users/:username", Legacy: "/mailbox/user/:username",
+			Scope: data.ScopeAdmin, Summary: "Delete a user",
+			Handler: core.DeleteUser(users)},
+		{Method: "POST", Path: "/users/:username/totp", Legacy: "/mailbox/user/:username/totp",
+			Summary:  "Start enrolling in two-factor authentication",
+			Response: gin.H{"secret": "", "url": ""},
+			Handler:  core.EnrollTOTP(users)},
+		{Method: "POST", Path: "/users/:username/totp/verify", Legacy: "/mailbox/user/:username/totp/verify",
+			Summary:  "Enable two-factor authentication",
+			Request:  gin.H{"code": ""},
+			Response: gin.H{"recovery_codes": []string{}},
+			Handler:  core.EnableTOTP(users)},
+		{Method: "DELETE", Path: "/users/:username/totp", Legacy: "/mailbox/user/:username/totp",
+			Summary: "Disable two-factor authentication",
+			Handler: core.DisableTOTP(users)},
+		{Method: "GET", Path: "/audit",
+			Scope: data.ScopeAdmin, Summary: "List audit records, most recent first",
+			Query: gin.H{"page": 0, "user": "", "action": "", "entry_id": "",
+				"after": "", "before": ""},
+			Response: gin.H{"page": 0, "page_count": 0, "record_count": 0,
+				"records": []data.AuditRecord{}},
+			Handler: core.ReadAudit(audits)},
+		{Method: "GET", Path: "/tokens", Legacy: "/mailbox/tokens/",
+			Scope: data.ScopeAdmin, Summary: "List API tokens",
+			Response: gin.H{"token_count": 0, "tokens": []data.Token{}},
+			Handler:  core.ReadAllTokens(tokens)},
+		{Method: "POST", Path: "/tokens", Legacy: "/mailbox/tokens/",
+			Scope: data.ScopeAdmin, Summary: "Create an API token",
+			Request: gin.H{"name": "", "scopes": []string{}, "mailbox": "",
+				"expires_in": ""},
+			Response: gin.H{"token": "", "detail": data.Token{}},
+			Handler:  core.CreateToken(tokens)},
+		{Method: "DELETE", Path: "/tokens/:id", Legacy: "/mailbox/token/:id",
+			Scope: data.ScopeAdmin, Summary: "Revoke an API token",
+			Handler: core.DeleteToken(tokens)},
+		{Method: "GET", Path: "/webhooks/deliveries", Legacy: "/mailbox/webhooks/deliveries/",
+			Scope: data.ScopeAdmin, Summary: "List webhook deliveries, most recent first",
+			Query: gin.H{"page": 0, "status": ""},
+			Response: gin.H{"page": 0, "page_count": 0, "delivery_count": 0,
+				"deliveries": []data.Delivery{}},
+			Handler: core.ReadAllDeliveries(deliveries)},
+		{Method: "GET", Path: "/webhooks/deliveries/:id", Legacy: "/mailbox/webhooks/delivery/:id",
+			Scope: data.ScopeAdmin, Summary: "Fetch a webhook delivery",
+			Response: data.Delivery{}, Handler: core.ReadDelivery(deliveries)},
+		{Method: "POST", Path: "/webhooks/deliveries/:id/redeliver", Legacy: "/mailbox/webhooks/delivery/:id/redeliver",
+			Scope: data.ScopeAdmin, Summary: "Resend a webhook delivery",
+			Response: data.Delivery{}, Handler: core.Redeliver(webhooks)},
+		{Method: "GET", Path: "/jobs", Legacy: "/mailbox/jobs/",
+			Scope: data.ScopeAdmin, Summary: "List outbox jobs, most recent first",
+			Query: gin.H{"page": 0, "status": ""},
+			Response: gin.H{"page": 0, "page_count": 0, "job_count": 0,
+				"jobs": []data.Job{}},
+			Handler: core.ReadAllJobs(jobs)},
+		{Method: "GET", Path: "/jobs/:id", Legacy: "/mailbox/job/:id",
+			Scope: data.ScopeAdmin, Summary: "Fetch an outbox job",
+			Response: data.Job{}, Handler: core.ReadJob(jobs)},
+		{Method: "POST", Path: "/jobs/:id/retry", Legacy: "/mailbox/job/:id/retry",
+			Scope: data.ScopeAdmin, Summary: "Requeue a dead outbox job",
+			Response: data.Job{}, Handler: core.RetryJob(queue)},
+		{Method: "GET", Path: "/status", Legacy: "/status", Public: true,
+			Summary: "Report that the server is up", Response: "",
+			Handler: func(c *gin.Context) {
+				c.String(http.StatusOK, "ok")
+			}},
+	}...)
+	core.Mount(r, routes, auth)
 
 	r.Run("0.0.0.0:" + config.Port)
 }